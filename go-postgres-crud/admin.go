@@ -0,0 +1,327 @@
+package main
+
+import (
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// adminDB is a dedicated single-connection pool for operational endpoints, so
+// they stay reachable even when the main pool is exhausted.
+var adminDB *sql.DB
+
+const maxQueryTextLength = 100
+
+type dbConnection struct {
+    PID        int        `json:"pid"`
+    State      string     `json:"state"`
+    QueryStart *time.Time `json:"query_start"`
+    Query      string     `json:"query"`
+}
+
+func getConnections(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "getConnections", tracer.ResourceName("SELECT pid, state, query_start, query FROM pg_stat_activity"))
+    defer span.Finish()
+
+    sqlStatement := `SELECT pid, state, query_start, query FROM pg_stat_activity WHERE datname = $1 ORDER BY query_start`
+    rows, err := adminDB.QueryContext(ctx, sqlStatement, dbname)
+    if err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+    defer rows.Close()
+
+    connections := []dbConnection{}
+    for rows.Next() {
+        var conn dbConnection
+        var state, query sql.NullString
+        var queryStart sql.NullTime
+        err := rows.Scan(&conn.PID, &state, &queryStart, &query)
+        if err != nil {
+            writeInternalError(w, r, err)
+            return
+        }
+        conn.State = state.String
+        conn.Query = truncateQuery(query.String)
+        if queryStart.Valid {
+            conn.QueryStart = &queryStart.Time
+        }
+        connections = append(connections, conn)
+    }
+    if err := rows.Err(); err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "connections": connections,
+        "pool":        db.Stats(),
+    })
+}
+
+// dbPoolStats is sql.DBStats of the main pool, with durations in
+// milliseconds.
+type dbPoolStats struct {
+    Time               time.Time `json:"time"`
+    MaxOpenConnections int       `json:"max_open_connections"`
+    OpenConnections    int       `json:"open_connections"`
+    InUse              int       `json:"in_use"`
+    Idle               int       `json:"idle"`
+    WaitCount          int64     `json:"wait_count"`
+    WaitDurationMS     int64     `json:"wait_duration_ms"`
+    MaxIdleClosed      int64     `json:"max_idle_closed"`
+    MaxIdleTimeClosed  int64     `json:"max_idle_time_closed"`
+    MaxLifetimeClosed  int64     `json:"max_lifetime_closed"`
+}
+
+// getDBStats reports the main pool's statistics. It reads them from memory
+// without a span or a connection, so it answers at once even when the pool is
+// exhausted.
+func getDBStats(w http.ResponseWriter, r *http.Request) {
+    stats := db.Stats()
+    writeJSON(w, http.StatusOK, dbPoolStats{
+        Time:               time.Now().UTC(),
+        MaxOpenConnections: stats.MaxOpenConnections,
+        OpenConnections:    stats.OpenConnections,
+        InUse:              stats.InUse,
+        Idle:               stats.Idle,
+        WaitCount:          stats.WaitCount,
+        WaitDurationMS:     stats.WaitDuration.Milliseconds(),
+        MaxIdleClosed:      stats.MaxIdleClosed,
+        MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+        MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+    })
+}
+
+// cancelConnection cancels the current query of a backend, or terminates the
+// backend entirely with ?force=true. Only backends connected to this
+// application's database can be targeted.
+func cancelConnection(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "cancelConnection", tracer.ResourceName("SELECT pg_cancel_backend($1)"))
+    defer span.Finish()
+
+    pid, err := strconv.Atoi(r.PathValue("pid"))
+    if err != nil || pid <= 0 {
+        writeError(w, http.StatusBadRequest, "INVALID_PID", "Invalid pid")
+        return
+    }
+    force := r.URL.Query().Get("force") == "true"
+
+    var datname sql.NullString
+    var own bool
+    err = adminDB.QueryRowContext(ctx, `SELECT datname, pid = pg_backend_pid() FROM pg_stat_activity WHERE pid = $1`, pid).Scan(&datname, &own)
+    if err != nil && err != sql.ErrNoRows {
+        writeInternalError(w, r, err)
+        return
+    }
+
+    reason := ""
+    switch {
+    case err == sql.ErrNoRows || datname.String != dbname:
+        reason = "pid not found"
+    case own:
+        reason = "pid belongs to this admin connection"
+    }
+    if reason != "" {
+        writeJSON(w, http.StatusOK, map[string]interface{}{"cancelled": false, "reason": reason})
+        return
+    }
+
+    sqlStatement := `SELECT pg_cancel_backend($1)`
+    if force {
+        sqlStatement = `SELECT pg_terminate_backend($1)`
+    }
+    var cancelled bool
+    err = adminDB.QueryRowContext(ctx, sqlStatement, pid).Scan(&cancelled)
+    if err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+    requestLogger(ctx).Info("admin cancelled backend", "pid", pid, "force", force, "cancelled", cancelled)
+
+    response := map[string]interface{}{"cancelled": cancelled}
+    if !cancelled {
+        response["reason"] = "pid not found"
+    }
+    writeJSON(w, http.StatusOK, response)
+}
+
+// truncateQuery keeps only the first maxQueryTextLength characters of the SQL
+// text so literal values further into a statement are not exposed.
+func truncateQuery(query string) string {
+    runes := []rune(query)
+    if len(runes) <= maxQueryTextLength {
+        return query
+    }
+    return string(runes[:maxQueryTextLength]) + "..."
+}
+
+type analyzeQueryRequest struct {
+    Handler string                 `json:"handler"`
+    Params  map[string]interface{} `json:"params"`
+}
+
+// queryBuilders reproduce the SQL each handler would run for the given
+// parameters, as the default tenant. Only handlers listed here can be
+// analyzed.
+var queryBuilders = map[string]func(params map[string]interface{}) (string, []interface{}, error){
+    "getItems": func(params map[string]interface{}) (string, []interface{}, error) {
+        err := allowParams(params, "q", "name", "name_contains", "min_price", "max_price", "sort", "limit", "offset", "page", "per_page")
+        if err != nil {
+            return "", nil, err
+        }
+        filters := ItemFilters{TenantID: defaultTenantID, FullText: fullTextSearchAvailable, Limit: defaultPageLimit}
+        q, _ := params["q"].(string)
+        filters.Q = strings.TrimSpace(q)
+        // name_contains is accepted as a more descriptive name for ?name=,
+        // which matches names containing the value.
+        _, hasName := params["name"]
+        _, hasNameContains := params["name_contains"]
+        if hasName && hasNameContains {
+            return "", nil, fmt.Errorf("params.name and params.name_contains cannot be combined")
+        }
+        name, _ := params["name"].(string)
+        if hasNameContains {
+            name, _ = params["name_contains"].(string)
+        }
+        filters.Name = strings.TrimSpace(name)
+        if value, ok := params["min_price"].(float64); ok {
+            filters.MinPrice = &value
+        }
+        if value, ok := params["max_price"].(float64); ok {
+            filters.MaxPrice = &value
+        }
+        sortKey, _ := params["sort"].(string)
+        if _, ok := itemSortOrders[sortKey]; !ok {
+            return "", nil, fmt.Errorf("params.sort must be one of %s", strings.Join(sortKeys(), ", "))
+        }
+        filters.Sort = sortKey
+        if err := analyzedPage(params, &filters); err != nil {
+            return "", nil, err
+        }
+        sqlStatement, args := buildItemsQuery(filters)
+        return sqlStatement, args, nil
+    },
+    "getItem": func(params map[string]interface{}) (string, []interface{}, error) {
+        if err := allowParams(params, "id"); err != nil {
+            return "", nil, err
+        }
+        id, ok := params["id"].(float64)
+        if !ok || id <= 0 || id != float64(int(id)) {
+            return "", nil, fmt.Errorf("params.id must be a positive integer")
+        }
+        return `SELECT id, name, description, price FROM items WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL`, []interface{}{int(id), defaultTenantID}, nil
+    },
+}
+
+// analyzedPage sets the page of filters from params: limit and offset as
+// GET /items takes them, or page and per_page, counting pages from 1.
+func analyzedPage(params map[string]interface{}, filters *ItemFilters) error {
+    _, hasPage := params["page"]
+    _, hasPerPage := params["per_page"]
+    if hasPage || hasPerPage {
+        if _, ok := params["limit"]; ok {
+            return fmt.Errorf("params.limit and params.offset cannot be combined with params.page and params.per_page")
+        }
+        if _, ok := params["offset"]; ok {
+            return fmt.Errorf("params.limit and params.offset cannot be combined with params.page and params.per_page")
+        }
+        page, perPage := 1.0, float64(defaultPageLimit)
+        if hasPage {
+            page, _ = params["page"].(float64)
+        }
+        if hasPerPage {
+            perPage, _ = params["per_page"].(float64)
+        }
+        if page < 1 || page != float64(int(page)) {
+            return fmt.Errorf("params.page must be a positive integer")
+        }
+        if perPage < 1 || perPage > maxPageLimit || perPage != float64(int(perPage)) {
+            return fmt.Errorf("params.per_page must be an integer between 1 and %d", maxPageLimit)
+        }
+        filters.Limit = int(perPage)
+        filters.Offset = (int(page) - 1) * int(perPage)
+        return nil
+    }
+    if value, ok := params["limit"].(float64); ok && value > 0 && value <= maxPageLimit {
+        filters.Limit = int(value)
+    }
+    if value, ok := params["offset"].(float64); ok && value >= 0 {
+        filters.Offset = int(value)
+    }
+    return nil
+}
+
+func allowParams(params map[string]interface{}, allowed ...string) error {
+    for name := range params {
+        known := false
+        for _, a := range allowed {
+            if name == a {
+                known = true
+            }
+        }
+        if !known {
+            return fmt.Errorf("unknown parameter %q", name)
+        }
+    }
+    return nil
+}
+
+func analyzeQuery(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    span, ctx := tracer.StartSpanFromContext(ctx, "analyzeQuery")
+    defer span.Finish()
+
+    var req analyzeQueryRequest
+    err := json.NewDecoder(r.Body).Decode(&req)
+    if err != nil {
+        writeBodyError(w, err, "Request body is not valid JSON")
+        return
+    }
+    build, ok := queryBuilders[req.Handler]
+    if !ok {
+        handlers := make([]string, 0, len(queryBuilders))
+        for name := range queryBuilders {
+            handlers = append(handlers, name)
+        }
+        sort.Strings(handlers)
+        writeError(w, http.StatusBadRequest, "UNKNOWN_HANDLER", "Unknown handler; expected one of: "+strings.Join(handlers, ", "))
+        return
+    }
+    sqlStatement, args, err := build(req.Params)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, "INVALID_PARAMS", err.Error())
+        return
+    }
+
+    // EXPLAIN ANALYZE executes the statement, so run it in a read-only
+    // transaction that is always rolled back.
+    tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+    if err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+    defer tx.Rollback()
+
+    var plan []byte
+    err = tx.QueryRowContext(ctx, "EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) "+sqlStatement, args...).Scan(&plan)
+    if err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "handler": req.Handler,
+        "sql":     sqlStatement,
+        "plan":    json.RawMessage(plan),
+    })
+}
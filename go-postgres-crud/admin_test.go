@@ -0,0 +1,69 @@
+package main
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestAnalyzeGetItemsQuery(t *testing.T) {
+    minPrice := 5.0
+    tests := []struct {
+        name   string
+        params map[string]interface{}
+        want   ItemFilters
+    }{
+        {
+            "name_contains with page and per_page",
+            map[string]interface{}{"name_contains": " widget ", "min_price": 5.0, "page": 3.0, "per_page": 10.0},
+            ItemFilters{Name: "widget", MinPrice: &minPrice, Limit: 10, Offset: 20},
+        },
+        {
+            "page defaults to the first",
+            map[string]interface{}{"per_page": 50.0},
+            ItemFilters{Limit: 50},
+        },
+        {
+            "name with limit and offset",
+            map[string]interface{}{"name": "widget", "limit": 5.0, "offset": 15.0},
+            ItemFilters{Name: "widget", Limit: 5, Offset: 15},
+        },
+        {
+            "no params",
+            nil,
+            ItemFilters{Limit: defaultPageLimit},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            sqlStatement, args, err := queryBuilders["getItems"](tt.params)
+            if err != nil {
+                t.Fatal(err)
+            }
+            tt.want.TenantID, tt.want.FullText = defaultTenantID, fullTextSearchAvailable
+            wantSQL, wantArgs := buildItemsQuery(tt.want)
+            if sqlStatement != wantSQL || !reflect.DeepEqual(args, wantArgs) {
+                t.Errorf("got %s %v\nwant %s %v", sqlStatement, args, wantSQL, wantArgs)
+            }
+        })
+    }
+}
+
+func TestAnalyzeGetItemsQueryRejectsParams(t *testing.T) {
+    tests := map[string]map[string]interface{}{
+        "unknown":              {"colour": "red"},
+        "name twice":           {"name": "a", "name_contains": "b"},
+        "page with limit":      {"page": 2.0, "limit": 10.0},
+        "per_page with offset": {"per_page": 10.0, "offset": 10.0},
+        "page zero":            {"page": 0.0},
+        "fractional page":      {"page": 1.5},
+        "per_page over limit":  {"per_page": float64(maxPageLimit + 1)},
+        "per_page not number":  {"per_page": "20"},
+    }
+    for name, params := range tests {
+        t.Run(name, func(t *testing.T) {
+            if _, _, err := queryBuilders["getItems"](params); err == nil {
+                t.Errorf("params %v were accepted", params)
+            }
+        })
+    }
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "log/slog"
+    "net/http"
+    "time"
+
+    "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// The buckets of items_price_histogram, as given to width_bucket in
+// migration 025.
+const (
+    priceHistogramMax     = 1000.0
+    priceHistogramBuckets = 20
+)
+
+// priceHistogramBucket is one row of items_price_histogram. Bucket 1 to 20
+// cover [0, 1000) in steps of 50; bucket 21 holds prices of 1000 and above.
+type priceHistogramBucket struct {
+    Bucket    int     `json:"bucket"`
+    Count     int     `json:"count"`
+    BucketMin float64 `json:"bucket_min"`
+    BucketMax float64 `json:"bucket_max"`
+}
+
+// getPriceHistogram serves the tenant's rows of the items_price_histogram
+// view. The view is refreshed nightly, so it lags behind writes made since;
+// GET /items/stats aggregates live data instead.
+func getPriceHistogram(w http.ResponseWriter, r *http.Request) error {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "getPriceHistogram", tracer.ResourceName("SELECT FROM items_price_histogram"))
+    defer span.Finish()
+
+    rows, err := queryRead(r, `SELECT bucket, count, bucket_min, bucket_max FROM items_price_histogram
+        WHERE tenant_id = $1 ORDER BY bucket`, tenantFromContext(ctx))
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+    buckets := []priceHistogramBucket{}
+    for rows.Next() {
+        var bucket priceHistogramBucket
+        if err := rows.Scan(&bucket.Bucket, &bucket.Count, &bucket.BucketMin, &bucket.BucketMax); err != nil {
+            return err
+        }
+        buckets = append(buckets, bucket)
+    }
+    if err := rows.Err(); err != nil {
+        return err
+    }
+
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "bucket_width": priceHistogramMax / priceHistogramBuckets,
+        "buckets":      buckets,
+    })
+    return nil
+}
+
+// startPriceHistogramRefresher refreshes items_price_histogram daily at hour
+// UTC. The returned stop function cancels the refresher and waits for it to
+// exit.
+func startPriceHistogramRefresher(db *sql.DB, hour int) (stop func()) {
+    ctx, cancel := context.WithCancel(context.Background())
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        for {
+            timer := time.NewTimer(time.Until(nextDailyRun(time.Now(), hour)))
+            select {
+            case <-ctx.Done():
+                timer.Stop()
+                return
+            case <-timer.C:
+                refreshPriceHistogram(ctx, db)
+            }
+        }
+    }()
+    return func() {
+        cancel()
+        <-done
+    }
+}
+
+// refreshPriceHistogram recomputes items_price_histogram. CONCURRENTLY keeps
+// the old rows readable while it runs.
+func refreshPriceHistogram(ctx context.Context, db *sql.DB) {
+    start := time.Now()
+    if _, err := db.ExecContext(ctx, `REFRESH MATERIALIZED VIEW CONCURRENTLY items_price_histogram`); err != nil {
+        if ctx.Err() == nil {
+            slog.Error("refreshing the price histogram failed", "error", err)
+        }
+        return
+    }
+    slog.Info("refreshed the price histogram", "duration", time.Since(start).String())
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+    "context"
+    "net/http"
+    "testing"
+
+    "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestGetPriceHistogram(t *testing.T) {
+    mock := mockDB(t)
+    rt := newTestRouter(NewApp(storedItems(), nil, NewFeatureFlags(nil), nil))
+    mock.ExpectQuery(`SELECT bucket, count, bucket_min, bucket_max FROM items_price_histogram\s+WHERE tenant_id = \$1 ORDER BY bucket`).
+        WithArgs(defaultTenantID).
+        WillReturnRows(sqlmock.NewRows([]string{"bucket", "count", "bucket_min", "bucket_max"}).
+            AddRow(1, 12, 0.99, 49.5).AddRow(21, 2, 1200, 4999))
+
+    rec := doRequest(t, rt, http.MethodGet, "/analytics/price-histogram", nil, "")
+    var got struct {
+        BucketWidth float64                `json:"bucket_width"`
+        Buckets     []priceHistogramBucket `json:"buckets"`
+    }
+    decodeBody(t, rec, &got)
+    if rec.Code != http.StatusOK || got.BucketWidth != 50 || len(got.Buckets) != 2 {
+        t.Fatalf("status %d, body %s; want two buckets 50 wide", rec.Code, rec.Body)
+    }
+    if got.Buckets[1] != (priceHistogramBucket{Bucket: 21, Count: 2, BucketMin: 1200, BucketMax: 4999}) {
+        t.Errorf("overflow bucket = %+v", got.Buckets[1])
+    }
+}
+
+func TestRefreshPriceHistogram(t *testing.T) {
+    mock := mockDB(t)
+    mock.ExpectExec(`REFRESH MATERIALIZED VIEW CONCURRENTLY items_price_histogram`).WillReturnResult(sqlmock.NewResult(0, 0))
+    refreshPriceHistogram(context.Background(), db)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+    "context"
+    "crypto/rand"
+    "database/sql"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/google/uuid"
+    "golang.org/x/crypto/bcrypt"
+    "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+// Authentication methods recorded in the request context.
+const (
+    authMethodJWT    = "jwt"
+    authMethodAPIKey = "api_key"
+)
+
+type authMethodKey struct{}
+
+// APIKey is a long-lived credential for machine clients. Keys have the form
+// <id>.<secret>: bcrypt hashes are salted and cannot be looked up by value,
+// so the id selects the row whose hash the secret is checked against. A key
+// acts for the tenant of the token that issued it.
+type APIKey struct {
+    ID          int        `json:"id"`
+    TenantID    uuid.UUID  `json:"tenant_id"`
+    Description string     `json:"description"`
+    CreatedAt   time.Time  `json:"created_at"`
+    ExpiresAt   *time.Time `json:"expires_at"`
+    // Key is only returned when the key is created.
+    Key string `json:"key,omitempty"`
+}
+
+// createAPIKey issues a key. The route runs requireAdminRole, so it needs an
+// admin's JWT: an API key cannot mint further keys.
+func createAPIKey(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "createAPIKey", tracer.ResourceName("INSERT INTO api_keys"))
+    defer span.Finish()
+
+    var key APIKey
+    err := json.NewDecoder(r.Body).Decode(&key)
+    if err != nil {
+        writeBodyError(w, err, "Request body is not valid JSON")
+        return
+    }
+    if key.ExpiresAt != nil && !key.ExpiresAt.After(time.Now()) {
+        writeError(w, http.StatusBadRequest, "INVALID_EXPIRY", "expires_at must be in the future")
+        return
+    }
+
+    raw := make([]byte, 32)
+    if _, err := rand.Read(raw); err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+    secret := base64.RawURLEncoding.EncodeToString(raw)
+    hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+    if err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+
+    key.TenantID = tenantFromContext(ctx)
+    sqlStatement := `INSERT INTO api_keys (key_hash, description, expires_at, tenant_id) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+    err = db.QueryRowContext(ctx, sqlStatement, string(hash), key.Description, key.ExpiresAt, key.TenantID).Scan(&key.ID, &key.CreatedAt)
+    if err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+    key.Key = fmt.Sprintf("%d.%s", key.ID, secret)
+    requestLogger(ctx).Info("api key issued", "api_key_id", key.ID, "user_id", userIDFromContext(ctx))
+
+    writeJSON(w, http.StatusCreated, key)
+}
+
+var errInvalidAPIKey = errors.New("invalid or expired API key")
+
+// apiKeyMiddleware authenticates write requests that carry an X-API-Key
+// header and no Authorization header; a bearer token takes precedence and is
+// left to jwtMiddleware, which skips requests authenticated here.
+func apiKeyMiddleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        raw := r.Header.Get(apiKeyHeader)
+        if raw == "" || r.Header.Get("Authorization") != "" {
+            next.ServeHTTP(w, r)
+            return
+        }
+        switch r.Method {
+        case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+        default:
+            next.ServeHTTP(w, r)
+            return
+        }
+
+        id, tenantID, err := verifyAPIKey(r.Context(), raw)
+        if errors.Is(err, errInvalidAPIKey) {
+            writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", err.Error())
+            return
+        }
+        if err != nil {
+            writeInternalError(w, r, err)
+            return
+        }
+        ctx := context.WithValue(r.Context(), userIDKey{}, "api-key:"+strconv.Itoa(id))
+        ctx = context.WithValue(ctx, authMethodKey{}, authMethodAPIKey)
+        ctx = withTenant(ctx, tenantID)
+        next.ServeHTTP(w, r.WithContext(ctx))
+    })
+}
+
+// verifyAPIKey checks raw against its stored hash and records the use. It
+// returns the key's id and tenant, and errInvalidAPIKey for malformed,
+// unknown, mismatched or expired keys alike, so a client cannot tell which
+// check failed.
+func verifyAPIKey(ctx context.Context, raw string) (int, uuid.UUID, error) {
+    idPart, secret, ok := strings.Cut(raw, ".")
+    id, err := strconv.Atoi(idPart)
+    if !ok || err != nil || id <= 0 || secret == "" {
+        return 0, uuid.Nil, errInvalidAPIKey
+    }
+
+    var hash string
+    var expiresAt sql.NullTime
+    var tenantID uuid.UUID
+    err = db.QueryRowContext(ctx, `SELECT key_hash, expires_at, tenant_id FROM api_keys WHERE id = $1`, id).Scan(&hash, &expiresAt, &tenantID)
+    if err == sql.ErrNoRows {
+        return 0, uuid.Nil, errInvalidAPIKey
+    }
+    if err != nil {
+        return 0, uuid.Nil, err
+    }
+    if bcrypt.CompareHashAndPassword([]byte(hash), []byte(secret)) != nil {
+        return 0, uuid.Nil, errInvalidAPIKey
+    }
+    if expiresAt.Valid && !expiresAt.Time.After(time.Now()) {
+        return 0, uuid.Nil, errInvalidAPIKey
+    }
+
+    // Concurrent requests with the same key each set the timestamp; the last
+    // writer wins, which is all last_used_at promises.
+    if _, err := db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = NOW() WHERE id = $1`, id); err != nil {
+        return 0, uuid.Nil, err
+    }
+    return id, tenantID, nil
+}
+
+// authMethodFromContext returns how the request was authenticated, or "" for
+// anonymous requests.
+func authMethodFromContext(ctx context.Context) string {
+    method, _ := ctx.Value(authMethodKey{}).(string)
+    return method
+}
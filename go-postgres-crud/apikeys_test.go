@@ -0,0 +1,198 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/DATA-DOG/go-sqlmock"
+    "github.com/golang-jwt/jwt/v5"
+    "golang.org/x/crypto/bcrypt"
+)
+
+func TestCreateAPIKeyRequiresAdminRole(t *testing.T) {
+    tests := []struct {
+        name   string
+        token  string
+        status int
+    }{
+        {"no role", testToken(t, nil), http.StatusForbidden},
+        {"editor role", testToken(t, jwt.MapClaims{"role": "editor"}), http.StatusForbidden},
+        {"no token", "", http.StatusUnauthorized},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            // No INSERT is expected: the key must not be issued.
+            rt := newTestRouter(NewApp(storedItems(), nil, nil, nil))
+            mockDB(t)
+            rec := doRequest(t, rt, http.MethodPost, "/api-keys", map[string]string{"description": "ci"}, tt.token)
+            if rec.Code != tt.status {
+                t.Errorf("status %d, body %s; want %d", rec.Code, rec.Body, tt.status)
+            }
+        })
+    }
+}
+
+func TestCreateAPIKeyAsAdmin(t *testing.T) {
+    mock := mockDB(t)
+    rt := newTestRouter(NewApp(storedItems(), nil, nil, nil))
+    mock.ExpectQuery(`INSERT INTO api_keys`).WithArgs(sqlmock.AnyArg(), "ci", nil, defaultTenantID).
+        WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(5, time.Now()))
+
+    rec := doRequest(t, rt, http.MethodPost, "/api-keys", map[string]string{"description": "ci"}, testToken(t, jwt.MapClaims{"role": "admin"}))
+    if rec.Code != http.StatusCreated {
+        t.Fatalf("status = %d, want 201: %s", rec.Code, rec.Body)
+    }
+    var key APIKey
+    decodeBody(t, rec, &key)
+    if key.ID != 5 || len(key.Key) < 3 || key.Key[:2] != "5." {
+        t.Errorf("key = %+v, want ID 5 and a key of the form 5.<secret>", key)
+    }
+}
+
+const testAPIKeySecret = "s3cr3t"
+
+// apiKeyRows is the api_keys row of a key with testAPIKeySecret. A zero
+// expiresAt is stored as NULL.
+func apiKeyRows(t *testing.T, expiresAt time.Time) *sqlmock.Rows {
+    t.Helper()
+    hash, err := bcrypt.GenerateFromPassword([]byte(testAPIKeySecret), bcrypt.MinCost)
+    if err != nil {
+        t.Fatal(err)
+    }
+    expires := sql.NullTime{Time: expiresAt, Valid: !expiresAt.IsZero()}
+    return sqlmock.NewRows([]string{"key_hash", "expires_at", "tenant_id"}).AddRow(string(hash), expires, defaultTenantID)
+}
+
+// createWithKey posts an item carrying key as X-API-Key and, when set, token
+// as the Authorization header. It returns the response and the user the
+// repository saw the item created by.
+func createWithKey(t *testing.T, key, token string) (*httptest.ResponseRecorder, string) {
+    t.Helper()
+    var createdBy string
+    repo := storedItems()
+    create := repo.CreateFunc
+    repo.CreateFunc = func(ctx context.Context, item Item, idempotencyKey string) (Item, error) {
+        createdBy = userIDFromContext(ctx)
+        return create(ctx, item, idempotencyKey)
+    }
+    req := httptest.NewRequest(http.MethodPost, "/items", strings.NewReader(`{"name":"Widget","price":1}`))
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set(apiKeyHeader, key)
+    if token != "" {
+        req.Header.Set("Authorization", token)
+    }
+    rec := httptest.NewRecorder()
+    newMockApp(t, repo).ServeHTTP(rec, req)
+    return rec, createdBy
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+    mock := mockDB(t)
+    mock.ExpectQuery(`SELECT key_hash, expires_at, tenant_id FROM api_keys WHERE id = \$1`).WithArgs(5).
+        WillReturnRows(apiKeyRows(t, time.Now().Add(time.Hour)))
+    mock.ExpectExec(`UPDATE api_keys SET last_used_at = NOW\(\) WHERE id = \$1`).WithArgs(5).
+        WillReturnResult(sqlmock.NewResult(0, 1))
+    expectWebhookLookup(mock)
+
+    rec, createdBy := createWithKey(t, "5."+testAPIKeySecret, "")
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+    }
+    if createdBy != "api-key:5" {
+        t.Errorf("created by %q, want api-key:5", createdBy)
+    }
+    awaitExpectations(t, mock)
+}
+
+func TestAPIKeyRejected(t *testing.T) {
+    lookup := `SELECT key_hash, expires_at, tenant_id FROM api_keys WHERE id = \$1`
+    tests := []struct {
+        name   string
+        key    string
+        expect func(t *testing.T, mock sqlmock.Sqlmock)
+    }{
+        {"expired", "5." + testAPIKeySecret, func(t *testing.T, mock sqlmock.Sqlmock) {
+            mock.ExpectQuery(lookup).WithArgs(5).WillReturnRows(apiKeyRows(t, time.Now().Add(-time.Minute)))
+        }},
+        {"unknown", "5." + testAPIKeySecret, func(t *testing.T, mock sqlmock.Sqlmock) {
+            mock.ExpectQuery(lookup).WithArgs(5).WillReturnError(sql.ErrNoRows)
+        }},
+        {"wrong secret", "5.guess", func(t *testing.T, mock sqlmock.Sqlmock) {
+            mock.ExpectQuery(lookup).WithArgs(5).WillReturnRows(apiKeyRows(t, time.Time{}))
+        }},
+        // Malformed keys are refused before the database is asked.
+        {"no separator", "5" + testAPIKeySecret, nil},
+        {"no secret", "5.", nil},
+        {"non-numeric id", "five." + testAPIKeySecret, nil},
+        {"zero id", "0." + testAPIKeySecret, nil},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            // No UPDATE of last_used_at is expected, nor any create.
+            mock := mockDB(t)
+            if tt.expect != nil {
+                tt.expect(t, mock)
+            }
+            rec, createdBy := createWithKey(t, tt.key, "")
+            if rec.Code != http.StatusUnauthorized || errorCode(t, rec) != "UNAUTHORIZED" {
+                t.Errorf("status %d, body %s; want 401 UNAUTHORIZED", rec.Code, rec.Body)
+            }
+            if createdBy != "" {
+                t.Errorf("item created by %q", createdBy)
+            }
+        })
+    }
+}
+
+// A bearer token takes precedence: the key is not even looked up, so an
+// invalid one does not fail the request.
+func TestBearerTokenTakesPrecedenceOverAPIKey(t *testing.T) {
+    mock := mockDB(t)
+    expectWebhookLookup(mock)
+
+    rec, createdBy := createWithKey(t, "5.guess", testToken(t, nil))
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+    }
+    if createdBy != "test-user" {
+        t.Errorf("created by %q, want the token's test-user", createdBy)
+    }
+    awaitExpectations(t, mock)
+}
+
+// Concurrent requests with one key each record their use; neither waits for
+// nor fails on the other's update of last_used_at.
+func TestAPIKeyConcurrentUse(t *testing.T) {
+    mock := mockDB(t)
+    mock.MatchExpectationsInOrder(false)
+    const requests = 2
+    for i := 0; i < requests; i++ {
+        mock.ExpectQuery(`SELECT key_hash, expires_at, tenant_id FROM api_keys`).WithArgs(5).WillReturnRows(apiKeyRows(t, time.Time{}))
+        mock.ExpectExec(`UPDATE api_keys SET last_used_at = NOW\(\) WHERE id = \$1`).WithArgs(5).WillReturnResult(sqlmock.NewResult(0, 1))
+        expectWebhookLookup(mock)
+    }
+    rt := newMockApp(t, storedItems())
+
+    codes := make(chan int, requests)
+    for i := 0; i < requests; i++ {
+        go func() {
+            req := httptest.NewRequest(http.MethodPost, "/items", strings.NewReader(`{"name":"Widget","price":1}`))
+            req.Header.Set("Content-Type", "application/json")
+            req.Header.Set(apiKeyHeader, "5."+testAPIKeySecret)
+            rec := httptest.NewRecorder()
+            rt.ServeHTTP(rec, req)
+            codes <- rec.Code
+        }()
+    }
+    for i := 0; i < requests; i++ {
+        if code := <-codes; code != http.StatusOK {
+            t.Errorf("status = %d, want 200", code)
+        }
+    }
+    awaitExpectations(t, mock)
+}
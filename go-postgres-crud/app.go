@@ -0,0 +1,22 @@
+package main
+
+import "time"
+
+// App holds the dependencies shared by the item handlers, which are its
+// methods.
+type App struct {
+    items ItemRepository
+    stmts *Statements
+    flags *FeatureFlags
+    // fields renames response keys for legacy clients, both in buffered
+    // JSON responses through its Middleware and in handlers that stream.
+    fields *FieldMapper
+}
+
+// NewApp builds an App. A nil fields leaves response keys as they are.
+func NewApp(items ItemRepository, stmts *Statements, flags *FeatureFlags, fields *FieldMapper) *App {
+    if fields == nil {
+        fields = NewFieldMapper(nil, time.Time{})
+    }
+    return &App{items: items, stmts: stmts, flags: flags, fields: fields}
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/lib/pq"
+    "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// Audit actions recorded in audit_logs.action.
+const (
+    auditCreate  = "create"
+    auditUpdate  = "update"
+    auditDelete  = "delete"
+    auditRestore = "restored"
+    auditRevert  = "reverted"
+)
+
+// auditActions are the values GET /admin/audit-log filters operation on.
+var auditActions = []string{auditCreate, auditUpdate, auditDelete, auditRestore, auditRevert}
+
+const defaultAuditPageSize = 50
+
+// auditRevertWindow is how far back PUT /items/{id}/restore may reach.
+const auditRevertWindow = 90 * 24 * time.Hour
+
+type auditActionKey struct{}
+
+// withAuditAction makes the writes under ctx record action instead of their
+// own, so an update that reverts an item is audited as the revert it is.
+func withAuditAction(ctx context.Context, action string) context.Context {
+    return context.WithValue(ctx, auditActionKey{}, action)
+}
+
+// auditAction returns the action set by withAuditAction, or fallback.
+func auditAction(ctx context.Context, fallback string) string {
+    if action, ok := ctx.Value(auditActionKey{}).(string); ok {
+        return action
+    }
+    return fallback
+}
+
+type auditEntry struct {
+    ID        int64           `json:"id"`
+    ItemID    int             `json:"item_id"`
+    UserID    *string         `json:"user_id"`
+    Action    string          `json:"action"`
+    OldValue  json.RawMessage `json:"old_value,omitempty"`
+    NewValue  json.RawMessage `json:"new_value,omitempty"`
+    CreatedAt time.Time       `json:"created_at"`
+}
+
+// recordAudit stores who changed an item and its state before and after the
+// change. It runs inside the mutation's transaction so the audit trail can
+// never disagree with the data. A nil old or new is stored as NULL.
+func recordAudit(ctx context.Context, tx *sql.Tx, itemID int, action string, old, new interface{}) error {
+    oldValue, err := auditValue(old)
+    if err != nil {
+        return err
+    }
+    newValue, err := auditValue(new)
+    if err != nil {
+        return err
+    }
+    var userID sql.NullString
+    if id := userIDFromContext(ctx); id != "" {
+        userID = sql.NullString{String: id, Valid: true}
+    }
+    _, err = tx.ExecContext(ctx, `INSERT INTO audit_logs (item_id, user_id, action, old_value, new_value)
+        VALUES ($1, $2, $3, $4, $5)`, itemID, userID, action, oldValue, newValue)
+    return err
+}
+
+func auditValue(v interface{}) (interface{}, error) {
+    if v == nil {
+        return nil, nil
+    }
+    b, err := json.Marshal(v)
+    if err != nil {
+        return nil, err
+    }
+    return string(b), nil
+}
+
+// getItemAudit returns the audit history of one of the tenant's items, oldest
+// first. Deleted items keep their history.
+func getItemAudit(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "getItemAudit", tracer.ResourceName("SELECT FROM audit_logs WHERE item_id = $1"))
+    defer span.Finish()
+
+    id, err := parseItemID(r.PathValue("id"))
+    if err != nil {
+        writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid item ID")
+        return
+    }
+
+    rows, err := queryRead(r, `SELECT a.id, a.item_id, a.user_id, a.action, a.old_value, a.new_value, a.created_at
+        FROM audit_logs a JOIN items i ON i.id = a.item_id
+        WHERE a.item_id = $1 AND i.tenant_id = $2 ORDER BY a.created_at, a.id`, id, tenantFromContext(ctx))
+    if err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+    defer rows.Close()
+
+    entries := []auditEntry{}
+    for rows.Next() {
+        var entry auditEntry
+        var userID sql.NullString
+        var oldValue, newValue []byte
+        err := rows.Scan(&entry.ID, &entry.ItemID, &userID, &entry.Action, &oldValue, &newValue, &entry.CreatedAt)
+        if err != nil {
+            writeInternalError(w, r, err)
+            return
+        }
+        if userID.Valid {
+            entry.UserID = &userID.String
+        }
+        entry.OldValue = nullableJSON(oldValue)
+        entry.NewValue = nullableJSON(newValue)
+        entries = append(entries, entry)
+    }
+    if err := rows.Err(); err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+
+    writeJSON(w, http.StatusOK, map[string]interface{}{"item_id": id, "entries": entries})
+}
+
+func nullableJSON(b []byte) json.RawMessage {
+    if b == nil {
+        return json.RawMessage("null")
+    }
+    return json.RawMessage(b)
+}
+
+// auditLogPage is the response of GET /admin/audit-log.
+type auditLogPage struct {
+    Entries []auditEntry `json:"entries"`
+    Total   int          `json:"total"`
+    Page    int          `json:"page"`
+    PerPage int          `json:"per_page"`
+}
+
+// auditLogFilters is the parsed query of GET /admin/audit-log. A nil filter
+// matches every entry.
+type auditLogFilters struct {
+    Action  *string
+    ItemID  *int
+    Actor   *string
+    From    *time.Time
+    To      *time.Time
+    Page    int
+    PerPage int
+    Diff    bool
+}
+
+func parseAuditLogFilters(r *http.Request) (auditLogFilters, error) {
+    query := r.URL.Query()
+    filters := auditLogFilters{Page: 1, PerPage: defaultAuditPageSize, Diff: query.Get("include_diff") == "true"}
+    if raw := query.Get("operation"); raw != "" {
+        action := strings.ToLower(raw)
+        known := false
+        for _, a := range auditActions {
+            known = known || a == action
+        }
+        if !known {
+            return filters, fmt.Errorf("operation must be one of %s", strings.Join(auditActions, ", "))
+        }
+        filters.Action = &action
+    }
+    if raw := query.Get("item_id"); raw != "" {
+        id, err := parseItemID(raw)
+        if err != nil {
+            return filters, fmt.Errorf("item_id must be a valid item ID")
+        }
+        filters.ItemID = &id
+    }
+    if raw := query.Get("actor"); raw != "" {
+        filters.Actor = &raw
+    }
+    var err error
+    if filters.From, err = parseHistoryDate(r, "from"); err != nil {
+        return filters, err
+    }
+    if filters.To, err = parseHistoryDate(r, "to"); err != nil {
+        return filters, err
+    }
+    if filters.To != nil {
+        // Include the whole of the to date.
+        end := filters.To.AddDate(0, 0, 1)
+        filters.To = &end
+    }
+    if filters.From != nil && filters.To != nil && !filters.From.Before(*filters.To) {
+        return filters, fmt.Errorf("from must not be after to")
+    }
+    if raw := query.Get("page"); raw != "" {
+        if filters.Page, err = strconv.Atoi(raw); err != nil || filters.Page < 1 {
+            return filters, fmt.Errorf("page must be a positive integer")
+        }
+    }
+    if raw := query.Get("per_page"); raw != "" {
+        if filters.PerPage, err = strconv.Atoi(raw); err != nil || filters.PerPage < 1 || filters.PerPage > maxPageLimit {
+            return filters, fmt.Errorf("per_page must be an integer between 1 and %d", maxPageLimit)
+        }
+    }
+    return filters, nil
+}
+
+// auditLogWhere selects the entries of the tenant's items matching $2 to $6.
+const auditLogWhere = `FROM audit_logs a JOIN items i ON i.id = a.item_id
+    WHERE i.tenant_id = $1
+        AND ($2::text IS NULL OR a.action = $2)
+        AND ($3::int IS NULL OR a.item_id = $3)
+        AND ($4::text IS NULL OR a.user_id = $4)
+        AND ($5::timestamptz IS NULL OR a.created_at >= $5)
+        AND ($6::timestamptz IS NULL OR a.created_at < $6)`
+
+// getAuditLog pages through the audit entries of the tenant's items, newest
+// first. The before and after states are only included with
+// include_diff=true, to keep the default response small.
+func getAuditLog(w http.ResponseWriter, r *http.Request) error {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "getAuditLog", tracer.ResourceName("SELECT FROM audit_logs"))
+    defer span.Finish()
+
+    filters, err := parseAuditLogFilters(r)
+    if err != nil {
+        return &ValidationError{Code: "INVALID_QUERY", Message: err.Error()}
+    }
+    args := []interface{}{tenantFromContext(ctx), filters.Action, filters.ItemID, filters.Actor, filters.From, filters.To}
+
+    page := auditLogPage{Entries: []auditEntry{}, Page: filters.Page, PerPage: filters.PerPage}
+    rows, err := queryRead(r, `SELECT COUNT(*) `+auditLogWhere, args...)
+    if err != nil {
+        return err
+    }
+    for rows.Next() {
+        if err := rows.Scan(&page.Total); err != nil {
+            rows.Close()
+            return err
+        }
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return err
+    }
+
+    values := "NULL::jsonb, NULL::jsonb"
+    if filters.Diff {
+        values = "a.old_value, a.new_value"
+    }
+    rows, err = queryRead(r, `SELECT a.id, a.item_id, a.user_id, a.action, `+values+`, a.created_at `+auditLogWhere+`
+        ORDER BY a.created_at DESC, a.id DESC LIMIT $7 OFFSET $8`,
+        append(args, filters.PerPage, (filters.Page-1)*filters.PerPage)...)
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var entry auditEntry
+        var userID sql.NullString
+        var oldValue, newValue []byte
+        if err := rows.Scan(&entry.ID, &entry.ItemID, &userID, &entry.Action, &oldValue, &newValue, &entry.CreatedAt); err != nil {
+            return err
+        }
+        if userID.Valid {
+            entry.UserID = &userID.String
+        }
+        if filters.Diff {
+            entry.OldValue = nullableJSON(oldValue)
+            entry.NewValue = nullableJSON(newValue)
+        }
+        page.Entries = append(page.Entries, entry)
+    }
+    if err := rows.Err(); err != nil {
+        return err
+    }
+
+    writeJSON(w, http.StatusOK, page)
+    return nil
+}
+
+type revertItemRequest struct {
+    RestoreToAuditID int64 `json:"restore_to_audit_id"`
+}
+
+// revertItem puts the tenant's item back in the state it was in before the
+// change of audit entry restore_to_audit_id, through the repository's Update
+// like PUT /items/{id}, and returns it. The entry must belong to the item, be
+// at most 90 days old and have a before state, which creates and restores do
+// not. Categories are put back when the snapshot lists them. The change is
+// audited as reverted.
+func (app *App) revertItem(w http.ResponseWriter, r *http.Request) error {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "revertItem", tracer.ResourceName("UPDATE items"))
+    defer span.Finish()
+
+    id, err := parseItemID(r.PathValue("id"))
+    if err != nil {
+        return &ValidationError{Code: "INVALID_ID", Message: "Invalid item ID"}
+    }
+    var req revertItemRequest
+    err = json.NewDecoder(r.Body).Decode(&req)
+    if err != nil {
+        return bodyError(err, "Request body is not valid JSON")
+    }
+    if req.RestoreToAuditID <= 0 {
+        return &ValidationError{Code: "INVALID_BODY", Message: "restore_to_audit_id must be a positive integer"}
+    }
+
+    tenantID := tenantFromContext(ctx)
+    var itemID int
+    var oldValue []byte
+    var createdAt time.Time
+    err = db.QueryRowContext(ctx, `SELECT a.item_id, a.old_value, a.created_at
+        FROM audit_logs a JOIN items i ON i.id = a.item_id
+        WHERE a.id = $1 AND i.tenant_id = $2`, req.RestoreToAuditID, tenantID).Scan(&itemID, &oldValue, &createdAt)
+    if err == sql.ErrNoRows {
+        return &NotFoundError{Resource: "Audit entry"}
+    }
+    if err != nil {
+        return err
+    }
+    switch {
+    case itemID != id:
+        return &ValidationError{Code: "AUDIT_ENTRY_MISMATCH", Message: "The audit entry belongs to another item"}
+    case time.Since(createdAt) > auditRevertWindow:
+        return &ValidationError{Code: "AUDIT_ENTRY_TOO_OLD", Message: "Only the last 90 days of audit history can be restored"}
+    case oldValue == nil:
+        return &ValidationError{Code: "AUDIT_ENTRY_NO_SNAPSHOT", Message: "The audit entry has no earlier state to restore"}
+    }
+    var snapshot Item
+    if err := json.Unmarshal(oldValue, &snapshot); err != nil {
+        return err
+    }
+    item := Item{Name: snapshot.Name, Description: snapshot.Description, Price: snapshot.Price, Metadata: snapshot.Metadata}
+    if snapshot.Categories != nil {
+        item.CategoryIDs = []int{}
+        for _, category := range snapshot.Categories {
+            item.CategoryIDs = append(item.CategoryIDs, category.ID)
+        }
+    }
+    if err := validateItem(ctx, item); err != nil {
+        return err
+    }
+
+    old, item, err := app.items.Update(withAuditAction(ctx, auditRevert), tenantID, id, item)
+    if err == sql.ErrNoRows {
+        return &NotFoundError{Resource: "Item"}
+    }
+    if err != nil {
+        return err
+    }
+    evictItem(id)
+    if old.Price != item.Price {
+        priceChanges.Publish(priceChange{ItemID: id, Old: old.Price, New: item.Price})
+    }
+    if fresh, err := app.items.GetByID(ctx, tenantID, id); err == nil {
+        item = fresh
+    }
+    notifyItemChange(ctx, eventItemUpdated, item)
+
+    writeJSON(w, http.StatusOK, item)
+    return nil
+}
+
+// diffItemVersions returns the JSON Patch from the item's state before audit
+// entry audit_id_a to its state before audit_id_b. Both entries must belong
+// to the tenant's item and have a before state.
+func diffItemVersions(w http.ResponseWriter, r *http.Request) error {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "diffItemVersions", tracer.ResourceName("SELECT FROM audit_logs WHERE id = ANY($1)"))
+    defer span.Finish()
+
+    id, err := parseItemID(r.PathValue("id"))
+    if err != nil {
+        return &ValidationError{Code: "INVALID_ID", Message: "Invalid item ID"}
+    }
+    var auditIDs [2]int64
+    for i, name := range []string{"audit_id_a", "audit_id_b"} {
+        auditIDs[i], err = strconv.ParseInt(r.PathValue(name), 10, 64)
+        if err != nil || auditIDs[i] <= 0 {
+            return &ValidationError{Code: "INVALID_ID", Message: name + " must be a positive integer"}
+        }
+    }
+    if auditIDs[0] == auditIDs[1] {
+        return &ValidationError{Code: "INVALID_ID", Message: "audit_id_a and audit_id_b must differ"}
+    }
+
+    rows, err := queryRead(r, `SELECT a.id, a.old_value FROM audit_logs a JOIN items i ON i.id = a.item_id
+        WHERE a.id = ANY($1) AND a.item_id = $2 AND i.tenant_id = $3`, pq.Array(auditIDs[:]), id, tenantFromContext(ctx))
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+    snapshots := map[int64][]byte{}
+    for rows.Next() {
+        var auditID int64
+        var oldValue []byte
+        if err := rows.Scan(&auditID, &oldValue); err != nil {
+            return err
+        }
+        snapshots[auditID] = oldValue
+    }
+    if err := rows.Err(); err != nil {
+        return err
+    }
+
+    var states [2]map[string]interface{}
+    for i, auditID := range auditIDs {
+        snapshot, ok := snapshots[auditID]
+        if !ok {
+            return &NotFoundError{Resource: "Audit entry"}
+        }
+        if snapshot == nil {
+            return &ValidationError{Code: "AUDIT_ENTRY_NO_SNAPSHOT", Message: fmt.Sprintf("Audit entry %d has no earlier state to compare", auditID)}
+        }
+        if err := json.Unmarshal(snapshot, &states[i]); err != nil {
+            return err
+        }
+    }
+
+    writeJSON(w, http.StatusOK, diffJSON(states[0], states[1]))
+    return nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+    "context"
+    "net/http"
+    "testing"
+    "time"
+
+    "github.com/DATA-DOG/go-sqlmock"
+    "github.com/golang-jwt/jwt/v5"
+)
+
+var auditLogColumns = []string{"id", "item_id", "user_id", "action", "old_value", "new_value", "created_at"}
+
+func auditLogRequest(t *testing.T, query string) (int, auditLogPage) {
+    t.Helper()
+    rt := newTestRouter(NewApp(storedItems(), nil, NewFeatureFlags(nil), nil))
+    rec := doRequest(t, rt, http.MethodGet, "/admin/audit-log"+query, nil, testToken(t, jwt.MapClaims{"role": "admin"}))
+    var page auditLogPage
+    if rec.Code == http.StatusOK {
+        decodeBody(t, rec, &page)
+    }
+    return rec.Code, page
+}
+
+func TestGetAuditLogFilters(t *testing.T) {
+    mock := mockDB(t)
+    from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+    // to is inclusive, so the bound is the start of the next day.
+    until := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+    mock.ExpectQuery(`SELECT COUNT\(\*\) FROM audit_logs a JOIN items i`).WithArgs(defaultTenantID, auditUpdate, 7, "alice", from, until).
+        WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+    mock.ExpectQuery(`SELECT a.id, a.item_id, a.user_id, a.action, NULL::jsonb, NULL::jsonb, a.created_at FROM audit_logs`).
+        WithArgs(defaultTenantID, auditUpdate, 7, "alice", from, until, 2, 2).
+        WillReturnRows(sqlmock.NewRows(auditLogColumns).AddRow(5, 7, "alice", auditUpdate, nil, nil, from))
+
+    status, page := auditLogRequest(t, "?operation=UPDATE&item_id=7&actor=alice&from=2024-01-01&to=2024-01-31&page=2&per_page=2")
+    if status != http.StatusOK || page.Total != 3 || page.Page != 2 || page.PerPage != 2 || len(page.Entries) != 1 {
+        t.Fatalf("status %d, page %+v; want the second page of three entries", status, page)
+    }
+    if entry := page.Entries[0]; entry.ID != 5 || *entry.UserID != "alice" || entry.OldValue != nil || entry.NewValue != nil {
+        t.Errorf("entry %+v, want entry 5 by alice without a diff", entry)
+    }
+}
+
+func TestGetAuditLogIncludeDiff(t *testing.T) {
+    mock := mockDB(t)
+    mock.ExpectQuery(`SELECT COUNT`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+    mock.ExpectQuery(`a.old_value, a.new_value`).WithArgs(defaultTenantID, nil, nil, nil, nil, nil, defaultAuditPageSize, 0).
+        WillReturnRows(sqlmock.NewRows(auditLogColumns).AddRow(1, 2, nil, auditCreate, nil, []byte(`{"name":"Drill"}`), time.Now()))
+
+    status, page := auditLogRequest(t, "?include_diff=true")
+    if status != http.StatusOK || len(page.Entries) != 1 {
+        t.Fatalf("status %d, page %+v; want one entry", status, page)
+    }
+    if entry := page.Entries[0]; string(entry.OldValue) != "null" || string(entry.NewValue) != `{"name":"Drill"}` || entry.UserID != nil {
+        t.Errorf("entry %+v, want a null old value and the created item", entry)
+    }
+}
+
+func TestGetAuditLogInvalid(t *testing.T) {
+    // None of these reach the database.
+    mockDB(t)
+    for _, query := range []string{
+        "?operation=purge",
+        "?item_id=abc",
+        "?from=yesterday",
+        "?from=2024-02-01&to=2024-01-01",
+        "?page=0",
+        "?per_page=501",
+    } {
+        if status, _ := auditLogRequest(t, query); status != http.StatusBadRequest {
+            t.Errorf("GET /admin/audit-log%s: status = %d, want 400", query, status)
+        }
+    }
+}
+
+func TestRevertItem(t *testing.T) {
+    mock := mockDB(t)
+    repo := storedItems(Item{ID: 3, Name: "Drill v2", Description: "new", Price: 40, Version: 2})
+    update := repo.UpdateFunc
+    var action string
+    repo.UpdateFunc = func(ctx context.Context, id int, item Item) (Item, Item, error) {
+        action = auditAction(ctx, auditUpdate)
+        return update(ctx, id, item)
+    }
+    rt := newMockApp(t, repo)
+
+    mock.ExpectQuery(`SELECT a.item_id, a.old_value, a.created_at\s+FROM audit_logs a JOIN items i`).WithArgs(42, defaultTenantID).
+        WillReturnRows(sqlmock.NewRows([]string{"item_id", "old_value", "created_at"}).
+            AddRow(3, []byte(`{"id":3,"name":"Drill","description":"old","price":30,"version":1,"categories":[{"id":5,"name":"Tools"}]}`), time.Now().Add(-time.Hour)))
+    expectWebhookLookup(mock)
+
+    rec := doRequest(t, rt, http.MethodPut, "/items/3/restore", map[string]int{"restore_to_audit_id": 42}, testToken(t, nil))
+    var got Item
+    decodeBody(t, rec, &got)
+    if rec.Code != http.StatusOK || got.Name != "Drill" || got.Description != "old" || got.Price != 30 || got.Version != 3 {
+        t.Fatalf("status %d, body %s; want the snapshot at version 3", rec.Code, rec.Body)
+    }
+    if len(got.CategoryIDs) != 1 || got.CategoryIDs[0] != 5 {
+        t.Errorf("category IDs = %v, want the snapshot's [5]", got.CategoryIDs)
+    }
+    if action != auditRevert {
+        t.Errorf("update audited as %q, want %q", action, auditRevert)
+    }
+    awaitExpectations(t, mock)
+}
+
+func TestRevertItemErrors(t *testing.T) {
+    tests := []struct {
+        name      string
+        itemID    int
+        oldValue  []byte
+        createdAt time.Time
+        code      string
+    }{
+        {"another item", 4, []byte(`{"name":"Drill","price":30}`), time.Now(), "AUDIT_ENTRY_MISMATCH"},
+        {"too old", 3, []byte(`{"name":"Drill","price":30}`), time.Now().Add(-91 * 24 * time.Hour), "AUDIT_ENTRY_TOO_OLD"},
+        {"create entry", 3, nil, time.Now(), "AUDIT_ENTRY_NO_SNAPSHOT"},
+    }
+    repo := storedItems(Item{ID: 3, Name: "Drill", Price: 40, Version: 2})
+    rt := newMockApp(t, repo)
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            mock := mockDB(t)
+            mock.ExpectQuery(`FROM audit_logs`).WillReturnRows(sqlmock.NewRows([]string{"item_id", "old_value", "created_at"}).AddRow(tt.itemID, tt.oldValue, tt.createdAt))
+            rec := doRequest(t, rt, http.MethodPut, "/items/3/restore", map[string]int{"restore_to_audit_id": 42}, testToken(t, nil))
+            if rec.Code != http.StatusBadRequest || errorCode(t, rec) != tt.code {
+                t.Errorf("status %d, body %s; want 400 %s", rec.Code, rec.Body, tt.code)
+            }
+        })
+    }
+
+    mock := mockDB(t)
+    mock.ExpectQuery(`FROM audit_logs`).WillReturnRows(sqlmock.NewRows([]string{"item_id", "old_value", "created_at"}))
+    if rec := doRequest(t, rt, http.MethodPut, "/items/3/restore", map[string]int{"restore_to_audit_id": 42}, testToken(t, nil)); rec.Code != http.StatusNotFound {
+        t.Errorf("missing entry: status %d, body %s; want 404", rec.Code, rec.Body)
+    }
+    if rec := doRequest(t, rt, http.MethodPut, "/items/3/restore", map[string]int{}, testToken(t, nil)); rec.Code != http.StatusBadRequest {
+        t.Errorf("no entry ID: status %d, body %s; want 400", rec.Code, rec.Body)
+    }
+    if n := repo.CallCount("Update"); n != 0 {
+        t.Errorf("Update called %d times for refused reverts", n)
+    }
+}
+
+func TestDiffItemVersions(t *testing.T) {
+    mock := mockDB(t)
+    rt := newMockApp(t, storedItems())
+
+    mock.ExpectQuery(`SELECT a.id, a.old_value FROM audit_logs a JOIN items i`).WithArgs("{42,43}", 3, defaultTenantID).
+        WillReturnRows(sqlmock.NewRows([]string{"id", "old_value"}).
+            AddRow(43, []byte(`{"name":"Drill","price":14.99}`)).
+            AddRow(42, []byte(`{"name":"Drill","price":9.99}`)))
+    rec := doRequest(t, rt, http.MethodGet, "/items/3/diff/42/43", nil, "")
+    var got []map[string]interface{}
+    decodeBody(t, rec, &got)
+    if rec.Code != http.StatusOK || len(got) != 1 || got[0]["path"] != "/price" || got[0]["value"] != 14.99 || got[0]["old_value"] != 9.99 {
+        t.Errorf("status %d, body %s; want the price replaced from 9.99 to 14.99", rec.Code, rec.Body)
+    }
+
+    t.Run("errors", func(t *testing.T) {
+        mock := mockDB(t)
+        // Entry 43 belongs to another item, so only 42 is found.
+        mock.ExpectQuery(`FROM audit_logs`).WillReturnRows(sqlmock.NewRows([]string{"id", "old_value"}).AddRow(42, []byte(`{}`)))
+        if rec := doRequest(t, rt, http.MethodGet, "/items/3/diff/42/43", nil, ""); rec.Code != http.StatusNotFound {
+            t.Errorf("foreign entry: status %d, body %s; want 404", rec.Code, rec.Body)
+        }
+        mock.ExpectQuery(`FROM audit_logs`).WillReturnRows(sqlmock.NewRows([]string{"id", "old_value"}).AddRow(42, nil).AddRow(43, []byte(`{}`)))
+        if rec := doRequest(t, rt, http.MethodGet, "/items/3/diff/42/43", nil, ""); rec.Code != http.StatusBadRequest || errorCode(t, rec) != "AUDIT_ENTRY_NO_SNAPSHOT" {
+            t.Errorf("create entry: status %d, body %s; want 400 AUDIT_ENTRY_NO_SNAPSHOT", rec.Code, rec.Body)
+        }
+        for _, target := range []string{"/items/3/diff/42/42", "/items/3/diff/0/42", "/items/3/diff/x/42"} {
+            if rec := doRequest(t, rt, http.MethodGet, target, nil, ""); rec.Code != http.StatusBadRequest {
+                t.Errorf("GET %s: status %d, want 400", target, rec.Code)
+            }
+        }
+    })
+}
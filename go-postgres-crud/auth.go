@@ -0,0 +1,130 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "strings"
+
+    "github.com/golang-jwt/jwt/v5"
+)
+
+// jwtSecret is the HMAC key for bearer tokens, from JWT_SECRET.
+var jwtSecret []byte
+
+type userIDKey struct{}
+
+type roleKey struct{}
+
+// jwtMiddleware requires a valid HS256 bearer token on every POST, PUT, PATCH
+// and DELETE request and stores its user_id and role claims in the request
+// context.
+// Requests already authenticated by apiKeyMiddleware pass through. Reads stay
+// public.
+func jwtMiddleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        switch r.Method {
+        case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+        default:
+            next.ServeHTTP(w, r)
+            return
+        }
+        if authMethodFromContext(r.Context()) == authMethodAPIKey {
+            next.ServeHTTP(w, r)
+            return
+        }
+
+        claims, err := parseBearerToken(r)
+        var userID string
+        if err == nil {
+            userID, err = userIDClaim(claims)
+        }
+        if err != nil {
+            w.Header().Set("WWW-Authenticate", `Bearer realm="items"`)
+            writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", err.Error())
+            return
+        }
+        ctx := context.WithValue(r.Context(), userIDKey{}, userID)
+        ctx = context.WithValue(ctx, authMethodKey{}, authMethodJWT)
+        ctx = withRole(ctx, claims)
+        next.ServeHTTP(w, r.WithContext(ctx))
+    })
+}
+
+func userIDClaim(claims jwt.MapClaims) (string, error) {
+    switch userID := claims["user_id"].(type) {
+    case string:
+        if userID != "" {
+            return userID, nil
+        }
+    case float64:
+        return fmt.Sprintf("%.0f", userID), nil
+    }
+    return "", fmt.Errorf("token has no user_id claim")
+}
+
+// parseBearerToken validates the bearer token of r and returns its claims.
+// Error messages are safe to show to the client.
+func parseBearerToken(r *http.Request) (jwt.MapClaims, error) {
+    return parseAuthorization(r.Header.Get("Authorization"))
+}
+
+// parseAuthorization validates an Authorization value of the form
+// "Bearer <token>", from an HTTP header or gRPC metadata.
+func parseAuthorization(header string) (jwt.MapClaims, error) {
+    scheme, raw, ok := strings.Cut(header, " ")
+    if header == "" {
+        return nil, fmt.Errorf("missing Authorization header")
+    }
+    if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(raw) == "" {
+        return nil, fmt.Errorf("Authorization header must be a Bearer token")
+    }
+
+    claims := jwt.MapClaims{}
+    _, err := jwt.ParseWithClaims(strings.TrimSpace(raw), claims, func(*jwt.Token) (interface{}, error) {
+        return jwtSecret, nil
+    }, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+    if err != nil {
+        return nil, fmt.Errorf("invalid or expired token")
+    }
+    return claims, nil
+}
+
+// requireAdminRole only lets through requests, reads included, whose bearer
+// token carries a role claim of "admin". API keys carry no role and are
+// refused.
+func requireAdminRole(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        claims, err := parseBearerToken(r)
+        if err != nil {
+            w.Header().Set("WWW-Authenticate", `Bearer realm="items"`)
+            writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", err.Error())
+            return
+        }
+        if role, _ := claims["role"].(string); role != "admin" {
+            writeError(w, http.StatusForbidden, "FORBIDDEN", "This endpoint requires the admin role")
+            return
+        }
+        next.ServeHTTP(w, r)
+    })
+}
+
+// userIDFromContext returns the authenticated user, or "" for anonymous
+// requests.
+func userIDFromContext(ctx context.Context) string {
+    id, _ := ctx.Value(userIDKey{}).(string)
+    return id
+}
+
+// withRole stores the role claim of a verified token in ctx.
+func withRole(ctx context.Context, claims jwt.MapClaims) context.Context {
+    role, _ := claims["role"].(string)
+    return context.WithValue(ctx, roleKey{}, role)
+}
+
+// roleFromContext returns the role of the authenticated user, or "" when the
+// request carries no role, as with API keys and anonymous reads.
+func roleFromContext(ctx context.Context) string {
+    role, _ := ctx.Value(roleKey{}).(string)
+    return role
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/golang-jwt/jwt/v5"
+)
+
+// signToken signs claims with secret, without the defaults of testToken.
+func signToken(t *testing.T, method jwt.SigningMethod, secret interface{}, claims jwt.MapClaims) string {
+    t.Helper()
+    signed, err := jwt.NewWithClaims(method, claims).SignedString(secret)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return "Bearer " + signed
+}
+
+func TestJWTMiddleware(t *testing.T) {
+    inAnHour := time.Now().Add(time.Hour).Unix()
+    tests := []struct {
+        name          string
+        authorization string
+        wantUser      string
+    }{
+        {"valid token", testToken(t, nil), "test-user"},
+        {"numeric user_id", testToken(t, jwt.MapClaims{"user_id": 42}), "42"},
+        {"missing header", "", ""},
+        {"malformed token", "Bearer not.a.jwt", ""},
+        {"not a bearer token", "Basic dXNlcjpwYXNz", ""},
+        {"empty bearer token", "Bearer ", ""},
+        {"expired token", testToken(t, jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}), ""},
+        {"no expiry", signToken(t, jwt.SigningMethodHS256, testJWTSecret, jwt.MapClaims{"user_id": "u"}), ""},
+        {"wrong secret", signToken(t, jwt.SigningMethodHS256, []byte("other"), jwt.MapClaims{"user_id": "u", "exp": inAnHour}), ""},
+        {"unsigned token", signToken(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, jwt.MapClaims{"user_id": "u", "exp": inAnHour}), ""},
+        {"no user_id", signToken(t, jwt.SigningMethodHS256, testJWTSecret, jwt.MapClaims{"exp": inAnHour}), ""},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var gotUser string
+            called := false
+            h := jwtMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                called = true
+                gotUser = userIDFromContext(r.Context())
+            }))
+            r := httptest.NewRequest(http.MethodPost, "/items", nil)
+            if tt.authorization != "" {
+                r.Header.Set("Authorization", tt.authorization)
+            }
+            rec := httptest.NewRecorder()
+            h.ServeHTTP(rec, r)
+
+            if tt.wantUser != "" {
+                if !called || gotUser != tt.wantUser {
+                    t.Errorf("status %d, user %q; want the request through as %q", rec.Code, gotUser, tt.wantUser)
+                }
+                return
+            }
+            if called || rec.Code != http.StatusUnauthorized || errorCode(t, rec) != "UNAUTHORIZED" {
+                t.Errorf("status %d, body %s; want 401 UNAUTHORIZED", rec.Code, rec.Body)
+            }
+            if rec.Header().Get("WWW-Authenticate") == "" {
+                t.Error("401 without a WWW-Authenticate header")
+            }
+        })
+    }
+}
+
+func TestJWTMiddlewareLeavesReadsPublic(t *testing.T) {
+    called := false
+    h := jwtMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+    h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items/1", nil))
+    if !called {
+        t.Error("GET without a token was refused")
+    }
+}
+
+func TestJWTMiddlewareOnProtectedRoute(t *testing.T) {
+    rt := newMockApp(t, storedItems(Item{ID: 1, Name: "Widget", Price: 1, Version: 1}))
+
+    rec := doRequest(t, rt, http.MethodDelete, "/items/1", nil, testToken(t, jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}))
+    if rec.Code != http.StatusUnauthorized {
+        t.Errorf("DELETE with an expired token: status = %d, want 401", rec.Code)
+    }
+    if rec := doRequest(t, rt, http.MethodGet, "/items/1", nil, ""); rec.Code != http.StatusOK {
+        t.Errorf("the refused DELETE changed the item: GET status = %d", rec.Code)
+    }
+    if rec := doRequest(t, rt, http.MethodDelete, "/items/1", nil, testToken(t, nil)); rec.Code != http.StatusNoContent {
+        t.Errorf("DELETE with a valid token: status = %d, want 204", rec.Code)
+    }
+}
+
+// TestAdminRoutesRequireAdminRole sends every /admin route a token without
+// the admin role, and none at all. Neither reaches a handler, so nothing
+// touches the database.
+func TestAdminRoutesRequireAdminRole(t *testing.T) {
+    routes := map[string]string{
+        "POST /admin/import-from-url":     "/admin/import-from-url",
+        "GET /admin/audit-log":            "/admin/audit-log",
+        "POST /admin/items/price-adjust":  "/admin/items/price-adjust",
+        "GET /admin/price-errors":         "/admin/price-errors",
+        "PUT /admin/price-errors/{id}":    "/admin/price-errors/1",
+        "GET /admin/connections":          "/admin/connections",
+        "DELETE /admin/connections/{pid}": "/admin/connections/42",
+        "GET /admin/db/stats":             "/admin/db/stats",
+        "POST /admin/analyze-query":       "/admin/analyze-query",
+        "POST /admin/backup":              "/admin/backup",
+        "GET /admin/flags":                "/admin/flags",
+        "PUT /admin/flags/{name}":         "/admin/flags/beta",
+    }
+    mockDB(t)
+    rt := newTestRouter(NewApp(storedItems(), nil, NewFeatureFlags(nil), nil))
+    for _, pattern := range *rt.patterns {
+        if _, path, _ := strings.Cut(pattern, " "); strings.HasPrefix(path, "/admin/") && routes[pattern] == "" {
+            t.Errorf("%s is not covered by this test", pattern)
+        }
+    }
+
+    editor := testToken(t, jwt.MapClaims{"role": "editor"})
+    for pattern, target := range routes {
+        method, _, _ := strings.Cut(pattern, " ")
+        rec := doRequest(t, rt, method, target, `{}`, editor)
+        if rec.Code != http.StatusForbidden || errorCode(t, rec) != "FORBIDDEN" {
+            t.Errorf("%s %s as an editor: status %d, body %s; want 403 FORBIDDEN", method, target, rec.Code, rec.Body)
+        }
+        if rec := doRequest(t, rt, method, target, `{}`, ""); rec.Code != http.StatusUnauthorized {
+            t.Errorf("%s %s without a token: status = %d, want 401", method, target, rec.Code)
+        }
+    }
+
+    if rec := doRequest(t, rt, http.MethodGet, "/admin/flags", nil, testToken(t, jwt.MapClaims{"role": "admin"})); rec.Code != http.StatusOK {
+        t.Errorf("GET /admin/flags as an admin: status = %d, want 200", rec.Code)
+    }
+}
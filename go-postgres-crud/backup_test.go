@@ -0,0 +1,55 @@
+package main
+
+import (
+    "bytes"
+    "compress/gzip"
+    "context"
+    "encoding/json"
+    "reflect"
+    "testing"
+    "time"
+
+    "github.com/DATA-DOG/go-sqlmock"
+    "github.com/google/uuid"
+)
+
+func TestWriteItemsBackup(t *testing.T) {
+    mock := mockDB(t)
+    otherTenant := uuid.MustParse("6f1c2a4e-8f0b-4f3e-9a57-0d2b6c9e1a34")
+    createdAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+    mock.ExpectQuery(`SELECT i.tenant_id, i.id, .* FROM items i WHERE i.deleted_at IS NULL ORDER BY i.id`).
+        WillReturnRows(sqlmock.NewRows([]string{"tenant_id", "id", "name", "description", "price", "version", "image_url",
+            "sku", "metadata", "stock", "created_at", "categories"}).
+            AddRow(defaultTenantID, 1, "Widget", "Small", 9.99, 2, "", "TOO-WID-X7K2", []byte(`{"color":"red"}`), 12, createdAt,
+                []byte(`[{"id":3,"name":"Tools","slug":"tools"}]`)).
+            AddRow(otherTenant, 2, "Gadget", "", 5, 1, "", "", nil, 0, createdAt, []byte(`[]`)))
+
+    var buf bytes.Buffer
+    if err := writeItemsBackup(context.Background(), &buf); err != nil {
+        t.Fatal(err)
+    }
+    gz, err := gzip.NewReader(&buf)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var got []map[string]interface{}
+    if err := json.NewDecoder(gz).Decode(&got); err != nil {
+        t.Fatal(err)
+    }
+
+    want := []map[string]interface{}{
+        {
+            "tenant_id": defaultTenantID.String(), "id": 1.0, "name": "Widget", "description": "Small", "price": 9.99,
+            "version": 2.0, "sku": "TOO-WID-X7K2", "metadata": map[string]interface{}{"color": "red"}, "stock": 12.0,
+            "created_at": "2025-03-01T12:00:00Z",
+            "categories": []interface{}{map[string]interface{}{"id": 3.0, "name": "Tools", "slug": "tools"}},
+        },
+        {
+            "tenant_id": otherTenant.String(), "id": 2.0, "name": "Gadget", "description": "", "price": 5.0,
+            "version": 1.0, "stock": 0.0, "created_at": "2025-03-01T12:00:00Z",
+        },
+    }
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("backup =\n%v\nwant\n%v", got, want)
+    }
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+    "bufio"
+    "log/slog"
+    "os"
+    "regexp"
+    "strings"
+    "sync/atomic"
+    "time"
+)
+
+// blockedWords holds the compiled content policy pattern. It is swapped
+// atomically on reload so validation never sees a half-loaded list; a nil
+// pattern means no words are blocked.
+var blockedWords atomic.Pointer[regexp.Regexp]
+
+// loadBlockedWords reads a newline-separated list of words or phrases and
+// compiles them into one case-insensitive, word-bounded pattern. Blank lines
+// and lines starting with # are ignored.
+func loadBlockedWords(path string) (*regexp.Regexp, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+
+    var alternatives []string
+    scanner := bufio.NewScanner(f)
+    for scanner.Scan() {
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        // Let any run of whitespace in a phrase match any other.
+        words := strings.Fields(line)
+        for i, word := range words {
+            words[i] = regexp.QuoteMeta(word)
+        }
+        alternatives = append(alternatives, strings.Join(words, `\s+`))
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, err
+    }
+    if len(alternatives) == 0 {
+        return nil, nil
+    }
+    return regexp.Compile(`(?i)\b(?:` + strings.Join(alternatives, "|") + `)\b`)
+}
+
+// watchBlockedWords reloads the blocked words file every interval. A file
+// that fails to load keeps the previous list in place.
+func watchBlockedWords(path string, interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for range ticker.C {
+        pattern, err := loadBlockedWords(path)
+        if err != nil {
+            slog.Error("error reloading blocked words", "path", path, "error", err)
+            continue
+        }
+        blockedWords.Store(pattern)
+    }
+}
+
+// containsBlockedWord reports whether text matches the content policy.
+func containsBlockedWord(text string) bool {
+    pattern := blockedWords.Load()
+    return pattern != nil && pattern.MatchString(text)
+}
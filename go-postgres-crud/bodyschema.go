@@ -0,0 +1,83 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "strings"
+
+    _ "embed"
+
+    "github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+var (
+    //go:embed schemas/item.create.json
+    itemCreateSchema []byte
+    //go:embed schemas/item.update.json
+    itemUpdateSchema []byte
+)
+
+// validateBody rejects a request whose JSON body does not match schema with
+// 422 and one violation per failed constraint, before the handler runs. The
+// body is rewound, so the handler decodes it as usual. A schema that does not
+// compile is a programming error and panics at route registration. XML bodies
+// are passed through; the handler's own validation covers them.
+func validateBody(schema []byte) func(http.Handler) http.Handler {
+    compiler := jsonschema.NewCompiler()
+    if err := compiler.AddResource("body.json", bytes.NewReader(schema)); err != nil {
+        panic(fmt.Sprintf("validateBody: %v", err))
+    }
+    compiled := compiler.MustCompile("body.json")
+
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if isXMLContentType(r.Header.Get("Content-Type")) {
+                next.ServeHTTP(w, r)
+                return
+            }
+            body, err := io.ReadAll(r.Body)
+            if err != nil {
+                handleError(w, r, bodyError(err, "Could not read request body"))
+                return
+            }
+            var doc interface{}
+            if err := json.Unmarshal(body, &doc); err != nil {
+                writeError(w, http.StatusBadRequest, "INVALID_BODY", "Request body is not valid JSON")
+                return
+            }
+            if err := compiled.Validate(doc); err != nil {
+                writeErrorDetails(w, http.StatusUnprocessableEntity, "SCHEMA_VIOLATION",
+                    "The request body does not match the schema", schemaViolations(err))
+                return
+            }
+            r.Body = io.NopCloser(bytes.NewReader(body))
+            next.ServeHTTP(w, r)
+        })
+    }
+}
+
+// schemaViolations flattens a schema error to its leaf causes. Field is the
+// dotted path of the offending value, empty for the body itself.
+func schemaViolations(err error) []fieldViolation {
+    validationErr, ok := err.(*jsonschema.ValidationError)
+    if !ok {
+        return []fieldViolation{{Message: err.Error()}}
+    }
+    var violations []fieldViolation
+    var walk func(e *jsonschema.ValidationError)
+    walk = func(e *jsonschema.ValidationError) {
+        if len(e.Causes) == 0 {
+            field := strings.ReplaceAll(strings.TrimPrefix(e.InstanceLocation, "/"), "/", ".")
+            violations = append(violations, fieldViolation{Field: field, Message: e.Message})
+            return
+        }
+        for _, cause := range e.Causes {
+            walk(cause)
+        }
+    }
+    walk(validationErr)
+    return violations
+}
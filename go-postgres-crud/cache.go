@@ -0,0 +1,53 @@
+package main
+
+import (
+    "time"
+
+    "github.com/google/uuid"
+    "github.com/hashicorp/golang-lru/v2/expirable"
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// itemCache holds GET /items/{id} results, bounded by CACHE_MAX_SIZE entries
+// and CACHE_TTL_SECONDS. Handlers that change an item evict it; the TTL
+// bounds staleness from writes made outside this process.
+var itemCache = newItemCache(1000, 60*time.Second)
+
+// cachedItemEntry remembers the tenant of a cached item, so it is only ever
+// served to that tenant.
+type cachedItemEntry struct {
+    tenantID uuid.UUID
+    item     Item
+}
+
+var itemCacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+    Name: "item_cache_requests_total",
+    Help: "Item cache lookups by GET /items/{id}, by result (hit or miss).",
+}, []string{"result"})
+
+func newItemCache(size int, ttl time.Duration) *expirable.LRU[int, cachedItemEntry] {
+    return expirable.NewLRU[int, cachedItemEntry](size, nil, ttl)
+}
+
+// cachedItem returns the cached item for id, when it belongs to tenantID, and
+// records the lookup.
+func cachedItem(tenantID uuid.UUID, id int) (Item, bool) {
+    entry, ok := itemCache.Get(id)
+    ok = ok && entry.tenantID == tenantID
+    if ok {
+        itemCacheRequests.WithLabelValues("hit").Inc()
+    } else {
+        itemCacheRequests.WithLabelValues("miss").Inc()
+    }
+    return entry.item, ok
+}
+
+// cacheItem stores item as tenantID's item for later GET /items/{id} requests.
+func cacheItem(tenantID uuid.UUID, item Item) {
+    itemCache.Add(item.ID, cachedItemEntry{tenantID: tenantID, item: item})
+}
+
+func evictItem(id int) {
+    itemCache.Remove(id)
+}
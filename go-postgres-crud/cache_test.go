@@ -0,0 +1,65 @@
+package main
+
+import (
+    "net/http"
+    "testing"
+
+    "github.com/golang-jwt/jwt/v5"
+    "github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestGetItemServedFromCache(t *testing.T) {
+    repo := storedItems(Item{ID: 1, Name: "Widget", Price: 9.99, Version: 1})
+    rt := newMockApp(t, repo)
+    hits := testutil.ToFloat64(itemCacheRequests.WithLabelValues("hit"))
+
+    for i := 0; i < 2; i++ {
+        if rec := doRequest(t, rt, http.MethodGet, "/items/1", nil, ""); rec.Code != http.StatusOK {
+            t.Fatalf("GET %d: status = %d, want 200", i+1, rec.Code)
+        }
+    }
+    if n := repo.CallCount("GetByID"); n != 1 {
+        t.Errorf("GetByID called %d times for two GETs, want 1", n)
+    }
+    if got := testutil.ToFloat64(itemCacheRequests.WithLabelValues("hit")) - hits; got != 1 {
+        t.Errorf("cache hits grew by %v, want 1", got)
+    }
+}
+
+func TestItemCacheEvictedOnWrite(t *testing.T) {
+    repo := storedItems(Item{ID: 1, Name: "Widget", Price: 9.99, Version: 1})
+    rt := newMockApp(t, repo)
+
+    doRequest(t, rt, http.MethodGet, "/items/1", nil, "")
+    rec := doRequest(t, rt, http.MethodPut, "/items/1", Item{Name: "Gadget", Price: 5, Version: 1}, testToken(t, nil))
+    if rec.Code != http.StatusNoContent {
+        t.Fatalf("PUT: status = %d, want 204: %s", rec.Code, rec.Body)
+    }
+    getsAfterUpdate := repo.CallCount("GetByID")
+    rec = doRequest(t, rt, http.MethodGet, "/items/1", nil, "")
+    var got Item
+    decodeBody(t, rec, &got)
+    if got.Name != "Gadget" {
+        t.Errorf("GET after PUT served %q, want the updated name", got.Name)
+    }
+
+    doRequest(t, rt, http.MethodDelete, "/items/1", nil, testToken(t, nil))
+    if rec := doRequest(t, rt, http.MethodGet, "/items/1", nil, ""); rec.Code != http.StatusNotFound {
+        t.Errorf("GET after DELETE: status = %d, want 404 rather than the cached item", rec.Code)
+    }
+    if n := repo.CallCount("GetByID"); n <= getsAfterUpdate {
+        t.Errorf("GetByID calls = %d after the writes, want the reads to reach the repository", n)
+    }
+}
+
+func TestItemCacheIsPerTenant(t *testing.T) {
+    repo := storedItems(Item{ID: 1, Name: "Widget", Price: 9.99, Version: 1})
+    rt := newMockApp(t, repo)
+
+    doRequest(t, rt, http.MethodGet, "/items/1", nil, "")
+    other := testToken(t, jwt.MapClaims{"tenant_id": "7d444840-9dc0-11d1-b245-5ffdce74fad2"})
+    doRequest(t, rt, http.MethodGet, "/items/1", nil, other)
+    if n := repo.CallCount("GetByID"); n != 2 {
+        t.Errorf("GetByID called %d times, want the other tenant's read to miss the cache", n)
+    }
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "regexp"
+    "strings"
+    "unicode/utf8"
+
+    "github.com/google/uuid"
+    "github.com/lib/pq"
+    "github.com/prometheus/client_golang/prometheus"
+    "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+type Category struct {
+    ID   int    `json:"id" xml:"id"`
+    Name string `json:"name" xml:"name"`
+    Slug string `json:"slug" xml:"slug"`
+    // ParentID is only read and listed by the /categories routes; the
+    // categories of an item leave it out.
+    ParentID *int `json:"parent_id,omitempty" xml:"parent_id,omitempty"`
+}
+
+// maxCategoryDepth bounds how many levels GET /categories/tree and
+// /categories/{id}/ancestors walk, the root being level 1.
+const maxCategoryDepth = 10
+
+// categoryNode is a category with its subcategories, as GET /categories/tree
+// nests them.
+type categoryNode struct {
+    Category
+    Children []*categoryNode `json:"children"`
+}
+
+// categorySlugPattern allows lowercase letters and digits in groups separated
+// by single hyphens, so slugs can be used in URLs unescaped.
+var categorySlugPattern = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+
+var errUnknownCategory = errors.New("unknown category")
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+    QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func createCategory(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "createCategory", tracer.ResourceName("INSERT INTO categories"))
+    defer span.Finish()
+
+    var category Category
+    err := json.NewDecoder(r.Body).Decode(&category)
+    if err != nil {
+        writeBodyError(w, err, "Request body is not valid JSON")
+        return
+    }
+    category.Name = strings.TrimSpace(category.Name)
+
+    var violations validationErrors
+    if category.Name == "" {
+        violations = append(violations, fieldViolation{Field: "name", Message: "must not be empty"})
+    } else if utf8.RuneCountInString(category.Name) > maxNameLength {
+        violations = append(violations, fieldViolation{Field: "name", Message: fmt.Sprintf("must be at most %d characters", maxNameLength)})
+    }
+    if !categorySlugPattern.MatchString(category.Slug) || len(category.Slug) > maxNameLength {
+        violations = append(violations, fieldViolation{Field: "slug", Message: "must be lowercase letters and digits separated by hyphens"})
+    }
+    if len(violations) > 0 {
+        writeValidationError(w, violations)
+        return
+    }
+
+    sqlStatement := `INSERT INTO categories (name, slug, parent_id) VALUES ($1, $2, $3) RETURNING id`
+    err = db.QueryRowContext(ctx, sqlStatement, category.Name, category.Slug, category.ParentID).Scan(&category.ID)
+    var pqErr *pq.Error
+    if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+        writeError(w, http.StatusConflict, "SLUG_TAKEN", "A category with this slug already exists")
+        return
+    }
+    if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+        writeError(w, http.StatusBadRequest, "UNKNOWN_CATEGORY", "parent_id is not a category")
+        return
+    }
+    if err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+
+    writeJSON(w, http.StatusCreated, category)
+}
+
+func getCategories(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "getCategories", tracer.ResourceName("SELECT id, name, slug, parent_id FROM categories"))
+    defer span.Finish()
+
+    rows, err := queryRead(r, `SELECT id, name, slug, parent_id FROM categories ORDER BY name, id`)
+    if err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+    defer rows.Close()
+
+    categories := []Category{}
+    for rows.Next() {
+        var category Category
+        if err := rows.Scan(&category.ID, &category.Name, &category.Slug, &category.ParentID); err != nil {
+            writeInternalError(w, r, err)
+            return
+        }
+        categories = append(categories, category)
+    }
+    if err := rows.Err(); err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+
+    writeJSON(w, http.StatusOK, categories)
+}
+
+// getCategoryTree lists the top-level categories with their subcategories
+// nested under them, each level ordered by name, down to maxCategoryDepth
+// levels.
+func getCategoryTree(w http.ResponseWriter, r *http.Request) error {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "getCategoryTree", tracer.ResourceName("WITH RECURSIVE category_tree"))
+    defer span.Finish()
+
+    rows, err := queryRead(r, `WITH RECURSIVE category_tree AS (
+            SELECT id, name, slug, parent_id, 1 AS depth FROM categories WHERE parent_id IS NULL
+            UNION ALL
+            SELECT c.id, c.name, c.slug, c.parent_id, t.depth + 1
+            FROM categories c JOIN category_tree t ON c.parent_id = t.id
+            WHERE t.depth < $1
+        )
+        SELECT id, name, slug, parent_id FROM category_tree ORDER BY depth, name, id`, maxCategoryDepth)
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+
+    // Parents come before their children, so every parent is in byID by the
+    // time its children are read.
+    roots := []*categoryNode{}
+    byID := map[int]*categoryNode{}
+    for rows.Next() {
+        node := &categoryNode{Children: []*categoryNode{}}
+        if err := rows.Scan(&node.ID, &node.Name, &node.Slug, &node.ParentID); err != nil {
+            return err
+        }
+        byID[node.ID] = node
+        if node.ParentID == nil {
+            roots = append(roots, node)
+        } else if parent, ok := byID[*node.ParentID]; ok {
+            parent.Children = append(parent.Children, node)
+        }
+    }
+    if err := rows.Err(); err != nil {
+        return err
+    }
+
+    writeJSON(w, http.StatusOK, roots)
+    return nil
+}
+
+// getCategoryAncestors returns the path from the top-level category down to
+// the category itself, at most maxCategoryDepth categories long.
+func getCategoryAncestors(w http.ResponseWriter, r *http.Request) error {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "getCategoryAncestors", tracer.ResourceName("WITH RECURSIVE ancestors"))
+    defer span.Finish()
+
+    id, err := parseItemID(r.PathValue("id"))
+    if err != nil {
+        return &ValidationError{Code: "INVALID_ID", Message: "Invalid category ID"}
+    }
+
+    rows, err := queryRead(r, `WITH RECURSIVE ancestors AS (
+            SELECT id, name, slug, parent_id, 1 AS depth FROM categories WHERE id = $1
+            UNION ALL
+            SELECT c.id, c.name, c.slug, c.parent_id, a.depth + 1
+            FROM categories c JOIN ancestors a ON c.id = a.parent_id
+            WHERE a.depth < $2
+        )
+        SELECT id, name, slug, parent_id FROM ancestors ORDER BY depth DESC`, id, maxCategoryDepth)
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+
+    path := []Category{}
+    for rows.Next() {
+        var category Category
+        if err := rows.Scan(&category.ID, &category.Name, &category.Slug, &category.ParentID); err != nil {
+            return err
+        }
+        path = append(path, category)
+    }
+    if err := rows.Err(); err != nil {
+        return err
+    }
+    if len(path) == 0 {
+        return &NotFoundError{Resource: "Category"}
+    }
+
+    writeJSON(w, http.StatusOK, path)
+    return nil
+}
+
+// setItemCategories replaces the categories of an item. It returns
+// errUnknownCategory when an ID does not exist.
+func setItemCategories(ctx context.Context, tx *sql.Tx, itemID int, categoryIDs []int) error {
+    if _, err := tx.ExecContext(ctx, `DELETE FROM item_categories WHERE item_id = $1`, itemID); err != nil {
+        return err
+    }
+    if len(categoryIDs) == 0 {
+        return nil
+    }
+    ids := make([]int64, len(categoryIDs))
+    for i, id := range categoryIDs {
+        ids[i] = int64(id)
+    }
+    _, err := tx.ExecContext(ctx, `INSERT INTO item_categories (item_id, category_id)
+        SELECT $1, unnest($2::int[]) ON CONFLICT DO NOTHING`, itemID, pq.Array(ids))
+    var pqErr *pq.Error
+    if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+        return errUnknownCategory
+    }
+    return err
+}
+
+// attachCategories loads the categories of items in one query and sets them
+// on each item.
+func attachCategories(ctx context.Context, q queryer, items []Item) error {
+    if len(items) == 0 {
+        return nil
+    }
+    ids := make([]int64, len(items))
+    for i, item := range items {
+        ids[i] = int64(item.ID)
+    }
+    rows, err := q.QueryContext(ctx, `SELECT ic.item_id, c.id, c.name, c.slug
+        FROM item_categories ic JOIN categories c ON c.id = ic.category_id
+        WHERE ic.item_id = ANY($1) ORDER BY c.name, c.id`, pq.Array(ids))
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+
+    byItem := map[int][]Category{}
+    for rows.Next() {
+        var itemID int
+        var category Category
+        if err := rows.Scan(&itemID, &category.ID, &category.Name, &category.Slug); err != nil {
+            return err
+        }
+        byItem[itemID] = append(byItem[itemID], category)
+    }
+    if err := rows.Err(); err != nil {
+        return err
+    }
+    for i := range items {
+        items[i].Categories = byItem[items[i].ID]
+    }
+    return nil
+}
+
+// The ?cascade policies of DELETE /categories/{id}: refuse while live items
+// are in the category, move its items to another category first, or
+// soft-delete them along with it.
+const (
+    categoryDeleteError = "error"
+    categoryDeleteMove  = "move"
+    categoryDeleteItems = "items"
+)
+
+// categoryDeletion is the response of DELETE /categories/{id}.
+type categoryDeletion struct {
+    ID            int    `json:"id"`
+    Cascade       string `json:"cascade"`
+    AffectedItems int    `json:"affected_items"`
+}
+
+// deleteCategory deletes a category under the policy named by ?cascade, in a
+// single transaction. Categories are shared by every tenant, so the route is
+// for admins, and cascade=items soft-deletes the category's items of every
+// tenant.
+func deleteCategory(w http.ResponseWriter, r *http.Request) error {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "deleteCategory", tracer.ResourceName("DELETE FROM categories WHERE id = $1"))
+    defer span.Finish()
+
+    id, err := parseItemID(r.PathValue("id"))
+    if err != nil {
+        return &ValidationError{Code: "INVALID_ID", Message: "Invalid category ID"}
+    }
+    policy := r.URL.Query().Get("cascade")
+    var targetID int
+    switch policy {
+    case categoryDeleteError, categoryDeleteItems:
+    case categoryDeleteMove:
+        targetID, err = parseItemID(r.URL.Query().Get("target_category_id"))
+        if err != nil {
+            return &ValidationError{Code: "INVALID_QUERY", Message: "cascade=move needs a valid target_category_id"}
+        }
+        if targetID == id {
+            return &ValidationError{Code: "INVALID_QUERY", Message: "target_category_id must differ from the deleted category"}
+        }
+    default:
+        return &ValidationError{Code: "INVALID_QUERY", Message: "cascade must be one of error, move or items"}
+    }
+
+    tx, err := db.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    // The lock makes a concurrent write that puts an item in the category
+    // wait, so no item slips in between the policy and the delete.
+    err = tx.QueryRowContext(ctx, `SELECT id FROM categories WHERE id = $1 FOR UPDATE`, id).Scan(&id)
+    if err == sql.ErrNoRows {
+        return &NotFoundError{Resource: "Category"}
+    }
+    if err != nil {
+        return err
+    }
+
+    result := categoryDeletion{ID: id, Cascade: policy}
+    var deleted []deletedCategoryItem
+    var moved []int
+    switch policy {
+    case categoryDeleteError:
+        err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM item_categories ic JOIN items i ON i.id = ic.item_id
+            WHERE ic.category_id = $1 AND i.deleted_at IS NULL`, id).Scan(&result.AffectedItems)
+        if err != nil {
+            return err
+        }
+        if result.AffectedItems > 0 {
+            return &ConflictError{Code: "CATEGORY_IN_USE", Message: fmt.Sprintf("%d live items are in this category", result.AffectedItems)}
+        }
+    case categoryDeleteMove:
+        moved, err = moveCategoryItems(ctx, tx, id, targetID)
+        result.AffectedItems = len(moved)
+    case categoryDeleteItems:
+        deleted, err = deleteCategoryItems(ctx, tx, id)
+        result.AffectedItems = len(deleted)
+    }
+    if err != nil {
+        return err
+    }
+
+    // Deleting the category drops its remaining item_categories rows.
+    if _, err := tx.ExecContext(ctx, `DELETE FROM categories WHERE id = $1`, id); err != nil {
+        return err
+    }
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+
+    for _, itemID := range moved {
+        evictItem(itemID)
+    }
+    evictItemLists()
+    for _, item := range deleted {
+        evictItem(item.ID)
+        notifyItemChange(withTenant(ctx, item.TenantID), eventItemDeleted, item.Item)
+    }
+    requestLogger(ctx).Info("category deleted", "category_id", id, "cascade", policy, "target_category_id", targetID, "affected_items", result.AffectedItems)
+
+    writeJSON(w, http.StatusOK, result)
+    return nil
+}
+
+// moveCategoryItems puts every item of category from, live or deleted, in
+// category to instead, and returns their IDs.
+func moveCategoryItems(ctx context.Context, tx *sql.Tx, from, to int) ([]int, error) {
+    err := tx.QueryRowContext(ctx, `SELECT id FROM categories WHERE id = $1 FOR SHARE`, to).Scan(&to)
+    if err == sql.ErrNoRows {
+        return nil, &ValidationError{Code: "UNKNOWN_CATEGORY", Message: "target_category_id does not exist"}
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    _, err = tx.ExecContext(ctx, `INSERT INTO item_categories (item_id, category_id)
+        SELECT item_id, $2 FROM item_categories WHERE category_id = $1 ON CONFLICT DO NOTHING`, from, to)
+    if err != nil {
+        return nil, err
+    }
+    rows, err := tx.QueryContext(ctx, `DELETE FROM item_categories WHERE category_id = $1 RETURNING item_id`, from)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    var ids []int
+    for rows.Next() {
+        var id int
+        if err := rows.Scan(&id); err != nil {
+            return nil, err
+        }
+        ids = append(ids, id)
+    }
+    return ids, rows.Err()
+}
+
+// deletedCategoryItem is an item soft-deleted with its category, with the
+// tenant its change notification goes to.
+type deletedCategoryItem struct {
+    Item
+    TenantID uuid.UUID
+}
+
+// deleteCategoryItems soft-deletes the live items of a category and records
+// their audit entries. An item reserved by someone other than the caller
+// fails the whole deletion with errItemReserved, as a single delete would.
+func deleteCategoryItems(ctx context.Context, tx *sql.Tx, categoryID int) ([]deletedCategoryItem, error) {
+    var reserved bool
+    err := tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM items i JOIN item_categories ic ON ic.item_id = i.id
+        WHERE ic.category_id = $1 AND i.deleted_at IS NULL AND i.reserved_until > NOW() AND i.reserved_by IS DISTINCT FROM $2)`,
+        categoryID, userIDFromContext(ctx)).Scan(&reserved)
+    if err != nil {
+        return nil, err
+    }
+    if reserved {
+        return nil, errItemReserved
+    }
+
+    // None of the returned columns change on delete, so they serve as the
+    // audited before-state.
+    timer := prometheus.NewTimer(dbQueryDuration.WithLabelValues("delete"))
+    rows, err := tx.QueryContext(ctx, `UPDATE items SET deleted_at = NOW()
+        WHERE deleted_at IS NULL AND id IN (SELECT item_id FROM item_categories WHERE category_id = $1)
+        RETURNING id, name, description, price, version, tenant_id`, categoryID)
+    timer.ObserveDuration()
+    if err != nil {
+        return nil, err
+    }
+    var deleted []deletedCategoryItem
+    for rows.Next() {
+        var item deletedCategoryItem
+        if err := rows.Scan(&item.ID, &item.Name, &item.Description, &item.Price, &item.Version, &item.TenantID); err != nil {
+            rows.Close()
+            return nil, err
+        }
+        deleted = append(deleted, item)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+    for _, item := range deleted {
+        if err := recordAudit(ctx, tx, item.ID, auditDelete, item.Item, nil); err != nil {
+            return nil, err
+        }
+    }
+    return deleted, nil
+}
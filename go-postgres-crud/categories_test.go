@@ -0,0 +1,222 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/DATA-DOG/go-sqlmock"
+    "github.com/golang-jwt/jwt/v5"
+    "github.com/google/uuid"
+    "github.com/lib/pq"
+)
+
+// deleteCategoryRequest sends DELETE /categories/3 with query as an admin.
+func deleteCategoryRequest(t *testing.T, query string) *httptest.ResponseRecorder {
+    t.Helper()
+    rt := newTestRouter(NewApp(storedItems(), nil, NewFeatureFlags(nil), nil))
+    return doRequest(t, rt, http.MethodDelete, "/categories/3"+query, nil, testToken(t, jwt.MapClaims{"role": "admin"}))
+}
+
+func expectCategoryLock(mock sqlmock.Sqlmock) {
+    mock.ExpectBegin()
+    mock.ExpectQuery(`SELECT id FROM categories WHERE id = \$1 FOR UPDATE`).WithArgs(3).
+        WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+}
+
+func TestDeleteCategoryRefusesWhileInUse(t *testing.T) {
+    mock := mockDB(t)
+    expectCategoryLock(mock)
+    mock.ExpectQuery(`SELECT COUNT\(\*\) FROM item_categories`).WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+    mock.ExpectRollback()
+
+    rec := deleteCategoryRequest(t, "?cascade=error")
+    if rec.Code != http.StatusConflict || errorCode(t, rec) != "CATEGORY_IN_USE" {
+        t.Errorf("status %d, body %s; want 409 CATEGORY_IN_USE", rec.Code, rec.Body)
+    }
+}
+
+func TestDeleteCategoryUnused(t *testing.T) {
+    mock := mockDB(t)
+    expectCategoryLock(mock)
+    mock.ExpectQuery(`SELECT COUNT\(\*\) FROM item_categories`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+    mock.ExpectExec(`DELETE FROM categories WHERE id = \$1`).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+    mock.ExpectCommit()
+
+    var got categoryDeletion
+    rec := deleteCategoryRequest(t, "?cascade=error")
+    decodeBody(t, rec, &got)
+    if rec.Code != http.StatusOK || got != (categoryDeletion{ID: 3, Cascade: "error"}) {
+        t.Errorf("status %d, body %+v; want 200 with no affected items", rec.Code, got)
+    }
+}
+
+func TestDeleteCategoryMove(t *testing.T) {
+    mock := mockDB(t)
+    expectCategoryLock(mock)
+    mock.ExpectQuery(`SELECT id FROM categories WHERE id = \$1 FOR SHARE`).WithArgs(5).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+    mock.ExpectExec(`INSERT INTO item_categories \(item_id, category_id\)\s+SELECT item_id, \$2 FROM item_categories WHERE category_id = \$1`).
+        WithArgs(3, 5).WillReturnResult(sqlmock.NewResult(0, 2))
+    mock.ExpectQuery(`DELETE FROM item_categories WHERE category_id = \$1 RETURNING item_id`).WithArgs(3).
+        WillReturnRows(sqlmock.NewRows([]string{"item_id"}).AddRow(1).AddRow(2))
+    mock.ExpectExec(`DELETE FROM categories`).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+    mock.ExpectCommit()
+
+    var got categoryDeletion
+    rec := deleteCategoryRequest(t, "?cascade=move&target_category_id=5")
+    decodeBody(t, rec, &got)
+    if rec.Code != http.StatusOK || got != (categoryDeletion{ID: 3, Cascade: "move", AffectedItems: 2}) {
+        t.Fatalf("status %d, body %+v; want 200 with two items moved", rec.Code, got)
+    }
+
+    t.Run("unknown target", func(t *testing.T) {
+        mock := mockDB(t)
+        expectCategoryLock(mock)
+        mock.ExpectQuery(`FOR SHARE`).WithArgs(9).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+        mock.ExpectRollback()
+        rec := deleteCategoryRequest(t, "?cascade=move&target_category_id=9")
+        if rec.Code != http.StatusBadRequest || errorCode(t, rec) != "UNKNOWN_CATEGORY" {
+            t.Errorf("status %d, body %s; want 400 UNKNOWN_CATEGORY", rec.Code, rec.Body)
+        }
+    })
+}
+
+func TestDeleteCategoryItems(t *testing.T) {
+    mock := mockDB(t)
+    tenantID := uuid.New()
+    expectCategoryLock(mock)
+    mock.ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM items i JOIN item_categories`).WithArgs(3, "test-user").
+        WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+    mock.ExpectQuery(`UPDATE items SET deleted_at = NOW\(\)`).WithArgs(3).
+        WillReturnRows(sqlmock.NewRows([]string{"id", "name", "description", "price", "version", "tenant_id"}).AddRow(4, "Drill", "", 30.0, 2, tenantID))
+    mock.ExpectExec(`INSERT INTO audit_logs`).WithArgs(4, "test-user", auditDelete, sqlmock.AnyArg(), nil).WillReturnResult(sqlmock.NewResult(1, 1))
+    mock.ExpectExec(`DELETE FROM categories`).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+    mock.ExpectCommit()
+    // The deletion is announced to the item's tenant.
+    mock.ExpectQuery(`FROM webhooks`).WithArgs(eventItemDeleted, tenantID).WillReturnRows(sqlmock.NewRows([]string{"id", "url", "secret"}))
+
+    var got categoryDeletion
+    rec := deleteCategoryRequest(t, "?cascade=items")
+    decodeBody(t, rec, &got)
+    if rec.Code != http.StatusOK || got.AffectedItems != 1 {
+        t.Fatalf("status %d, body %+v; want 200 with one item deleted", rec.Code, got)
+    }
+    awaitExpectations(t, mock)
+
+    t.Run("reserved item", func(t *testing.T) {
+        mock := mockDB(t)
+        expectCategoryLock(mock)
+        mock.ExpectQuery(`SELECT EXISTS`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+        mock.ExpectRollback()
+        rec := deleteCategoryRequest(t, "?cascade=items")
+        if rec.Code != http.StatusConflict || errorCode(t, rec) != "ITEM_RESERVED" {
+            t.Errorf("status %d, body %s; want 409 ITEM_RESERVED", rec.Code, rec.Body)
+        }
+    })
+}
+
+func TestDeleteCategoryInvalid(t *testing.T) {
+    tests := []struct {
+        name   string
+        target string
+        token  string
+        status int
+    }{
+        {"no policy", "/categories/3", "admin", http.StatusBadRequest},
+        {"unknown policy", "/categories/3?cascade=all", "admin", http.StatusBadRequest},
+        {"move without target", "/categories/3?cascade=move", "admin", http.StatusBadRequest},
+        {"move to itself", "/categories/3?cascade=move&target_category_id=3", "admin", http.StatusBadRequest},
+        {"invalid ID", "/categories/abc?cascade=error", "admin", http.StatusBadRequest},
+        {"not an admin", "/categories/3?cascade=error", "editor", http.StatusForbidden},
+    }
+    // None of these reach the database.
+    mockDB(t)
+    rt := newTestRouter(NewApp(storedItems(), nil, NewFeatureFlags(nil), nil))
+    for _, tt := range tests {
+        rec := doRequest(t, rt, http.MethodDelete, tt.target, nil, testToken(t, jwt.MapClaims{"role": tt.token}))
+        if rec.Code != tt.status {
+            t.Errorf("%s: status %d, body %s; want %d", tt.name, rec.Code, rec.Body, tt.status)
+        }
+    }
+
+    t.Run("missing", func(t *testing.T) {
+        mock := mockDB(t)
+        mock.ExpectBegin()
+        mock.ExpectQuery(`FOR UPDATE`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+        mock.ExpectRollback()
+        if rec := deleteCategoryRequest(t, "?cascade=error"); rec.Code != http.StatusNotFound {
+            t.Errorf("status %d, body %s; want 404", rec.Code, rec.Body)
+        }
+    })
+}
+
+var categoryColumns = []string{"id", "name", "slug", "parent_id"}
+
+func TestGetCategoryTree(t *testing.T) {
+    mock := mockDB(t)
+    rt := newTestRouter(NewApp(storedItems(), nil, NewFeatureFlags(nil), nil))
+
+    mock.ExpectQuery(`WITH RECURSIVE category_tree AS .* WHERE t.depth < \$1`).WithArgs(maxCategoryDepth).
+        WillReturnRows(sqlmock.NewRows(categoryColumns).
+            AddRow(1, "Electronics", "electronics", nil).
+            AddRow(4, "Garden", "garden", nil).
+            AddRow(2, "Phones", "phones", 1).
+            AddRow(3, "Android", "android", 2))
+    rec := doRequest(t, rt, http.MethodGet, "/categories/tree", nil, "")
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status %d, body %s; want 200", rec.Code, rec.Body)
+    }
+    var roots []categoryNode
+    decodeBody(t, rec, &roots)
+    if len(roots) != 2 || roots[0].Name != "Electronics" || len(roots[1].Children) != 0 {
+        t.Fatalf("roots = %s, want Electronics and a childless Garden", rec.Body)
+    }
+    phones := roots[0].Children
+    if len(phones) != 1 || phones[0].ID != 2 || len(phones[0].Children) != 1 || phones[0].Children[0].Name != "Android" {
+        t.Errorf("Electronics children = %s, want Phones > Android", rec.Body)
+    }
+}
+
+func TestGetCategoryAncestors(t *testing.T) {
+    mock := mockDB(t)
+    rt := newTestRouter(NewApp(storedItems(), nil, NewFeatureFlags(nil), nil))
+
+    mock.ExpectQuery(`WITH RECURSIVE ancestors AS .* ORDER BY depth DESC`).WithArgs(3, maxCategoryDepth).
+        WillReturnRows(sqlmock.NewRows(categoryColumns).
+            AddRow(1, "Electronics", "electronics", nil).
+            AddRow(2, "Phones", "phones", 1).
+            AddRow(3, "Android", "android", 2))
+    rec := doRequest(t, rt, http.MethodGet, "/categories/3/ancestors", nil, "")
+    var path []Category
+    decodeBody(t, rec, &path)
+    if rec.Code != http.StatusOK || len(path) != 3 || path[0].ID != 1 || path[2].ID != 3 || *path[2].ParentID != 2 {
+        t.Errorf("status %d, body %s; want Electronics > Phones > Android", rec.Code, rec.Body)
+    }
+
+    mock.ExpectQuery(`WITH RECURSIVE ancestors`).WillReturnRows(sqlmock.NewRows(categoryColumns))
+    if rec := doRequest(t, rt, http.MethodGet, "/categories/9/ancestors", nil, ""); rec.Code != http.StatusNotFound {
+        t.Errorf("missing category: status %d, want 404", rec.Code)
+    }
+    if rec := doRequest(t, rt, http.MethodGet, "/categories/x/ancestors", nil, ""); rec.Code != http.StatusBadRequest {
+        t.Errorf("invalid ID: status %d, want 400", rec.Code)
+    }
+}
+
+func TestCreateCategoryWithParent(t *testing.T) {
+    mock := mockDB(t)
+    rt := newTestRouter(NewApp(storedItems(), nil, NewFeatureFlags(nil), nil))
+
+    mock.ExpectQuery(`INSERT INTO categories \(name, slug, parent_id\)`).WithArgs("Phones", "phones", 1).
+        WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+    body := map[string]interface{}{"name": "Phones", "slug": "phones", "parent_id": 1}
+    if rec := doRequest(t, rt, http.MethodPost, "/categories", body, testToken(t, nil)); rec.Code != http.StatusCreated {
+        t.Errorf("status %d, body %s; want 201", rec.Code, rec.Body)
+    }
+
+    mock.ExpectQuery(`INSERT INTO categories`).WillReturnError(&pq.Error{Code: "23503"})
+    body["parent_id"] = 99
+    rec := doRequest(t, rt, http.MethodPost, "/categories", body, testToken(t, nil))
+    if rec.Code != http.StatusBadRequest || errorCode(t, rec) != "UNKNOWN_CATEGORY" {
+        t.Errorf("unknown parent: status %d, body %s; want 400 UNKNOWN_CATEGORY", rec.Code, rec.Body)
+    }
+}
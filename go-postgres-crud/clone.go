@@ -0,0 +1,91 @@
+package main
+
+import (
+    "database/sql"
+    "encoding/json"
+    "io"
+    "net/http"
+
+    "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// copySuffix is appended to the name of a duplicate whose body does not set
+// one, so the copy does not collide with the unique name index.
+const copySuffix = " (copy)"
+
+// duplicateOverrides holds the optional body of POST /items/{id}/duplicate.
+// Nil fields are copied from the source item.
+type duplicateOverrides struct {
+    Name        *string   `json:"name"`
+    Description *string   `json:"description"`
+    Price       *float64  `json:"price"`
+    Metadata    *Metadata `json:"metadata"`
+    CategoryIDs *[]int    `json:"category_ids"`
+}
+
+// duplicateItem creates a new item from the fields of an existing one, with
+// any overrides from the body applied. The copy starts at version 1 with its
+// own audit history; the image is not copied.
+func (app *App) duplicateItem(w http.ResponseWriter, r *http.Request) error {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "duplicateItem", tracer.ResourceName("INSERT INTO items"))
+    defer span.Finish()
+
+    id, err := parseItemID(r.PathValue("id"))
+    if err != nil {
+        return &ValidationError{Code: "INVALID_ID", Message: "Invalid item ID"}
+    }
+
+    var overrides duplicateOverrides
+    err = json.NewDecoder(r.Body).Decode(&overrides)
+    if err != nil && err != io.EOF {
+        return bodyError(err, "Request body is not valid JSON")
+    }
+
+    tenantID := tenantFromContext(ctx)
+    source, err := app.items.GetByID(ctx, tenantID, id)
+    if err == sql.ErrNoRows {
+        return &NotFoundError{Resource: "Item"}
+    }
+    if err != nil {
+        return err
+    }
+
+    item := Item{
+        Name:        source.Name + copySuffix,
+        Description: source.Description,
+        Price:       source.Price,
+        Metadata:    source.Metadata,
+        CategoryIDs: []int{},
+    }
+    for _, category := range source.Categories {
+        item.CategoryIDs = append(item.CategoryIDs, category.ID)
+    }
+    if overrides.Name != nil {
+        item.Name = *overrides.Name
+    }
+    if overrides.Description != nil {
+        item.Description = *overrides.Description
+    }
+    if overrides.Price != nil {
+        item.Price = *overrides.Price
+    }
+    if overrides.Metadata != nil {
+        item.Metadata = *overrides.Metadata
+    }
+    if overrides.CategoryIDs != nil {
+        item.CategoryIDs = *overrides.CategoryIDs
+    }
+    if err := validateItem(ctx, item); err != nil {
+        return err
+    }
+
+    item, err = app.items.Create(ctx, tenantID, item, "")
+    if err != nil {
+        return err
+    }
+    notifyItemChange(ctx, eventItemCreated, item)
+
+    writeJSON(w, http.StatusCreated, item)
+    return nil
+}
@@ -0,0 +1,163 @@
+// Command changelog prints the release notes for a range of git tags as a
+// Markdown section, grouping commits by their conventional-commit type:
+//
+//    go run ./cmd/changelog --from v1.2.0 --to v1.3.0 --output CHANGELOG-v1.3.0.md
+//
+// Without --from the range starts at the tag before --to.
+package main
+
+import (
+    "bytes"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "os/exec"
+    "regexp"
+    "strings"
+    "time"
+)
+
+// sections lists the commit types that get their own heading, in the order
+// they are printed. Commits of any other type, or without one, go under
+// "Other changes".
+var sections = []struct {
+    kind  string
+    title string
+}{
+    {"feat", "Features"},
+    {"fix", "Bug fixes"},
+    {"perf", "Performance"},
+    {"refactor", "Refactoring"},
+}
+
+// conventionalSubject matches "type(scope)!: description"; scope and the
+// breaking-change marker are optional.
+var conventionalSubject = regexp.MustCompile(`^([a-z]+)(?:\(([^)]*)\))?(!)?: (.+)$`)
+
+type commit struct {
+    hash    string
+    kind    string
+    scope   string
+    subject string
+}
+
+func main() {
+    if err := run(os.Args[1:]); err != nil {
+        fmt.Fprintln(os.Stderr, "changelog:", err)
+        os.Exit(1)
+    }
+}
+
+func run(args []string) error {
+    flags := flag.NewFlagSet("changelog", flag.ContinueOnError)
+    from := flags.String("from", "", "tag the range starts after; defaults to the tag before --to")
+    to := flags.String("to", "HEAD", "tag or revision the range ends at")
+    output := flags.String("output", "", "file to write the changelog to; defaults to stdout")
+    if err := flags.Parse(args); err == flag.ErrHelp {
+        return nil
+    } else if err != nil {
+        return err
+    }
+
+    if *from == "" {
+        previous, err := git("describe", "--tags", "--abbrev=0", *to+"^")
+        if err != nil {
+            return fmt.Errorf("finding the tag before %s (pass --from): %w", *to, err)
+        }
+        *from = strings.TrimSpace(previous)
+    }
+    log, err := git("log", "--oneline", "--no-decorate", *from+".."+*to)
+    if err != nil {
+        return err
+    }
+
+    var out io.Writer = os.Stdout
+    if *output != "" {
+        file, err := os.Create(*output)
+        if err != nil {
+            return err
+        }
+        defer file.Close()
+        out = file
+    }
+    _, err = io.WriteString(out, formatChangelog(*to, time.Now(), parseCommits(log)))
+    return err
+}
+
+// git runs git with args and returns its standard output. A failure carries
+// git's own error message.
+func git(args ...string) (string, error) {
+    var stdout, stderr bytes.Buffer
+    cmd := exec.Command("git", args...)
+    cmd.Stdout = &stdout
+    cmd.Stderr = &stderr
+    if err := cmd.Run(); err != nil {
+        if msg := strings.TrimSpace(stderr.String()); msg != "" {
+            return "", fmt.Errorf("git %s: %s", args[0], msg)
+        }
+        return "", fmt.Errorf("git %s: %w", args[0], err)
+    }
+    return stdout.String(), nil
+}
+
+// parseCommits reads the lines of git log --oneline.
+func parseCommits(log string) []commit {
+    var commits []commit
+    for _, line := range strings.Split(log, "\n") {
+        hash, subject, ok := strings.Cut(strings.TrimSpace(line), " ")
+        if !ok {
+            continue
+        }
+        c := commit{hash: hash, subject: subject}
+        if m := conventionalSubject.FindStringSubmatch(subject); m != nil {
+            c.kind, c.scope, c.subject = m[1], m[2], m[4]
+            if m[3] != "" {
+                c.subject = "**BREAKING:** " + c.subject
+            }
+        }
+        commits = append(commits, c)
+    }
+    return commits
+}
+
+func formatChangelog(version string, date time.Time, commits []commit) string {
+    grouped := map[string][]commit{}
+    for _, c := range commits {
+        grouped[c.kind] = append(grouped[c.kind], c)
+    }
+
+    var b strings.Builder
+    fmt.Fprintf(&b, "## %s (%s)\n", version, date.Format("2006-01-02"))
+    if len(commits) == 0 {
+        b.WriteString("\nNo changes.\n")
+        return b.String()
+    }
+    var other []commit
+    known := map[string]bool{}
+    for _, section := range sections {
+        known[section.kind] = true
+        writeSection(&b, section.title, grouped[section.kind])
+    }
+    for _, c := range commits {
+        if !known[c.kind] {
+            other = append(other, c)
+        }
+    }
+    writeSection(&b, "Other changes", other)
+    return b.String()
+}
+
+func writeSection(b *strings.Builder, title string, commits []commit) {
+    if len(commits) == 0 {
+        return
+    }
+    fmt.Fprintf(b, "\n### %s\n\n", title)
+    for _, c := range commits {
+        if c.scope != "" {
+            fmt.Fprintf(b, "- **%s:** %s (%s)\n", c.scope, c.subject, c.hash)
+        } else {
+            fmt.Fprintf(b, "- %s (%s)\n", c.subject, c.hash)
+        }
+    }
+}
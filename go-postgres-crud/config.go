@@ -0,0 +1,256 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "net/url"
+    "os"
+    "strconv"
+    "strings"
+)
+
+// appEnv is APP_ENV: "production" (the default) or "development".
+var appEnv = "production"
+
+// Database connection defaults, overridden by DB_HOST, DB_PORT, DB_USER and
+// DB_NAME. DB_PASSWORD has no default and must always be set.
+const (
+    defaultDBHost = "localhost"
+    defaultDBPort = 5432
+    defaultDBUser = "go_user"
+    defaultDBName = "go_crud"
+)
+
+// dbname is the database the server connects to, from DB_NAME.
+var dbname = defaultDBName
+
+// dbSettings is the database configuration from DB_HOST, DB_PORT, DB_USER,
+// DB_PASSWORD, DB_NAME and DB_STATEMENT_TIMEOUT_MS, shared by the server and
+// the seed subcommand.
+type dbSettings struct {
+    Host               string
+    Port               int
+    User               string
+    Password           string
+    Name               string
+    StatementTimeoutMS int
+}
+
+func loadDBSettings() (dbSettings, error) {
+    settings := dbSettings{
+        Host: getEnv("DB_HOST", defaultDBHost),
+        User: getEnv("DB_USER", defaultDBUser),
+        Name: getEnv("DB_NAME", defaultDBName),
+    }
+    var err error
+    settings.StatementTimeoutMS, err = getEnvInt("DB_STATEMENT_TIMEOUT_MS", 5000)
+    if err != nil || settings.StatementTimeoutMS < 0 {
+        return settings, errors.New("DB_STATEMENT_TIMEOUT_MS must be a non-negative integer")
+    }
+    settings.Password, err = requireEnv("DB_PASSWORD")
+    if err != nil {
+        return settings, err
+    }
+    settings.Port, err = getEnvInt("DB_PORT", defaultDBPort)
+    if err != nil {
+        return settings, err
+    }
+    return settings, nil
+}
+
+// dsn builds the libpq connection string. statement_timeout is not a driver
+// setting, so lib/pq sends it as a run-time parameter in the startup packet of
+// every new connection. The server then cancels runaway queries even if
+// context cancellation lags.
+func (s dbSettings) dsn() string {
+    return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable statement_timeout=%d",
+        quoteDSNValue(s.Host), s.Port, quoteDSNValue(s.User),
+        quoteDSNValue(s.Password), quoteDSNValue(s.Name), s.StatementTimeoutMS)
+}
+
+// getEnv returns the named environment variable, or fallback when it is
+// unset or empty.
+func getEnv(key, fallback string) string {
+    if value := os.Getenv(key); value != "" {
+        return value
+    }
+    return fallback
+}
+
+// requireEnv returns the named environment variable, or an error naming it
+// when it is unset or empty.
+func requireEnv(key string) (string, error) {
+    value := os.Getenv(key)
+    if value == "" {
+        return "", fmt.Errorf("%s must be set", key)
+    }
+    return value, nil
+}
+
+// quoteDSNValue quotes a value for a libpq key=value connection string, so
+// passwords containing spaces or quotes survive intact.
+func quoteDSNValue(value string) string {
+    value = strings.ReplaceAll(value, `\`, `\\`)
+    value = strings.ReplaceAll(value, `'`, `\'`)
+    return "'" + value + "'"
+}
+
+// getEnvFloat returns the float value of the named environment variable, or
+// fallback when it is unset.
+func getEnvFloat(key string, fallback float64) (float64, error) {
+    raw := os.Getenv(key)
+    if raw == "" {
+        return fallback, nil
+    }
+    value, err := strconv.ParseFloat(raw, 64)
+    if err != nil {
+        return 0, fmt.Errorf("%s must be a number, got %q", key, raw)
+    }
+    return value, nil
+}
+
+// getEnvInt returns the integer value of the named environment variable, or
+// fallback when it is unset.
+func getEnvInt(key string, fallback int) (int, error) {
+    raw := os.Getenv(key)
+    if raw == "" {
+        return fallback, nil
+    }
+    value, err := strconv.Atoi(raw)
+    if err != nil {
+        return 0, fmt.Errorf("%s must be an integer, got %q", key, raw)
+    }
+    return value, nil
+}
+
+// getEnvList splits the named environment variable on commas, dropping empty
+// entries, or returns fallback when it is unset or empty.
+func getEnvList(key string, fallback []string) []string {
+    var values []string
+    for _, value := range strings.Split(os.Getenv(key), ",") {
+        if value = strings.TrimSpace(value); value != "" {
+            values = append(values, value)
+        }
+    }
+    if len(values) == 0 {
+        return fallback
+    }
+    return values
+}
+
+// getEnvBool returns the boolean value of the named environment variable, or
+// fallback when it is unset.
+func getEnvBool(key string, fallback bool) (bool, error) {
+    raw := os.Getenv(key)
+    if raw == "" {
+        return fallback, nil
+    }
+    value, err := strconv.ParseBool(raw)
+    if err != nil {
+        return false, fmt.Errorf("%s must be true or false, got %q", key, raw)
+    }
+    return value, nil
+}
+
+// validateDSN checks a PostgreSQL connection string before it is handed to
+// the driver, which only reports problems on the first Ping. Errors never
+// include the connection string itself so the password cannot leak into logs.
+func validateDSN(dsn string) error {
+    if strings.Contains(dsn, "://") {
+        u, err := url.Parse(dsn)
+        if err != nil {
+            return errors.New("invalid DSN: malformed URL")
+        }
+        if u.Scheme != "postgres" && u.Scheme != "postgresql" {
+            return fmt.Errorf("invalid DSN: scheme must be postgres or postgresql, got %q", u.Scheme)
+        }
+        if u.Hostname() == "" {
+            return errors.New("invalid DSN: host is empty")
+        }
+        if port := u.Port(); port != "" {
+            if _, err := strconv.Atoi(port); err != nil {
+                return fmt.Errorf("invalid DSN: port %q is not numeric", port)
+            }
+        }
+        return validateSSLMode(u.Query()["sslmode"])
+    }
+
+    params, err := parseKeyValueDSN(dsn)
+    if err != nil {
+        return err
+    }
+    for _, key := range []string{"host", "dbname", "user"} {
+        if params[key] == "" {
+            return fmt.Errorf("invalid DSN: missing %s", key)
+        }
+    }
+    if port, ok := params["port"]; ok {
+        if _, err := strconv.Atoi(port); err != nil {
+            return fmt.Errorf("invalid DSN: port %q is not numeric", port)
+        }
+    }
+    if mode, ok := params["sslmode"]; ok {
+        return validateSSLMode([]string{mode})
+    }
+    return nil
+}
+
+// sslModes are the sslmode values libpq accepts.
+var sslModes = map[string]bool{
+    "disable": true, "allow": true, "prefer": true, "require": true, "verify-ca": true, "verify-full": true,
+}
+
+func validateSSLMode(modes []string) error {
+    for _, mode := range modes {
+        if !sslModes[mode] {
+            return fmt.Errorf("invalid DSN: sslmode %q is not one of disable, allow, prefer, require, verify-ca, verify-full", mode)
+        }
+    }
+    return nil
+}
+
+// parseKeyValueDSN splits a libpq key=value connection string. Values may be
+// single-quoted, with backslash escapes, as libpq allows.
+func parseKeyValueDSN(dsn string) (map[string]string, error) {
+    params := map[string]string{}
+    s := strings.TrimSpace(dsn)
+    for s != "" {
+        eq := strings.IndexByte(s, '=')
+        if eq <= 0 {
+            return nil, errors.New("invalid DSN: expected key=value pairs")
+        }
+        key := strings.TrimSpace(s[:eq])
+        s = strings.TrimLeft(s[eq+1:], " ")
+
+        var value strings.Builder
+        if strings.HasPrefix(s, "'") {
+            end := -1
+            for i := 1; i < len(s); i++ {
+                if s[i] == '\\' && i+1 < len(s) {
+                    i++
+                    value.WriteByte(s[i])
+                    continue
+                }
+                if s[i] == '\'' {
+                    end = i
+                    break
+                }
+                value.WriteByte(s[i])
+            }
+            if end == -1 {
+                return nil, fmt.Errorf("invalid DSN: unterminated quoted value for %s", key)
+            }
+            s = s[end+1:]
+        } else {
+            end := strings.IndexAny(s, " \t\n")
+            if end == -1 {
+                end = len(s)
+            }
+            value.WriteString(s[:end])
+            s = s[end:]
+        }
+        params[key] = value.String()
+        s = strings.TrimSpace(s)
+    }
+    return params, nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "io/fs"
+    "os"
+    "reflect"
+    "strings"
+
+    "gopkg.in/yaml.v3"
+)
+
+// Config mirrors the environment variables the server reads, grouped as they
+// appear in a config file. Every field names its variable in an env tag.
+// Values are kept as strings, as the environment holds them, so a file value
+// goes through the same parsing and validation as the variable would; an
+// empty value means unset.
+type Config struct {
+    Server struct {
+        ListenAddr             string   `yaml:"listen_addr" env:"LISTEN_ADDR"`
+        GRPCPort               string   `yaml:"grpc_port" env:"GRPC_PORT"`
+        AppEnv                 string   `yaml:"app_env" env:"APP_ENV"`
+        LogLevel               string   `yaml:"log_level" env:"LOG_LEVEL"`
+        ShutdownTimeoutSeconds string   `yaml:"shutdown_timeout_seconds" env:"SHUTDOWN_TIMEOUT_SECONDS"`
+        RequestTimeoutSeconds  string   `yaml:"request_timeout_seconds" env:"REQUEST_TIMEOUT_SECONDS"`
+        SlowRequestThresholdMS string   `yaml:"slow_request_threshold_ms" env:"SLOW_REQUEST_THRESHOLD_MS"`
+        MaxRequestBodyBytes    string   `yaml:"max_request_body_bytes" env:"MAX_REQUEST_BODY_BYTES"`
+        GzipLevel              string   `yaml:"gzip_level" env:"GZIP_LEVEL"`
+        SSEMaxClients          string   `yaml:"sse_max_clients" env:"SSE_MAX_CLIENTS"`
+        JWTSecret              string   `yaml:"jwt_secret" env:"JWT_SECRET"`
+        TrustedProxyCIDRs      []string `yaml:"trusted_proxy_cidrs" env:"TRUSTED_PROXY_CIDRS"`
+        AdminAllowedCIDRs      []string `yaml:"admin_allowed_cidrs" env:"ADMIN_ALLOWED_CIDRS"`
+    } `yaml:"server"`
+    TLS struct {
+        Mode     string `yaml:"mode" env:"TLS_MODE"`
+        CertFile string `yaml:"cert_file" env:"TLS_CERT_FILE"`
+        KeyFile  string `yaml:"key_file" env:"TLS_KEY_FILE"`
+        Domain   string `yaml:"domain" env:"TLS_DOMAIN"`
+        CacheDir string `yaml:"cache_dir" env:"TLS_CACHE_DIR"`
+    } `yaml:"tls"`
+    DB struct {
+        Host                   string   `yaml:"host" env:"DB_HOST"`
+        Port                   string   `yaml:"port" env:"DB_PORT"`
+        User                   string   `yaml:"user" env:"DB_USER"`
+        Password               string   `yaml:"password" env:"DB_PASSWORD"`
+        Name                   string   `yaml:"name" env:"DB_NAME"`
+        StatementTimeoutMS     string   `yaml:"statement_timeout_ms" env:"DB_STATEMENT_TIMEOUT_MS"`
+        MaxOpenConns           string   `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+        MaxIdleConns           string   `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+        ConnMaxLifetimeMinutes string   `yaml:"conn_max_lifetime_minutes" env:"DB_CONN_MAX_LIFETIME_MINUTES"`
+        SkipMigrations         string   `yaml:"skip_migrations" env:"SKIP_MIGRATIONS"`
+        ReadReplicaDSNs        []string `yaml:"read_replica_dsns" env:"DB_READ_REPLICA_DSN"`
+    } `yaml:"db"`
+    CORS struct {
+        AllowedOrigins   []string `yaml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+        AllowedMethods   []string `yaml:"allowed_methods" env:"CORS_ALLOWED_METHODS"`
+        AllowCredentials string   `yaml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS"`
+    } `yaml:"cors"`
+    Cache struct {
+        MaxSize         string `yaml:"max_size" env:"CACHE_MAX_SIZE"`
+        TTLSeconds      string `yaml:"ttl_seconds" env:"CACHE_TTL_SECONDS"`
+        StatsTTLSeconds string `yaml:"stats_ttl_seconds" env:"STATS_CACHE_TTL_SECONDS"`
+        RedisURL        string `yaml:"redis_url" env:"REDIS_URL"`
+        RedisTTLSeconds string `yaml:"redis_ttl_seconds" env:"REDIS_CACHE_TTL_SECONDS"`
+    } `yaml:"cache"`
+    RateLimit struct {
+        RPS             string `yaml:"rps" env:"RATE_LIMIT_RPS"`
+        Burst           string `yaml:"burst" env:"RATE_LIMIT_BURST"`
+        CleanupInterval string `yaml:"cleanup_interval" env:"RATE_LIMIT_CLEANUP_INTERVAL"`
+    } `yaml:"rate_limit"`
+    Items struct {
+        MinPrice                   string   `yaml:"min_price" env:"MIN_ITEM_PRICE"`
+        MaxPrice                   string   `yaml:"max_price" env:"MAX_ITEM_PRICE"`
+        ImmutableFields            []string `yaml:"immutable_fields" env:"IMMUTABLE_FIELDS"`
+        BlockedWordsFile           string   `yaml:"blocked_words_file" env:"BLOCKED_WORDS_FILE"`
+        BlockedWordsReloadInterval string   `yaml:"blocked_words_reload_interval" env:"BLOCKED_WORDS_RELOAD_INTERVAL"`
+        DeprecatedAt               string   `yaml:"deprecated_at" env:"ITEMS_DEPRECATED_AT"`
+        SunsetDate                 string   `yaml:"sunset_date" env:"ITEMS_SUNSET_DATE"`
+        SuccessorLink              string   `yaml:"successor_link" env:"ITEMS_SUCCESSOR_LINK"`
+        ResponseFieldMap           string   `yaml:"response_field_map" env:"RESPONSE_FIELD_MAP"`
+        FieldMapKeepOriginalUntil  string   `yaml:"response_field_map_keep_original_until" env:"RESPONSE_FIELD_MAP_KEEP_ORIGINAL_UNTIL"`
+        DefaultSortBy              string   `yaml:"default_sort_by" env:"DEFAULT_SORT_BY"`
+        DefaultSortOrder           string   `yaml:"default_sort_order" env:"DEFAULT_SORT_ORDER"`
+        LowStockThreshold          string   `yaml:"low_stock_threshold" env:"LOW_STOCK_THRESHOLD"`
+        LowStockAlertHour          string   `yaml:"low_stock_alert_hour" env:"LOW_STOCK_ALERT_HOUR"`
+        PriceHistogramRefreshHour  string   `yaml:"price_histogram_refresh_hour" env:"PRICE_HISTOGRAM_REFRESH_HOUR"`
+    } `yaml:"items"`
+    Purge struct {
+        RetentionDays string `yaml:"retention_days" env:"PURGE_RETENTION_DAYS"`
+        IntervalHours string `yaml:"interval_hours" env:"PURGE_INTERVAL_HOURS"`
+    } `yaml:"purge"`
+    S3 struct {
+        Bucket    string `yaml:"bucket" env:"S3_BUCKET"`
+        Region    string `yaml:"region" env:"S3_REGION"`
+        Endpoint  string `yaml:"endpoint" env:"S3_ENDPOINT"`
+        PublicURL string `yaml:"public_url" env:"S3_PUBLIC_URL"`
+    } `yaml:"s3"`
+    Tracing struct {
+        AgentAddr          string `yaml:"agent_addr" env:"DD_AGENT_ADDR"`
+        SampleRate         string `yaml:"sample_rate" env:"DD_TRACE_SAMPLE_RATE"`
+        CriticalSampleRate string `yaml:"critical_sample_rate" env:"DD_TRACE_CRITICAL_SAMPLE_RATE"`
+    } `yaml:"tracing"`
+}
+
+// LoadConfig reads the YAML file at path and then overrides each field whose
+// environment variable is set, so the environment always wins. A missing file
+// is not an error: the configuration then comes from the environment alone.
+func LoadConfig(path string) (*Config, error) {
+    cfg := &Config{}
+    data, err := os.ReadFile(path)
+    switch {
+    case errors.Is(err, fs.ErrNotExist):
+    case err != nil:
+        return nil, fmt.Errorf("reading config file: %w", err)
+    default:
+        decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+        decoder.KnownFields(true)
+        if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+            return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+        }
+    }
+    cfg.applyEnv(os.LookupEnv)
+    return cfg, nil
+}
+
+// applyEnv replaces every field whose variable lookup reports as set and
+// non-empty. List variables are comma-separated.
+func (c *Config) applyEnv(lookup func(string) (string, bool)) {
+    c.eachField(func(name string, field reflect.Value) {
+        value, ok := lookup(name)
+        if !ok || value == "" {
+            return
+        }
+        if field.Kind() == reflect.Slice {
+            field.Set(reflect.ValueOf(strings.Split(value, ",")))
+            return
+        }
+        field.SetString(value)
+    })
+}
+
+// Export writes the merged configuration back into the process environment,
+// where the settings are parsed and validated with the messages operators
+// know. Unset fields are left alone so their defaults still apply.
+func (c *Config) Export() error {
+    var err error
+    c.eachField(func(name string, field reflect.Value) {
+        value := ""
+        if field.Kind() == reflect.Slice {
+            value = strings.Join(field.Interface().([]string), ",")
+        } else {
+            value = field.String()
+        }
+        if value == "" || err != nil {
+            return
+        }
+        err = os.Setenv(name, value)
+    })
+    return err
+}
+
+// eachField calls fn with the env tag and value of every setting.
+func (c *Config) eachField(fn func(name string, field reflect.Value)) {
+    sections := reflect.ValueOf(c).Elem()
+    for i := 0; i < sections.NumField(); i++ {
+        section := sections.Field(i)
+        for j := 0; j < section.NumField(); j++ {
+            fn(section.Type().Field(j).Tag.Get("env"), section.Field(j))
+        }
+    }
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/santhosh-tekuri/jsonschema/v5"
+    "gopkg.in/yaml.v3"
+)
+
+// openAPIResponses holds the decoded spec and a compiler that has it as a
+// JSON resource, so any schema in it can be compiled by pointer.
+type openAPIResponses struct {
+    compiler *jsonschema.Compiler
+    doc      map[string]interface{}
+}
+
+// loadOpenAPIResponses converts openapi.yaml to a JSON Schema resource. The
+// spec is OpenAPI 3.0, whose schemas are draft 4 apart from nullable, which
+// becomes an anyOf with null.
+func loadOpenAPIResponses(t *testing.T) *openAPIResponses {
+    t.Helper()
+    var spec map[string]interface{}
+    if err := yaml.Unmarshal(openAPISpec, &spec); err != nil {
+        t.Fatalf("openapi.yaml: %v", err)
+    }
+    allowNullable(spec)
+    encoded, err := json.Marshal(spec)
+    if err != nil {
+        t.Fatalf("openapi.yaml as JSON: %v", err)
+    }
+    compiler := jsonschema.NewCompiler()
+    compiler.Draft = jsonschema.Draft4
+    if err := compiler.AddResource("openapi.json", bytes.NewReader(encoded)); err != nil {
+        t.Fatal(err)
+    }
+    return &openAPIResponses{compiler: compiler, doc: spec}
+}
+
+// allowNullable rewrites every nullable schema below node in place.
+func allowNullable(node interface{}) {
+    switch node := node.(type) {
+    case map[string]interface{}:
+        for key, child := range node {
+            allowNullable(child)
+            schema, ok := child.(map[string]interface{})
+            if !ok || schema["nullable"] != true {
+                continue
+            }
+            delete(schema, "nullable")
+            node[key] = map[string]interface{}{
+                "anyOf": []interface{}{map[string]interface{}{"type": "null"}, schema},
+            }
+        }
+    case []interface{}:
+        for _, child := range node {
+            allowNullable(child)
+        }
+    }
+}
+
+// schema compiles the JSON body schema of the documented response, or
+// returns nil when the response has no JSON body. It fails the test when
+// the status is not documented for the operation.
+func (spec *openAPIResponses) schema(t *testing.T, method, path string, status int) *jsonschema.Schema {
+    t.Helper()
+    paths, _ := spec.doc["paths"].(map[string]interface{})
+    operation, _ := paths[path].(map[string]interface{})[strings.ToLower(method)].(map[string]interface{})
+    if operation == nil {
+        t.Fatalf("%s %s is not documented", method, path)
+    }
+    code := fmt.Sprint(status)
+    response, ok := operation["responses"].(map[string]interface{})[code].(map[string]interface{})
+    if !ok {
+        t.Errorf("%s %s answered %d, which is not documented", method, path, status)
+        return nil
+    }
+    pointer := "#/paths/" + escapePointerToken(path) + "/" + strings.ToLower(method) + "/responses/" + code
+    if ref, ok := response["$ref"].(string); ok {
+        pointer = ref
+        name := strings.TrimPrefix(ref, "#/components/responses/")
+        components, _ := spec.doc["components"].(map[string]interface{})
+        response, _ = components["responses"].(map[string]interface{})[name].(map[string]interface{})
+    }
+    content, _ := response["content"].(map[string]interface{})
+    if _, ok := content["application/json"]; !ok {
+        return nil
+    }
+    compiled, err := spec.compiler.Compile("openapi.json" + pointer + "/content/application~1json/schema")
+    if err != nil {
+        t.Fatalf("%s %s %d: %v", method, path, status, err)
+    }
+    return compiled
+}
+
+// TestContractCompliance sends requests to the item routes and checks each
+// response status is documented and its JSON body matches the schema
+// openapi.yaml gives for that status. go generate runs it with the route
+// check.
+func TestContractCompliance(t *testing.T) {
+    spec := loadOpenAPIResponses(t)
+    repo := storedItems(Item{ID: 1, Name: "Widget", Price: 9.99, Version: 1, Metadata: map[string]interface{}{"color": "red"}})
+    repo.GetAllFunc = func(ctx context.Context, filters ItemFilters) (itemPage, error) {
+        item, err := repo.GetByIDFunc(ctx, 1)
+        return itemPage{Items: []Item{item}, Total: 1, Limit: filters.Limit, Offset: filters.Offset}, err
+    }
+    repo.GetAfterFunc = func(ctx context.Context, filters ItemFilters) (itemCursorPage, error) {
+        item, err := repo.GetByIDFunc(ctx, 1)
+        return itemCursorPage{Items: []Item{item}, Limit: filters.Limit}, err
+    }
+    rt := newMockApp(t, repo)
+    token := testToken(t, nil)
+
+    tests := []struct {
+        method, target, path string
+        body                 interface{}
+    }{
+        {http.MethodGet, "/items", "/items", nil},
+        {http.MethodGet, "/items?after=", "/items", nil},
+        {http.MethodGet, "/items?limit=0", "/items", nil},
+        {http.MethodPost, "/items", "/items", map[string]interface{}{"name": "Gadget", "price": 5}},
+        {http.MethodPost, "/items", "/items", map[string]interface{}{"name": "Gadget", "price": -5}},
+        {http.MethodPost, "/items", "/items", map[string]interface{}{"name": "Gadget", "price": 1000000}},
+        {http.MethodGet, "/items/1", "/items/{id}", nil},
+        {http.MethodGet, "/items/999", "/items/{id}", nil},
+        {http.MethodGet, "/items/abc", "/items/{id}", nil},
+        {http.MethodPut, "/items/1", "/items/{id}", map[string]interface{}{"name": "Widget", "price": 11}},
+        {http.MethodPut, "/items/1", "/items/{id}", map[string]interface{}{"name": "Widget", "price": 1000000}},
+        {http.MethodDelete, "/items/2", "/items/{id}", nil},
+    }
+    for _, tt := range tests {
+        t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+            var body bytes.Buffer
+            if tt.body != nil {
+                if err := json.NewEncoder(&body).Encode(tt.body); err != nil {
+                    t.Fatal(err)
+                }
+            }
+            r := httptest.NewRequest(tt.method, tt.target, &body)
+            if tt.body != nil {
+                r.Header.Set("Content-Type", "application/json")
+            }
+            r.Header.Set("Authorization", token)
+            rec := httptest.NewRecorder()
+            rt.ServeHTTP(rec, r)
+
+            schema := spec.schema(t, tt.method, tt.path, rec.Code)
+            if schema == nil {
+                if rec.Body.Len() > 0 && strings.HasPrefix(rec.Header().Get("Content-Type"), "application/json") {
+                    t.Errorf("status %d is documented without a JSON body, got %s", rec.Code, rec.Body)
+                }
+                return
+            }
+            var doc interface{}
+            if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+                t.Fatalf("status %d: body is not JSON: %v: %s", rec.Code, err, rec.Body)
+            }
+            if err := schema.Validate(doc); err != nil {
+                for _, violation := range schemaViolations(err) {
+                    t.Errorf("status %d: %s: %s", rec.Code, violation.Field, violation.Message)
+                }
+                t.Logf("body: %s", rec.Body)
+            }
+        })
+    }
+}
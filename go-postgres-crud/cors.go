@@ -0,0 +1,44 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "log/slog"
+    "net/url"
+
+    "github.com/rs/cors"
+)
+
+// parseCORSOrigins checks the CORS_ALLOWED_ORIGINS list. Without one,
+// development allows every origin and production refuses to start rather
+// than guess.
+func parseCORSOrigins(origins []string, env string) ([]string, error) {
+    if len(origins) == 0 {
+        if env != "development" {
+            return nil, errors.New("CORS_ALLOWED_ORIGINS must be set in production")
+        }
+        slog.Warn("CORS_ALLOWED_ORIGINS is not set; allowing every origin in development")
+        return []string{"*"}, nil
+    }
+    for _, origin := range origins {
+        if origin == "*" {
+            continue
+        }
+        if u, err := url.Parse(origin); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+            return nil, fmt.Errorf("CORS_ALLOWED_ORIGINS must be a comma-separated list of http(s) origins, not %q", origin)
+        }
+    }
+    return origins, nil
+}
+
+func newCORS(allowedOrigins, allowedMethods []string, allowCredentials bool) *cors.Cors {
+    return cors.New(cors.Options{
+        AllowedOrigins:   allowedOrigins,
+        AllowedMethods:   allowedMethods,
+        AllowedHeaders:   []string{"Authorization", "Content-Type", idempotencyKeyHeader, upsertKeyHeader, "If-None-Match", requestIDHeader, apiKeyHeader},
+        ExposedHeaders:   []string{"ETag", "Location", itemVersionHeader, requestIDHeader},
+        AllowCredentials: allowCredentials,
+        // Let pre-flight requests reach the OPTIONS handlers so they carry an Allow header.
+        OptionsPassthrough: true,
+    })
+}
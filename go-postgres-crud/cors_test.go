@@ -0,0 +1,56 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestCORSRejectsDisallowedOrigin(t *testing.T) {
+    h := newCORS([]string{"https://app.example.com"}, []string{"GET", "POST"}, true).
+        Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+    tests := []struct {
+        name   string
+        method string
+        origin string
+        want   string
+    }{
+        {"allowed origin", http.MethodGet, "https://app.example.com", "https://app.example.com"},
+        {"disallowed origin", http.MethodGet, "https://evil.example.com", ""},
+        {"allowed origin over http", http.MethodGet, "http://app.example.com", ""},
+        {"disallowed pre-flight", http.MethodOptions, "https://evil.example.com", ""},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            r := httptest.NewRequest(tt.method, "/items", nil)
+            r.Header.Set("Origin", tt.origin)
+            if tt.method == http.MethodOptions {
+                r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+            }
+            rec := httptest.NewRecorder()
+            h.ServeHTTP(rec, r)
+            if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.want {
+                t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.want)
+            }
+            if tt.want == "" && rec.Header().Get("Access-Control-Allow-Credentials") != "" {
+                t.Error("credentials allowed for a disallowed origin")
+            }
+        })
+    }
+}
+
+func TestParseCORSOrigins(t *testing.T) {
+    if _, err := parseCORSOrigins(nil, "production"); err == nil {
+        t.Error("no origins in production: want an error")
+    }
+    if origins, err := parseCORSOrigins(nil, "development"); err != nil || len(origins) != 1 || origins[0] != "*" {
+        t.Errorf("no origins in development = %v, %v; want [*]", origins, err)
+    }
+    if _, err := parseCORSOrigins([]string{"https://app.example.com", "app.example.com"}, "production"); err == nil {
+        t.Error("an origin without a scheme: want an error")
+    }
+    if origins, err := parseCORSOrigins([]string{"https://app.example.com", "http://localhost:3000"}, "production"); err != nil || len(origins) != 2 {
+        t.Errorf("valid origins = %v, %v", origins, err)
+    }
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+    "bytes"
+    "encoding/csv"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "sort"
+
+    "github.com/prometheus/client_golang/prometheus"
+    "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+const (
+    maxCSVImportBytes = 10 << 20 // 10 MB
+    maxCSVImportRows  = 10000
+)
+
+var errCSVTooLarge = errors.New("csv file too large")
+
+// csvRowError reports why one row of an uploaded CSV file was skipped. Row
+// numbers count the header as row 1, matching what a spreadsheet shows.
+type csvRowError struct {
+    Row     int    `json:"row"`
+    Message string `json:"message"`
+}
+
+type csvImportResult struct {
+    Inserted int           `json:"inserted"`
+    Skipped  int           `json:"skipped"`
+    Errors   []csvRowError `json:"errors,omitempty"`
+}
+
+// importItemsCSV inserts the rows of the CSV file in the "file" field of a
+// multipart/form-data body. Valid rows are inserted in one transaction; rows
+// that fail validation, or whose name is already taken, are skipped and listed
+// in a 422 response.
+func (app *App) importItemsCSV(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    span, ctx := tracer.StartSpanFromContext(ctx, "importItemsCSV", tracer.ResourceName("INSERT INTO items"))
+    defer span.Finish()
+
+    records, err := readCSVFormFile(r)
+    if err != nil {
+        var tooLarge *http.MaxBytesError
+        switch {
+        case errors.Is(err, errCSVTooLarge), errors.As(err, &tooLarge):
+            writeError(w, http.StatusRequestEntityTooLarge, "FILE_TOO_LARGE", fmt.Sprintf("CSV files are limited to %d bytes", maxCSVImportBytes))
+        default:
+            writeError(w, http.StatusBadRequest, "INVALID_BODY", err.Error())
+        }
+        return
+    }
+    reader := csv.NewReader(records)
+    // Rows are checked one by one below, so a short row is reported
+    // rather than failing the whole file.
+    reader.FieldsPerRecord = -1
+    columns, err := readCSVHeader(reader)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, "INVALID_CSV", err.Error())
+        return
+    }
+    rows, err := reader.ReadAll()
+    if err != nil {
+        writeError(w, http.StatusBadRequest, "INVALID_CSV", err.Error())
+        return
+    }
+    if len(rows) > maxCSVImportRows {
+        writeError(w, http.StatusBadRequest, "TOO_MANY_ROWS", fmt.Sprintf("At most %d rows can be imported at once", maxCSVImportRows))
+        return
+    }
+
+    var result csvImportResult
+    items := make([]Item, 0, len(rows))
+    rowNumbers := make([]int, 0, len(rows))
+    for i, record := range rows {
+        row := i + 2
+        item, err := csvRowItem(record, columns)
+        if err == nil {
+            err = validateItem(ctx, item)
+        }
+        if err != nil {
+            result.Errors = append(result.Errors, csvRowError{Row: row, Message: err.Error()})
+            continue
+        }
+        items = append(items, item)
+        rowNumbers = append(rowNumbers, row)
+    }
+
+    tx, err := db.BeginTx(ctx, nil)
+    if err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+    defer tx.Rollback()
+
+    stmt := tx.StmtContext(ctx, app.stmts.Insert)
+    tenantID := tenantFromContext(ctx)
+    timer := prometheus.NewTimer(dbQueryDuration.WithLabelValues("create"))
+    inserted := make([]Item, 0, len(items))
+    for i, item := range items {
+        // A savepoint per row lets a duplicate name skip that row without
+        // aborting the transaction.
+        if _, err := tx.ExecContext(ctx, `SAVEPOINT csv_row`); err != nil {
+            writeInternalError(w, r, err)
+            return
+        }
+        err := stmt.QueryRowContext(ctx, item.Name, item.Description, item.Price, item.Metadata, tenantID).Scan(&item.ID, &item.Version)
+        if isDuplicateName(err) {
+            if _, err := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT csv_row`); err != nil {
+                writeInternalError(w, r, err)
+                return
+            }
+            result.Errors = append(result.Errors, csvRowError{Row: rowNumbers[i], Message: "an item with this name already exists"})
+            continue
+        }
+        if err != nil {
+            writeInternalError(w, r, err)
+            return
+        }
+        if err := recordAudit(ctx, tx, item.ID, auditCreate, nil, item); err != nil {
+            writeInternalError(w, r, err)
+            return
+        }
+        inserted = append(inserted, item)
+    }
+    timer.ObserveDuration()
+    if err := tx.Commit(); err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+    for _, item := range inserted {
+        notifyItemChange(ctx, eventItemCreated, item)
+    }
+    requestLogger(ctx).Info("csv import finished", "inserted", len(inserted), "skipped", len(result.Errors))
+
+    result.Inserted = len(inserted)
+    result.Skipped = len(result.Errors)
+    if len(result.Errors) > 0 {
+        sortCSVRowErrors(result.Errors)
+        writeErrorDetails(w, http.StatusUnprocessableEntity, "INVALID_ROWS",
+            fmt.Sprintf("%d rows were skipped; the other rows were imported", result.Skipped), result)
+        return
+    }
+    writeJSON(w, http.StatusOK, result)
+}
+
+// csvRowItem is csvRecordItem for rows that may be shorter than the header.
+func csvRowItem(record []string, columns map[string]int) (Item, error) {
+    for _, name := range []string{"name", "description", "price"} {
+        if columns[name] >= len(record) {
+            return Item{}, fmt.Errorf("row is missing the %q column", name)
+        }
+    }
+    return csvRecordItem(record, columns)
+}
+
+// sortCSVRowErrors orders errors by row, since duplicate names are only found
+// after the validation pass.
+func sortCSVRowErrors(errs []csvRowError) {
+    sort.Slice(errs, func(i, j int) bool { return errs[i].Row < errs[j].Row })
+}
+
+// readCSVFormFile returns a reader over the "file" part of a multipart body,
+// holding at most maxCSVImportBytes of it.
+func readCSVFormFile(r *http.Request) (io.Reader, error) {
+    reader, err := r.MultipartReader()
+    if err != nil {
+        return nil, errors.New("request body must be multipart/form-data")
+    }
+    for {
+        part, err := reader.NextPart()
+        if err == io.EOF {
+            return nil, errors.New(`request body must contain a "file" field`)
+        }
+        if err != nil {
+            return nil, err
+        }
+        if part.FormName() != "file" {
+            part.Close()
+            continue
+        }
+        defer part.Close()
+        data, err := io.ReadAll(io.LimitReader(part, maxCSVImportBytes+1))
+        if err != nil {
+            return nil, err
+        }
+        if len(data) > maxCSVImportBytes {
+            return nil, errCSVTooLarge
+        }
+        return bytes.NewReader(data), nil
+    }
+}
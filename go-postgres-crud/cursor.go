@@ -0,0 +1,61 @@
+package main
+
+import (
+    "bytes"
+    "encoding/base64"
+    "encoding/json"
+    "encoding/xml"
+    "errors"
+    "time"
+)
+
+var errInvalidCursor = errors.New("after is not a valid cursor")
+
+// itemCursor is the position of the last item on a keyset page. Clients see
+// it only as an opaque string from encodeItemCursor.
+type itemCursor struct {
+    ID        int       `json:"id"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// itemCursorPage is one keyset page of GET /items. Unlike itemPage it has no
+// total, since counting every match is exactly the cost keyset pagination
+// avoids. NextCursor is nil on the last page, and is then left out of the
+// XML <items> element.
+type itemCursorPage struct {
+    XMLName    xml.Name `json:"-" xml:"items"`
+    Items      []Item   `json:"items" xml:"item"`
+    Limit      int      `json:"limit" xml:"limit,attr"`
+    NextCursor *string  `json:"next_cursor" xml:"next_cursor,attr,omitempty"`
+    HasMore    bool     `json:"has_more" xml:"has_more,attr"`
+}
+
+type cursorMeta struct {
+    Limit      int     `json:"limit"`
+    NextCursor *string `json:"next_cursor"`
+    HasMore    bool    `json:"has_more"`
+}
+
+func encodeItemCursor(cursor itemCursor) string {
+    raw, _ := json.Marshal(cursor)
+    return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeItemCursor rejects anything encodeItemCursor could not have produced:
+// bad base64, unknown or trailing JSON, and out-of-range positions.
+func decodeItemCursor(raw string) (itemCursor, error) {
+    data, err := base64.RawURLEncoding.DecodeString(raw)
+    if err != nil {
+        return itemCursor{}, errInvalidCursor
+    }
+    decoder := json.NewDecoder(bytes.NewReader(data))
+    decoder.DisallowUnknownFields()
+    var cursor itemCursor
+    if err := decoder.Decode(&cursor); err != nil || decoder.More() {
+        return itemCursor{}, errInvalidCursor
+    }
+    if cursor.ID <= 0 || cursor.CreatedAt.IsZero() {
+        return itemCursor{}, errInvalidCursor
+    }
+    return cursor, nil
+}
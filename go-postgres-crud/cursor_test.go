@@ -0,0 +1,96 @@
+package main
+
+import (
+    "encoding/base64"
+    "net/http"
+    "net/url"
+    "testing"
+    "time"
+
+    "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestItemCursorRoundTrip(t *testing.T) {
+    want := itemCursor{ID: 42, CreatedAt: time.Date(2024, 5, 1, 12, 30, 0, 123456789, time.UTC)}
+    got, err := decodeItemCursor(encodeItemCursor(want))
+    if err != nil || got.ID != want.ID || !got.CreatedAt.Equal(want.CreatedAt) {
+        t.Errorf("round trip = %+v, %v; want %+v", got, err, want)
+    }
+}
+
+func TestDecodeItemCursorRejectsTampering(t *testing.T) {
+    encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+    valid := encodeItemCursor(itemCursor{ID: 42, CreatedAt: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)})
+    for name, raw := range map[string]string{
+        "not base64":     "not*base64",
+        "padded":         valid + "==",
+        "not JSON":       encode("id=42"),
+        "unknown field":  encode(`{"id":42,"created_at":"2024-05-01T00:00:00Z","tenant_id":"x"}`),
+        "trailing data":  encode(`{"id":42,"created_at":"2024-05-01T00:00:00Z"}{}`),
+        "zero ID":        encode(`{"id":0,"created_at":"2024-05-01T00:00:00Z"}`),
+        "negative ID":    encode(`{"id":-1,"created_at":"2024-05-01T00:00:00Z"}`),
+        "no created_at":  encode(`{"id":42}`),
+        "string ID":      encode(`{"id":"42","created_at":"2024-05-01T00:00:00Z"}`),
+        "truncated JSON": valid[:len(valid)-4],
+    } {
+        if _, err := decodeItemCursor(raw); err != errInvalidCursor {
+            t.Errorf("%s: err = %v, want errInvalidCursor", name, err)
+        }
+    }
+}
+
+func TestGetItemsAfterRejectsInvalidCursors(t *testing.T) {
+    rt := newMockApp(t, storedItems())
+    for _, query := range []string{"after=garbage", "after=" + url.QueryEscape(encodeItemCursor(itemCursor{ID: 1})), "after=&offset=20", "after=&sort=price", "after=&format=csv"} {
+        rec := doRequest(t, rt, http.MethodGet, "/items?"+query, nil, "")
+        if rec.Code != http.StatusBadRequest || errorCode(t, rec) != "INVALID_QUERY" {
+            t.Errorf("%s: status %d, body %s; want 400 INVALID_QUERY", query, rec.Code, rec.Body)
+        }
+    }
+}
+
+// TestGetItemsAfterPages walks two keyset pages of GET /items: the first
+// reads one row past the limit and so has a cursor, which the second query
+// continues from.
+func TestGetItemsAfterPages(t *testing.T) {
+    mock := mockDB(t)
+    rt := newTestRouter(NewApp(NewPostgresItemRepository(db, nil), nil, nil, nil))
+    base := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+    keysetRows := func(ids ...int) *sqlmock.Rows {
+        rows := sqlmock.NewRows([]string{"id", "name", "description", "price", "version", "image_url", "sku", "metadata", "created_at"})
+        for _, id := range ids {
+            rows.AddRow(id, "Item", "", 1.0, 1, "", "", nil, base.Add(time.Duration(id)*time.Second))
+        }
+        return rows
+    }
+    noCategories := sqlmock.NewRows([]string{"item_id", "id", "name", "slug"})
+
+    mock.ExpectQuery(`FROM items WHERE tenant_id = \$1 AND deleted_at IS NULL ORDER BY created_at, id LIMIT \$2$`).
+        WithArgs(defaultTenantID, 3).WillReturnRows(keysetRows(1, 2, 3))
+    mock.ExpectQuery(`FROM item_categories`).WillReturnRows(noCategories)
+
+    var first itemCursorPage
+    rec := doRequest(t, rt, http.MethodGet, "/items?after=&limit=2", nil, "")
+    decodeBody(t, rec, &first)
+    if rec.Code != http.StatusOK || len(first.Items) != 2 || !first.HasMore || first.NextCursor == nil {
+        t.Fatalf("first page: status %d, %+v; want two items and a cursor", rec.Code, first)
+    }
+    cursor, err := decodeItemCursor(*first.NextCursor)
+    if err != nil || cursor.ID != 2 || !cursor.CreatedAt.Equal(base.Add(2*time.Second)) {
+        t.Fatalf("next_cursor = %+v, %v; want the position of item 2", cursor, err)
+    }
+
+    mock.ExpectQuery(`AND \(created_at, id\) > \(\$2, \$3\) ORDER BY created_at, id LIMIT \$4$`).
+        WithArgs(defaultTenantID, cursor.CreatedAt, 2, 3).WillReturnRows(keysetRows(3))
+    mock.ExpectQuery(`FROM item_categories`).WillReturnRows(noCategories)
+
+    rec = doRequest(t, rt, http.MethodGet, "/items?limit=2&after="+url.QueryEscape(*first.NextCursor), nil, "")
+    var body map[string]interface{}
+    decodeBody(t, rec, &body)
+    if rec.Code != http.StatusOK || body["has_more"] != false || body["next_cursor"] != nil {
+        t.Errorf("last page: status %d, %v; want has_more false and next_cursor null", rec.Code, body)
+    }
+    if items, _ := body["items"].([]interface{}); len(items) != 1 {
+        t.Errorf("last page has %d items, want 1", len(items))
+    }
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "log/slog"
+    "net/http"
+    "time"
+
+    "golang.org/x/time/rate"
+    "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+const (
+    duplicateSimilarityThreshold = 0.6
+    duplicatePriceTolerance      = 0.2
+    maxDuplicateResults          = 10
+)
+
+// trigramAvailable is set at startup when the pg_trgm extension is installed.
+var trigramAvailable bool
+
+// findDuplicatesLimiter caps the expensive similarity scans to 10 per minute
+// across all clients.
+var findDuplicatesLimiter = rate.NewLimiter(rate.Every(time.Minute/10), 10)
+
+type duplicateCandidate struct {
+    Item
+    Similarity float64 `json:"similarity"`
+}
+
+func probeTrigramExtension(ctx context.Context, db *sql.DB) bool {
+    var exists bool
+    err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_trgm')`).Scan(&exists)
+    if err != nil {
+        slog.Warn("could not check for the pg_trgm extension", "error", err)
+        return false
+    }
+    if !exists {
+        slog.Warn("pg_trgm extension is not installed; POST /items/{id}/find-duplicates is disabled")
+    }
+    return exists
+}
+
+func (app *App) findDuplicates(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "findDuplicates", tracer.ResourceName("SELECT similarity(name, $1) FROM items"))
+    defer span.Finish()
+
+    if !trigramAvailable {
+        writeError(w, http.StatusNotImplemented, "NOT_IMPLEMENTED", "Duplicate detection requires the pg_trgm extension")
+        return
+    }
+    if !findDuplicatesLimiter.Allow() {
+        w.Header().Set("Retry-After", "6")
+        writeError(w, http.StatusTooManyRequests, "RATE_LIMITED", "Too many duplicate searches, try again later")
+        return
+    }
+
+    id, err := parseItemID(r.PathValue("id"))
+    if err != nil {
+        writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid item ID")
+        return
+    }
+    tenantID := tenantFromContext(ctx)
+    item, err := app.stmts.fetchItem(ctx, tenantID, id)
+    if err != nil {
+        if err == sql.ErrNoRows {
+            writeError(w, http.StatusNotFound, "NOT_FOUND", "Item not found")
+            return
+        }
+        writeInternalError(w, r, err)
+        return
+    }
+
+    sqlStatement := `SELECT id, name, description, price, similarity(name, $1) AS score
+        FROM items
+        WHERE id <> $2 AND tenant_id = $7 AND deleted_at IS NULL AND similarity(name, $1) > $3 AND price BETWEEN $4 AND $5
+        ORDER BY score DESC
+        LIMIT $6`
+    rows, err := db.QueryContext(ctx, sqlStatement, item.Name, id, duplicateSimilarityThreshold,
+        item.Price*(1-duplicatePriceTolerance), item.Price*(1+duplicatePriceTolerance), maxDuplicateResults, tenantID)
+    if err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+    defer rows.Close()
+
+    duplicates := []duplicateCandidate{}
+    for rows.Next() {
+        var candidate duplicateCandidate
+        err := rows.Scan(&candidate.ID, &candidate.Name, &candidate.Description, &candidate.Price, &candidate.Similarity)
+        if err != nil {
+            writeInternalError(w, r, err)
+            return
+        }
+        duplicates = append(duplicates, candidate)
+    }
+    if err := rows.Err(); err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "item_id":    id,
+        "duplicates": duplicates,
+    })
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+
+    "github.com/lib/pq"
+)
+
+const genericInternalError = "an internal error occurred"
+
+// ErrorResponse is the JSON body of every error the API returns. Code is a
+// stable machine-readable identifier; Message is meant for humans.
+type ErrorResponse struct {
+    Code    string      `json:"code"`
+    Message string      `json:"message"`
+    Details interface{} `json:"details,omitempty"`
+}
+
+// AppHandler is a handler that returns its failure instead of writing it.
+// A non-nil error must not be preceded by a response; handleError turns it
+// into one.
+type AppHandler func(w http.ResponseWriter, r *http.Request) error
+
+func (h AppHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    if err := h(w, r); err != nil {
+        handleError(w, r, err)
+    }
+}
+
+// NotFoundError reports that the requested resource, e.g. "Item", does not
+// exist.
+type NotFoundError struct {
+    Resource string
+}
+
+func (e *NotFoundError) Error() string {
+    return e.Resource + " not found"
+}
+
+// ValidationError rejects a malformed request with 400. Err, when set, is the
+// underlying cause, e.g. a JSON decoding error; a body cut off by
+// maxBytesMiddleware is still answered with 413.
+type ValidationError struct {
+    Code    string
+    Message string
+    Details interface{}
+    Err     error
+}
+
+func (e *ValidationError) Error() string {
+    return e.Message
+}
+
+func (e *ValidationError) Unwrap() error {
+    return e.Err
+}
+
+// ConflictError rejects a request that clashes with the stored state with
+// 409.
+type ConflictError struct {
+    Code    string
+    Message string
+    Details interface{}
+}
+
+func (e *ConflictError) Error() string {
+    return e.Message
+}
+
+// bodyError is the ValidationError for a request body that could not be read
+// or decoded.
+func bodyError(err error, msg string) error {
+    return &ValidationError{Code: "INVALID_BODY", Message: msg, Err: err}
+}
+
+// handleError maps an error returned by an AppHandler to its response. Errors
+// it does not recognise are internal errors.
+func handleError(w http.ResponseWriter, r *http.Request, err error) {
+    var (
+        tooLarge        *http.MaxBytesError
+        notFound        *NotFoundError
+        invalid         *ValidationError
+        conflict        *ConflictError
+        versionConflict *versionConflictError
+        violations      validationErrors
+        rangeErr        *priceRangeError
+        policyErr       *contentPolicyError
+        immutableErr    *immutableFieldError
+    )
+    switch {
+    case errors.As(err, &tooLarge):
+        writeBodyError(w, err, "")
+    case errors.As(err, &notFound):
+        writeError(w, http.StatusNotFound, "NOT_FOUND", notFound.Error())
+    case errors.As(err, &invalid):
+        writeErrorDetails(w, http.StatusBadRequest, invalid.Code, invalid.Message, invalid.Details)
+    case errors.As(err, &conflict):
+        writeErrorDetails(w, http.StatusConflict, conflict.Code, conflict.Message, conflict.Details)
+    case errors.As(err, &versionConflict):
+        writeVersionConflict(w, versionConflict.Current)
+    case errors.Is(err, errDuplicateName):
+        writeDuplicateName(w)
+    case errors.Is(err, errItemNotDeleted):
+        writeError(w, http.StatusBadRequest, "NOT_DELETED", errItemNotDeleted.Error())
+    case errors.Is(err, errUnknownCategory):
+        writeError(w, http.StatusBadRequest, "UNKNOWN_CATEGORY", "category_ids contains a category that does not exist")
+    case errors.Is(err, errItemReserved):
+        writeError(w, http.StatusConflict, "ITEM_RESERVED", "The item is reserved by another client")
+    case errors.Is(err, errOutOfStock):
+        writeError(w, http.StatusConflict, "OUT_OF_STOCK", "The item has no stock left for this change")
+    case errors.Is(err, errIdempotencyKeyInUse):
+        writeError(w, http.StatusConflict, "IDEMPOTENCY_KEY_IN_USE", "Another request with this Idempotency-Key has already completed")
+    case errors.As(err, &violations), errors.As(err, &rangeErr), errors.As(err, &policyErr), errors.As(err, &immutableErr):
+        writeValidationError(w, err)
+    default:
+        writeInternalError(w, r, err)
+    }
+}
+
+// writeError sends an ErrorResponse with the given status.
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+    writeErrorDetails(w, status, code, msg, nil)
+}
+
+func writeErrorDetails(w http.ResponseWriter, status int, code, msg string, details interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("X-Content-Type-Options", "nosniff")
+    writeJSON(w, status, ErrorResponse{Code: code, Message: msg, Details: details})
+}
+
+// writeBodyError reports a failure to read or decode the request body: 413
+// when maxBytesMiddleware cut the body off, otherwise 400 with msg.
+func writeBodyError(w http.ResponseWriter, err error, msg string) {
+    var tooLarge *http.MaxBytesError
+    if errors.As(err, &tooLarge) {
+        writeError(w, http.StatusRequestEntityTooLarge, "BODY_TOO_LARGE",
+            fmt.Sprintf("Request body must not exceed %d bytes", tooLarge.Limit))
+        return
+    }
+    writeError(w, http.StatusBadRequest, "INVALID_BODY", msg)
+}
+
+// sanitizeError returns the message a client may see for an internal error.
+// Outside development, raw error strings (SQL errors, driver messages, stack
+// traces wrapped into errors) are replaced by a generic message.
+func sanitizeError(err error, env string) string {
+    if env == "development" {
+        return err.Error()
+    }
+    return genericInternalError
+}
+
+// writeInternalError logs err in full, tagged with the request ID, and sends
+// the client a 500 with the sanitized message.
+func writeInternalError(w http.ResponseWriter, r *http.Request, err error) {
+    requestLogger(r.Context()).Error("internal error", "status_code", http.StatusInternalServerError, "error", err)
+    writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", sanitizeError(err, appEnv))
+}
+
+// writeVersionConflict answers an update whose version no longer matches the
+// stored item. The current version is included so the client can refetch and
+// retry.
+func writeVersionConflict(w http.ResponseWriter, current int) {
+    writeErrorDetails(w, http.StatusConflict, "VERSION_CONFLICT", "The item was modified by another request", map[string]int{
+        "current_version": current,
+    })
+}
+
+// isDuplicateName reports whether err violates the case-insensitive unique
+// index on live item names.
+func isDuplicateName(err error) bool {
+    var pqErr *pq.Error
+    return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "items_name_lower_key"
+}
+
+func writeDuplicateName(w http.ResponseWriter) {
+    writeError(w, http.StatusConflict, "DUPLICATE_NAME", "an item with this name already exists")
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "encoding/xml"
+    "net/http"
+    "strings"
+)
+
+// itemVersionHeader carries the new item version on 204 responses to
+// PUT /items/{id}, which have no body to report it in.
+const itemVersionHeader = "X-Item-Version"
+
+// itemETag is a strong validator for the JSON representation of item, as
+// served by GET /items/{id}. Any change to a field changes the tag.
+func itemETag(item Item) string {
+    return jsonETag(item)
+}
+
+// jsonETag hashes the JSON encoding of payload, so each response shape of an
+// item gets its own tag.
+func jsonETag(payload interface{}) string {
+    body, _ := json.Marshal(payload)
+    sum := sha256.Sum256(body)
+    return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// etagMatches reports whether the If-None-Match header of r lists etag, using
+// the weak comparison RFC 9110 prescribes for If-None-Match.
+func etagMatches(r *http.Request, etag string) bool {
+    for _, value := range r.Header.Values("If-None-Match") {
+        for _, candidate := range strings.Split(value, ",") {
+            candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+            if candidate == "*" || candidate == etag {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// xmlETag is jsonETag for the XML representation of payload.
+func xmlETag(payload interface{}) string {
+    body, _ := xml.Marshal(payload)
+    sum := sha256.Sum256(body)
+    return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// writeItem sends item as XML or JSON, as negotiated, in the envelope if the
+// client asked for it, with its ETag, or 304 Not Modified when the client
+// already holds that representation.
+func writeItem(w http.ResponseWriter, r *http.Request, item Item) {
+    if negotiateFormat(r) == "xml" {
+        etag := xmlETag(item)
+        w.Header().Set("ETag", etag)
+        if etagMatches(r, etag) {
+            w.Header().Add("Vary", "Accept")
+            w.WriteHeader(http.StatusNotModified)
+            return
+        }
+        writeXML(w, http.StatusOK, item)
+        return
+    }
+
+    var payload interface{} = item
+    if wantsEnvelope(w, r) {
+        payload = envelope{Data: item}
+    }
+    etag := jsonETag(payload)
+    w.Header().Set("ETag", etag)
+    if etagMatches(r, etag) {
+        w.Header().Del("Content-Type")
+        w.WriteHeader(http.StatusNotModified)
+        return
+    }
+    writeJSON(w, http.StatusOK, payload)
+}
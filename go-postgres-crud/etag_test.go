@@ -0,0 +1,91 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/DATA-DOG/go-sqlmock"
+)
+
+// conditionalGet fetches target with If-None-Match set to etag.
+func conditionalGet(h http.Handler, target, etag string) *httptest.ResponseRecorder {
+    r := httptest.NewRequest(http.MethodGet, target, nil)
+    r.Header.Set("If-None-Match", etag)
+    rec := httptest.NewRecorder()
+    h.ServeHTTP(rec, r)
+    return rec
+}
+
+func TestGetItemNotModified(t *testing.T) {
+    rt := newMockApp(t, storedItems(Item{ID: 1, Name: "Widget", Price: 9.99, Version: 1}))
+    rec := doRequest(t, rt, http.MethodGet, "/items/1", nil, "")
+    etag := rec.Header().Get("ETag")
+    if rec.Code != http.StatusOK || etag == "" {
+        t.Fatalf("status %d, ETag %q; want 200 with an ETag", rec.Code, etag)
+    }
+
+    for _, ifNoneMatch := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+        rec := conditionalGet(rt, "/items/1", ifNoneMatch)
+        if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+            t.Errorf("If-None-Match %s: status %d, %d body bytes; want an empty 304", ifNoneMatch, rec.Code, rec.Body.Len())
+        }
+        if rec.Header().Get("ETag") != etag {
+            t.Errorf("If-None-Match %s: 304 carries ETag %q, want %q", ifNoneMatch, rec.Header().Get("ETag"), etag)
+        }
+    }
+}
+
+func TestGetItemETagStaleAfterUpdate(t *testing.T) {
+    rt := newMockApp(t, storedItems(Item{ID: 1, Name: "Widget", Price: 9.99, Version: 1}))
+    oldETag := doRequest(t, rt, http.MethodGet, "/items/1", nil, "").Header().Get("ETag")
+
+    rec := doRequest(t, rt, http.MethodPut, "/items/1", Item{Name: "Widget", Price: 12.5, Version: 1}, testToken(t, nil))
+    newETag := rec.Header().Get("ETag")
+    if newETag == "" || newETag == oldETag {
+        t.Fatalf("PUT ETag = %q, want a new one (was %q)", newETag, oldETag)
+    }
+
+    rec = conditionalGet(rt, "/items/1", oldETag)
+    var got Item
+    decodeBody(t, rec, &got)
+    if rec.Code != http.StatusOK || got.Price != 12.5 {
+        t.Errorf("stale ETag: status %d, item %+v; want 200 with the update", rec.Code, got)
+    }
+    if rec.Header().Get("ETag") != newETag {
+        t.Errorf("GET ETag = %q, want the one PUT returned, %q", rec.Header().Get("ETag"), newETag)
+    }
+    if rec := conditionalGet(rt, "/items/1", newETag); rec.Code != http.StatusNotModified {
+        t.Errorf("ETag from PUT: status = %d, want 304", rec.Code)
+    }
+}
+
+func TestPatchItemSetsETag(t *testing.T) {
+    mock := mockDB(t)
+    rt := newStockRouter(t, mock)
+    current := Item{ID: 1, Name: "Widget", Price: 9.99, Version: 1}
+
+    mock.ExpectBegin()
+    mock.ExpectQuery(`FOR UPDATE`).WithArgs(1, defaultTenantID).WillReturnRows(lockedItemRows(current))
+    mock.ExpectQuery(`SELECT reserved_by FROM items`).WillReturnRows(sqlmock.NewRows([]string{"reserved_by"}))
+    mock.ExpectQuery(`UPDATE items SET name = \$1, version = version \+ 1 WHERE id = \$2 AND tenant_id = \$3 RETURNING`).
+        WithArgs("Gadget", 1, defaultTenantID).
+        WillReturnRows(lockedItemRows(Item{ID: 1, Name: "Gadget", Price: 9.99, Version: 2}))
+    mock.ExpectExec(`INSERT INTO audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+    mock.ExpectCommit()
+    mock.ExpectQuery(`FROM items WHERE id = \$1`).WillReturnRows(lockedItemRows(Item{ID: 1, Name: "Gadget", Price: 9.99, Version: 2}))
+    mock.ExpectQuery(`FROM item_categories`).WillReturnRows(sqlmock.NewRows([]string{"item_id", "id", "name", "slug"}))
+
+    rec := doRequest(t, rt, http.MethodPatch, "/items/1", map[string]string{"name": "Gadget"}, testToken(t, nil))
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+    }
+    var got Item
+    decodeBody(t, rec, &got)
+    if want := itemETag(got); rec.Header().Get("ETag") != want {
+        t.Errorf("ETag = %q, want %q, the tag of the returned item", rec.Header().Get("ETag"), want)
+    }
+    if rec.Header().Get("ETag") == itemETag(current) {
+        t.Error("PATCH kept the old ETag")
+    }
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "github.com/google/uuid"
+)
+
+const sseKeepAliveInterval = 15 * time.Second
+
+type priceChange struct {
+    ItemID int     `json:"-"`
+    Old    float64 `json:"old"`
+    New    float64 `json:"new"`
+}
+
+// priceChangeBus fans price changes out to the stream subscribers of each item.
+type priceChangeBus struct {
+    mu          sync.RWMutex
+    subscribers map[int]map[chan priceChange]struct{}
+}
+
+var priceChanges = &priceChangeBus{subscribers: map[int]map[chan priceChange]struct{}{}}
+
+func (b *priceChangeBus) Subscribe(itemID int) chan priceChange {
+    ch := make(chan priceChange, 16)
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    if b.subscribers[itemID] == nil {
+        b.subscribers[itemID] = map[chan priceChange]struct{}{}
+    }
+    b.subscribers[itemID][ch] = struct{}{}
+    return ch
+}
+
+func (b *priceChangeBus) Unsubscribe(itemID int, ch chan priceChange) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    delete(b.subscribers[itemID], ch)
+    if len(b.subscribers[itemID]) == 0 {
+        delete(b.subscribers, itemID)
+    }
+}
+
+// Publish never blocks: a subscriber that is not keeping up misses events
+// rather than stalling the handler that changed the price.
+func (b *priceChangeBus) Publish(change priceChange) {
+    b.mu.RLock()
+    defer b.mu.RUnlock()
+    for ch := range b.subscribers[change.ItemID] {
+        select {
+        case ch <- change:
+        default:
+        }
+    }
+}
+
+func (app *App) streamItemPrice(w http.ResponseWriter, r *http.Request) {
+    id, err := parseItemID(r.PathValue("id"))
+    if err != nil {
+        writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid item ID")
+        return
+    }
+    flusher, ok := w.(http.Flusher)
+    if !ok {
+        writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Streaming unsupported")
+        return
+    }
+
+    ctx := r.Context()
+    if _, err := app.stmts.fetchItem(ctx, tenantFromContext(ctx), id); err != nil {
+        if err == sql.ErrNoRows {
+            writeError(w, http.StatusNotFound, "NOT_FOUND", "Item not found")
+            return
+        }
+        writeInternalError(w, r, err)
+        return
+    }
+
+    changes := priceChanges.Subscribe(id)
+    defer priceChanges.Unsubscribe(id, changes)
+
+    w.Header().Set("Content-Type", "text/event-stream")
+    w.Header().Set("Cache-Control", "no-cache")
+    w.Header().Set("Connection", "keep-alive")
+    w.WriteHeader(http.StatusOK)
+    flusher.Flush()
+
+    keepAlive := time.NewTicker(sseKeepAliveInterval)
+    defer keepAlive.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-keepAlive.C:
+            fmt.Fprint(w, ": keep-alive\n\n")
+            flusher.Flush()
+        case change := <-changes:
+            data, err := json.Marshal(change)
+            if err != nil {
+                continue
+            }
+            fmt.Fprintf(w, "event: price-change\ndata: %s\n\n", data)
+            flusher.Flush()
+        }
+    }
+}
+
+// itemEvent is one mutation as sent on GET /items/stream. Kind is created,
+// updated, deleted or restored. Only streams of TenantID receive it.
+type itemEvent struct {
+    Kind     string
+    Item     Item
+    TenantID uuid.UUID
+}
+
+// pubsub fans item events out to every stream subscriber. Like
+// priceChangeBus, publishing never blocks on a slow subscriber.
+type pubsub struct {
+    mu          sync.RWMutex
+    subscribers []chan itemEvent
+}
+
+var itemEvents = &pubsub{}
+
+// sseMaxClients is SSE_MAX_CLIENTS, the cap on concurrent GET /items/stream
+// connections; sseClients counts the open ones.
+var (
+    sseMaxClients int64 = 100
+    sseClients    atomic.Int64
+)
+
+func (p *pubsub) Subscribe() chan itemEvent {
+    ch := make(chan itemEvent, 16)
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    p.subscribers = append(p.subscribers, ch)
+    return ch
+}
+
+func (p *pubsub) Unsubscribe(ch chan itemEvent) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    for i, subscriber := range p.subscribers {
+        if subscriber == ch {
+            p.subscribers = append(p.subscribers[:i], p.subscribers[i+1:]...)
+            return
+        }
+    }
+}
+
+func (p *pubsub) Publish(event itemEvent) {
+    p.mu.RLock()
+    defer p.mu.RUnlock()
+    for _, ch := range p.subscribers {
+        select {
+        case ch <- event:
+        default:
+        }
+    }
+}
+
+// notifyItemChange announces a committed mutation to stream subscribers and
+// webhooks and drops the cached item lists. event is one of the webhook event
+// names, e.g. item.created.
+func notifyItemChange(ctx context.Context, event string, item Item) {
+    evictItemLists()
+    itemEvents.Publish(itemEvent{Kind: strings.TrimPrefix(event, "item."), Item: item, TenantID: tenantFromContext(ctx)})
+    dispatchWebhook(ctx, event, item)
+}
+
+// streamItems sends every item mutation of the caller's tenant as a
+// server-sent event named after the kind of change, with the item as data.
+func streamItems(w http.ResponseWriter, r *http.Request) {
+    flusher, ok := w.(http.Flusher)
+    if !ok {
+        writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Streaming unsupported")
+        return
+    }
+    if sseClients.Add(1) > sseMaxClients {
+        sseClients.Add(-1)
+        writeError(w, http.StatusServiceUnavailable, "TOO_MANY_STREAMS", "Too many open streams, try again later")
+        return
+    }
+    defer sseClients.Add(-1)
+
+    events := itemEvents.Subscribe()
+    defer itemEvents.Unsubscribe(events)
+
+    w.Header().Set("Content-Type", "text/event-stream")
+    w.Header().Set("Cache-Control", "no-cache")
+    w.Header().Set("Connection", "keep-alive")
+    w.WriteHeader(http.StatusOK)
+    flusher.Flush()
+
+    ctx := r.Context()
+    tenantID := tenantFromContext(ctx)
+    keepAlive := time.NewTicker(sseKeepAliveInterval)
+    defer keepAlive.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-keepAlive.C:
+            fmt.Fprint(w, ": keep-alive\n\n")
+            flusher.Flush()
+        case event := <-events:
+            if event.TenantID != tenantID {
+                continue
+            }
+            data, err := json.Marshal(event.Item)
+            if err != nil {
+                continue
+            }
+            fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Kind, data)
+            flusher.Flush()
+        }
+    }
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "encoding/csv"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "strconv"
+
+    "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+var csvExportHeader = []string{"id", "name", "description", "price"}
+
+// getItemsCSV streams every item matching filters as CSV, ignoring
+// pagination. Rows are written as they are read, and the Content-Type is only
+// set once the query has succeeded so errors still get the JSON envelope.
+func getItemsCSV(w http.ResponseWriter, r *http.Request, filters ItemFilters) {
+    ctx := r.Context()
+
+    rows, err := queryItemsExport(ctx, filters)
+    if err != nil && filters.Q != "" && filters.FullText && isFullTextUnavailable(err) {
+        requestLogger(ctx).Warn("full-text search failed, falling back to ILIKE", "error", err)
+        filters.FullText = false
+        rows, err = queryItemsExport(ctx, filters)
+    }
+    if err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+    defer rows.Close()
+
+    w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+    w.Header().Set("Content-Disposition", `attachment; filename="items.csv"`)
+    writer := csv.NewWriter(w)
+    writer.Write(csvExportHeader)
+    for rows.Next() {
+        var item Item
+        if err := rows.Scan(&item.ID, &item.Name, &item.Description, &item.Price, &item.Version, &item.ImageURL, &item.SKU, &item.Metadata); err != nil {
+            // The status line is already sent; all that is left is to stop.
+            requestLogger(ctx).Error("csv export aborted", "error", err)
+            break
+        }
+        writer.Write([]string{
+            strconv.Itoa(item.ID),
+            item.Name,
+            item.Description,
+            strconv.FormatFloat(item.Price, 'f', -1, 64),
+        })
+    }
+    if err := rows.Err(); err != nil {
+        requestLogger(ctx).Error("csv export aborted", "error", err)
+    }
+    writer.Flush()
+}
+
+// exportItemsNDJSON streams every item matching the GET /items filters as
+// newline-delimited JSON, one item per line. Each row is encoded and flushed
+// as soon as it is read, so memory use does not grow with the result set. A
+// client that disconnects cancels r.Context(), which aborts the query. The
+// stream bypasses the FieldMapper middleware, so lines are aliased here.
+func (app *App) exportItemsNDJSON(w http.ResponseWriter, r *http.Request) error {
+    ctx := r.Context()
+    span, ctx := tracer.StartSpanFromContext(ctx, "exportItemsNDJSON", tracer.ResourceName("SELECT id, name, description, price FROM items"))
+    defer span.Finish()
+
+    filters, err := parseItemFilters(r)
+    if err != nil {
+        return &ValidationError{Code: "INVALID_QUERY", Message: err.Error()}
+    }
+    if filters.Keyset {
+        return &ValidationError{Code: "INVALID_QUERY", Message: "after is not supported by the export"}
+    }
+    filters.FullText = fullTextSearchAvailable
+    flusher, ok := w.(http.Flusher)
+    if !ok {
+        return errors.New("streaming unsupported")
+    }
+
+    rows, err := queryItemsExport(ctx, filters)
+    if err != nil && filters.Q != "" && filters.FullText && isFullTextUnavailable(err) {
+        requestLogger(ctx).Warn("full-text search failed, falling back to ILIKE", "error", err)
+        filters.FullText = false
+        rows, err = queryItemsExport(ctx, filters)
+    }
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+
+    w.Header().Set("Content-Type", "application/x-ndjson")
+    w.WriteHeader(http.StatusOK)
+    for rows.Next() {
+        var item Item
+        if err := rows.Scan(&item.ID, &item.Name, &item.Description, &item.Price, &item.Version, &item.ImageURL, &item.SKU, &item.Metadata); err != nil {
+            // The status line is already sent; all that is left is to stop.
+            requestLogger(ctx).Error("ndjson export aborted", "error", err)
+            return nil
+        }
+        line, err := json.Marshal(item)
+        if err == nil {
+            line, err = app.fields.Rewrite(line)
+        }
+        if err != nil {
+            requestLogger(ctx).Error("ndjson export aborted", "error", err)
+            return nil
+        }
+        if _, err := w.Write(append(line, '\n')); err != nil {
+            requestLogger(ctx).Info("ndjson export stopped", "error", err)
+            return nil
+        }
+        flusher.Flush()
+    }
+    if err := rows.Err(); err != nil && ctx.Err() == nil {
+        requestLogger(ctx).Error("ndjson export aborted", "error", err)
+    }
+    return nil
+}
+
+// queryItemsExport selects the items of the request's tenant.
+func queryItemsExport(ctx context.Context, filters ItemFilters) (*sql.Rows, error) {
+    filters.TenantID = tenantFromContext(ctx)
+    sqlStatement, args := buildItemsExportQuery(filters)
+    var rows *sql.Rows
+    err := withReadFallback(ctx, readDB(), func(q *sql.DB) error {
+        var err error
+        rows, err = q.QueryContext(ctx, sqlStatement, args...)
+        return err
+    })
+    return rows, err
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+    "bufio"
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "strings"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "github.com/DATA-DOG/go-sqlmock"
+)
+
+// exportRows is the result of the export query for items.
+func exportRows(items ...Item) *sqlmock.Rows {
+    rows := sqlmock.NewRows([]string{"id", "name", "description", "price", "version", "image_url", "sku", "metadata"})
+    for _, item := range items {
+        rows.AddRow(item.ID, item.Name, item.Description, item.Price, item.Version, item.ImageURL, item.SKU, nil)
+    }
+    return rows
+}
+
+func TestGetItemsCSV(t *testing.T) {
+    mock := mockDB(t)
+    mock.ExpectQuery(`SELECT id, name, description, price, .* FROM items WHERE tenant_id = \$1 AND deleted_at IS NULL AND price >= \$2 ORDER BY id$`).
+        WithArgs(defaultTenantID, 5.0).
+        WillReturnRows(exportRows(
+            Item{ID: 1, Name: `Widget, "Deluxe"`, Description: "line one\nline two", Price: 9.5, Version: 1},
+            Item{ID: 2, Name: "Gadget", Description: "plain", Price: 12, Version: 3},
+        ))
+
+    rec := doRequest(t, newMockApp(t, storedItems()), http.MethodGet, "/items?format=csv&min_price=5", nil, "")
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+    }
+    if got := rec.Header().Get("Content-Type"); got != "text/csv; charset=utf-8" {
+        t.Errorf("Content-Type = %q", got)
+    }
+    if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="items.csv"` {
+        t.Errorf("Content-Disposition = %q", got)
+    }
+
+    wantBody := "id,name,description,price\n" +
+        "1,\"Widget, \"\"Deluxe\"\"\",\"line one\nline two\",9.5\n" +
+        "2,Gadget,plain,12\n"
+    if rec.Body.String() != wantBody {
+        t.Errorf("body =\n%s\nwant\n%s", rec.Body, wantBody)
+    }
+    records, err := csv.NewReader(strings.NewReader(rec.Body.String())).ReadAll()
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := [][]string{
+        csvExportHeader,
+        {"1", `Widget, "Deluxe"`, "line one\nline two", "9.5"},
+        {"2", "Gadget", "plain", "12"},
+    }
+    if !reflect.DeepEqual(records, want) {
+        t.Errorf("records = %q, want %q", records, want)
+    }
+}
+
+func TestGetItemsCSVEmpty(t *testing.T) {
+    mock := mockDB(t)
+    mock.ExpectQuery(`FROM items`).WillReturnRows(exportRows())
+
+    rec := doRequest(t, newMockApp(t, storedItems()), http.MethodGet, "/items?format=csv", nil, "")
+    if rec.Code != http.StatusOK || rec.Body.String() != "id,name,description,price\n" {
+        t.Errorf("status %d, body %q; want only the header row", rec.Code, rec.Body)
+    }
+}
+
+// slowStream delays every write of a response, standing in for a slow
+// network, and counts the writes.
+type slowStream struct {
+    http.ResponseWriter
+    writes *atomic.Int32
+}
+
+func (s slowStream) Write(p []byte) (int, error) {
+    time.Sleep(time.Millisecond)
+    s.writes.Add(1)
+    return s.ResponseWriter.Write(p)
+}
+
+func (s slowStream) Flush() {
+    s.ResponseWriter.(http.Flusher).Flush()
+}
+
+func TestExportItemsNDJSONStopsWhenClientDisconnects(t *testing.T) {
+    mock := mockDB(t)
+    items := make([]Item, 1000)
+    for i := range items {
+        items[i] = Item{ID: i + 1, Name: fmt.Sprintf("Item %d", i+1), Price: 1, Version: 1}
+    }
+    mock.ExpectQuery(`FROM items WHERE tenant_id = \$1 AND deleted_at IS NULL ORDER BY id$`).
+        WillReturnRows(exportRows(items...)).RowsWillBeClosed()
+
+    rt := newTestRouter(NewApp(storedItems(), nil, nil, NewFieldMapper(nil, time.Time{})))
+    var writes atomic.Int32
+    var ctxErr error
+    done := make(chan struct{})
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        defer close(done)
+        rt.ServeHTTP(slowStream{ResponseWriter: w, writes: &writes}, r)
+        ctxErr = r.Context().Err()
+    }))
+    defer server.Close()
+
+    resp, err := http.Get(server.URL + "/items/export")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusOK || got != "application/x-ndjson" {
+        t.Fatalf("status %d, Content-Type %q; want 200 application/x-ndjson", resp.StatusCode, got)
+    }
+    lines := bufio.NewScanner(resp.Body)
+    for want := 1; want <= 5; want++ {
+        if !lines.Scan() {
+            t.Fatalf("stream ended before line %d: %v", want, lines.Err())
+        }
+        var item Item
+        if err := json.Unmarshal(lines.Bytes(), &item); err != nil || item.ID != want {
+            t.Fatalf("line %d = %s, %v; want item %d", want, lines.Bytes(), err, want)
+        }
+    }
+    // Closing the body before the end drops the connection.
+    resp.Body.Close()
+
+    select {
+    case <-done:
+    case <-time.After(5 * time.Second):
+        t.Fatal("the export kept running after the client disconnected")
+    }
+    if ctxErr == nil {
+        t.Error("the request context was not cancelled")
+    }
+    if n := writes.Load(); n >= int32(len(items)) {
+        t.Errorf("the export wrote %d lines, want it to stop early", n)
+    }
+}
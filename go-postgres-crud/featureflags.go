@@ -0,0 +1,165 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "hash/fnv"
+    "log/slog"
+    "net/http"
+    "sort"
+    "strings"
+    "sync/atomic"
+    "time"
+
+    "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+const featureFlagRefreshInterval = 60 * time.Second
+
+// FeatureFlag is a row of the feature_flags table. An enabled flag applies to
+// RolloutPercentage percent of requests.
+type FeatureFlag struct {
+    Name              string `json:"name"`
+    Enabled           bool   `json:"enabled"`
+    RolloutPercentage int    `json:"rollout_percentage"`
+}
+
+// FeatureFlags serves flag lookups from an in-memory copy of the
+// feature_flags table. The copy is swapped atomically, so a refresh never
+// exposes a half-loaded set.
+type FeatureFlags struct {
+    db    *sql.DB
+    flags atomic.Pointer[map[string]FeatureFlag]
+}
+
+func NewFeatureFlags(db *sql.DB) *FeatureFlags {
+    f := &FeatureFlags{db: db}
+    f.flags.Store(&map[string]FeatureFlag{})
+    return f
+}
+
+// Load replaces the in-memory flags with the contents of the table.
+func (f *FeatureFlags) Load(ctx context.Context) error {
+    rows, err := f.db.QueryContext(ctx, `SELECT flag_name, enabled, rollout_percentage FROM feature_flags`)
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+    flags := map[string]FeatureFlag{}
+    for rows.Next() {
+        var flag FeatureFlag
+        if err := rows.Scan(&flag.Name, &flag.Enabled, &flag.RolloutPercentage); err != nil {
+            return err
+        }
+        flags[flag.Name] = flag
+    }
+    if err := rows.Err(); err != nil {
+        return err
+    }
+    f.flags.Store(&flags)
+    return nil
+}
+
+// Watch reloads the flags every interval. A failed reload keeps the previous
+// flags in place.
+func (f *FeatureFlags) Watch(interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for range ticker.C {
+        if err := f.Load(context.Background()); err != nil {
+            slog.Error("error reloading feature flags", "error", err)
+        }
+    }
+}
+
+// IsEnabled reports whether the named flag applies to the current request.
+// Unknown and disabled flags are off. For a partial rollout the request ID is
+// hashed together with the flag name, so a request lands in the same bucket
+// for every check of one flag while different flags roll out to different
+// requests. Without a request ID only a full rollout applies.
+func (f *FeatureFlags) IsEnabled(ctx context.Context, name string) bool {
+    flag, ok := (*f.flags.Load())[name]
+    if !ok || !flag.Enabled {
+        return false
+    }
+    if flag.RolloutPercentage >= 100 {
+        return true
+    }
+    requestID := requestIDFromContext(ctx)
+    if requestID == "" {
+        return false
+    }
+    return rolloutBucket(name, requestID) < flag.RolloutPercentage
+}
+
+// rolloutBucket maps a flag and request ID to a bucket in [0, 100).
+func rolloutBucket(name, requestID string) int {
+    h := fnv.New32a()
+    h.Write([]byte(name))
+    h.Write([]byte{0})
+    h.Write([]byte(requestID))
+    return int(h.Sum32() % 100)
+}
+
+func (f *FeatureFlags) listFlags(w http.ResponseWriter, r *http.Request) error {
+    span, _ := tracer.StartSpanFromContext(r.Context(), "listFlags")
+    defer span.Finish()
+
+    current := *f.flags.Load()
+    flags := make([]FeatureFlag, 0, len(current))
+    for _, flag := range current {
+        flags = append(flags, flag)
+    }
+    sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+    writeJSON(w, http.StatusOK, flags)
+    return nil
+}
+
+type flagUpdate struct {
+    Enabled           *bool `json:"enabled"`
+    RolloutPercentage *int  `json:"rollout_percentage"`
+}
+
+// updateFlag creates or changes a flag. Omitted fields keep their stored
+// value; a new flag defaults to disabled with a full rollout. The change
+// applies on this instance at once and on the others at their next refresh.
+func (f *FeatureFlags) updateFlag(w http.ResponseWriter, r *http.Request) error {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "updateFlag", tracer.ResourceName("INSERT INTO feature_flags"))
+    defer span.Finish()
+
+    name := strings.TrimSpace(r.PathValue("name"))
+    if name == "" {
+        return &ValidationError{Code: "INVALID_FLAG", Message: "Flag name must not be empty"}
+    }
+    var update flagUpdate
+    if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+        return bodyError(err, "Request body is not valid JSON")
+    }
+    if update.Enabled == nil && update.RolloutPercentage == nil {
+        return &ValidationError{Code: "INVALID_BODY", Message: "At least one of enabled or rollout_percentage is required"}
+    }
+    if p := update.RolloutPercentage; p != nil && (*p < 0 || *p > 100) {
+        return &ValidationError{Code: "INVALID_BODY", Message: "rollout_percentage must be between 0 and 100"}
+    }
+
+    sqlStatement := `INSERT INTO feature_flags (flag_name, enabled, rollout_percentage)
+        VALUES ($1, COALESCE($2, FALSE), COALESCE($3, 100))
+        ON CONFLICT (flag_name) DO UPDATE SET
+            enabled = COALESCE($2, feature_flags.enabled),
+            rollout_percentage = COALESCE($3, feature_flags.rollout_percentage)
+        RETURNING flag_name, enabled, rollout_percentage`
+    var flag FeatureFlag
+    err := f.db.QueryRowContext(ctx, sqlStatement, name, update.Enabled, update.RolloutPercentage).Scan(&flag.Name, &flag.Enabled, &flag.RolloutPercentage)
+    if err != nil {
+        return err
+    }
+    requestLogger(ctx).Info("feature flag updated", "flag", flag.Name, "enabled", flag.Enabled, "rollout_percentage", flag.RolloutPercentage)
+
+    if err := f.Load(ctx); err != nil {
+        requestLogger(ctx).Error("error reloading feature flags", "error", err)
+    }
+    writeJSON(w, http.StatusOK, flag)
+    return nil
+}
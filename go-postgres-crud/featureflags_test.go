@@ -0,0 +1,129 @@
+package main
+
+import (
+    "context"
+    "net/http"
+    "testing"
+
+    "github.com/DATA-DOG/go-sqlmock"
+    "github.com/golang-jwt/jwt/v5"
+    "github.com/google/uuid"
+)
+
+// flagsWith returns FeatureFlags holding flags, without a database.
+func flagsWith(flags ...FeatureFlag) *FeatureFlags {
+    f := NewFeatureFlags(nil)
+    byName := map[string]FeatureFlag{}
+    for _, flag := range flags {
+        byName[flag.Name] = flag
+    }
+    f.flags.Store(&byName)
+    return f
+}
+
+func withRequestID(id string) context.Context {
+    return context.WithValue(context.Background(), requestIDKey{}, id)
+}
+
+func TestFeatureFlagHalfRollout(t *testing.T) {
+    flags := flagsWith(FeatureFlag{Name: "new_search_algorithm", Enabled: true, RolloutPercentage: 50})
+    const requests = 10000
+    enabled := 0
+    for i := 0; i < requests; i++ {
+        ctx := withRequestID(uuid.NewSHA1(uuid.NameSpaceOID, []byte{byte(i >> 8), byte(i)}).String())
+        on := flags.IsEnabled(ctx, "new_search_algorithm")
+        if on {
+            enabled++
+        }
+        // A request gets the same answer on every check.
+        if flags.IsEnabled(ctx, "new_search_algorithm") != on {
+            t.Fatal("a request changed buckets between two checks")
+        }
+    }
+    // The IDs are fixed, so the count is too; a fair hash lands within four
+    // standard deviations (50 each) of 5000.
+    if enabled < 4800 || enabled > 5200 {
+        t.Errorf("%d of %d requests enabled, want about half", enabled, requests)
+    }
+}
+
+func TestFeatureFlagIsEnabled(t *testing.T) {
+    flags := flagsWith(
+        FeatureFlag{Name: "full", Enabled: true, RolloutPercentage: 100},
+        FeatureFlag{Name: "none", Enabled: true, RolloutPercentage: 0},
+        FeatureFlag{Name: "off", Enabled: false, RolloutPercentage: 100},
+        FeatureFlag{Name: "half", Enabled: true, RolloutPercentage: 50},
+    )
+    tests := []struct {
+        flag      string
+        requestID string
+        want      bool
+    }{
+        {"full", "req-1", true},
+        {"full", "", true},
+        {"none", "req-1", false},
+        {"off", "req-1", false},
+        {"unknown", "req-1", false},
+        {"half", "", false},
+    }
+    for _, tt := range tests {
+        if got := flags.IsEnabled(withRequestID(tt.requestID), tt.flag); got != tt.want {
+            t.Errorf("IsEnabled(%s) with request ID %q = %v, want %v", tt.flag, tt.requestID, got, tt.want)
+        }
+    }
+}
+
+func TestFeatureFlagsLoad(t *testing.T) {
+    mock := mockDB(t)
+    flags := NewFeatureFlags(db)
+    mock.ExpectQuery(`SELECT flag_name, enabled, rollout_percentage FROM feature_flags`).
+        WillReturnRows(sqlmock.NewRows([]string{"flag_name", "enabled", "rollout_percentage"}).AddRow("beta", true, 100))
+    if err := flags.Load(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    if !flags.IsEnabled(context.Background(), "beta") {
+        t.Error("beta is off after loading it enabled")
+    }
+
+    // A failed reload keeps the flags already loaded.
+    mock.ExpectQuery(`FROM feature_flags`).WillReturnError(sqlmock.ErrCancelled)
+    if err := flags.Load(context.Background()); err == nil {
+        t.Fatal("Load succeeded on a failed query")
+    }
+    if !flags.IsEnabled(context.Background(), "beta") {
+        t.Error("a failed reload dropped beta")
+    }
+}
+
+func TestUpdateFlagAppliesAtOnce(t *testing.T) {
+    mock := mockDB(t)
+    flags := NewFeatureFlags(db)
+    rt := newTestRouter(NewApp(storedItems(), nil, flags, nil))
+    admin := testToken(t, jwt.MapClaims{"role": "admin"})
+
+    mock.ExpectQuery(`INSERT INTO feature_flags`).WithArgs("beta", true, nil).
+        WillReturnRows(sqlmock.NewRows([]string{"flag_name", "enabled", "rollout_percentage"}).AddRow("beta", true, 100))
+    mock.ExpectQuery(`SELECT flag_name, enabled, rollout_percentage FROM feature_flags`).
+        WillReturnRows(sqlmock.NewRows([]string{"flag_name", "enabled", "rollout_percentage"}).AddRow("beta", true, 100))
+    rec := doRequest(t, rt, http.MethodPut, "/admin/flags/beta", map[string]bool{"enabled": true}, admin)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+    }
+    if !flags.IsEnabled(context.Background(), "beta") {
+        t.Error("beta is still off after enabling it")
+    }
+
+    var listed []FeatureFlag
+    rec = doRequest(t, rt, http.MethodGet, "/admin/flags", nil, admin)
+    decodeBody(t, rec, &listed)
+    if len(listed) != 1 || listed[0] != (FeatureFlag{Name: "beta", Enabled: true, RolloutPercentage: 100}) {
+        t.Errorf("GET /admin/flags = %+v, want beta", listed)
+    }
+
+    for _, body := range []interface{}{map[string]int{"rollout_percentage": 101}, map[string]string{}} {
+        rec := doRequest(t, rt, http.MethodPut, "/admin/flags/beta", body, admin)
+        if rec.Code != http.StatusBadRequest || errorCode(t, rec) != "INVALID_BODY" {
+            t.Errorf("PUT %v: status %d, body %s; want 400 INVALID_BODY", body, rec.Code, rec.Body)
+        }
+    }
+}
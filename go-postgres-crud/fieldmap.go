@@ -0,0 +1,183 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strings"
+    "time"
+)
+
+// FieldMapper renames JSON keys in API responses so legacy clients can keep
+// reading the field names they were built against, e.g. {"name":"item_name"}.
+// Until keepOriginalUntil has passed, both the original and the aliased key are
+// emitted so clients can migrate at their own pace.
+type FieldMapper struct {
+    fields            map[string]string
+    keepOriginalUntil time.Time
+}
+
+func NewFieldMapper(fields map[string]string, keepOriginalUntil time.Time) *FieldMapper {
+    return &FieldMapper{fields: fields, keepOriginalUntil: keepOriginalUntil}
+}
+
+// ParseFieldMap decodes the RESPONSE_FIELD_MAP JSON object.
+func ParseFieldMap(raw string) (map[string]string, error) {
+    fields := map[string]string{}
+    if strings.TrimSpace(raw) == "" {
+        return fields, nil
+    }
+    if err := json.Unmarshal([]byte(raw), &fields); err != nil {
+        return nil, fmt.Errorf("invalid field map: %w", err)
+    }
+    for from, to := range fields {
+        if from == "" || to == "" {
+            return nil, fmt.Errorf("invalid field map: empty field name in %q -> %q", from, to)
+        }
+    }
+    return fields, nil
+}
+
+// Rewrite applies the field map to every object in a serialized JSON document.
+func (m *FieldMapper) Rewrite(body []byte) ([]byte, error) {
+    if len(m.fields) == 0 {
+        return body, nil
+    }
+    return m.rewrite(json.RawMessage(body), time.Now().Before(m.keepOriginalUntil))
+}
+
+func (m *FieldMapper) rewrite(raw json.RawMessage, keepOriginal bool) (json.RawMessage, error) {
+    trimmed := bytes.TrimSpace(raw)
+    if len(trimmed) == 0 {
+        return raw, nil
+    }
+
+    switch trimmed[0] {
+    case '{':
+        var object map[string]json.RawMessage
+        if err := json.Unmarshal(trimmed, &object); err != nil {
+            return nil, err
+        }
+        mapped := make(map[string]json.RawMessage, len(object))
+        for key, value := range object {
+            value, err := m.rewrite(value, keepOriginal)
+            if err != nil {
+                return nil, err
+            }
+            alias, ok := m.fields[key]
+            if !ok {
+                mapped[key] = value
+                continue
+            }
+            mapped[alias] = value
+            if keepOriginal {
+                mapped[key] = value
+            }
+        }
+        return json.Marshal(mapped)
+    case '[':
+        var array []json.RawMessage
+        if err := json.Unmarshal(trimmed, &array); err != nil {
+            return nil, err
+        }
+        for i, value := range array {
+            value, err := m.rewrite(value, keepOriginal)
+            if err != nil {
+                return nil, err
+            }
+            array[i] = value
+        }
+        return json.Marshal(array)
+    default:
+        return raw, nil
+    }
+}
+
+// Middleware buffers JSON responses from next and rewrites their keys before
+// they are sent to the client. Other responses, including streams, are passed
+// through untouched.
+func (m *FieldMapper) Middleware(next http.Handler) http.Handler {
+    if len(m.fields) == 0 {
+        return next
+    }
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        fw := &fieldMapWriter{ResponseWriter: w, status: http.StatusOK}
+        next.ServeHTTP(fw, r)
+        if !fw.buffering {
+            return
+        }
+
+        body := fw.body.Bytes()
+        if len(bytes.TrimSpace(body)) > 0 {
+            rewritten, err := m.Rewrite(body)
+            if err == nil {
+                body = append(rewritten, '\n')
+            }
+        }
+        w.Header().Del("Content-Length")
+        w.WriteHeader(fw.status)
+        w.Write(body)
+    })
+}
+
+// fieldMapWriter decides on the first WriteHeader or Write whether the
+// response is JSON. JSON is buffered for rewriting; anything else goes
+// straight to the client.
+type fieldMapWriter struct {
+    http.ResponseWriter
+    status    int
+    decided   bool
+    buffering bool
+    body      bytes.Buffer
+}
+
+func (f *fieldMapWriter) decide() {
+    if f.decided {
+        return
+    }
+    f.decided = true
+    f.buffering = isJSONContentType(f.Header().Get("Content-Type"))
+}
+
+func (f *fieldMapWriter) WriteHeader(status int) {
+    f.decide()
+    if f.buffering {
+        f.status = status
+        return
+    }
+    f.ResponseWriter.WriteHeader(status)
+}
+
+func (f *fieldMapWriter) Write(p []byte) (int, error) {
+    f.decide()
+    if f.buffering {
+        return f.body.Write(p)
+    }
+    return f.ResponseWriter.Write(p)
+}
+
+func (f *fieldMapWriter) Flush() {
+    if f.buffering {
+        return
+    }
+    if flusher, ok := f.ResponseWriter.(http.Flusher); ok {
+        flusher.Flush()
+    }
+}
+
+// bufferedResponseWriter holds back the status code and body so a middleware
+// can inspect or transform them after the handler returns.
+type bufferedResponseWriter struct {
+    http.ResponseWriter
+    status int
+    body   bytes.Buffer
+}
+
+func (b *bufferedResponseWriter) WriteHeader(status int) {
+    b.status = status
+}
+
+func (b *bufferedResponseWriter) Write(p []byte) (int, error) {
+    return b.body.Write(p)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+func TestNewAppDefaultsFieldMapper(t *testing.T) {
+    app := NewApp(nil, nil, nil, nil)
+    if app.fields == nil {
+        t.Fatal("NewApp left fields nil")
+    }
+    body := []byte(`{"name":"widget"}`)
+    got, err := app.fields.Rewrite(body)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if string(got) != string(body) {
+        t.Errorf("default mapper rewrote %s to %s", body, got)
+    }
+}
+
+func TestFieldMapperMiddleware(t *testing.T) {
+    tests := []struct {
+        name              string
+        keepOriginalUntil time.Time
+        want              map[string]bool
+    }{
+        {"aliases only", time.Time{}, map[string]bool{"item_name": true, "price": true}},
+        {"keeps originals", time.Now().Add(time.Hour), map[string]bool{"item_name": true, "name": true, "price": true}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            mapper := NewFieldMapper(map[string]string{"name": "item_name"}, tt.keepOriginalUntil)
+            handler := mapper.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                writeJSON(w, http.StatusCreated, []Item{{Name: "widget", Price: 2}})
+            }))
+            rec := httptest.NewRecorder()
+            handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/items", nil))
+
+            if rec.Code != http.StatusCreated {
+                t.Errorf("status = %d, want %d", rec.Code, http.StatusCreated)
+            }
+            var items []map[string]interface{}
+            if err := json.Unmarshal(rec.Body.Bytes(), &items); err != nil {
+                t.Fatalf("body %q: %v", rec.Body, err)
+            }
+            if len(items) != 1 {
+                t.Fatalf("got %d items, want 1", len(items))
+            }
+            for key, want := range tt.want {
+                if _, ok := items[0][key]; ok != want {
+                    t.Errorf("key %q present = %v, want %v", key, ok, want)
+                }
+            }
+            if _, ok := items[0]["name"]; ok && !tt.want["name"] {
+                t.Error("original key name was kept after the migration period")
+            }
+        })
+    }
+}
+
+func TestFieldMapperLeavesStreamsAlone(t *testing.T) {
+    mapper := NewFieldMapper(map[string]string{"name": "item_name"}, time.Time{})
+    handler := mapper.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "text/event-stream")
+        w.Write([]byte(`data: {"name":"widget"}` + "\n\n"))
+    }))
+    rec := httptest.NewRecorder()
+    handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/items/stream", nil))
+
+    if got, want := rec.Body.String(), `data: {"name":"widget"}`+"\n\n"; got != want {
+        t.Errorf("body = %q, want %q", got, want)
+    }
+}
@@ -0,0 +1,232 @@
+package main
+
+//go:generate buf generate --template buf.gen.yaml
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "log/slog"
+
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/health/grpc_health_v1"
+    "google.golang.org/grpc/metadata"
+    "google.golang.org/grpc/status"
+
+    itemspb "go-postgres-crud/proto"
+)
+
+// itemServer serves the ItemService RPCs from the same repository as the
+// REST handlers, with the same validation, cache eviction and change
+// notifications.
+type itemServer struct {
+    itemspb.UnimplementedItemServiceServer
+    app *App
+}
+
+// newGRPCServer returns a gRPC server for app. Like the REST API, reads are
+// public and writes need a bearer token.
+func newGRPCServer(app *App) *grpc.Server {
+    server := grpc.NewServer(grpc.UnaryInterceptor(grpcAuthInterceptor))
+    itemspb.RegisterItemServiceServer(server, &itemServer{app: app})
+    grpc_health_v1.RegisterHealthServer(server, healthServer{})
+    return server
+}
+
+// healthServer implements grpc.health.v1.Health for grpc_health_probe and
+// Kubernetes gRPC probes. Like /healthz it pings the database on every
+// check: SERVING while it answers, NOT_SERVING otherwise. It knows the
+// server as a whole ("") and the ItemService. Watch is not supported.
+type healthServer struct {
+    grpc_health_v1.UnimplementedHealthServer
+}
+
+func (healthServer) Check(ctx context.Context, req *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+    if req.Service != "" && req.Service != itemspb.ItemService_ServiceDesc.ServiceName {
+        return nil, status.Errorf(codes.NotFound, "unknown service %q", req.Service)
+    }
+    ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+    defer cancel()
+    if err := db.PingContext(ctx); err != nil {
+        slog.Warn("gRPC health check failed", "error", err)
+        return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_NOT_SERVING}, nil
+    }
+    return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}, nil
+}
+
+// stopGRPCServer lets in-flight RPCs finish until ctx, the shutdown
+// deadline of the HTTP server, is done, then closes the remaining
+// connections.
+func stopGRPCServer(ctx context.Context, server *grpc.Server) {
+    stopped := make(chan struct{})
+    go func() {
+        server.GracefulStop()
+        close(stopped)
+    }()
+    select {
+    case <-stopped:
+    case <-ctx.Done():
+        slog.Error("graceful gRPC shutdown did not complete", "error", ctx.Err())
+        server.Stop()
+    }
+}
+
+// grpcReadMethods need no token.
+var grpcReadMethods = map[string]bool{
+    itemspb.ItemService_GetItem_FullMethodName:   true,
+    itemspb.ItemService_ListItems_FullMethodName: true,
+    grpc_health_v1.Health_Check_FullMethodName:   true,
+}
+
+// grpcAuthInterceptor validates the authorization metadata of write RPCs
+// and stores the token's user in the context, as jwtMiddleware does. Like
+// tenantMiddleware it stores the token's tenant for every RPC: reads without
+// a token see the default tenant, and a token sent with a read must be valid.
+func grpcAuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+    var header string
+    if md, ok := metadata.FromIncomingContext(ctx); ok {
+        if values := md.Get("authorization"); len(values) > 0 {
+            header = values[0]
+        }
+    }
+    if grpcReadMethods[info.FullMethod] && header == "" {
+        return handler(withTenant(ctx, defaultTenantID), req)
+    }
+    claims, err := parseAuthorization(header)
+    if err != nil {
+        return nil, status.Error(codes.Unauthenticated, err.Error())
+    }
+    tenantID, err := tenantClaim(claims)
+    if err != nil {
+        return nil, status.Error(codes.Unauthenticated, err.Error())
+    }
+    ctx = withTenant(ctx, tenantID)
+    if grpcReadMethods[info.FullMethod] {
+        return handler(ctx, req)
+    }
+    userID, err := userIDClaim(claims)
+    if err != nil {
+        return nil, status.Error(codes.Unauthenticated, err.Error())
+    }
+    ctx = context.WithValue(ctx, userIDKey{}, userID)
+    ctx = context.WithValue(ctx, authMethodKey{}, authMethodJWT)
+    ctx = withRole(ctx, claims)
+    return handler(ctx, req)
+}
+
+func (s *itemServer) CreateItem(ctx context.Context, req *itemspb.CreateItemRequest) (*itemspb.Item, error) {
+    item := Item{Name: req.Name, Description: req.Description, Price: req.Price}
+    if err := validateItem(ctx, item); err != nil {
+        return nil, grpcError(err)
+    }
+    item, err := s.app.items.Create(ctx, tenantFromContext(ctx), item, "")
+    if err != nil {
+        return nil, grpcError(err)
+    }
+    notifyItemChange(ctx, eventItemCreated, item)
+    return itemToProto(item), nil
+}
+
+func (s *itemServer) ListItems(ctx context.Context, req *itemspb.ListItemsRequest) (*itemspb.ListItemsResponse, error) {
+    limit, offset := int(req.Limit), int(req.Offset)
+    switch {
+    case limit < 0 || offset < 0:
+        return nil, status.Error(codes.InvalidArgument, "limit and offset must not be negative")
+    case limit > maxPageLimit:
+        return nil, status.Errorf(codes.InvalidArgument, "limit must not exceed %d", maxPageLimit)
+    case limit == 0:
+        limit = defaultPageLimit
+    }
+    page, err := s.app.items.GetAll(ctx, tenantFromContext(ctx), ItemFilters{Limit: limit, Offset: offset})
+    if err != nil {
+        return nil, grpcError(err)
+    }
+    resp := &itemspb.ListItemsResponse{Total: int32(page.Total), Limit: int32(page.Limit), Offset: int32(page.Offset)}
+    for _, item := range page.Items {
+        resp.Items = append(resp.Items, itemToProto(item))
+    }
+    return resp, nil
+}
+
+func (s *itemServer) GetItem(ctx context.Context, req *itemspb.GetItemRequest) (*itemspb.Item, error) {
+    tenantID := tenantFromContext(ctx)
+    if item, ok := cachedItem(tenantID, int(req.Id)); ok {
+        return itemToProto(item), nil
+    }
+    item, err := s.app.items.GetByID(ctx, tenantID, int(req.Id))
+    if err != nil {
+        return nil, grpcError(err)
+    }
+    cacheItem(tenantID, item)
+    return itemToProto(item), nil
+}
+
+func (s *itemServer) UpdateItem(ctx context.Context, req *itemspb.UpdateItemRequest) (*itemspb.Item, error) {
+    item := Item{Name: req.Name, Description: req.Description, Price: req.Price, Version: int(req.Version)}
+    if err := validateItem(ctx, item); err != nil {
+        return nil, grpcError(err)
+    }
+    old, item, err := s.app.items.Update(ctx, tenantFromContext(ctx), int(req.Id), item)
+    if err != nil {
+        return nil, grpcError(err)
+    }
+    evictItem(item.ID)
+    if old.Price != item.Price {
+        priceChanges.Publish(priceChange{ItemID: item.ID, Old: old.Price, New: item.Price})
+    }
+    notifyItemChange(ctx, eventItemUpdated, item)
+    return itemToProto(item), nil
+}
+
+func (s *itemServer) DeleteItem(ctx context.Context, req *itemspb.DeleteItemRequest) (*itemspb.DeleteItemResponse, error) {
+    old, err := s.app.items.Delete(ctx, tenantFromContext(ctx), int(req.Id))
+    if err != nil {
+        return nil, grpcError(err)
+    }
+    evictItem(old.ID)
+    notifyItemChange(ctx, eventItemDeleted, old)
+    return &itemspb.DeleteItemResponse{}, nil
+}
+
+func itemToProto(item Item) *itemspb.Item {
+    return &itemspb.Item{
+        Id:          int64(item.ID),
+        Name:        item.Name,
+        Description: item.Description,
+        Price:       item.Price,
+        Version:     int64(item.Version),
+    }
+}
+
+// grpcError maps repository and validation errors to status codes, as
+// handleError maps them to HTTP statuses.
+func grpcError(err error) error {
+    var versionErr *versionConflictError
+    switch {
+    case err == sql.ErrNoRows:
+        return status.Error(codes.NotFound, "Item not found")
+    case errors.As(err, &versionErr):
+        return status.Error(codes.Aborted, err.Error())
+    case errors.Is(err, errDuplicateName):
+        return status.Error(codes.AlreadyExists, err.Error())
+    case errors.Is(err, errItemReserved):
+        return status.Error(codes.FailedPrecondition, err.Error())
+    case isItemValidationError(err):
+        return status.Error(codes.InvalidArgument, err.Error())
+    case errors.Is(err, context.Canceled):
+        return status.Error(codes.Canceled, err.Error())
+    case errors.Is(err, context.DeadlineExceeded):
+        return status.Error(codes.DeadlineExceeded, err.Error())
+    }
+    slog.Error("grpc request failed", "error", err)
+    return status.Error(codes.Internal, "internal error")
+}
+
+// isItemValidationError reports the errors validateItem returns.
+func isItemValidationError(err error) bool {
+    var violations validationErrors
+    var rangeErr *priceRangeError
+    var policyErr *contentPolicyError
+    return errors.As(err, &violations) || errors.As(err, &rangeErr) || errors.As(err, &policyErr)
+}
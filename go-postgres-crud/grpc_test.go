@@ -0,0 +1,148 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "net"
+    "testing"
+    "time"
+
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/credentials/insecure"
+    "google.golang.org/grpc/health/grpc_health_v1"
+    "google.golang.org/grpc/metadata"
+    "google.golang.org/grpc/status"
+    "google.golang.org/grpc/test/bufconn"
+
+    itemspb "go-postgres-crud/proto"
+)
+
+// newGRPCTestConn serves newGRPCServer(app) over an in-memory listener and
+// returns a client connection to it.
+func newGRPCTestConn(t *testing.T, app *App) *grpc.ClientConn {
+    t.Helper()
+    listener := bufconn.Listen(1 << 20)
+    server := newGRPCServer(app)
+    go server.Serve(listener)
+    conn, err := grpc.NewClient("passthrough:///bufnet",
+        grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+        grpc.WithTransportCredentials(insecure.NewCredentials()))
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() {
+        conn.Close()
+        server.Stop()
+    })
+    return conn
+}
+
+func TestGRPCHealthCheck(t *testing.T) {
+    mock := mockDB(t)
+    health := grpc_health_v1.NewHealthClient(newGRPCTestConn(t, NewApp(storedItems(), nil, nil, nil)))
+    ctx := context.Background()
+
+    mock.ExpectPing()
+    resp, err := health.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+    if err != nil || resp.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+        t.Errorf("Check with the database up = %v, %v; want SERVING", resp, err)
+    }
+
+    mock.ExpectPing()
+    resp, err = health.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: itemspb.ItemService_ServiceDesc.ServiceName})
+    if err != nil || resp.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+        t.Errorf("Check of the ItemService = %v, %v; want SERVING", resp, err)
+    }
+
+    mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+    resp, err = health.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+    if err != nil || resp.Status != grpc_health_v1.HealthCheckResponse_NOT_SERVING {
+        t.Errorf("Check with the database down = %v, %v; want NOT_SERVING", resp, err)
+    }
+
+    _, err = health.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: "unknown.Service"})
+    if status.Code(err) != codes.NotFound {
+        t.Errorf("Check of an unknown service: %v, want NotFound", err)
+    }
+}
+
+// TestGRPCItemService runs every ItemService RPC once over bufconn against
+// the same repository the REST handlers use.
+func TestGRPCItemService(t *testing.T) {
+    itemCache = newItemCache(1000, time.Minute)
+    client := itemspb.NewItemServiceClient(newGRPCTestConn(t, NewApp(storedItems(), nil, nil, nil)))
+    ctx := context.Background()
+    authorized := metadata.AppendToOutgoingContext(ctx, "authorization", testToken(t, nil))
+
+    created, err := client.CreateItem(authorized, &itemspb.CreateItemRequest{Name: "Widget", Description: "Small", Price: 9.99})
+    if err != nil || created.Id == 0 || created.Version != 1 {
+        t.Fatalf("CreateItem = %v, %v; want a new item at version 1", created, err)
+    }
+
+    got, err := client.GetItem(ctx, &itemspb.GetItemRequest{Id: created.Id})
+    if err != nil || got.Name != "Widget" || got.Price != 9.99 {
+        t.Errorf("GetItem without a token = %v, %v; want the created item", got, err)
+    }
+    list, err := client.ListItems(ctx, &itemspb.ListItemsRequest{})
+    if err != nil || list.Limit != defaultPageLimit {
+        t.Errorf("ListItems = %v, %v; want a page of the default size", list, err)
+    }
+
+    updated, err := client.UpdateItem(authorized, &itemspb.UpdateItemRequest{Id: created.Id, Name: "Gadget", Price: 12, Version: created.Version})
+    if err != nil || updated.Name != "Gadget" || updated.Version != 2 {
+        t.Errorf("UpdateItem = %v, %v; want version 2", updated, err)
+    }
+    if got, err := client.GetItem(ctx, &itemspb.GetItemRequest{Id: created.Id}); err != nil || got.Name != "Gadget" {
+        t.Errorf("GetItem after the update = %v, %v; want the update, not the cached item", got, err)
+    }
+    _, err = client.UpdateItem(authorized, &itemspb.UpdateItemRequest{Id: created.Id, Name: "Stale", Price: 1, Version: created.Version})
+    if status.Code(err) != codes.Aborted {
+        t.Errorf("UpdateItem with a stale version: %v, want Aborted", err)
+    }
+
+    if _, err := client.DeleteItem(authorized, &itemspb.DeleteItemRequest{Id: created.Id}); err != nil {
+        t.Errorf("DeleteItem: %v", err)
+    }
+    if _, err := client.GetItem(ctx, &itemspb.GetItemRequest{Id: created.Id}); status.Code(err) != codes.NotFound {
+        t.Errorf("GetItem after the delete: %v, want NotFound", err)
+    }
+}
+
+func TestGRPCItemServiceErrors(t *testing.T) {
+    client := itemspb.NewItemServiceClient(newGRPCTestConn(t, NewApp(storedItems(), nil, nil, nil)))
+    ctx := context.Background()
+    authorized := metadata.AppendToOutgoingContext(ctx, "authorization", testToken(t, nil))
+
+    tests := []struct {
+        name string
+        call func() error
+        want codes.Code
+    }{
+        {"write without a token", func() error {
+            _, err := client.CreateItem(ctx, &itemspb.CreateItemRequest{Name: "Widget", Price: 1})
+            return err
+        }, codes.Unauthenticated},
+        {"read with a bad token", func() error {
+            _, err := client.GetItem(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer nope"), &itemspb.GetItemRequest{Id: 1})
+            return err
+        }, codes.Unauthenticated},
+        {"invalid item", func() error {
+            _, err := client.CreateItem(authorized, &itemspb.CreateItemRequest{Name: " ", Price: 1})
+            return err
+        }, codes.InvalidArgument},
+        {"limit too large", func() error {
+            _, err := client.ListItems(ctx, &itemspb.ListItemsRequest{Limit: maxPageLimit + 1})
+            return err
+        }, codes.InvalidArgument},
+        {"missing item", func() error {
+            _, err := client.DeleteItem(authorized, &itemspb.DeleteItemRequest{Id: 99})
+            return err
+        }, codes.NotFound},
+    }
+    for _, tt := range tests {
+        if err := tt.call(); status.Code(err) != tt.want {
+            t.Errorf("%s: %v, want %s", tt.name, err, tt.want)
+        }
+    }
+}
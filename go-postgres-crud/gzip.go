@@ -0,0 +1,112 @@
+package main
+
+import (
+    "compress/gzip"
+    "io"
+    "net/http"
+    "strings"
+    "sync"
+)
+
+// gzipMiddleware compresses JSON (including +json types), XML and CSV
+// responses for clients that send Accept-Encoding: gzip. Everything else,
+// notably event streams, is passed through untouched. Writers are pooled per
+// middleware, so level is fixed once at startup; it must be a valid
+// compress/gzip level.
+func gzipMiddleware(level int) func(http.Handler) http.Handler {
+    pool := sync.Pool{
+        New: func() interface{} {
+            gz, _ := gzip.NewWriterLevel(io.Discard, level)
+            return gz
+        },
+    }
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            w.Header().Add("Vary", "Accept-Encoding")
+            if r.Method == http.MethodHead || !acceptsGzip(r) {
+                next.ServeHTTP(w, r)
+                return
+            }
+
+            gw := &gzipResponseWriter{ResponseWriter: w, pool: &pool}
+            defer gw.close()
+            next.ServeHTTP(gw, r)
+        })
+    }
+}
+
+func acceptsGzip(r *http.Request) bool {
+    for _, value := range r.Header.Values("Accept-Encoding") {
+        for _, coding := range strings.Split(value, ",") {
+            name, params, _ := strings.Cut(strings.TrimSpace(coding), ";")
+            if strings.EqualFold(strings.TrimSpace(name), "gzip") && strings.ReplaceAll(params, " ", "") != "q=0" {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// gzipResponseWriter decides on the first WriteHeader or Write whether the
+// response is compressed, based on its status and Content-Type.
+type gzipResponseWriter struct {
+    http.ResponseWriter
+    pool    *sync.Pool
+    gz      *gzip.Writer
+    decided bool
+}
+
+func (g *gzipResponseWriter) decide(status int) {
+    if g.decided {
+        return
+    }
+    g.decided = true
+    if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+        return
+    }
+    header := g.Header()
+    if header.Get("Content-Encoding") != "" {
+        return
+    }
+    contentType := header.Get("Content-Type")
+    if isJSONContentType(contentType) || isXMLContentType(contentType) || strings.HasPrefix(contentType, "text/csv") {
+        header.Set("Content-Encoding", "gzip")
+        header.Del("Content-Length")
+        g.gz = g.pool.Get().(*gzip.Writer)
+        g.gz.Reset(g.ResponseWriter)
+    }
+}
+
+func (g *gzipResponseWriter) WriteHeader(status int) {
+    g.decide(status)
+    g.ResponseWriter.WriteHeader(status)
+}
+
+func (g *gzipResponseWriter) Write(p []byte) (int, error) {
+    if !g.decided {
+        g.WriteHeader(http.StatusOK)
+    }
+    if g.gz != nil {
+        return g.gz.Write(p)
+    }
+    return g.ResponseWriter.Write(p)
+}
+
+func (g *gzipResponseWriter) Flush() {
+    if g.gz != nil {
+        g.gz.Flush()
+    }
+    if flusher, ok := g.ResponseWriter.(http.Flusher); ok {
+        flusher.Flush()
+    }
+}
+
+func (g *gzipResponseWriter) close() {
+    if g.gz == nil {
+        return
+    }
+    g.gz.Close()
+    g.gz.Reset(io.Discard)
+    g.pool.Put(g.gz)
+    g.gz = nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+    "compress/gzip"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestGzipMiddleware(t *testing.T) {
+    const body = `{"items":[]}`
+    tests := []struct {
+        name           string
+        acceptEncoding string
+        contentType    string
+        status         int
+        compressed     bool
+    }{
+        {"JSON", "gzip, deflate", "application/json", http.StatusOK, true},
+        {"problem JSON", "gzip", "application/problem+json", http.StatusBadRequest, true},
+        {"CSV", "gzip", "text/csv; charset=utf-8", http.StatusOK, true},
+        {"event stream", "gzip", "text/event-stream", http.StatusOK, false},
+        {"no Accept-Encoding", "", "application/json", http.StatusOK, false},
+        {"gzip refused", "gzip;q=0, deflate", "application/json", http.StatusOK, false},
+        {"no content", "gzip", "application/json", http.StatusNoContent, false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            h := gzipMiddleware(gzip.DefaultCompression)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                w.Header().Set("Content-Type", tt.contentType)
+                w.WriteHeader(tt.status)
+                if tt.status != http.StatusNoContent {
+                    io.WriteString(w, body)
+                }
+            }))
+            r := httptest.NewRequest(http.MethodGet, "/items", nil)
+            if tt.acceptEncoding != "" {
+                r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+            }
+            rec := httptest.NewRecorder()
+            h.ServeHTTP(rec, r)
+
+            if rec.Code != tt.status {
+                t.Errorf("status = %d, want %d", rec.Code, tt.status)
+            }
+            if rec.Header().Get("Vary") != "Accept-Encoding" {
+                t.Errorf("Vary = %q, want Accept-Encoding", rec.Header().Get("Vary"))
+            }
+            encoding := rec.Header().Get("Content-Encoding")
+            if !tt.compressed {
+                if encoding != "" {
+                    t.Errorf("Content-Encoding = %q, want none", encoding)
+                }
+                return
+            }
+            if encoding != "gzip" {
+                t.Fatalf("Content-Encoding = %q, want gzip", encoding)
+            }
+            gz, err := gzip.NewReader(rec.Body)
+            if err != nil {
+                t.Fatal(err)
+            }
+            got, err := io.ReadAll(gz)
+            if err != nil || string(got) != body {
+                t.Errorf("decompressed body = %q, %v; want %q", got, err, body)
+            }
+        })
+    }
+}
+
+// BenchmarkGzipMiddleware serves a page of 1000 items with and without
+// compression. The reported throughput is of the uncompressed payload.
+func BenchmarkGzipMiddleware(b *testing.B) {
+    items := make([]Item, 1000)
+    for i := range items {
+        items[i] = Item{ID: i + 1, Name: fmt.Sprintf("Item %d", i+1), Description: "A reasonably long description of the item", Price: float64(i) + 0.99, Version: 1}
+    }
+    payload, err := json.Marshal(itemPage{Items: items, Total: len(items), Limit: len(items)})
+    if err != nil {
+        b.Fatal(err)
+    }
+    handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        w.Write(payload)
+    })
+
+    for _, bm := range []struct {
+        name           string
+        acceptEncoding string
+    }{{"uncompressed", ""}, {"gzip", "gzip"}} {
+        b.Run(bm.name, func(b *testing.B) {
+            h := gzipMiddleware(gzip.DefaultCompression)(handler)
+            r := httptest.NewRequest(http.MethodGet, "/items", nil)
+            if bm.acceptEncoding != "" {
+                r.Header.Set("Accept-Encoding", bm.acceptEncoding)
+            }
+            b.SetBytes(int64(len(payload)))
+            b.ReportAllocs()
+            var written int
+            for i := 0; i < b.N; i++ {
+                rec := httptest.NewRecorder()
+                h.ServeHTTP(rec, r)
+                written = rec.Body.Len()
+            }
+            b.ReportMetric(float64(written), "response-bytes")
+        })
+    }
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+    "context"
+    "net/http"
+    "time"
+)
+
+const healthCheckTimeout = 2 * time.Second
+
+type healthStatus struct {
+    Status string `json:"status"`
+    DB     string `json:"db"`
+    Error  string `json:"error,omitempty"`
+}
+
+// healthz reports whether the database answers a ping. It is listed in
+// untracedPaths and deliberately starts no span of its own.
+func healthz(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+    defer cancel()
+
+    status := healthStatus{Status: "ok", DB: "up"}
+    code := http.StatusOK
+    if err := db.PingContext(ctx); err != nil {
+        status = healthStatus{Status: "degraded", DB: "down", Error: sanitizeError(err, appEnv)}
+        code = http.StatusServiceUnavailable
+    }
+
+    w.Header().Set("Cache-Control", "no-store")
+    writeJSON(w, code, status)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestHealthz(t *testing.T) {
+    mock := mockDB(t)
+    mock.ExpectPing()
+
+    rec := httptest.NewRecorder()
+    healthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+    var status healthStatus
+    decodeBody(t, rec, &status)
+    if rec.Code != http.StatusOK || status != (healthStatus{Status: "ok", DB: "up"}) {
+        t.Errorf("status %d, body %+v; want 200 ok", rec.Code, status)
+    }
+}
+
+func TestHealthzDatabaseDown(t *testing.T) {
+    mock := mockDB(t)
+    mock.ExpectPing().WillReturnError(errors.New("dial tcp 10.0.0.7:5432: connection refused"))
+
+    rec := httptest.NewRecorder()
+    healthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+    if rec.Code != http.StatusServiceUnavailable {
+        t.Fatalf("status = %d, want 503", rec.Code)
+    }
+    if got := rec.Header().Get("Cache-Control"); got != "no-store" {
+        t.Errorf("Cache-Control = %q, want no-store", got)
+    }
+    var status healthStatus
+    decodeBody(t, rec, &status)
+    if status.Status != "degraded" || status.DB != "down" || status.Error != genericInternalError {
+        t.Errorf("body = %+v, want degraded with the generic error", status)
+    }
+}
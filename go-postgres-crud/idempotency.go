@@ -0,0 +1,81 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "net/http"
+
+    "github.com/google/uuid"
+)
+
+const (
+    idempotencyKeyHeader = "Idempotency-Key"
+    upsertKeyHeader      = "X-Upsert-Key"
+    maxIdempotencyKeyLen = 128
+)
+
+// idempotencyWindow is how long a stored response is replayed for. Older
+// keys are treated as unused and are removed by the purge worker.
+const idempotencyWindow = "24 hours"
+
+var errIdempotencyKeyInUse = errors.New("idempotency key is already in use")
+
+// idempotencyKey returns the Idempotency-Key header of r, or "" when the
+// client did not send one. Keys must be UUIDs.
+func idempotencyKey(r *http.Request) (string, error) {
+    key := r.Header.Get(idempotencyKeyHeader)
+    if key == "" {
+        return "", nil
+    }
+    if len(key) > maxIdempotencyKeyLen {
+        return "", errors.New("Idempotency-Key must be at most 128 characters")
+    }
+    if _, err := uuid.Parse(key); err != nil {
+        return "", errors.New("Idempotency-Key must be a UUID")
+    }
+    return key, nil
+}
+
+// replayIdempotentResponse writes the response stored for the tenant's key, if
+// a request with that key completed within idempotencyWindow.
+func replayIdempotentResponse(ctx context.Context, w http.ResponseWriter, tenantID uuid.UUID, key string) (bool, error) {
+    var status int
+    var body []byte
+    err := db.QueryRowContext(ctx, `SELECT status_code, response_body FROM idempotency_keys
+        WHERE tenant_id = $1 AND key = $2 AND created_at > NOW() - $3::interval`, tenantID, key, idempotencyWindow).Scan(&status, &body)
+    if err == sql.ErrNoRows {
+        return false, nil
+    }
+    if err != nil {
+        return false, err
+    }
+    w.Header().Set("Idempotent-Replayed", "true")
+    writeJSON(w, status, json.RawMessage(body))
+    return true, nil
+}
+
+// storeIdempotentResponse records the response for the tenant's key in tx, so
+// it is only kept if the work it describes commits. An expired entry for the
+// same key is overwritten; a live one yields errIdempotencyKeyInUse.
+func storeIdempotentResponse(ctx context.Context, tx *sql.Tx, tenantID uuid.UUID, key string, status int, response interface{}) error {
+    body, err := json.Marshal(response)
+    if err != nil {
+        return err
+    }
+    result, err := tx.ExecContext(ctx, `INSERT INTO idempotency_keys (tenant_id, key, status_code, response_body) VALUES ($1, $2, $3, $4)
+        ON CONFLICT (tenant_id, key) DO UPDATE SET status_code = EXCLUDED.status_code, response_body = EXCLUDED.response_body, created_at = NOW()
+        WHERE idempotency_keys.created_at <= NOW() - $5::interval`, tenantID, key, status, body, idempotencyWindow)
+    if err != nil {
+        return err
+    }
+    stored, err := result.RowsAffected()
+    if err != nil {
+        return err
+    }
+    if stored == 0 {
+        return errIdempotencyKeyInUse
+    }
+    return nil
+}
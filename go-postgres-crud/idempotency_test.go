@@ -0,0 +1,91 @@
+package main
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/DATA-DOG/go-sqlmock"
+    "github.com/golang-jwt/jwt/v5"
+    "github.com/google/uuid"
+)
+
+const testIdempotencyKey = "5f0c3a2e-8d1b-4c6f-9a7e-2b4d6f8a0c1e"
+
+// idempotentCreate posts item with Idempotency-Key set to key, for tenantID.
+func idempotentCreate(t *testing.T, h http.Handler, tenantID uuid.UUID, key string, item string) *httptest.ResponseRecorder {
+    t.Helper()
+    r := httptest.NewRequest(http.MethodPost, "/items", strings.NewReader(item))
+    r.Header.Set("Content-Type", "application/json")
+    r.Header.Set("Authorization", testToken(t, jwt.MapClaims{"tenant_id": tenantID.String()}))
+    r.Header.Set(idempotencyKeyHeader, key)
+    rec := httptest.NewRecorder()
+    h.ServeHTTP(rec, r)
+    return rec
+}
+
+// A key replays only for the tenant that stored it; another tenant sending
+// the same key gets a create of its own.
+func TestIdempotencyKeysPerTenant(t *testing.T) {
+    mock := mockDB(t)
+    repo := storedItems()
+    rt := newMockApp(t, repo)
+    first, second := uuid.New(), uuid.New()
+
+    mock.ExpectQuery(`FROM idempotency_keys\s+WHERE tenant_id = \$1 AND key = \$2`).WithArgs(first, testIdempotencyKey, idempotencyWindow).
+        WillReturnRows(sqlmock.NewRows([]string{"status_code", "response_body"}).AddRow(http.StatusOK, []byte(`{"id":1,"name":"Widget"}`)))
+    rec := idempotentCreate(t, rt, first, testIdempotencyKey, `{"name":"Widget","price":1}`)
+    if rec.Code != http.StatusOK || rec.Header().Get("Idempotent-Replayed") != "true" {
+        t.Fatalf("first tenant: status %d, body %s; want the stored response replayed", rec.Code, rec.Body)
+    }
+    if n := repo.CallCount("Create"); n != 0 {
+        t.Errorf("Create called %d times for a replayed request", n)
+    }
+
+    mock.ExpectQuery(`FROM idempotency_keys`).WithArgs(second, testIdempotencyKey, idempotencyWindow).
+        WillReturnRows(sqlmock.NewRows([]string{"status_code", "response_body"}))
+    expectWebhookLookup(mock)
+    rec = idempotentCreate(t, rt, second, testIdempotencyKey, `{"name":"Widget","price":1}`)
+    if rec.Code != http.StatusOK || rec.Header().Get("Idempotent-Replayed") != "" {
+        t.Fatalf("second tenant: status %d, body %s; want a fresh create", rec.Code, rec.Body)
+    }
+    awaitExpectations(t, mock)
+    if n := repo.CallCount("Create"); n != 1 {
+        t.Errorf("Create called %d times, want once for the second tenant", n)
+    }
+}
+
+func TestStoreIdempotentResponse(t *testing.T) {
+    mock := mockDB(t)
+    repo := NewPostgresItemRepository(db, mockStatements(t, mock))
+    tenantID := uuid.New()
+    ctx := withTenant(context.Background(), tenantID)
+
+    expectCreate := func() {
+        mock.ExpectBegin()
+        mock.ExpectQuery(`SELECT EXISTS`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+        mock.ExpectQuery(`INSERT INTO items`).WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow(1, 1))
+        mock.ExpectExec(`INSERT INTO audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+    }
+
+    expectCreate()
+    mock.ExpectExec(`INSERT INTO idempotency_keys \(tenant_id, key, status_code, response_body\).*ON CONFLICT \(tenant_id, key\)`).
+        WithArgs(tenantID, testIdempotencyKey, http.StatusOK, sqlmock.AnyArg(), idempotencyWindow).
+        WillReturnResult(sqlmock.NewResult(0, 1))
+    mock.ExpectCommit()
+    if _, err := repo.Create(ctx, tenantID, Item{Name: "Widget", Price: 1}, testIdempotencyKey); err != nil {
+        t.Fatal(err)
+    }
+
+    // The tenant's key is live, so the conflict updates nothing and the
+    // create rolls back.
+    expectCreate()
+    mock.ExpectExec(`INSERT INTO idempotency_keys`).WithArgs(tenantID, testIdempotencyKey, http.StatusOK, sqlmock.AnyArg(), idempotencyWindow).
+        WillReturnResult(sqlmock.NewResult(0, 0))
+    mock.ExpectRollback()
+    if _, err := repo.Create(ctx, tenantID, Item{Name: "Widget", Price: 1}, testIdempotencyKey); err != errIdempotencyKeyInUse {
+        t.Errorf("Create with a live key = %v, want errIdempotencyKeyInUse", err)
+    }
+}
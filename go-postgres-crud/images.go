@@ -0,0 +1,164 @@
+package main
+
+import (
+    "bytes"
+    "database/sql"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "strconv"
+
+    "github.com/aws/aws-sdk-go-v2/aws"
+    "github.com/aws/aws-sdk-go-v2/service/s3"
+    "github.com/google/uuid"
+    "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+const maxImageBytes = 5 << 20 // 5 MB
+
+// imageExtensions lists the accepted image types, as sniffed from the file
+// contents, with the extension used for the object key.
+var imageExtensions = map[string]string{
+    "image/jpeg": ".jpg",
+    "image/png":  ".png",
+}
+
+// uploadItemImage stores the single file of a multipart/form-data body in the
+// S3 bucket and points the item's image_url at it. The content type is sniffed
+// from the bytes rather than trusted from the part header.
+func (app *App) uploadItemImage(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    span, ctx := tracer.StartSpanFromContext(ctx, "uploadItemImage", tracer.ResourceName("UPDATE items SET image_url = $1 WHERE id = $2"))
+    defer span.Finish()
+
+    id, err := parseItemID(r.PathValue("id"))
+    if err != nil {
+        writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid item ID")
+        return
+    }
+    if s3Client == nil {
+        writeError(w, http.StatusServiceUnavailable, "IMAGES_NOT_CONFIGURED", "Image uploads are not configured: set S3_BUCKET")
+        return
+    }
+
+    data, err := readImagePart(r)
+    if err != nil {
+        var tooLarge *http.MaxBytesError
+        switch {
+        case errors.Is(err, errImageTooLarge), errors.As(err, &tooLarge):
+            writeError(w, http.StatusRequestEntityTooLarge, "FILE_TOO_LARGE", fmt.Sprintf("Images are limited to %d bytes", maxImageBytes))
+        default:
+            writeError(w, http.StatusBadRequest, "INVALID_BODY", err.Error())
+        }
+        return
+    }
+    contentType := http.DetectContentType(data)
+    ext, ok := imageExtensions[contentType]
+    if !ok {
+        writeError(w, http.StatusUnsupportedMediaType, "UNSUPPORTED_MEDIA_TYPE", "Images must be image/jpeg or image/png")
+        return
+    }
+
+    tenantID := tenantFromContext(ctx)
+    if _, err := app.stmts.fetchItem(ctx, tenantID, id); err != nil {
+        if err == sql.ErrNoRows {
+            writeError(w, http.StatusNotFound, "NOT_FOUND", "Item not found")
+            return
+        }
+        writeInternalError(w, r, err)
+        return
+    }
+
+    key := "items/" + strconv.Itoa(id) + "/" + uuid.NewString() + ext
+    _, err = s3Client.PutObject(ctx, &s3.PutObjectInput{
+        Bucket:        aws.String(s3Bucket),
+        Key:           aws.String(key),
+        Body:          bytes.NewReader(data),
+        ContentType:   aws.String(contentType),
+        ContentLength: aws.Int64(int64(len(data))),
+    })
+    if err != nil {
+        requestLogger(ctx).Error("image upload failed", "bucket", s3Bucket, "key", key, "error", err)
+        writeInternalError(w, r, err)
+        return
+    }
+
+    tx, err := db.BeginTx(ctx, nil)
+    if err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+    defer tx.Rollback()
+
+    old, err := app.stmts.lockItem(ctx, tx, tenantID, id)
+    if err == sql.ErrNoRows {
+        writeError(w, http.StatusNotFound, "NOT_FOUND", "Item not found")
+        return
+    }
+    if err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+    if err := checkReservation(ctx, tx, tenantID, id); err != nil {
+        handleError(w, r, err)
+        return
+    }
+    item := old
+    item.ImageURL = s3PublicURL(key)
+    err = tx.QueryRowContext(ctx, `UPDATE items SET image_url = $1, version = version + 1 WHERE id = $2 AND tenant_id = $3 RETURNING version`, item.ImageURL, id, tenantID).
+        Scan(&item.Version)
+    if err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+    if err := recordAudit(ctx, tx, id, auditUpdate, old, item); err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+    if err := tx.Commit(); err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+    evictItem(id)
+    requestLogger(ctx).Info("item image stored", "item_id", id, "key", key, "bytes", len(data))
+
+    if fresh, err := app.stmts.loadItem(ctx, tenantID, id); err == nil {
+        item = fresh
+    }
+    notifyItemChange(ctx, eventItemUpdated, item)
+    writeItem(w, r, item)
+}
+
+var errImageTooLarge = errors.New("image too large")
+
+// readImagePart returns the contents of the first file part of a multipart
+// body, reading at most maxImageBytes of it.
+func readImagePart(r *http.Request) ([]byte, error) {
+    reader, err := r.MultipartReader()
+    if err != nil {
+        return nil, errors.New("request body must be multipart/form-data")
+    }
+    for {
+        part, err := reader.NextPart()
+        if err == io.EOF {
+            return nil, errors.New("request body must contain a file")
+        }
+        if err != nil {
+            return nil, err
+        }
+        if part.FileName() == "" {
+            part.Close()
+            continue
+        }
+        defer part.Close()
+        data, err := io.ReadAll(io.LimitReader(part, maxImageBytes+1))
+        if err != nil {
+            return nil, err
+        }
+        if len(data) > maxImageBytes {
+            return nil, errImageTooLarge
+        }
+        return data, nil
+    }
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+    "context"
+    "encoding/csv"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log/slog"
+    "net"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "syscall"
+    "time"
+
+    "github.com/google/uuid"
+    httptrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/net/http"
+    "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+const (
+    importFetchTimeout = 60 * time.Second
+    importMaxBytes     = 50 << 20 // 50 MB
+)
+
+var errImportTooLarge = errors.New("import exceeds the 50 MB size limit")
+
+// importClient fetches remote catalogs.
+var importClient = newPublicHTTPClient(importFetchTimeout)
+
+// newPublicHTTPClient returns a client for user-supplied URLs. The dialer
+// re-checks every resolved address at connect time so a DNS answer that
+// changes after validation cannot be used to reach internal hosts.
+func newPublicHTTPClient(timeout time.Duration) *http.Client {
+    return httptrace.WrapClient(&http.Client{
+        Timeout: timeout,
+        Transport: &http.Transport{
+            Proxy: nil,
+            DialContext: (&net.Dialer{
+                Timeout: 10 * time.Second,
+                Control: func(network, address string, _ syscall.RawConn) error {
+                    host, _, err := net.SplitHostPort(address)
+                    if err != nil {
+                        return err
+                    }
+                    if ip := net.ParseIP(host); ip == nil || isPrivateIP(ip) {
+                        return fmt.Errorf("refusing to connect to private address %s", host)
+                    }
+                    return nil
+                },
+            }).DialContext,
+            TLSHandshakeTimeout: 10 * time.Second,
+        },
+    })
+}
+
+type importFromURLRequest struct {
+    URL    string `json:"url"`
+    Format string `json:"format"`
+}
+
+func importFromURL(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    span, ctx := tracer.StartSpanFromContext(ctx, "importFromURL")
+    defer span.Finish()
+
+    var req importFromURLRequest
+    err := json.NewDecoder(r.Body).Decode(&req)
+    if err != nil {
+        writeBodyError(w, err, "Request body is not valid JSON")
+        return
+    }
+    if req.Format != "csv" && req.Format != "json" {
+        writeError(w, http.StatusBadRequest, "INVALID_FORMAT", `format must be "csv" or "json"`)
+        return
+    }
+    target, err := validateImportURL(ctx, req.URL)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, "INVALID_URL", err.Error())
+        return
+    }
+
+    jobID := uuid.NewString()
+    go runImportJob(jobID, tenantFromContext(ctx), target, req.Format)
+
+    writeJSON(w, http.StatusAccepted, map[string]string{"job_id": jobID, "status": "queued"})
+}
+
+// validateImportURL only accepts HTTPS URLs whose host resolves exclusively to
+// public addresses.
+func validateImportURL(ctx context.Context, raw string) (*url.URL, error) {
+    target, err := url.Parse(raw)
+    if err != nil {
+        return nil, fmt.Errorf("invalid url: %w", err)
+    }
+    if target.Scheme != "https" {
+        return nil, errors.New("url must use https")
+    }
+    if target.Hostname() == "" {
+        return nil, errors.New("url must include a host")
+    }
+
+    addrs, err := net.DefaultResolver.LookupIPAddr(ctx, target.Hostname())
+    if err != nil {
+        return nil, fmt.Errorf("could not resolve %s", target.Hostname())
+    }
+    for _, addr := range addrs {
+        if isPrivateIP(addr.IP) {
+            return nil, fmt.Errorf("url resolves to a private address")
+        }
+    }
+    return target, nil
+}
+
+func isPrivateIP(ip net.IP) bool {
+    return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+        ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified()
+}
+
+// runImportJob imports into tenantID, the tenant of the request that queued
+// the job.
+func runImportJob(jobID string, tenantID uuid.UUID, target *url.URL, format string) {
+    span := tracer.StartSpan("importJob", tracer.ResourceName(target.Host))
+    defer span.Finish()
+    ctx := withTenant(tracer.ContextWithSpan(context.Background(), span), tenantID)
+
+    slog.Info("import job started", "job_id", jobID, "format", format, "url", target.Redacted())
+    inserted, err := fetchAndImport(ctx, target, format)
+    if err != nil {
+        span.SetTag("error", err)
+        slog.Error("import job failed", "job_id", jobID, "inserted", inserted, "error", err)
+        return
+    }
+    slog.Info("import job finished", "job_id", jobID, "inserted", inserted)
+}
+
+func fetchAndImport(ctx context.Context, target *url.URL, format string) (int, error) {
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+    if err != nil {
+        return 0, err
+    }
+    resp, err := importClient.Do(req)
+    if err != nil {
+        return 0, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return 0, fmt.Errorf("unexpected status %s", resp.Status)
+    }
+    if resp.ContentLength > importMaxBytes {
+        return 0, errImportTooLarge
+    }
+
+    body := &limitedReader{r: resp.Body, remaining: importMaxBytes}
+    return importItems(ctx, body, format)
+}
+
+// importItems streams items out of r and inserts them for the tenant of ctx
+// in a single transaction, so a failed import leaves the catalog untouched.
+func importItems(ctx context.Context, r io.Reader, format string) (int, error) {
+    tx, err := db.BeginTx(ctx, nil)
+    if err != nil {
+        return 0, err
+    }
+    defer tx.Rollback()
+
+    stmt, err := tx.PrepareContext(ctx, `INSERT INTO items (name, description, price, tenant_id) VALUES ($1, $2, $3, $4)`)
+    if err != nil {
+        return 0, err
+    }
+    defer stmt.Close()
+
+    inserted := 0
+    insert := func(item Item) error {
+        if err := validateItem(ctx, item); err != nil {
+            return err
+        }
+        if _, err := stmt.ExecContext(ctx, item.Name, item.Description, item.Price, tenantFromContext(ctx)); err != nil {
+            return err
+        }
+        inserted++
+        return nil
+    }
+
+    switch format {
+    case "csv":
+        err = decodeCSVItems(r, insert)
+    case "json":
+        err = decodeJSONItems(r, insert)
+    default:
+        err = fmt.Errorf("unsupported format %q", format)
+    }
+    if err != nil {
+        return inserted, err
+    }
+    if err := tx.Commit(); err != nil {
+        return 0, err
+    }
+    evictItemLists()
+    return inserted, nil
+}
+
+// decodeCSVItems expects a header row naming the name, description and price
+// columns, in any order.
+func decodeCSVItems(r io.Reader, fn func(Item) error) error {
+    reader := csv.NewReader(r)
+    columns, err := readCSVHeader(reader)
+    if err != nil {
+        return err
+    }
+
+    for line := 2; ; line++ {
+        record, err := reader.Read()
+        if err == io.EOF {
+            return nil
+        }
+        if err != nil {
+            return err
+        }
+        item, err := csvRecordItem(record, columns)
+        if err != nil {
+            return fmt.Errorf("line %d: %w", line, err)
+        }
+        if err := fn(item); err != nil {
+            return fmt.Errorf("line %d: %w", line, err)
+        }
+    }
+}
+
+// readCSVHeader reads the header row and maps each column name to its index.
+func readCSVHeader(reader *csv.Reader) (map[string]int, error) {
+    header, err := reader.Read()
+    if err != nil {
+        return nil, fmt.Errorf("reading csv header: %w", err)
+    }
+    columns := map[string]int{}
+    for i, name := range header {
+        columns[strings.ToLower(strings.TrimSpace(name))] = i
+    }
+    for _, name := range []string{"name", "description", "price"} {
+        if _, ok := columns[name]; !ok {
+            return nil, fmt.Errorf("csv header is missing the %q column", name)
+        }
+    }
+    return columns, nil
+}
+
+func csvRecordItem(record []string, columns map[string]int) (Item, error) {
+    price, err := strconv.ParseFloat(strings.TrimSpace(record[columns["price"]]), 64)
+    if err != nil {
+        return Item{}, errors.New("invalid price")
+    }
+    return Item{
+        Name:        record[columns["name"]],
+        Description: record[columns["description"]],
+        Price:       price,
+    }, nil
+}
+
+// decodeJSONItems reads a top-level JSON array one element at a time.
+func decodeJSONItems(r io.Reader, fn func(Item) error) error {
+    decoder := json.NewDecoder(r)
+    token, err := decoder.Token()
+    if err != nil {
+        return err
+    }
+    if delim, ok := token.(json.Delim); !ok || delim != '[' {
+        return errors.New("json catalog must be an array of items")
+    }
+    for index := 0; decoder.More(); index++ {
+        var item Item
+        if err := decoder.Decode(&item); err != nil {
+            return fmt.Errorf("item %d: %w", index, err)
+        }
+        if err := fn(item); err != nil {
+            return fmt.Errorf("item %d: %w", index, err)
+        }
+    }
+    _, err = decoder.Token()
+    return err
+}
+
+// limitedReader is like io.LimitReader but reports an error instead of a
+// silent EOF when the limit is exceeded.
+type limitedReader struct {
+    r         io.Reader
+    remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+    if l.remaining <= 0 {
+        return 0, errImportTooLarge
+    }
+    if int64(len(p)) > l.remaining {
+        p = p[:l.remaining]
+    }
+    n, err := l.r.Read(p)
+    l.remaining -= int64(n)
+    return n, err
+}
@@ -0,0 +1,685 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "runtime"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/golang-jwt/jwt/v5"
+    "github.com/google/uuid"
+    "github.com/lib/pq"
+    "github.com/testcontainers/testcontainers-go/modules/postgres"
+)
+
+// integration is the database of the integration tests, a migrated Postgres
+// container started by TestMain. It is only set up when INTEGRATION_TESTS is
+// true; the tests skip themselves otherwise.
+var integration struct {
+    db       *sql.DB
+    settings dbSettings
+    stmts    *Statements
+}
+
+// startIntegrationDB starts the Postgres container, runs the migrations and
+// points the package's database handles at it. stop terminates it again.
+func startIntegrationDB() (stop func(), err error) {
+    if os.Getenv("INTEGRATION_TESTS") != "true" {
+        return func() {}, nil
+    }
+    ctx := context.Background()
+    container, err := postgres.Run(ctx, "postgres:16-alpine",
+        postgres.WithDatabase("go_crud_test"),
+        postgres.WithUsername("go_user"),
+        postgres.WithPassword("go_password"),
+        postgres.BasicWaitStrategies(),
+    )
+    if err != nil {
+        return nil, fmt.Errorf("starting postgres: %w", err)
+    }
+    stop = func() { container.Terminate(ctx) }
+
+    host, err := container.Host(ctx)
+    if err != nil {
+        stop()
+        return nil, err
+    }
+    port, err := container.MappedPort(ctx, "5432/tcp")
+    if err != nil {
+        stop()
+        return nil, err
+    }
+    settings := dbSettings{Host: host, Port: port.Int(), User: "go_user", Password: "go_password", Name: "go_crud_test", StatementTimeoutMS: 5000}
+    conn, err := sql.Open("postgres", settings.dsn())
+    if err != nil {
+        stop()
+        return nil, err
+    }
+    if err := runMigrations(conn); err != nil {
+        stop()
+        return nil, err
+    }
+    stmts, err := prepareStatements(conn)
+    if err != nil {
+        stop()
+        return nil, err
+    }
+
+    db, adminDB, dbname = conn, conn, settings.Name
+    fullTextSearchAvailable = probeFullTextIndex(ctx, conn)
+    trigramAvailable = probeTrigramExtension(ctx, conn)
+    integration.db, integration.settings, integration.stmts = conn, settings, stmts
+    return func() {
+        stmts.Close()
+        conn.Close()
+        stop()
+    }, nil
+}
+
+// integrationClient talks to a fresh httptest server over the real database.
+// Every client acts for a tenant of its own, so tests do not see each other's
+// items, and the tenant's items are removed when the test ends.
+type integrationClient struct {
+    t        *testing.T
+    server   *httptest.Server
+    tenantID uuid.UUID
+    token    string
+}
+
+func newIntegrationClient(t *testing.T) *integrationClient {
+    t.Helper()
+    if integration.db == nil {
+        t.Skip("set INTEGRATION_TESTS=true to run the integration tests against a Postgres container")
+    }
+    db = integration.db
+    itemCache = newItemCache(1000, time.Minute)
+
+    app := NewApp(NewPostgresItemRepository(integration.db, integration.stmts), integration.stmts, NewFeatureFlags(integration.db), nil)
+    server := httptest.NewServer(newTestRouter(app))
+    tenantID := uuid.New()
+    t.Cleanup(func() {
+        server.Close()
+        if _, err := integration.db.Exec(`DELETE FROM items WHERE tenant_id = $1`, tenantID); err != nil {
+            t.Errorf("cleaning up items: %v", err)
+        }
+    })
+    return &integrationClient{
+        t:        t,
+        server:   server,
+        tenantID: tenantID,
+        token:    testToken(t, jwt.MapClaims{"tenant_id": tenantID.String()}),
+    }
+}
+
+// do sends body as JSON and returns the status and the raw response body.
+func (c *integrationClient) do(method, path string, body interface{}) (*http.Response, []byte) {
+    c.t.Helper()
+    var reader io.Reader
+    if body != nil {
+        encoded, err := json.Marshal(body)
+        if err != nil {
+            c.t.Fatal(err)
+        }
+        reader = bytes.NewReader(encoded)
+    }
+    req, err := http.NewRequest(method, c.server.URL+path, reader)
+    if err != nil {
+        c.t.Fatal(err)
+    }
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("Authorization", c.token)
+    resp, err := c.server.Client().Do(req)
+    if err != nil {
+        c.t.Fatal(err)
+    }
+    defer resp.Body.Close()
+    raw, err := io.ReadAll(resp.Body)
+    if err != nil {
+        c.t.Fatal(err)
+    }
+    return resp, raw
+}
+
+// create adds an item and fails the test unless it succeeds.
+func (c *integrationClient) create(item Item) Item {
+    c.t.Helper()
+    resp, raw := c.do(http.MethodPost, "/items", item)
+    if resp.StatusCode != http.StatusOK {
+        c.t.Fatalf("POST /items: status %d: %s", resp.StatusCode, raw)
+    }
+    var created Item
+    if err := json.Unmarshal(raw, &created); err != nil {
+        c.t.Fatal(err)
+    }
+    return created
+}
+
+func (c *integrationClient) get(id int) (*http.Response, Item) {
+    c.t.Helper()
+    resp, raw := c.do(http.MethodGet, fmt.Sprintf("/items/%d", id), nil)
+    var item Item
+    if resp.StatusCode == http.StatusOK {
+        if err := json.Unmarshal(raw, &item); err != nil {
+            c.t.Fatal(err)
+        }
+    }
+    return resp, item
+}
+
+// categories adds a category for each name and returns their IDs. Categories
+// are shared by all tenants, so the slugs carry the client's tenant to stay
+// unique, and the categories are removed when the test ends.
+func (c *integrationClient) categories(names ...string) []int {
+    c.t.Helper()
+    var ids []int
+    for _, name := range names {
+        var id int
+        slug := fmt.Sprintf("%s-%s", name, c.tenantID.String()[:8])
+        if err := integration.db.QueryRow(`INSERT INTO categories (name, slug) VALUES ($1, $1) RETURNING id`, slug).Scan(&id); err != nil {
+            c.t.Fatal(err)
+        }
+        ids = append(ids, id)
+    }
+    c.t.Cleanup(func() { integration.db.Exec(`DELETE FROM categories WHERE id = ANY($1)`, pq.Array(ids)) })
+    return ids
+}
+
+func TestIntegrationCreateAndRead(t *testing.T) {
+    c := newIntegrationClient(t)
+
+    created := c.create(Item{Name: "Widget", Description: "A widget", Price: 9.99})
+    if created.ID == 0 || created.Version != 1 {
+        t.Errorf("created item = %+v, want an ID and version 1", created)
+    }
+
+    resp, got := c.get(created.ID)
+    if resp.StatusCode != http.StatusOK {
+        t.Fatalf("GET status = %d, want 200", resp.StatusCode)
+    }
+    if got.Name != "Widget" || got.Description != "A widget" || got.Price != 9.99 {
+        t.Errorf("GET returned %+v, want the created item", got)
+    }
+}
+
+func TestIntegrationUpdate(t *testing.T) {
+    c := newIntegrationClient(t)
+    created := c.create(Item{Name: "Gadget", Price: 5})
+
+    resp, raw := c.do(http.MethodPut, fmt.Sprintf("/items/%d", created.ID), Item{Name: "Gadget Pro", Price: 7.5, Version: created.Version})
+    if resp.StatusCode != http.StatusNoContent {
+        t.Fatalf("PUT status = %d, want 204: %s", resp.StatusCode, raw)
+    }
+    if got := resp.Header.Get(itemVersionHeader); got != "2" {
+        t.Errorf("%s = %q, want 2", itemVersionHeader, got)
+    }
+
+    _, got := c.get(created.ID)
+    if got.Name != "Gadget Pro" || got.Price != 7.5 || got.Version != 2 {
+        t.Errorf("after update GET returned %+v", got)
+    }
+
+    resp, _ = c.do(http.MethodPut, fmt.Sprintf("/items/%d", created.ID), Item{Name: "Stale", Price: 1, Version: created.Version})
+    if resp.StatusCode != http.StatusConflict {
+        t.Errorf("PUT with a stale version: status = %d, want 409", resp.StatusCode)
+    }
+}
+
+// TestIntegrationConcurrentUpdates races two unversioned writes to one item.
+// The row lock makes the second wait for the first, so the item ends up as
+// exactly one of them and the second's before-state is the first's result.
+func TestIntegrationConcurrentUpdates(t *testing.T) {
+    tests := []struct {
+        method string
+        bodies [2]interface{}
+    }{
+        {http.MethodPut, [2]interface{}{
+            Item{Name: "Left", Description: "from the left", Price: 1},
+            Item{Name: "Right", Description: "from the right", Price: 2},
+        }},
+        {http.MethodPatch, [2]interface{}{
+            map[string]interface{}{"name": "Left", "description": "from the left", "price": 1},
+            map[string]interface{}{"name": "Right", "description": "from the right", "price": 2},
+        }},
+    }
+    for _, tt := range tests {
+        t.Run(tt.method, func(t *testing.T) {
+            c := newIntegrationClient(t)
+            created := c.create(Item{Name: "Contested", Description: "original", Price: 5})
+
+            var requests [2]*http.Request
+            for i, body := range tt.bodies {
+                encoded, err := json.Marshal(body)
+                if err != nil {
+                    t.Fatal(err)
+                }
+                requests[i], err = http.NewRequest(tt.method, fmt.Sprintf("%s/items/%d", c.server.URL, created.ID), bytes.NewReader(encoded))
+                if err != nil {
+                    t.Fatal(err)
+                }
+                requests[i].Header.Set("Content-Type", "application/json")
+                requests[i].Header.Set("Authorization", c.token)
+            }
+            // c.do fails the test, which only the test goroutine may do.
+            statuses := make(chan int, 2)
+            for _, req := range requests {
+                go func(req *http.Request) {
+                    resp, err := c.server.Client().Do(req)
+                    if err != nil {
+                        statuses <- 0
+                        return
+                    }
+                    resp.Body.Close()
+                    statuses <- resp.StatusCode
+                }(req)
+            }
+            for i := 0; i < 2; i++ {
+                if status := <-statuses; status != http.StatusOK && status != http.StatusNoContent {
+                    t.Fatalf("%s status = %d, want both writes to succeed", tt.method, status)
+                }
+            }
+
+            _, got := c.get(created.ID)
+            left := got.Name == "Left" && got.Description == "from the left" && got.Price == 1
+            right := got.Name == "Right" && got.Description == "from the right" && got.Price == 2
+            if !left && !right || got.Version != created.Version+2 {
+                t.Errorf("after the race GET returned %+v, want one write whole at version %d", got, created.Version+2)
+            }
+
+            // The price history chains: the second write saw the first's price.
+            rows, err := integration.db.Query(`SELECT old_price, new_price FROM item_price_history WHERE item_id = $1 ORDER BY id`, created.ID)
+            if err != nil {
+                t.Fatal(err)
+            }
+            defer rows.Close()
+            var history [][2]float64
+            for rows.Next() {
+                var change [2]float64
+                if err := rows.Scan(&change[0], &change[1]); err != nil {
+                    t.Fatal(err)
+                }
+                history = append(history, change)
+            }
+            if len(history) != 2 || history[0][0] != 5 || history[1][0] != history[0][1] || history[1][1] != got.Price {
+                t.Errorf("price history = %v, want 5 → first write → second write, ending at %v", history, got.Price)
+            }
+        })
+    }
+}
+
+func TestIntegrationDelete(t *testing.T) {
+    c := newIntegrationClient(t)
+    created := c.create(Item{Name: "Doomed", Price: 1})
+
+    resp, _ := c.do(http.MethodDelete, fmt.Sprintf("/items/%d", created.ID), nil)
+    if resp.StatusCode != http.StatusNoContent {
+        t.Fatalf("DELETE status = %d, want 204", resp.StatusCode)
+    }
+    if resp, _ := c.get(created.ID); resp.StatusCode != http.StatusNotFound {
+        t.Errorf("GET after DELETE: status = %d, want 404", resp.StatusCode)
+    }
+
+    var deletedAt sql.NullTime
+    err := integration.db.QueryRow(`SELECT deleted_at FROM items WHERE id = $1`, created.ID).Scan(&deletedAt)
+    if err != nil || !deletedAt.Valid {
+        t.Errorf("row after DELETE: deleted_at = %v, err = %v; want a soft delete", deletedAt, err)
+    }
+}
+
+// TestIntegrationIdempotencyKeysPerTenant sends one Idempotency-Key from two
+// tenants: each gets an item of its own, and only its own retry replays it.
+func TestIntegrationIdempotencyKeysPerTenant(t *testing.T) {
+    first, second := newIntegrationClient(t), newIntegrationClient(t)
+    key := uuid.NewString()
+    t.Cleanup(func() { integration.db.Exec(`DELETE FROM idempotency_keys WHERE key = $1`, key) })
+    create := func(c *integrationClient) (Item, bool) {
+        t.Helper()
+        req, err := http.NewRequest(http.MethodPost, c.server.URL+"/items", strings.NewReader(`{"name":"Widget","price":1}`))
+        if err != nil {
+            t.Fatal(err)
+        }
+        req.Header.Set("Content-Type", "application/json")
+        req.Header.Set("Authorization", c.token)
+        req.Header.Set(idempotencyKeyHeader, key)
+        resp, err := c.server.Client().Do(req)
+        if err != nil {
+            t.Fatal(err)
+        }
+        defer resp.Body.Close()
+        if resp.StatusCode != http.StatusOK {
+            t.Fatalf("POST /items: status %d", resp.StatusCode)
+        }
+        var item Item
+        if err := json.NewDecoder(resp.Body).Decode(&item); err != nil {
+            t.Fatal(err)
+        }
+        return item, resp.Header.Get("Idempotent-Replayed") == "true"
+    }
+
+    mine, replayed := create(first)
+    if replayed {
+        t.Fatal("the first request with a new key was replayed")
+    }
+    theirs, replayed := create(second)
+    if replayed || theirs.ID == mine.ID {
+        t.Errorf("second tenant got item %d (replayed %v), want a new item of its own", theirs.ID, replayed)
+    }
+    if again, replayed := create(first); !replayed || again.ID != mine.ID {
+        t.Errorf("first tenant's retry got item %d (replayed %v), want item %d replayed", again.ID, replayed, mine.ID)
+    }
+}
+
+func TestIntegrationRestore(t *testing.T) {
+    c := newIntegrationClient(t)
+    created := c.create(Item{Name: "Phoenix", Price: 3})
+    path := fmt.Sprintf("/items/%d/restore", created.ID)
+
+    if resp, raw := c.do(http.MethodPost, path, nil); resp.StatusCode != http.StatusBadRequest || !bytes.Contains(raw, []byte("NOT_DELETED")) {
+        t.Errorf("restoring a live item: status %d: %s; want 400 NOT_DELETED", resp.StatusCode, raw)
+    }
+
+    c.do(http.MethodDelete, fmt.Sprintf("/items/%d", created.ID), nil)
+    resp, raw := c.do(http.MethodPost, path, nil)
+    if resp.StatusCode != http.StatusOK {
+        t.Fatalf("POST restore: status %d: %s", resp.StatusCode, raw)
+    }
+    if resp, got := c.get(created.ID); resp.StatusCode != http.StatusOK || got.Name != "Phoenix" {
+        t.Errorf("GET after restore: status %d, item %+v; want the item back", resp.StatusCode, got)
+    }
+    var restores int
+    err := integration.db.QueryRow(`SELECT COUNT(*) FROM audit_logs WHERE item_id = $1 AND action = $2`, created.ID, auditRestore).Scan(&restores)
+    if err != nil || restores != 1 {
+        t.Errorf("audit_logs has %d restores, err = %v; want 1", restores, err)
+    }
+
+    // A live item took the name while the first was deleted.
+    c.do(http.MethodDelete, fmt.Sprintf("/items/%d", created.ID), nil)
+    c.create(Item{Name: "PHOENIX", Price: 4})
+    if resp, raw := c.do(http.MethodPost, path, nil); resp.StatusCode != http.StatusConflict || !bytes.Contains(raw, []byte("DUPLICATE_NAME")) {
+        t.Errorf("restoring over a live name: status %d: %s; want 409 DUPLICATE_NAME", resp.StatusCode, raw)
+    }
+
+    if resp, _ := c.do(http.MethodPost, fmt.Sprintf("/items/%d/restore", maxItemID), nil); resp.StatusCode != http.StatusNotFound {
+        t.Errorf("restoring a missing item: status = %d, want 404", resp.StatusCode)
+    }
+}
+
+func TestIntegrationNotFound(t *testing.T) {
+    c := newIntegrationClient(t)
+
+    if resp, _ := c.get(maxItemID); resp.StatusCode != http.StatusNotFound {
+        t.Errorf("GET of a missing item: status = %d, want 404", resp.StatusCode)
+    }
+    resp, raw := c.do(http.MethodPatch, fmt.Sprintf("/items/%d", maxItemID), map[string]interface{}{"price": 3})
+    if resp.StatusCode != http.StatusNotFound {
+        t.Errorf("PATCH of a missing item: status = %d, want 404: %s", resp.StatusCode, raw)
+    }
+}
+
+func TestIntegrationValidationErrors(t *testing.T) {
+    c := newIntegrationClient(t)
+
+    tests := []struct {
+        name   string
+        body   interface{}
+        status int
+    }{
+        {"missing name", map[string]interface{}{"price": 3}, http.StatusUnprocessableEntity},
+        {"negative price", map[string]interface{}{"name": "Broken", "price": -1}, http.StatusUnprocessableEntity},
+        {"price above the maximum", map[string]interface{}{"name": "Pricey", "price": maxItemPrice + 1}, http.StatusUnprocessableEntity},
+        {"blank name", map[string]interface{}{"name": "   ", "price": 3}, http.StatusBadRequest},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            resp, raw := c.do(http.MethodPost, "/items", tt.body)
+            if resp.StatusCode != tt.status {
+                t.Errorf("status = %d, want %d: %s", resp.StatusCode, tt.status, raw)
+            }
+        })
+    }
+
+    c.create(Item{Name: "Unique", Price: 1})
+    resp, raw := c.do(http.MethodPost, "/items", Item{Name: "unique", Price: 2})
+    if resp.StatusCode != http.StatusConflict {
+        t.Errorf("duplicate name: status = %d, want 409: %s", resp.StatusCode, raw)
+    }
+}
+
+func TestIntegrationPagination(t *testing.T) {
+    c := newIntegrationClient(t)
+    for i := 1; i <= 5; i++ {
+        c.create(Item{Name: fmt.Sprintf("Page item %d", i), Price: float64(i)})
+    }
+
+    resp, raw := c.do(http.MethodGet, "/items?sort=price_asc&limit=2&offset=2", nil)
+    if resp.StatusCode != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", resp.StatusCode, raw)
+    }
+    var page itemPage
+    if err := json.Unmarshal(raw, &page); err != nil {
+        t.Fatal(err)
+    }
+    if page.Total != 5 || page.Limit != 2 || page.Offset != 2 {
+        t.Errorf("page = total %d, limit %d, offset %d; want 5, 2, 2", page.Total, page.Limit, page.Offset)
+    }
+    if len(page.Items) != 2 || page.Items[0].Price != 3 || page.Items[1].Price != 4 {
+        t.Errorf("page items = %+v, want the items priced 3 and 4", page.Items)
+    }
+}
+
+// TestIntegrationStatementTimeout checks that the statement_timeout of the
+// DSN applies to every connection, without a context deadline.
+func TestIntegrationStatementTimeout(t *testing.T) {
+    if integration.db == nil {
+        t.Skip("set INTEGRATION_TESTS=true to run the integration tests against a Postgres container")
+    }
+    settings := integration.settings
+    settings.StatementTimeoutMS = 1000
+    conn, err := sql.Open("postgres", settings.dsn())
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer conn.Close()
+
+    start := time.Now()
+    _, err = conn.Exec(`SELECT pg_sleep(10)`)
+    elapsed := time.Since(start)
+    var pqErr *pq.Error
+    if !errors.As(err, &pqErr) || pqErr.Code != "57014" {
+        t.Fatalf("pg_sleep(10) = %v, want a query_canceled (57014) error", err)
+    }
+    if elapsed >= 5*time.Second {
+        t.Errorf("pg_sleep(10) returned after %v, want under 5s", elapsed)
+    }
+}
+
+// TestIntegrationRelatedItems ranks a known dataset: the source shares two
+// categories with one item and one with another, while a third item shares
+// none and a fourth is deleted.
+func TestIntegrationRelatedItems(t *testing.T) {
+    c := newIntegrationClient(t)
+    categories := c.categories("tools", "garden", "kitchen")
+    tools, garden, kitchen := categories[0], categories[1], categories[2]
+
+    source := c.create(Item{Name: "Spade", Price: 1, CategoryIDs: []int{tools, garden}})
+    one := c.create(Item{Name: "Hose", Price: 1, CategoryIDs: []int{garden}})
+    two := c.create(Item{Name: "Rake", Price: 1, CategoryIDs: []int{garden, tools}})
+    c.create(Item{Name: "Whisk", Price: 1, CategoryIDs: []int{kitchen}})
+    deleted := c.create(Item{Name: "Trowel", Price: 1, CategoryIDs: []int{tools, garden}})
+    if resp, _ := c.do(http.MethodDelete, fmt.Sprintf("/items/%d", deleted.ID), nil); resp.StatusCode != http.StatusNoContent {
+        t.Fatalf("DELETE status = %d, want 204", resp.StatusCode)
+    }
+
+    resp, raw := c.do(http.MethodGet, fmt.Sprintf("/items/%d/related", source.ID), nil)
+    if resp.StatusCode != http.StatusOK {
+        t.Fatalf("GET related: status %d: %s", resp.StatusCode, raw)
+    }
+    var body relatedBody
+    if err := json.Unmarshal(raw, &body); err != nil {
+        t.Fatal(err)
+    }
+    if ids := relatedIDs(body.Related); len(ids) != 2 || ids[0] != two.ID || ids[1] != one.ID {
+        t.Errorf("related = %v, want [%d %d]: most shared categories first", ids, two.ID, one.ID)
+    }
+
+    if !trigramAvailable {
+        return
+    }
+    named := c.create(Item{Name: "Blue Widget", Price: 1})
+    similar := c.create(Item{Name: "Blue Widgets", Price: 1})
+    c.create(Item{Name: "Red Gadget", Price: 1})
+    _, raw = c.do(http.MethodGet, fmt.Sprintf("/items/%d/related", named.ID), nil)
+    body = relatedBody{}
+    if err := json.Unmarshal(raw, &body); err != nil {
+        t.Fatal(err)
+    }
+    if ids := relatedIDs(body.Related); len(ids) != 1 || ids[0] != similar.ID {
+        t.Errorf("related by name = %v, want only %d", ids, similar.ID)
+    }
+}
+
+// TestIntegrationItemCounts counts a known dataset: one item in two
+// categories, one in one, one in none and a deleted one.
+func TestIntegrationItemCounts(t *testing.T) {
+    resetItemCounts(t)
+    c := newIntegrationClient(t)
+    categories := c.categories("books", "music")
+    books, music := categories[0], categories[1]
+    c.create(Item{Name: "Songbook", Price: 1, CategoryIDs: []int{books, music}})
+    c.create(Item{Name: "Novel", Price: 1, CategoryIDs: []int{books}})
+    c.create(Item{Name: "Loose item", Price: 1})
+    deleted := c.create(Item{Name: "Gone", Price: 1, CategoryIDs: []int{music}})
+    if resp, _ := c.do(http.MethodDelete, fmt.Sprintf("/items/%d", deleted.ID), nil); resp.StatusCode != http.StatusNoContent {
+        t.Fatalf("DELETE status = %d, want 204", resp.StatusCode)
+    }
+
+    resp, raw := c.do(http.MethodGet, "/items/count", nil)
+    if resp.StatusCode != http.StatusOK {
+        t.Fatalf("GET /items/count: status %d: %s", resp.StatusCode, raw)
+    }
+    var got itemCounts
+    if err := json.Unmarshal(raw, &got); err != nil {
+        t.Fatal(err)
+    }
+    want := itemCounts{Total: 3, ByCategory: map[string]int{
+        fmt.Sprintf("books-%s", c.tenantID.String()[:8]): 2,
+        fmt.Sprintf("music-%s", c.tenantID.String()[:8]): 1,
+    }}
+    if got.Total != want.Total || len(got.ByCategory) != len(want.ByCategory) {
+        t.Fatalf("counts = %+v, want %+v", got, want)
+    }
+    for slug, n := range want.ByCategory {
+        if got.ByCategory[slug] != n {
+            t.Errorf("by_category[%s] = %d, want %d", slug, got.ByCategory[slug], n)
+        }
+    }
+}
+
+// BenchmarkIntegrationGetItem reads one item from 100 concurrent goroutines,
+// through the prepared Get statement and through the same SQL sent unprepared,
+// which Postgres parses and plans on every call.
+func BenchmarkIntegrationGetItem(b *testing.B) {
+    if integration.db == nil {
+        b.Skip("set INTEGRATION_TESTS=true to run the integration benchmarks against a Postgres container")
+    }
+    ctx := context.Background()
+    tenantID := uuid.New()
+    var id int
+    err := integration.stmts.Insert.QueryRowContext(ctx, "Benchmark item", "", 1.0, nil, tenantID).Scan(&id, new(int))
+    if err != nil {
+        b.Fatal(err)
+    }
+    b.Cleanup(func() { integration.db.Exec(`DELETE FROM items WHERE tenant_id = $1`, tenantID) })
+
+    const concurrency = 100
+    integration.db.SetMaxOpenConns(concurrency)
+    b.Cleanup(func() { integration.db.SetMaxOpenConns(0) })
+    unprepared := `SELECT ` + itemColumns + ` FROM items WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL`
+
+    for _, bm := range []struct {
+        name  string
+        query func() *sql.Row
+    }{
+        {"prepared", func() *sql.Row { return integration.stmts.Get.QueryRowContext(ctx, id, tenantID) }},
+        {"unprepared", func() *sql.Row { return integration.db.QueryRowContext(ctx, unprepared, id, tenantID) }},
+    } {
+        b.Run(bm.name, func(b *testing.B) {
+            b.SetParallelism((concurrency + runtime.GOMAXPROCS(0) - 1) / runtime.GOMAXPROCS(0))
+            b.RunParallel(func(pb *testing.PB) {
+                for pb.Next() {
+                    var item Item
+                    err := bm.query().Scan(&item.ID, &item.Name, &item.Description, &item.Price, &item.Version, &item.ImageURL, &item.SKU, &item.Metadata)
+                    if err != nil {
+                        b.Error(err)
+                        return
+                    }
+                }
+            })
+        })
+    }
+}
+
+// BenchmarkIntegrationPagination reads the 20 items after the first 99,980 of
+// 100,000, once with LIMIT/OFFSET, which makes Postgres walk every skipped
+// row, and once from the keyset cursor of the last skipped item.
+func BenchmarkIntegrationPagination(b *testing.B) {
+    if integration.db == nil {
+        b.Skip("set INTEGRATION_TESTS=true to run the integration benchmarks against a Postgres container")
+    }
+    const rows, limit = 100000, 20
+    ctx := context.Background()
+    tenantID := uuid.New()
+    _, err := integration.db.ExecContext(ctx, `INSERT INTO items (name, description, price, tenant_id, created_at)
+        SELECT 'Item ' || n, '', 1, $1, NOW() - (($2 - n) * INTERVAL '1 second') FROM generate_series(1, $2) AS n`, tenantID, rows)
+    if err != nil {
+        b.Fatal(err)
+    }
+    b.Cleanup(func() { integration.db.Exec(`DELETE FROM items WHERE tenant_id = $1`, tenantID) })
+    if _, err := integration.db.ExecContext(ctx, `ANALYZE items`); err != nil {
+        b.Fatal(err)
+    }
+
+    var after itemCursor
+    err = integration.db.QueryRowContext(ctx, `SELECT id, created_at FROM items WHERE tenant_id = $1
+        ORDER BY created_at, id OFFSET $2 LIMIT 1`, tenantID, rows-limit-1).Scan(&after.ID, &after.CreatedAt)
+    if err != nil {
+        b.Fatal(err)
+    }
+    offsetSQL, offsetArgs := buildItemsQuery(ItemFilters{TenantID: tenantID, Limit: limit, Offset: rows - limit})
+    keysetSQL, keysetArgs := buildItemsKeysetQuery(ItemFilters{TenantID: tenantID, Limit: limit, Keyset: true, After: &after})
+
+    for _, bm := range []struct {
+        name  string
+        query string
+        args  []interface{}
+    }{
+        {"offset", offsetSQL, offsetArgs},
+        {"keyset", keysetSQL, keysetArgs},
+    } {
+        b.Run(bm.name, func(b *testing.B) {
+            for i := 0; i < b.N; i++ {
+                result, err := integration.db.QueryContext(ctx, bm.query, bm.args...)
+                if err != nil {
+                    b.Fatal(err)
+                }
+                n := 0
+                for result.Next() {
+                    n++
+                }
+                result.Close()
+                if n < limit {
+                    b.Fatalf("read %d rows, want at least %d", n, limit)
+                }
+            }
+        })
+    }
+}
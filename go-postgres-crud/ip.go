@@ -0,0 +1,85 @@
+package main
+
+import (
+    "fmt"
+    "net"
+    "net/http"
+    "strings"
+)
+
+// parseCIDRs parses a comma-separated list of CIDR ranges.
+func parseCIDRs(raw string) ([]*net.IPNet, error) {
+    var networks []*net.IPNet
+    for _, part := range strings.Split(raw, ",") {
+        part = strings.TrimSpace(part)
+        if part == "" {
+            continue
+        }
+        _, network, err := net.ParseCIDR(part)
+        if err != nil {
+            return nil, fmt.Errorf("invalid CIDR %q", part)
+        }
+        networks = append(networks, network)
+    }
+    return networks, nil
+}
+
+func ipInNetworks(ip net.IP, networks []*net.IPNet) bool {
+    for _, network := range networks {
+        if network.Contains(ip) {
+            return true
+        }
+    }
+    return false
+}
+
+// trustedProxies are the networks whose X-Forwarded-For headers are believed,
+// configured from TRUSTED_PROXY_CIDRS.
+var trustedProxies []*net.IPNet
+
+// realIP returns the client address. X-Forwarded-For is only consulted when
+// the direct peer is a trusted proxy; the header is then walked from the
+// right, skipping further trusted hops, so a client cannot spoof its address
+// by sending the header itself.
+func realIP(r *http.Request) net.IP {
+    host, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil {
+        host = r.RemoteAddr
+    }
+    remote := net.ParseIP(host)
+    if remote == nil || !ipInNetworks(remote, trustedProxies) {
+        return remote
+    }
+
+    hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+    for i := len(hops) - 1; i >= 0; i-- {
+        ip := net.ParseIP(strings.TrimSpace(hops[i]))
+        if ip == nil {
+            break
+        }
+        if !ipInNetworks(ip, trustedProxies) {
+            return ip
+        }
+        remote = ip
+    }
+    return remote
+}
+
+// adminIPWhitelistMiddleware only lets clients from the allowed networks
+// through. An empty list allows everyone, which is meant for development.
+func adminIPWhitelistMiddleware(allowed []*net.IPNet) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        if len(allowed) == 0 {
+            return next
+        }
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            ip := realIP(r)
+            if ip == nil || !ipInNetworks(ip, allowed) {
+                requestLogger(r.Context()).Warn("rejected admin request", "status_code", http.StatusForbidden, "client_ip", ip.String())
+                writeError(w, http.StatusForbidden, "FORBIDDEN", "Forbidden")
+                return
+            }
+            next.ServeHTTP(w, r)
+        })
+    }
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+// trustProxies sets trustedProxies for the duration of the test.
+func trustProxies(t *testing.T, cidrs string) {
+    t.Helper()
+    networks, err := parseCIDRs(cidrs)
+    if err != nil {
+        t.Fatal(err)
+    }
+    previous := trustedProxies
+    trustedProxies = networks
+    t.Cleanup(func() { trustedProxies = previous })
+}
+
+func TestRealIP(t *testing.T) {
+    trustProxies(t, "10.0.0.0/8,172.16.0.0/12")
+
+    tests := []struct {
+        name       string
+        remoteAddr string
+        forwarded  []string
+        want       string
+    }{
+        {"no header", "203.0.113.1:4711", nil, "203.0.113.1"},
+        {"untrusted peer spoofing loopback", "203.0.113.1:4711", []string{"127.0.0.1"}, "203.0.113.1"},
+        {"trusted proxy", "10.0.0.5:4711", []string{"198.51.100.7"}, "198.51.100.7"},
+        {"trusted proxy chain", "10.0.0.5:4711", []string{"198.51.100.7, 172.16.3.4"}, "198.51.100.7"},
+        {"client prepends a spoofed hop", "10.0.0.5:4711", []string{"127.0.0.1, 198.51.100.7"}, "198.51.100.7"},
+        {"repeated headers", "10.0.0.5:4711", []string{"127.0.0.1", "198.51.100.7"}, "198.51.100.7"},
+        {"only trusted hops", "10.0.0.5:4711", []string{"10.1.1.1"}, "10.1.1.1"},
+        {"garbage hop stops the walk", "10.0.0.5:4711", []string{"198.51.100.7, not-an-ip"}, "10.0.0.5"},
+        {"IPv6 peer", "[2001:db8::1]:4711", []string{"127.0.0.1"}, "2001:db8::1"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            r := httptest.NewRequest(http.MethodGet, "/", nil)
+            r.RemoteAddr = tt.remoteAddr
+            for _, value := range tt.forwarded {
+                r.Header.Add("X-Forwarded-For", value)
+            }
+            if got := realIP(r); got.String() != tt.want {
+                t.Errorf("realIP = %v, want %s", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestRealIPWithoutTrustedProxies(t *testing.T) {
+    trustProxies(t, "")
+    r := httptest.NewRequest(http.MethodGet, "/", nil)
+    r.RemoteAddr = "10.0.0.5:4711"
+    r.Header.Set("X-Forwarded-For", "198.51.100.7")
+    if got := realIP(r); got.String() != "10.0.0.5" {
+        t.Errorf("realIP = %v, want the peer address", got)
+    }
+}
+
+func TestParseCIDRs(t *testing.T) {
+    networks, err := parseCIDRs(" 10.0.0.0/8, ,172.16.0.0/12 ")
+    if err != nil || len(networks) != 2 {
+        t.Fatalf("parseCIDRs = %v, %v; want two networks", networks, err)
+    }
+    if _, err := parseCIDRs("10.0.0.0/8,10.0.0.1"); err == nil {
+        t.Error("parseCIDRs accepted an address without a prefix length")
+    }
+}
+
+func TestAdminIPWhitelistUsesTrustedProxies(t *testing.T) {
+    trustProxies(t, "10.0.0.0/8")
+    allowed, err := parseCIDRs("127.0.0.0/8")
+    if err != nil {
+        t.Fatal(err)
+    }
+    h := adminIPWhitelistMiddleware(allowed)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+    tests := []struct {
+        name       string
+        remoteAddr string
+        forwarded  string
+        status     int
+    }{
+        {"spoofed header from an untrusted peer", "203.0.113.1:4711", "127.0.0.1", http.StatusForbidden},
+        {"allowed client behind a trusted proxy", "10.0.0.5:4711", "127.0.0.1", http.StatusOK},
+        {"allowed peer", "127.0.0.1:4711", "", http.StatusOK},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            r := httptest.NewRequest(http.MethodGet, "/admin/db/stats", nil)
+            r.RemoteAddr = tt.remoteAddr
+            if tt.forwarded != "" {
+                r.Header.Set("X-Forwarded-For", tt.forwarded)
+            }
+            rec := httptest.NewRecorder()
+            h.ServeHTTP(rec, r)
+            if rec.Code != tt.status {
+                t.Errorf("status = %d, want %d", rec.Code, tt.status)
+            }
+        })
+    }
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+    "encoding/json"
+    "reflect"
+    "sort"
+    "strings"
+)
+
+// patchOperation is one operation of an RFC 6902 JSON Patch. OldValue is not
+// part of the RFC: it carries the value a replace or remove discards, so a
+// reader can show both sides of the change.
+type patchOperation struct {
+    Op       string
+    Path     string
+    Value    interface{}
+    OldValue interface{}
+}
+
+// MarshalJSON writes value for add and replace and old_value for replace and
+// remove, even when they are null.
+func (op patchOperation) MarshalJSON() ([]byte, error) {
+    wire := struct {
+        Op       string       `json:"op"`
+        Path     string       `json:"path"`
+        Value    *interface{} `json:"value,omitempty"`
+        OldValue *interface{} `json:"old_value,omitempty"`
+    }{Op: op.Op, Path: op.Path}
+    if op.Op != "remove" {
+        wire.Value = &op.Value
+    }
+    if op.Op != "add" {
+        wire.OldValue = &op.OldValue
+    }
+    return json.Marshal(wire)
+}
+
+// diffJSON returns the JSON Patch that turns from into to, both decoded by
+// encoding/json. Objects are compared member by member, in key order; any
+// other change, arrays included, replaces the value as a whole.
+func diffJSON(from, to interface{}) []patchOperation {
+    return appendDiff([]patchOperation{}, "", from, to)
+}
+
+func appendDiff(ops []patchOperation, path string, from, to interface{}) []patchOperation {
+    fromObject, fromOK := from.(map[string]interface{})
+    toObject, toOK := to.(map[string]interface{})
+    if !fromOK || !toOK {
+        if !reflect.DeepEqual(from, to) {
+            ops = append(ops, patchOperation{Op: "replace", Path: path, Value: to, OldValue: from})
+        }
+        return ops
+    }
+
+    keys := make([]string, 0, len(fromObject)+len(toObject))
+    for key := range fromObject {
+        keys = append(keys, key)
+    }
+    for key := range toObject {
+        if _, ok := fromObject[key]; !ok {
+            keys = append(keys, key)
+        }
+    }
+    sort.Strings(keys)
+    for _, key := range keys {
+        memberPath := path + "/" + escapePointerToken(key)
+        fromValue, inFrom := fromObject[key]
+        toValue, inTo := toObject[key]
+        switch {
+        case !inTo:
+            ops = append(ops, patchOperation{Op: "remove", Path: memberPath, OldValue: fromValue})
+        case !inFrom:
+            ops = append(ops, patchOperation{Op: "add", Path: memberPath, Value: toValue})
+        default:
+            ops = appendDiff(ops, memberPath, fromValue, toValue)
+        }
+    }
+    return ops
+}
+
+// escapePointerToken escapes a member name for a JSON Pointer (RFC 6901).
+func escapePointerToken(token string) string {
+    return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
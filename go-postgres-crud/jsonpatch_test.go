@@ -0,0 +1,33 @@
+package main
+
+import (
+    "encoding/json"
+    "testing"
+)
+
+func TestDiffJSON(t *testing.T) {
+    var from, to interface{}
+    json.Unmarshal([]byte(`{"name":"Drill","price":9.99,"metadata":{"color":"red","a/b":1},"tags":["x"],"retired":false}`), &from)
+    json.Unmarshal([]byte(`{"name":"Drill","price":14.99,"metadata":{"color":"blue","size":"L"},"tags":["x","y"],"sku":null}`), &to)
+
+    got, err := json.Marshal(diffJSON(from, to))
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := `[` +
+        `{"op":"remove","path":"/metadata/a~1b","old_value":1},` +
+        `{"op":"replace","path":"/metadata/color","value":"blue","old_value":"red"},` +
+        `{"op":"add","path":"/metadata/size","value":"L"},` +
+        `{"op":"replace","path":"/price","value":14.99,"old_value":9.99},` +
+        `{"op":"remove","path":"/retired","old_value":false},` +
+        `{"op":"add","path":"/sku","value":null},` +
+        `{"op":"replace","path":"/tags","value":["x","y"],"old_value":["x"]}` +
+        `]`
+    if string(got) != want {
+        t.Errorf("diffJSON =\n%s\nwant\n%s", got, want)
+    }
+
+    if ops := diffJSON(from, from); len(ops) != 0 {
+        t.Errorf("diffJSON of equal documents = %v, want no operations", ops)
+    }
+}
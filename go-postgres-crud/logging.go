@@ -0,0 +1,127 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "log/slog"
+    "net/http"
+    "os"
+    "strings"
+    "time"
+)
+
+// parseLogLevel maps LOG_LEVEL (debug, info, warn or error) to a slog level.
+// An empty value means info.
+func parseLogLevel(raw string) (slog.Level, error) {
+    switch strings.ToLower(strings.TrimSpace(raw)) {
+    case "debug":
+        return slog.LevelDebug, nil
+    case "", "info":
+        return slog.LevelInfo, nil
+    case "warn", "warning":
+        return slog.LevelWarn, nil
+    case "error":
+        return slog.LevelError, nil
+    }
+    return 0, fmt.Errorf("LOG_LEVEL must be debug, info, warn or error, got %q", raw)
+}
+
+func newLogger(w io.Writer, level slog.Level) *slog.Logger {
+    return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level}))
+}
+
+// fatal logs msg at error level and exits, like log.Fatal.
+func fatal(msg string, args ...any) {
+    slog.Error(msg, args...)
+    os.Exit(1)
+}
+
+type loggerKey struct{}
+
+// requestLogger returns the logger that accessLogMiddleware attached to ctx,
+// which carries request_id, method and path, or the default logger outside a
+// request.
+func requestLogger(ctx context.Context) *slog.Logger {
+    if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+        return logger
+    }
+    return slog.Default()
+}
+
+// accessLogMiddleware attaches a request-scoped logger to the context and logs
+// one entry per request once the response is complete. It must run inside
+// requestIDMiddleware so the request ID is already known.
+func accessLogMiddleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        start := time.Now()
+        logger := slog.Default().With(
+            "request_id", requestIDFromContext(r.Context()),
+            "method", r.Method,
+            "path", r.URL.Path,
+        )
+        rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+        next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), loggerKey{}, logger)))
+        logger.Info("request completed",
+            "status_code", rec.status,
+            "duration_ms", time.Since(start).Milliseconds(),
+        )
+    })
+}
+
+// slowRequestMiddleware logs a warning for every request that takes longer
+// than threshold, with enough detail to reproduce it. It runs inside the
+// router so the streaming routes, which are slow by design, can be skipped.
+func slowRequestMiddleware(threshold time.Duration) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if untimedRoutes[routeLabel(r)] {
+                next.ServeHTTP(w, r)
+                return
+            }
+            start := time.Now()
+            rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+            next.ServeHTTP(rec, r)
+
+            elapsed := time.Since(start)
+            if elapsed <= threshold {
+                return
+            }
+            requestLogger(r.Context()).Warn("slow request",
+                "duration_ms", elapsed.Milliseconds(),
+                "method", r.Method,
+                "path", r.URL.Path,
+                "query_string", r.URL.RawQuery,
+                "status_code", rec.status,
+                "request_id", requestIDFromContext(r.Context()),
+            )
+        })
+    }
+}
+
+// statusRecorder remembers the status code sent to the client. Flush is
+// forwarded so streaming handlers keep working.
+type statusRecorder struct {
+    http.ResponseWriter
+    status      int
+    wroteHeader bool
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+    if !s.wroteHeader {
+        s.status = status
+        s.wroteHeader = true
+    }
+    s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+    s.wroteHeader = true
+    return s.ResponseWriter.Write(p)
+}
+
+func (s *statusRecorder) Flush() {
+    if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+        flusher.Flush()
+    }
+}
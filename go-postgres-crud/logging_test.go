@@ -0,0 +1,75 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "log/slog"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+// captureLogs sends the default logger's JSON output to the returned buffer
+// until the test ends.
+func captureLogs(t *testing.T) *bytes.Buffer {
+    t.Helper()
+    var logs bytes.Buffer
+    previous := slog.Default()
+    slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+    t.Cleanup(func() { slog.SetDefault(previous) })
+    return &logs
+}
+
+func TestSlowRequestMiddleware(t *testing.T) {
+    logs := captureLogs(t)
+    delay := 30 * time.Millisecond
+    h := requestIDMiddleware(slowRequestMiddleware(10 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        time.Sleep(delay)
+        w.WriteHeader(http.StatusTeapot)
+    })))
+    r := httptest.NewRequest(http.MethodGet, "/items?q=widget&limit=5", nil)
+    r.Header.Set(requestIDHeader, "slow-req-1")
+    h.ServeHTTP(httptest.NewRecorder(), r)
+
+    var entry map[string]interface{}
+    if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+        t.Fatalf("log %q: %v", logs, err)
+    }
+    want := map[string]interface{}{
+        "level":        "WARN",
+        "msg":          "slow request",
+        "method":       "GET",
+        "path":         "/items",
+        "query_string": "q=widget&limit=5",
+        "status_code":  float64(http.StatusTeapot),
+        "request_id":   "slow-req-1",
+    }
+    for key, value := range want {
+        if entry[key] != value {
+            t.Errorf("%s = %v, want %v", key, entry[key], value)
+        }
+    }
+    if ms, _ := entry["duration_ms"].(float64); ms < float64(delay.Milliseconds()) {
+        t.Errorf("duration_ms = %v, want at least %d", entry["duration_ms"], delay.Milliseconds())
+    }
+}
+
+func TestSlowRequestMiddlewareSkips(t *testing.T) {
+    logs := captureLogs(t)
+    sleep := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { time.Sleep(20 * time.Millisecond) })
+
+    // A request under the threshold is not logged.
+    slowRequestMiddleware(time.Second)(sleep).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items", nil))
+
+    // Nor is a streaming route, however long it takes.
+    r := httptest.NewRequest(http.MethodGet, "/items/stream", nil)
+    r = r.WithContext(context.WithValue(r.Context(), routeKey{}, "/items/stream"))
+    slowRequestMiddleware(time.Millisecond)(sleep).ServeHTTP(httptest.NewRecorder(), r)
+
+    if out := strings.TrimSpace(logs.String()); out != "" {
+        t.Errorf("logged %s, want nothing", out)
+    }
+}
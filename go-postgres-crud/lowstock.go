@@ -0,0 +1,162 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "log/slog"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/google/uuid"
+    "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// lowStockThreshold is the stock at or below which an item counts as low,
+// unless GET /items/low-stock names another threshold. It is set from
+// LOW_STOCK_THRESHOLD at startup.
+var lowStockThreshold = 10
+
+// lowStockItem is an item in the low-stock report and alert.
+type lowStockItem struct {
+    ID    int    `json:"id"`
+    Name  string `json:"name"`
+    SKU   string `json:"sku,omitempty"`
+    Stock int    `json:"stock"`
+}
+
+// getLowStockItems lists the tenant's live items whose stock is at or below
+// threshold (default lowStockThreshold), lowest stock first, with the number
+// of such items across all pages.
+func getLowStockItems(w http.ResponseWriter, r *http.Request) error {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "getLowStockItems", tracer.ResourceName("SELECT FROM items WHERE stock <= $2"))
+    defer span.Finish()
+
+    threshold := lowStockThreshold
+    if raw := r.URL.Query().Get("threshold"); raw != "" {
+        var err error
+        threshold, err = strconv.Atoi(raw)
+        if err != nil || threshold < 0 {
+            return &ValidationError{Code: "INVALID_QUERY", Message: "threshold must be a non-negative integer"}
+        }
+    }
+    limit, offset, err := parsePagination(r)
+    if err != nil {
+        return &ValidationError{Code: "INVALID_PAGINATION", Message: err.Error()}
+    }
+
+    tenantID := tenantFromContext(ctx)
+    var total int
+    err = withReadFallback(ctx, selectDB(r), func(q *sql.DB) error {
+        return q.QueryRowContext(ctx, `SELECT COUNT(*) FROM items WHERE tenant_id = $1 AND deleted_at IS NULL AND stock <= $2`, tenantID, threshold).Scan(&total)
+    })
+    if err != nil {
+        return err
+    }
+
+    rows, err := queryRead(r, `SELECT id, name, COALESCE(sku, ''), stock FROM items
+        WHERE tenant_id = $1 AND deleted_at IS NULL AND stock <= $2
+        ORDER BY stock, id LIMIT $3 OFFSET $4`, tenantID, threshold, limit, offset)
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+    items := []lowStockItem{}
+    for rows.Next() {
+        var item lowStockItem
+        if err := rows.Scan(&item.ID, &item.Name, &item.SKU, &item.Stock); err != nil {
+            return err
+        }
+        items = append(items, item)
+    }
+    if err := rows.Err(); err != nil {
+        return err
+    }
+
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "items":           items,
+        "total_low_stock": total,
+        "threshold":       threshold,
+        "limit":           limit,
+        "offset":          offset,
+    })
+    return nil
+}
+
+// startLowStockAlerter sends every tenant's low-stock items to its
+// item.low_stock webhooks daily at hour UTC. The returned stop function
+// cancels the alerter and waits for it to exit.
+func startLowStockAlerter(db *sql.DB, hour int) (stop func()) {
+    ctx, cancel := context.WithCancel(context.Background())
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        for {
+            at := nextDailyRun(time.Now(), hour)
+            timer := time.NewTimer(time.Until(at))
+            select {
+            case <-ctx.Done():
+                timer.Stop()
+                return
+            case <-timer.C:
+                alertLowStock(ctx, db, at)
+            }
+        }
+    }()
+    return func() {
+        cancel()
+        <-done
+    }
+}
+
+// nextDailyRun is the first time after now at hour UTC.
+func nextDailyRun(now time.Time, hour int) time.Time {
+    now = now.UTC()
+    at := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, time.UTC)
+    if !at.After(now) {
+        at = at.AddDate(0, 0, 1)
+    }
+    return at
+}
+
+// alertLowStock marks the low-stock items not alerted in the 24 hours before
+// at, and delivers them to the webhooks of their tenants. Items are stamped
+// with at rather than the clock, so tomorrow's run matches today's stamp
+// exactly however late either run starts.
+func alertLowStock(ctx context.Context, db *sql.DB, at time.Time) {
+    rows, err := db.QueryContext(ctx, `UPDATE items SET low_stock_alerted_at = $2
+        WHERE deleted_at IS NULL AND stock <= $1
+            AND (low_stock_alerted_at IS NULL OR low_stock_alerted_at <= $3)
+        RETURNING tenant_id, id, name, COALESCE(sku, ''), stock`, lowStockThreshold, at, at.Add(-24*time.Hour))
+    if err != nil {
+        if ctx.Err() == nil {
+            slog.Error("finding low-stock items failed", "error", err)
+        }
+        return
+    }
+    defer rows.Close()
+    byTenant := map[uuid.UUID][]lowStockItem{}
+    for rows.Next() {
+        var tenantID uuid.UUID
+        var item lowStockItem
+        if err := rows.Scan(&tenantID, &item.ID, &item.Name, &item.SKU, &item.Stock); err != nil {
+            slog.Error("finding low-stock items failed", "error", err)
+            return
+        }
+        byTenant[tenantID] = append(byTenant[tenantID], item)
+    }
+    if err := rows.Err(); err != nil {
+        slog.Error("finding low-stock items failed", "error", err)
+        return
+    }
+    for tenantID, items := range byTenant {
+        dispatchWebhook(withTenant(ctx, tenantID), eventItemLowStock, map[string]interface{}{
+            "threshold": lowStockThreshold,
+            "items":     items,
+        })
+    }
+    if len(byTenant) > 0 {
+        slog.Info("sent low-stock alerts", "tenants", len(byTenant))
+    }
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    "github.com/DATA-DOG/go-sqlmock"
+    "github.com/google/uuid"
+)
+
+func TestGetLowStockItems(t *testing.T) {
+    mock := mockDB(t)
+    rt := newTestRouter(NewApp(storedItems(), nil, NewFeatureFlags(nil), nil))
+
+    mock.ExpectQuery(`SELECT COUNT\(\*\) FROM items WHERE tenant_id = \$1 AND deleted_at IS NULL AND stock <= \$2`).
+        WithArgs(defaultTenantID, lowStockThreshold).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(45))
+    mock.ExpectQuery(`ORDER BY stock, id LIMIT \$3 OFFSET \$4`).WithArgs(defaultTenantID, lowStockThreshold, 2, 4).
+        WillReturnRows(sqlmock.NewRows([]string{"id", "name", "sku", "stock"}).AddRow(7, "Drill", "DRL-1", 0).AddRow(3, "Saw", "", 1))
+
+    rec := doRequest(t, rt, http.MethodGet, "/items/low-stock?limit=2&offset=4", nil, "")
+    var got struct {
+        Items         []lowStockItem `json:"items"`
+        TotalLowStock int            `json:"total_low_stock"`
+        Threshold     int            `json:"threshold"`
+    }
+    decodeBody(t, rec, &got)
+    if rec.Code != http.StatusOK || got.TotalLowStock != 45 || got.Threshold != lowStockThreshold || len(got.Items) != 2 {
+        t.Fatalf("status %d, body %s; want two of 45 items at the default threshold", rec.Code, rec.Body)
+    }
+    if got.Items[0] != (lowStockItem{ID: 7, Name: "Drill", SKU: "DRL-1", Stock: 0}) {
+        t.Errorf("first item = %+v", got.Items[0])
+    }
+
+    t.Run("threshold", func(t *testing.T) {
+        mock := mockDB(t)
+        mock.ExpectQuery(`SELECT COUNT`).WithArgs(defaultTenantID, 0).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+        mock.ExpectQuery(`ORDER BY stock`).WithArgs(defaultTenantID, 0, defaultPageLimit, 0).WillReturnRows(sqlmock.NewRows([]string{"id", "name", "sku", "stock"}))
+        if rec := doRequest(t, rt, http.MethodGet, "/items/low-stock?threshold=0", nil, ""); rec.Code != http.StatusOK {
+            t.Errorf("status %d, body %s; want 200", rec.Code, rec.Body)
+        }
+    })
+
+    t.Run("invalid", func(t *testing.T) {
+        mockDB(t)
+        for _, query := range []string{"?threshold=-1", "?threshold=few", "?limit=501"} {
+            if rec := doRequest(t, rt, http.MethodGet, "/items/low-stock"+query, nil, ""); rec.Code != http.StatusBadRequest {
+                t.Errorf("GET /items/low-stock%s: status = %d, want 400", query, rec.Code)
+            }
+        }
+    })
+}
+
+func TestNextLowStockAlert(t *testing.T) {
+    tests := []struct {
+        now  time.Time
+        want time.Time
+    }{
+        {time.Date(2025, 3, 1, 7, 59, 0, 0, time.UTC), time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)},
+        {time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC), time.Date(2025, 3, 2, 8, 0, 0, 0, time.UTC)},
+        {time.Date(2025, 12, 31, 23, 0, 0, 0, time.UTC), time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC)},
+        // The hour is in UTC whatever the zone of now.
+        {time.Date(2025, 3, 1, 9, 0, 0, 0, time.FixedZone("CET", 3600)), time.Date(2025, 3, 2, 8, 0, 0, 0, time.UTC)},
+    }
+    for _, tt := range tests {
+        if got := nextDailyRun(tt.now, 8); !got.Equal(tt.want) {
+            t.Errorf("nextDailyRun(%v, 8) = %v, want %v", tt.now, got, tt.want)
+        }
+    }
+}
+
+// TestAlertLowStock checks that items not alerted since yesterday's run are
+// stamped and delivered to their tenant's item.low_stock webhooks.
+func TestAlertLowStock(t *testing.T) {
+    mock := mockDB(t)
+    delivered := make(chan webhookDelivery, 1)
+    hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, _ := io.ReadAll(r.Body)
+        var delivery webhookDelivery
+        json.Unmarshal(body, &delivery)
+        delivered <- delivery
+    }))
+    defer hook.Close()
+    // The public client refuses loopback addresses like the test server's.
+    client := webhookClient
+    webhookClient = hook.Client()
+    t.Cleanup(func() { webhookClient = client })
+
+    tenantID := uuid.New()
+    at := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+    mock.ExpectQuery(`UPDATE items SET low_stock_alerted_at = \$2`).WithArgs(lowStockThreshold, at, at.Add(-24*time.Hour)).
+        WillReturnRows(sqlmock.NewRows([]string{"tenant_id", "id", "name", "sku", "stock"}).
+            AddRow(tenantID, 7, "Drill", "", 0).AddRow(tenantID, 3, "Saw", "SAW-1", 2))
+    mock.ExpectQuery(`FROM webhooks`).WithArgs(eventItemLowStock, tenantID).
+        WillReturnRows(sqlmock.NewRows([]string{"id", "url", "secret"}).AddRow(1, hook.URL, "s3cret"))
+
+    alertLowStock(context.Background(), db, at)
+    select {
+    case delivery := <-delivered:
+        items, _ := delivery.Payload.(map[string]interface{})["items"].([]interface{})
+        if delivery.Event != eventItemLowStock || len(items) != 2 {
+            t.Errorf("delivery = %+v, want both items as item.low_stock", delivery)
+        }
+    case <-time.After(time.Second):
+        t.Fatal("no webhook delivery")
+    }
+}
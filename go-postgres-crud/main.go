@@ -1,90 +1,671 @@
 package main
 
 import (
+    "compress/gzip"
+    "context"
     "database/sql"
     "encoding/json"
+    "encoding/xml"
+    "errors"
+    "flag"
     "fmt"
-    "log"
+    "io"
+    "log/slog"
+    "net"
     "net/http"
+    "os"
+    "os/signal"
     "strconv"
+    "strings"
+    "syscall"
+    "time"
 
-    "github.com/gorilla/mux"
     "github.com/lib/pq" // Import pq driver
-    "github.com/rs/cors"
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+    "google.golang.org/grpc"
     httptrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/net/http"
     "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
     sqltrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/database/sql"
 )
 
-const (
-    host     = "localhost"
-    port     = 5432
-    user     = "go_user"
-    password = "go_user"
-    dbname   = "go_crud"
-)
-
 var db *sql.DB
 
 type Item struct {
-    ID          int     `json:"id"`
-    Name        string  `json:"name"`
-    Description string  `json:"description"`
-    Price       float64 `json:"price"`
+    XMLName     xml.Name `json:"-" xml:"item"`
+    ID          int      `json:"id" xml:"id"`
+    Name        string   `json:"name" xml:"name"`
+    Description string   `json:"description" xml:"description"`
+    Price       float64  `json:"price" xml:"price"`
+    // Version is bumped by every update. Updates that send it only succeed
+    // while it still matches the stored row.
+    Version  int    `json:"version" xml:"version"`
+    ImageURL string `json:"image_url,omitempty" xml:"image_url,omitempty"`
+    // SKU is set by POST /items/{id}/generate-sku and ignored in request
+    // bodies.
+    SKU string `json:"sku,omitempty" xml:"sku,omitempty"`
+    // Metadata holds free-form attributes. Like CategoryIDs, a nil value
+    // leaves the stored metadata unchanged on update. Arbitrary JSON has no
+    // XML mapping, so the XML representation leaves it out.
+    Metadata Metadata `json:"metadata,omitempty" xml:"-"`
+    // CategoryIDs is only read from create and update bodies; a nil slice
+    // leaves an item's categories unchanged on update.
+    CategoryIDs []int      `json:"category_ids,omitempty" xml:"category_ids>id,omitempty"`
+    Categories  []Category `json:"categories,omitempty" xml:"categories>category,omitempty"`
 }
 
 func main() {
+    // Settings come from the environment, with a config file filling in the
+    // variables that are not set.
+    configPath := flag.String("config", "config.yaml", "YAML config file; environment variables override its values")
+    flag.Parse()
+    cfg, err := LoadConfig(*configPath)
+    if err == nil {
+        err = cfg.Export()
+    }
+    if err != nil {
+        slog.Error("error reading configuration", "error", err)
+        os.Exit(1)
+    }
+
+    // slog.SetDefault also routes the standard log package, as used by
+    // net/http and the tracer, through the JSON handler.
+    logLevel, err := parseLogLevel(os.Getenv("LOG_LEVEL"))
+    if err != nil {
+        slog.Error("error reading configuration", "error", err)
+        os.Exit(1)
+    }
+    slog.SetDefault(newLogger(os.Stdout, logLevel))
+
+    if env := os.Getenv("APP_ENV"); env != "" {
+        if env != "production" && env != "development" {
+            fatal("error reading configuration", "error", "APP_ENV must be production or development", "app_env", env)
+        }
+        appEnv = env
+    }
+
+    // "seed" fills the database with sample items instead of starting the
+    // server; see runSeed.
+    if args := flag.Args(); len(args) > 0 && args[0] == "seed" {
+        if err := runSeed(args[1:]); err != nil {
+            fatal("error seeding the database", "error", err)
+        }
+        return
+    }
+    // "rollback" reverts the latest migration; see runRollback.
+    if args := flag.Args(); len(args) > 0 && args[0] == "rollback" {
+        if err := runRollback(args[1:]); err != nil {
+            fatal("error rolling back the database", "error", err)
+        }
+        return
+    }
+
+    rules, err := samplingRules()
+    if err != nil {
+        fatal("error reading configuration", "error", err)
+    }
+    shutdownSeconds, err := getEnvInt("SHUTDOWN_TIMEOUT_SECONDS", 30)
+    if err != nil || shutdownSeconds <= 0 {
+        fatal("error reading configuration", "error", "SHUTDOWN_TIMEOUT_SECONDS must be a positive integer")
+    }
+    shutdownTimeout := time.Duration(shutdownSeconds) * time.Second
+
     // Start Datadog tracer
     tracer.Start(
-        tracer.WithAgentAddr("localhost:8126"),
+        tracer.WithAgentAddr(getEnv("DD_AGENT_ADDR", "localhost:8126")),
         tracer.WithService("test-go"),
         tracer.WithEnv("prod"),
         tracer.WithServiceVersion("abc123"),
+        tracer.WithSamplingRules(rules),
     )
     defer tracer.Stop()
 
     // Register the driver with Datadog tracing
     sqltrace.Register("postgres", &pq.Driver{}, sqltrace.WithDBMPropagation(tracer.DBMPropagationModeFull))
 
-    psqlInfo := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-        host, port, user, password, dbname)
+    minItemPrice, err = getEnvFloat("MIN_ITEM_PRICE", minItemPrice)
+    if err != nil {
+        fatal("error reading configuration", "error", err)
+    }
+    maxItemPrice, err = getEnvFloat("MAX_ITEM_PRICE", maxItemPrice)
+    if err != nil {
+        fatal("error reading configuration", "error", err)
+    }
+    if minItemPrice > maxItemPrice {
+        fatal("error reading configuration", "error", "MIN_ITEM_PRICE must not exceed MAX_ITEM_PRICE", "min_item_price", minItemPrice, "max_item_price", maxItemPrice)
+    }
+
+    defaultItemSort, err = parseDefaultSort(os.Getenv("DEFAULT_SORT_BY"), os.Getenv("DEFAULT_SORT_ORDER"))
+    if err != nil {
+        fatal("error reading configuration", "error", err)
+    }
+
+    requestTimeoutSeconds, err := getEnvInt("REQUEST_TIMEOUT_SECONDS", 10)
+    if err != nil || requestTimeoutSeconds <= 0 {
+        fatal("error reading configuration", "error", "REQUEST_TIMEOUT_SECONDS must be a positive integer")
+    }
+
+    // RATE_LIMIT_RPS=0 turns per-client rate limiting off.
+    rateLimitRPS, err := getEnvFloat("RATE_LIMIT_RPS", 10)
+    if err != nil || rateLimitRPS < 0 {
+        fatal("error reading configuration", "error", "RATE_LIMIT_RPS must be a non-negative number")
+    }
+    rateLimitBurst, err := getEnvInt("RATE_LIMIT_BURST", 20)
+    if err != nil || rateLimitBurst <= 0 {
+        fatal("error reading configuration", "error", "RATE_LIMIT_BURST must be a positive integer")
+    }
+    if raw := os.Getenv("RATE_LIMIT_CLEANUP_INTERVAL"); raw != "" {
+        rateLimitCleanupInterval, err = time.ParseDuration(raw)
+        if err != nil || rateLimitCleanupInterval <= 0 {
+            fatal("error reading configuration", "error", "RATE_LIMIT_CLEANUP_INTERVAL must be a positive duration such as 5m")
+        }
+    }
+
+    if path := os.Getenv("BLOCKED_WORDS_FILE"); path != "" {
+        pattern, err := loadBlockedWords(path)
+        if err != nil {
+            fatal("error loading BLOCKED_WORDS_FILE", "error", err)
+        }
+        blockedWords.Store(pattern)
+        if raw := os.Getenv("BLOCKED_WORDS_RELOAD_INTERVAL"); raw != "" {
+            interval, err := time.ParseDuration(raw)
+            if err != nil || interval <= 0 {
+                fatal("error reading configuration", "error", "BLOCKED_WORDS_RELOAD_INTERVAL must be a positive duration such as 5m")
+            }
+            go watchBlockedWords(path, interval)
+        }
+    }
+
+    maxRequestBodyBytes, err := getEnvInt("MAX_REQUEST_BODY_BYTES", 64<<10)
+    if err != nil || maxRequestBodyBytes <= 0 {
+        fatal("error reading configuration", "error", "MAX_REQUEST_BODY_BYTES must be a positive integer")
+    }
+
+    for _, field := range strings.Split(os.Getenv("IMMUTABLE_FIELDS"), ",") {
+        if field = strings.TrimSpace(field); field != "" {
+            immutableFields = append(immutableFields, field)
+        }
+    }
+
+    secret, err := requireEnv("JWT_SECRET")
+    if err != nil {
+        fatal("error reading configuration", "error", err)
+    }
+    jwtSecret = []byte(secret)
+
+    dbConfig, err := loadDBSettings()
+    if err != nil {
+        fatal("error reading configuration", "error", err)
+    }
+    dbname = dbConfig.Name
+    psqlInfo := dbConfig.dsn()
+    if err := validateDSN(psqlInfo); err != nil {
+        fatal("error in database configuration", "error", err)
+    }
 
-    var err error
-    db, err = sqltrace.Open("postgres", psqlInfo)
+    // Only trace queries that run under an existing span, so the /healthz
+    // ping does not start root spans of its own.
+    db, err = sqltrace.Open("postgres", psqlInfo, sqltrace.WithChildSpansOnly())
     if err != nil {
-        log.Fatalf("Error opening database: %v\n", err)
+        fatal("error opening database", "error", err)
     }
     defer db.Close()
 
+    // Every replica opens up to DB_MAX_OPEN_CONNS connections, plus one for
+    // adminDB, so replicas * (DB_MAX_OPEN_CONNS + 1) must stay below the
+    // server's max_connections minus superuser_reserved_connections, leaving
+    // headroom for migrations and psql sessions. DB_MAX_IDLE_CONNS above
+    // DB_MAX_OPEN_CONNS is capped by database/sql.
+    maxOpenConns, err := getEnvInt("DB_MAX_OPEN_CONNS", 25)
+    if err != nil || maxOpenConns < 0 {
+        fatal("error reading configuration", "error", "DB_MAX_OPEN_CONNS must be a non-negative integer")
+    }
+    maxIdleConns, err := getEnvInt("DB_MAX_IDLE_CONNS", 5)
+    if err != nil || maxIdleConns < 0 {
+        fatal("error reading configuration", "error", "DB_MAX_IDLE_CONNS must be a non-negative integer")
+    }
+    // Recycling connections periodically also makes session settings such as
+    // statement_timeout follow configuration changes.
+    connMaxLifetimeMinutes, err := getEnvInt("DB_CONN_MAX_LIFETIME_MINUTES", 5)
+    if err != nil || connMaxLifetimeMinutes < 0 {
+        fatal("error reading configuration", "error", "DB_CONN_MAX_LIFETIME_MINUTES must be a non-negative integer")
+    }
+    db.SetMaxOpenConns(maxOpenConns)
+    db.SetMaxIdleConns(maxIdleConns)
+    db.SetConnMaxLifetime(time.Duration(connMaxLifetimeMinutes) * time.Minute)
+
     err = db.Ping()
     if err != nil {
-        log.Fatalf("Error connecting to the database: %v\n", err)
+        fatal("error connecting to the database", "error", err)
     }
 
-    // Create a traced mux router
-    muxRouter := mux.NewRouter()
-    tracedMux := httptrace.NewServeMux()
+    // Replicas get the primary's pool limits, so each one adds up to
+    // DB_MAX_OPEN_CONNS connections per server replica. One that is down at
+    // startup is kept: reads fall back to the primary until it recovers.
+    for i, dsn := range getEnvList("DB_READ_REPLICA_DSN", nil) {
+        if err := validateDSN(dsn); err != nil {
+            fatal("error in read replica configuration", "replica", i, "error", err)
+        }
+        replica, err := sqltrace.Open("postgres", dsn, sqltrace.WithChildSpansOnly())
+        if err != nil {
+            fatal("error opening read replica", "replica", i, "error", err)
+        }
+        defer replica.Close()
+        replica.SetMaxOpenConns(maxOpenConns)
+        replica.SetMaxIdleConns(maxIdleConns)
+        replica.SetConnMaxLifetime(time.Duration(connMaxLifetimeMinutes) * time.Minute)
+        if err := replica.Ping(); err != nil {
+            slog.Warn("read replica is unreachable", "replica", i, "error", err)
+        }
+        readReplicas = append(readReplicas, replica)
+    }
 
-    // Define routes
-    muxRouter.HandleFunc("/items", createItem).Methods("POST")
-    muxRouter.HandleFunc("/items", getItems).Methods("GET")
-    muxRouter.HandleFunc("/items/{id}", getItem).Methods("GET")
-    muxRouter.HandleFunc("/items/{id}", updateItem).Methods("PUT")
-    muxRouter.HandleFunc("/items/{id}", deleteItem).Methods("DELETE")
+    // SKIP_MIGRATIONS=true leaves the schema to an external tool; verifySchema
+    // still checks that it matches what the handlers need.
+    if os.Getenv("SKIP_MIGRATIONS") == "true" {
+        slog.Info("skipping database migrations")
+    } else if err := runMigrations(db); err != nil {
+        fatal("error migrating the database", "error", err)
+    }
 
-    tracedMux.Handle("/", muxRouter)
+    if err := verifySchema(context.Background(), db); err != nil {
+        fatal("error verifying the database schema", "error", err)
+    }
 
-    // CORS setup
-    c := cors.New(cors.Options{
-        AllowedOrigins:   []string{"http://localhost:3000"}, // Update with your frontend URL
-        AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE"},
-        AllowedHeaders:   []string{"Content-Type"},
-        AllowCredentials: true,
-    })
-    handler := c.Handler(tracedMux)
+    fullTextSearchAvailable = probeFullTextIndex(context.Background(), db)
+    trigramAvailable = probeTrigramExtension(context.Background(), db)
+
+    stmts, err := prepareStatements(db)
+    if err != nil {
+        fatal("error preparing statements", "error", err)
+    }
+    defer stmts.Close()
+    flags := NewFeatureFlags(db)
+    if err := flags.Load(context.Background()); err != nil {
+        fatal("error loading feature flags", "error", err)
+    }
+    go flags.Watch(featureFlagRefreshInterval)
+
+    // Optional response field aliasing for legacy clients, e.g.
+    // RESPONSE_FIELD_MAP='{"name":"item_name"}'. Original field names are kept
+    // alongside the aliases until RESPONSE_FIELD_MAP_KEEP_ORIGINAL_UNTIL (RFC 3339).
+    fieldMap, err := ParseFieldMap(os.Getenv("RESPONSE_FIELD_MAP"))
+    if err != nil {
+        fatal("error parsing RESPONSE_FIELD_MAP", "error", err)
+    }
+    var keepOriginalUntil time.Time
+    if raw := os.Getenv("RESPONSE_FIELD_MAP_KEEP_ORIGINAL_UNTIL"); raw != "" {
+        keepOriginalUntil, err = time.Parse(time.RFC3339, raw)
+        if err != nil {
+            fatal("error parsing RESPONSE_FIELD_MAP_KEEP_ORIGINAL_UNTIL", "error", err)
+        }
+    }
+    app := NewApp(timedItemRepository{NewPostgresItemRepository(db, stmts)}, stmts, flags, NewFieldMapper(fieldMap, keepOriginalUntil))
+
+    adminDB, err = sqltrace.Open("postgres", psqlInfo)
+    if err != nil {
+        fatal("error opening admin database", "error", err)
+    }
+    defer adminDB.Close()
+    adminDB.SetMaxOpenConns(1)
+    adminDB.SetMaxIdleConns(1)
+
+    cacheMaxSize, err := getEnvInt("CACHE_MAX_SIZE", 1000)
+    if err != nil || cacheMaxSize <= 0 {
+        fatal("error reading configuration", "error", "CACHE_MAX_SIZE must be a positive integer")
+    }
+    cacheTTLSeconds, err := getEnvInt("CACHE_TTL_SECONDS", 60)
+    if err != nil || cacheTTLSeconds <= 0 {
+        fatal("error reading configuration", "error", "CACHE_TTL_SECONDS must be a positive integer")
+    }
+    itemCache = newItemCache(cacheMaxSize, time.Duration(cacheTTLSeconds)*time.Second)
+    // REDIS_URL, e.g. redis://localhost:6379/0, turns on the GET /items page
+    // cache shared between replicas.
+    redisURL := os.Getenv("REDIS_URL")
+    redisCacheTTLSeconds, err := getEnvInt("REDIS_CACHE_TTL_SECONDS", 30)
+    if err != nil || redisCacheTTLSeconds <= 0 {
+        fatal("error reading configuration", "error", "REDIS_CACHE_TTL_SECONDS must be a positive integer")
+    }
+    listCacheTTL = time.Duration(redisCacheTTLSeconds) * time.Second
+    if redisURL != "" {
+        redisCache, err := NewRedisItemCache(redisURL)
+        if err != nil {
+            fatal("error reading configuration", "error", "REDIS_URL must be a redis:// or rediss:// URL")
+        }
+        defer redisCache.Close()
+        listCache = redisCache
+    }
+    statsCacheTTLSeconds, err := getEnvInt("STATS_CACHE_TTL_SECONDS", 30)
+    if err != nil || statsCacheTTLSeconds < 0 {
+        fatal("error reading configuration", "error", "STATS_CACHE_TTL_SECONDS must be a non-negative integer")
+    }
+    statsCacheTTL = time.Duration(statsCacheTTLSeconds) * time.Second
+    maxStreamClients, err := getEnvInt("SSE_MAX_CLIENTS", 100)
+    if err != nil || maxStreamClients <= 0 {
+        fatal("error reading configuration", "error", "SSE_MAX_CLIENTS must be a positive integer")
+    }
+    sseMaxClients = int64(maxStreamClients)
+
+    if s3Bucket = os.Getenv("S3_BUCKET"); s3Bucket != "" {
+        s3Client, err = newS3Client(context.Background())
+        if err != nil {
+            fatal("error configuring S3 client", "error", err)
+        }
+    }
+
+    trustedProxies, err = parseCIDRs(os.Getenv("TRUSTED_PROXY_CIDRS"))
+    if err != nil {
+        fatal("error reading configuration", "variable", "TRUSTED_PROXY_CIDRS", "error", err)
+    }
+
+    adminAllowedCIDRs, err := parseCIDRs(os.Getenv("ADMIN_ALLOWED_CIDRS"))
+    if err != nil {
+        fatal("error reading configuration", "variable", "ADMIN_ALLOWED_CIDRS", "error", err)
+    }
+    if len(adminAllowedCIDRs) == 0 {
+        slog.Warn("ADMIN_ALLOWED_CIDRS is empty; /admin endpoints are reachable from any IP")
+    }
+
+    // Create a traced router. It answers /items/ and /items/{id}/ with a 301
+    // to the canonical path instead of a 404.
+    muxRouter := newRouter()
+    tracedMux := httptrace.NewServeMux(
+        httptrace.WithResourceNamer(routeResourceNamer(muxRouter.mux)),
+        httptrace.WithIgnoreRequest(ignoreUntracedPaths),
+    )
+
+    // Middleware applies to the routes registered after it.
+    muxRouter.Use(metricsMiddleware)
+    // SLOW_REQUEST_THRESHOLD_MS=0 turns slow-request logging off.
+    slowRequestThresholdMS, err := getEnvInt("SLOW_REQUEST_THRESHOLD_MS", 500)
+    if err != nil || slowRequestThresholdMS < 0 {
+        fatal("error reading configuration", "error", "SLOW_REQUEST_THRESHOLD_MS must be a non-negative integer")
+    }
+    if slowRequestThresholdMS > 0 {
+        muxRouter.Use(slowRequestMiddleware(time.Duration(slowRequestThresholdMS) * time.Millisecond))
+    }
+    muxRouter.Use(timeoutMiddleware(time.Duration(requestTimeoutSeconds) * time.Second))
+    if rateLimitRPS > 0 {
+        muxRouter.Use(rateLimitMiddleware(rateLimitRPS, rateLimitBurst))
+    }
+    muxRouter.Use(bodySizeMiddleware)
+    muxRouter.Use(maxBytesMiddleware(int64(maxRequestBodyBytes)))
+    muxRouter.Use(apiKeyMiddleware)
+    muxRouter.Use(jwtMiddleware)
+    muxRouter.Use(tenantMiddleware)
+
+    // Once a successor API is live, ITEMS_DEPRECATED_AT and ITEMS_SUNSET_DATE
+    // (YYYY-MM-DD) and ITEMS_SUCCESSOR_LINK announce the retirement of the
+    // /items routes.
+    if sunset := os.Getenv("ITEMS_SUNSET_DATE"); sunset != "" {
+        sunsetDate, err := time.Parse("2006-01-02", sunset)
+        if err != nil {
+            fatal("error reading configuration", "error", "ITEMS_SUNSET_DATE must be a date like 2025-06-30")
+        }
+        deprecatedAt, err := time.Parse("2006-01-02", os.Getenv("ITEMS_DEPRECATED_AT"))
+        if err != nil {
+            fatal("error reading configuration", "error", "ITEMS_DEPRECATED_AT must be a date like 2025-01-31 with ITEMS_SUNSET_DATE")
+        }
+        if !deprecatedAt.Before(sunsetDate) {
+            fatal("error reading configuration", "error", "ITEMS_DEPRECATED_AT must be before ITEMS_SUNSET_DATE")
+        }
+        link := os.Getenv("ITEMS_SUCCESSOR_LINK")
+        if link == "" {
+            fatal("error reading configuration", "error", "ITEMS_SUCCESSOR_LINK is required with ITEMS_SUNSET_DATE")
+        }
+        muxRouter.Use(pathPrefixMiddleware("/items", deprecationMiddleware(deprecatedAt, sunsetDate, link)))
+    }
+    muxRouter.Use(serverTimingMiddleware)
+
+    registerRoutes(muxRouter, app, adminAllowedCIDRs)
+
+    // GZIP_LEVEL takes a compress/gzip level: -1 (default), -2 (Huffman only)
+    // or 0-9.
+    gzipLevel, err := getEnvInt("GZIP_LEVEL", gzip.DefaultCompression)
+    if err != nil || gzipLevel < gzip.HuffmanOnly || gzipLevel > gzip.BestCompression {
+        fatal("error reading configuration", "error", "GZIP_LEVEL must be an integer between -2 and 9")
+    }
+
+    tracedMux.Handle("/", gzipMiddleware(gzipLevel)(app.fields.Middleware(muxRouter)))
+
+    // CORS setup.
+    corsAllowedOrigins, err := parseCORSOrigins(getEnvList("CORS_ALLOWED_ORIGINS", nil), appEnv)
+    if err != nil {
+        fatal("error reading configuration", "error", err)
+    }
+    corsAllowedMethods := getEnvList("CORS_ALLOWED_METHODS", []string{"GET", "POST", "PUT", "PATCH", "DELETE"})
+    corsAllowCredentials, err := getEnvBool("CORS_ALLOW_CREDENTIALS", true)
+    if err != nil {
+        fatal("error reading configuration", "error", err)
+    }
+    c := newCORS(corsAllowedOrigins, corsAllowedMethods, corsAllowCredentials)
+    handler := requestIDMiddleware(accessLogMiddleware(c.Handler(tracedMux)))
+
+    tlsSettings, err := loadTLSSettings()
+    if err != nil {
+        fatal("error reading configuration", "error", err)
+    }
+    server := &http.Server{
+        Addr:    getEnv("LISTEN_ADDR", tlsSettings.defaultListenAddr()),
+        Handler: handler,
+    }
+    challengeServer := configureTLS(server, tlsSettings)
+    serveErr := make(chan error, 3)
+
+    // GRPC_PORT=0 turns the gRPC API off.
+    grpcPort, err := getEnvInt("GRPC_PORT", 9000)
+    if err != nil || grpcPort < 0 || grpcPort > 65535 {
+        fatal("error reading configuration", "error", "GRPC_PORT must be a port number")
+    }
+    var grpcServer *grpc.Server
+    var grpcListener net.Listener
+    if grpcPort > 0 {
+        grpcListener, err = net.Listen("tcp", ":"+strconv.Itoa(grpcPort))
+        if err != nil {
+            fatal("error starting gRPC listener", "error", err)
+        }
+        grpcServer = newGRPCServer(app)
+    }
+
+    purgeRetentionDays, err := getEnvInt("PURGE_RETENTION_DAYS", 90)
+    if err != nil || purgeRetentionDays <= 0 {
+        fatal("error reading configuration", "error", "PURGE_RETENTION_DAYS must be a positive integer")
+    }
+    purgeIntervalHours, err := getEnvInt("PURGE_INTERVAL_HOURS", 24)
+    if err != nil || purgeIntervalHours <= 0 {
+        fatal("error reading configuration", "error", "PURGE_INTERVAL_HOURS must be a positive integer")
+    }
+    lowStockThreshold, err = getEnvInt("LOW_STOCK_THRESHOLD", 10)
+    if err != nil || lowStockThreshold < 0 {
+        fatal("error reading configuration", "error", "LOW_STOCK_THRESHOLD must be a non-negative integer")
+    }
+    // Unless LOW_STOCK_ALERT_HOUR is set, no low-stock alerts are sent.
+    lowStockAlertHour, err := getEnvInt("LOW_STOCK_ALERT_HOUR", -1)
+    if err != nil || lowStockAlertHour < -1 || lowStockAlertHour > 23 {
+        fatal("error reading configuration", "error", "LOW_STOCK_ALERT_HOUR must be an hour between 0 and 23")
+    }
+    // PRICE_HISTOGRAM_REFRESH_HOUR=-1 leaves the view as the last refresh,
+    // or the migration, left it.
+    priceHistogramRefreshHour, err := getEnvInt("PRICE_HISTOGRAM_REFRESH_HOUR", 3)
+    if err != nil || priceHistogramRefreshHour < -1 || priceHistogramRefreshHour > 23 {
+        fatal("error reading configuration", "error", "PRICE_HISTOGRAM_REFRESH_HOUR must be an hour between 0 and 23, or -1")
+    }
+
+    slog.Info("resolved configuration",
+        "app_env", appEnv,
+        "log_level", logLevel.String(),
+        "listen_addr", server.Addr,
+        "tls_mode", tlsSettings.Mode,
+        "tls_domain", tlsSettings.Domain,
+        "db_host", dbConfig.Host,
+        "db_port", dbConfig.Port,
+        "db_user", dbConfig.User,
+        "db_name", dbname,
+        "db_password", "********",
+        "db_statement_timeout_ms", dbConfig.StatementTimeoutMS,
+        "db_max_open_conns", maxOpenConns,
+        "db_max_idle_conns", maxIdleConns,
+        "db_conn_max_lifetime_minutes", connMaxLifetimeMinutes,
+        "db_read_replicas", len(readReplicas),
+        "shutdown_timeout", shutdownTimeout.String(),
+        "max_request_body_bytes", maxRequestBodyBytes,
+        "request_timeout_seconds", requestTimeoutSeconds,
+        "slow_request_threshold_ms", slowRequestThresholdMS,
+        "rate_limit_rps", rateLimitRPS,
+        "rate_limit_burst", rateLimitBurst,
+        "gzip_level", gzipLevel,
+        "cors_allowed_origins", corsAllowedOrigins,
+        "cors_allowed_methods", corsAllowedMethods,
+        "cors_allow_credentials", corsAllowCredentials,
+        "cache_max_size", cacheMaxSize,
+        "cache_ttl_seconds", cacheTTLSeconds,
+        "stats_cache_ttl_seconds", statsCacheTTLSeconds,
+        "redis_cache", redisURL != "",
+        "redis_cache_ttl_seconds", redisCacheTTLSeconds,
+        "sse_max_clients", maxStreamClients,
+        "min_item_price", minItemPrice,
+        "max_item_price", maxItemPrice,
+        "immutable_fields", immutableFields,
+        "default_sort", defaultItemSort,
+        "s3_bucket", s3Bucket,
+        "full_text_search", fullTextSearchAvailable,
+        "trigram_search", trigramAvailable,
+        "purge_retention_days", purgeRetentionDays,
+        "purge_interval_hours", purgeIntervalHours,
+        "low_stock_threshold", lowStockThreshold,
+        "low_stock_alert_hour", lowStockAlertHour,
+        "price_histogram_refresh_hour", priceHistogramRefreshHour,
+        "grpc_port", grpcPort,
+    )
+    stopPurgeWorker := startPurgeWorker(db, time.Duration(purgeRetentionDays)*24*time.Hour, time.Duration(purgeIntervalHours)*time.Hour)
+    stopReservationSweeper := startReservationSweeper(db, reservationSweepInterval)
+    stopLowStockAlerter := func() {}
+    if lowStockAlertHour >= 0 {
+        stopLowStockAlerter = startLowStockAlerter(db, lowStockAlertHour)
+    }
+    stopPriceHistogramRefresher := func() {}
+    if priceHistogramRefreshHour >= 0 {
+        stopPriceHistogramRefresher = startPriceHistogramRefresher(db, priceHistogramRefreshHour)
+    }
+    go func() {
+        slog.Info("server started", "addr", server.Addr, "tls_mode", tlsSettings.Mode)
+        serveErr <- serve(server, tlsSettings)
+    }()
+    if grpcServer != nil {
+        go func() {
+            slog.Info("gRPC server started", "addr", grpcListener.Addr().String())
+            serveErr <- grpcServer.Serve(grpcListener)
+        }()
+    }
+    if challengeServer != nil {
+        go func() {
+            slog.Info("ACME challenge server started", "addr", challengeServer.Addr)
+            serveErr <- challengeServer.ListenAndServe()
+        }()
+    }
 
-    log.Println("Server started on :8000")
-    log.Fatal(http.ListenAndServe(":8000", handler))
+    // On SIGTERM or SIGINT stop accepting connections and let in-flight
+    // requests finish. Returning from main then runs the deferred closes, so
+    // the database pools outlive every request that uses them.
+    signals := make(chan os.Signal, 1)
+    signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+    select {
+    case err := <-serveErr:
+        fatal("server failed", "error", err)
+    case sig := <-signals:
+        slog.Info("shutting down", "signal", sig.String(), "timeout", shutdownTimeout.String())
+    }
+
+    shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+    defer cancel()
+    if err := server.Shutdown(shutdownCtx); err != nil {
+        slog.Error("graceful shutdown did not complete", "error", err)
+        server.Close()
+    }
+    if challengeServer != nil {
+        challengeServer.Shutdown(shutdownCtx)
+    }
+    if grpcServer != nil {
+        stopGRPCServer(shutdownCtx, grpcServer)
+    }
+    stopPurgeWorker()
+    stopReservationSweeper()
+    stopLowStockAlerter()
+    stopPriceHistogramRefresher()
+    slog.Info("server stopped")
+}
+
+// registerRoutes adds every HTTP route of the server to muxRouter, inside the
+// middleware already added to it. The /admin routes are also limited to
+// adminAllowedCIDRs, where an empty list allows every IP, and to bearer tokens
+// with the admin role.
+func registerRoutes(muxRouter *router, app *App, adminAllowedCIDRs []*net.IPNet) {
+    muxRouter.Handle("POST /items", validateBody(itemCreateSchema)(AppHandler(app.createItem)))
+    muxRouter.Handle("GET /items", AppHandler(app.getItems))
+    muxRouter.HandleFunc("DELETE /items", deleteItemsBulk)
+    muxRouter.Handle("POST /items/bulk", AppHandler(app.createItemsBulk))
+    muxRouter.HandleFunc("GET /items/compare", compareItems)
+    muxRouter.HandleFunc("GET /items/count", getItemCounts)
+    muxRouter.HandleFunc("GET /items/deleted", getDeletedItems)
+    muxRouter.Handle("GET /items/low-stock", AppHandler(getLowStockItems))
+    muxRouter.Handle("GET /items/export", AppHandler(app.exportItemsNDJSON))
+    muxRouter.HandleFunc("POST /items/import", app.importItemsCSV)
+    muxRouter.HandleFunc("GET /items/stats", getItemStats)
+    muxRouter.Handle("GET /analytics/price-histogram", AppHandler(getPriceHistogram))
+    muxRouter.HandleFunc("GET /items/stream", streamItems)
+    muxRouter.Handle("GET /items/{id}", AppHandler(app.getItem))
+    muxRouter.Handle("PUT /items/{id}", validateBody(itemUpdateSchema)(returnBodyMiddleware(app.fetchItemFromRequest)(AppHandler(app.updateItem))))
+    muxRouter.Handle("PATCH /items/{id}", AppHandler(app.patchItem))
+    muxRouter.Handle("DELETE /items/{id}", AppHandler(app.deleteItem))
+    muxRouter.HandleFunc("GET /items/{id}/audit", getItemAudit)
+    muxRouter.Handle("GET /items/{id}/diff/{audit_id_a}/{audit_id_b}", AppHandler(diffItemVersions))
+    muxRouter.HandleFunc("GET /items/{id}/price-history", getPriceHistory)
+    muxRouter.HandleFunc("GET /items/{id}/price-stream", app.streamItemPrice)
+    muxRouter.HandleFunc("POST /items/{id}/find-duplicates", app.findDuplicates)
+    muxRouter.Handle("POST /items/{id}/restore", AppHandler(app.restoreItem))
+    muxRouter.Handle("PUT /items/{id}/restore", AppHandler(app.revertItem))
+    muxRouter.Handle("GET /items/{id}/related", AppHandler(app.getRelatedItems))
+    muxRouter.Handle("POST /items/{id}/duplicate", AppHandler(app.duplicateItem))
+    muxRouter.Handle("POST /items/{id}/reserve", AppHandler(app.reserveItem))
+    muxRouter.Handle("DELETE /items/{id}/reserve", AppHandler(app.releaseItem))
+    muxRouter.Handle("POST /items/{id}/stock", AppHandler(app.adjustStock))
+    muxRouter.Handle("PATCH /items/{id}/stock/reserve-release", AppHandler(app.reserveReleaseStock))
+    muxRouter.Handle("GET /items/{id}/stock-history", AppHandler(getStockHistory))
+    muxRouter.Handle("POST /items/{id}/notify-me", AppHandler(createRestockAlert))
+    muxRouter.Handle("DELETE /items/{id}/notify-me", AppHandler(deleteRestockAlert))
+    muxRouter.Handle("POST /items/{id}/flag-price-error", AppHandler(flagPriceError))
+    muxRouter.Handle("POST /items/{id}/generate-sku", AppHandler(app.generateSKU))
+    muxRouter.HandleFunc("PUT /items/{id}/image", app.uploadItemImage)
+    muxRouter.HandleFunc("OPTIONS /items", optionsHandler("GET, POST, DELETE, OPTIONS"))
+    muxRouter.HandleFunc("OPTIONS /items/{id}", optionsHandler("GET, PUT, PATCH, DELETE, OPTIONS"))
+    muxRouter.HandleFunc("OPTIONS /items/import", optionsHandler("POST, OPTIONS"))
+    muxRouter.HandleFunc("OPTIONS /items/{id}/image", optionsHandler("PUT, OPTIONS"))
+    muxRouter.HandleFunc("POST /categories", createCategory)
+    muxRouter.HandleFunc("GET /categories", getCategories)
+    muxRouter.Handle("GET /categories/tree", AppHandler(getCategoryTree))
+    muxRouter.Handle("GET /categories/{id}/ancestors", AppHandler(getCategoryAncestors))
+    muxRouter.Handle("DELETE /categories/{id}", requireAdminRole(AppHandler(deleteCategory)))
+    muxRouter.Handle("POST /api-keys", requireAdminRole(http.HandlerFunc(createAPIKey)))
+    muxRouter.HandleFunc("POST /webhooks", createWebhook)
+    muxRouter.HandleFunc("DELETE /webhooks/{id}", deleteWebhook)
+    muxRouter.Handle("GET /metrics", promhttp.Handler())
+    muxRouter.HandleFunc("GET /healthz", healthz)
+    muxRouter.HandleFunc("GET /openapi.yaml", getOpenAPISpec)
+    muxRouter.HandleFunc("GET /docs", getDocs)
+
+    adminRouter := muxRouter.With(adminIPWhitelistMiddleware(adminAllowedCIDRs)).With(requireAdminRole)
+    adminRouter.HandleFunc("POST /admin/import-from-url", importFromURL)
+    adminRouter.Handle("GET /admin/audit-log", AppHandler(getAuditLog))
+    adminRouter.Handle("POST /admin/items/price-adjust", AppHandler(app.adjustPrices))
+    adminRouter.Handle("GET /admin/price-errors", AppHandler(listPriceErrors))
+    adminRouter.Handle("PUT /admin/price-errors/{id}", AppHandler(app.resolvePriceError))
+    adminRouter.HandleFunc("GET /admin/connections", getConnections)
+    adminRouter.HandleFunc("DELETE /admin/connections/{pid}", cancelConnection)
+    adminRouter.HandleFunc("GET /admin/db/stats", getDBStats)
+    adminRouter.HandleFunc("POST /admin/analyze-query", analyzeQuery)
+    adminRouter.HandleFunc("POST /admin/backup", backupItems)
+    adminRouter.Handle("GET /admin/flags", AppHandler(app.flags.listFlags))
+    adminRouter.Handle("PUT /admin/flags/{name}", AppHandler(app.flags.updateFlag))
 }
 
 func traceHTTPHandler(fn http.HandlerFunc) http.HandlerFunc {
@@ -96,132 +677,815 @@ func traceHTTPHandler(fn http.HandlerFunc) http.HandlerFunc {
     }
 }
 
-func createItem(w http.ResponseWriter, r *http.Request) {
+// optionsHandler answers OPTIONS requests with the methods a resource supports.
+func optionsHandler(allow string) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Allow", allow)
+        w.WriteHeader(http.StatusNoContent)
+    }
+}
+
+func (app *App) createItem(w http.ResponseWriter, r *http.Request) error {
     ctx := r.Context()
     span, _ := tracer.StartSpanFromContext(ctx, "createItem", tracer.ResourceName("INSERT INTO items"))
     defer span.Finish()
 
+    // A retried request carrying the same Idempotency-Key gets the original
+    // response instead of creating the item again.
+    key, err := idempotencyKey(r)
+    if err != nil {
+        return &ValidationError{Code: "INVALID_IDEMPOTENCY_KEY", Message: err.Error()}
+    }
+    upsert, err := upsertKey(r)
+    if err != nil {
+        return &ValidationError{Code: "INVALID_UPSERT_KEY", Message: err.Error()}
+    }
+    if upsert && key != "" {
+        return &ValidationError{Code: "INVALID_UPSERT_KEY", Message: "X-Upsert-Key cannot be combined with Idempotency-Key"}
+    }
+    if key != "" {
+        replayed, err := replayIdempotentResponse(ctx, w, tenantFromContext(ctx), key)
+        if err != nil {
+            return err
+        }
+        if replayed {
+            return nil
+        }
+    }
+
     var item Item
-    err := json.NewDecoder(r.Body).Decode(&item)
+    if isXMLContentType(r.Header.Get("Content-Type")) {
+        err = xml.NewDecoder(r.Body).Decode(&item)
+        if err != nil {
+            return bodyError(err, "Request body is not valid XML")
+        }
+    } else {
+        err = json.NewDecoder(r.Body).Decode(&item)
+        if err != nil {
+            return bodyError(err, "Request body is not valid JSON")
+        }
+    }
+    item.Categories = nil
+    item.SKU = ""
+
+    if err := validateItem(ctx, item); err != nil {
+        return err
+    }
+
+    if upsert {
+        return app.upsertItem(w, r, item)
+    }
+
+    item, err = app.items.Create(ctx, tenantFromContext(ctx), item, key)
     if err != nil {
-        http.Error(w, err.Error(), http.StatusBadRequest)
-        return
+        return err
     }
+    notifyItemChange(ctx, eventItemCreated, item)
+
+    writeJSON(w, http.StatusOK, item)
+    return nil
+}
+
+// upsertKey reports whether X-Upsert-Key asks to match items on name.
+func upsertKey(r *http.Request) (bool, error) {
+    switch key := r.Header.Get(upsertKeyHeader); key {
+    case "":
+        return false, nil
+    case "name":
+        return true, nil
+    default:
+        return false, fmt.Errorf("X-Upsert-Key %q is not an upsertable column; only name is", key)
+    }
+}
 
-    sqlStatement := `INSERT INTO items (name, description, price) VALUES ($1, $2, $3) RETURNING id`
-    err = db.QueryRowContext(ctx, sqlStatement, item.Name, item.Description, item.Price).Scan(&item.ID)
+// upsertItem creates item, answering 201 with its Location, or replaces the
+// live item with the same name, answering 200.
+func (app *App) upsertItem(w http.ResponseWriter, r *http.Request, item Item) error {
+    ctx := r.Context()
+    old, item, inserted, err := app.items.Upsert(ctx, tenantFromContext(ctx), item)
     if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
-        return
+        return err
+    }
+    if inserted {
+        notifyItemChange(ctx, eventItemCreated, item)
+        w.Header().Set("Location", fmt.Sprintf("/items/%d", item.ID))
+        writeJSON(w, http.StatusCreated, item)
+        return nil
     }
 
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(item)
+    evictItem(item.ID)
+    if old.Price != item.Price {
+        priceChanges.Publish(priceChange{ItemID: item.ID, Old: old.Price, New: item.Price})
+    }
+    notifyItemChange(ctx, eventItemUpdated, item)
+    writeJSON(w, http.StatusOK, item)
+    return nil
+}
+
+const maxBulkItems = 100
+
+// bulkItemError reports why one element of a bulk create was rejected.
+type bulkItemError struct {
+    Index   int    `json:"index"`
+    Message string `json:"message"`
+}
+
+// createItemsBulk creates up to maxBulkItems items through the repository in
+// one transaction. Every item is validated before the database is touched, so
+// either all items are created or none are.
+func (app *App) createItemsBulk(w http.ResponseWriter, r *http.Request) error {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "createItemsBulk", tracer.ResourceName("INSERT INTO items"))
+    defer span.Finish()
+
+    var items []Item
+    err := json.NewDecoder(r.Body).Decode(&items)
+    if err != nil {
+        return bodyError(err, "Request body must be a JSON array of items")
+    }
+    if len(items) == 0 {
+        return &ValidationError{Code: "INVALID_BODY", Message: "At least one item is required"}
+    }
+    if len(items) > maxBulkItems {
+        return &ValidationError{Code: "TOO_MANY_ITEMS", Message: fmt.Sprintf("At most %d items can be created at once", maxBulkItems)}
+    }
+
+    var invalid []bulkItemError
+    for i, item := range items {
+        items[i].Categories = nil
+        // A SKU is only assigned by POST /items/{id}/generate-sku. Refusing
+        // one here beats creating the item without it.
+        if item.SKU != "" {
+            invalid = append(invalid, bulkItemError{Index: i, Message: "sku cannot be set on create; use POST /items/{id}/generate-sku"})
+            continue
+        }
+        if err := validateItem(ctx, item); err != nil {
+            invalid = append(invalid, bulkItemError{Index: i, Message: err.Error()})
+        }
+    }
+    if len(invalid) > 0 {
+        return &ValidationError{Code: "VALIDATION_FAILED", Message: "Some items are invalid; none were created", Details: invalid}
+    }
+
+    items, err = app.items.CreateMany(ctx, tenantFromContext(ctx), items)
+    var failed *itemCreateError
+    if errors.As(err, &failed) && errors.Is(failed.Err, errDuplicateName) {
+        return &ConflictError{Code: "DUPLICATE_NAME", Message: "an item with this name already exists; none were created",
+            Details: []bulkItemError{{Index: failed.Index, Message: failed.Err.Error()}}}
+    }
+    if err != nil {
+        return err
+    }
+    for _, item := range items {
+        notifyItemChange(ctx, eventItemCreated, item)
+    }
+
+    writeJSON(w, http.StatusOK, items)
+    return nil
+}
+
+const (
+    defaultPageLimit = 20
+    maxPageLimit     = 500
+)
+
+// itemPage is the paginated response envelope of GET /items. In XML it is an
+// <items> element with the paging figures as attributes.
+type itemPage struct {
+    XMLName xml.Name `json:"-" xml:"items"`
+    Items   []Item   `json:"items" xml:"item"`
+    Total   int      `json:"total" xml:"total,attr"`
+    Limit   int      `json:"limit" xml:"limit,attr"`
+    Offset  int      `json:"offset" xml:"offset,attr"`
 }
 
-func getItems(w http.ResponseWriter, r *http.Request) {
+func (app *App) getItems(w http.ResponseWriter, r *http.Request) error {
     ctx := r.Context()
     span, _ := tracer.StartSpanFromContext(ctx, "getItems", tracer.ResourceName("SELECT id, name, description, price FROM items"))
     defer span.Finish()
 
-    rows, err := db.QueryContext(ctx, "SELECT id, name, description, price FROM items")
+    filters, err := parseItemFilters(r)
     if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return &ValidationError{Code: "INVALID_QUERY", Message: err.Error()}
+    }
+    filters.FullText = fullTextSearchAvailable
+
+    switch r.URL.Query().Get("format") {
+    case "", "json":
+    case "csv":
+        if filters.Keyset {
+            return &ValidationError{Code: "INVALID_QUERY", Message: "after cannot be combined with format=csv"}
+        }
+        getItemsCSV(w, r, filters)
+        return nil
+    default:
+        return &ValidationError{Code: "INVALID_QUERY", Message: `format must be "json" or "csv"`}
+    }
+
+    if filters.Keyset {
+        return app.getItemsAfter(w, r, filters)
+    }
+
+    tenantID := tenantFromContext(ctx)
+    page, ok := cachedItemPage(tenantID, filters)
+    if !ok {
+        cacheFilters := filters
+        page, err = app.items.GetAll(ctx, tenantID, filters)
+        if err != nil && filters.Q != "" && filters.FullText && isFullTextUnavailable(err) {
+            requestLogger(ctx).Warn("full-text search failed, falling back to ILIKE", "error", err)
+            filters.FullText = false
+            page, err = app.items.GetAll(ctx, tenantID, filters)
+        }
+        if err != nil {
+            return err
+        }
+        storeItemPage(tenantID, cacheFilters, page)
+    }
+
+    if negotiateFormat(r) == "xml" {
+        writeXML(w, http.StatusOK, page)
+        return nil
+    }
+    if wantsEnvelope(w, r) {
+        writeJSON(w, http.StatusOK, envelope{
+            Data: page.Items,
+            Meta: pageMeta{Total: page.Total, Limit: page.Limit, Offset: page.Offset},
+        })
+        return nil
+    }
+    writeJSON(w, http.StatusOK, page)
+    return nil
+}
+
+// getItemsAfter serves a keyset page of GET /items.
+func (app *App) getItemsAfter(w http.ResponseWriter, r *http.Request, filters ItemFilters) error {
+    ctx := r.Context()
+    page, err := app.items.GetAfter(ctx, tenantFromContext(ctx), filters)
+    if err != nil && filters.Q != "" && filters.FullText && isFullTextUnavailable(err) {
+        requestLogger(ctx).Warn("full-text search failed, falling back to ILIKE", "error", err)
+        filters.FullText = false
+        page, err = app.items.GetAfter(ctx, tenantFromContext(ctx), filters)
+    }
+    if err != nil {
+        return err
+    }
+
+    if negotiateFormat(r) == "xml" {
+        writeXML(w, http.StatusOK, page)
+        return nil
+    }
+    if wantsEnvelope(w, r) {
+        writeJSON(w, http.StatusOK, envelope{
+            Data: page.Items,
+            Meta: cursorMeta{Limit: page.Limit, NextCursor: page.NextCursor, HasMore: page.HasMore},
+        })
+        return nil
+    }
+    writeJSON(w, http.StatusOK, page)
+    return nil
+}
+
+// parsePagination reads ?limit= and ?offset=. A missing or zero limit means
+// defaultPageLimit.
+func parsePagination(r *http.Request) (limit, offset int, err error) {
+    query := r.URL.Query()
+    limit = defaultPageLimit
+    if raw := query.Get("limit"); raw != "" {
+        limit, err = strconv.Atoi(raw)
+        if err != nil || limit < 0 {
+            return 0, 0, fmt.Errorf("limit must be a non-negative integer")
+        }
+        if limit == 0 {
+            limit = defaultPageLimit
+        }
+        if limit > maxPageLimit {
+            return 0, 0, fmt.Errorf("limit must not exceed %d", maxPageLimit)
+        }
+    }
+    if raw := query.Get("offset"); raw != "" {
+        offset, err = strconv.Atoi(raw)
+        if err != nil || offset < 0 {
+            return 0, 0, fmt.Errorf("offset must be a non-negative integer")
+        }
+    }
+    return limit, offset, nil
+}
+
+// deletedItem is a soft-deleted item together with its deletion time.
+type deletedItem struct {
+    Item
+    DeletedAt time.Time `json:"deleted_at"`
+}
+
+// getDeletedItems lists the tenant's soft-deleted items, most recently
+// deleted first.
+func getDeletedItems(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "getDeletedItems", tracer.ResourceName("SELECT id, name, description, price, deleted_at FROM items WHERE deleted_at IS NOT NULL"))
+    defer span.Finish()
+
+    limit, offset, err := parsePagination(r)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, "INVALID_PAGINATION", err.Error())
+        return
+    }
+
+    sqlStatement := `SELECT id, name, description, price, deleted_at FROM items
+        WHERE tenant_id = $1 AND deleted_at IS NOT NULL ORDER BY deleted_at DESC, id LIMIT $2 OFFSET $3`
+    rows, err := queryRead(r, sqlStatement, tenantFromContext(ctx), limit, offset)
+    if err != nil {
+        writeInternalError(w, r, err)
         return
     }
     defer rows.Close()
 
-    items := []Item{}
+    items := []deletedItem{}
     for rows.Next() {
-        var item Item
-        err := rows.Scan(&item.ID, &item.Name, &item.Description, &item.Price)
+        var item deletedItem
+        err := rows.Scan(&item.ID, &item.Name, &item.Description, &item.Price, &item.DeletedAt)
         if err != nil {
-            http.Error(w, err.Error(), http.StatusInternalServerError)
+            writeInternalError(w, r, err)
             return
         }
         items = append(items, item)
     }
+    if err := rows.Err(); err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
 
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(items)
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "items":  items,
+        "limit":  limit,
+        "offset": offset,
+    })
 }
 
-func getItem(w http.ResponseWriter, r *http.Request) {
+func (app *App) getItem(w http.ResponseWriter, r *http.Request) error {
     ctx := r.Context()
     span, _ := tracer.StartSpanFromContext(ctx, "getItem", tracer.ResourceName("SELECT id, name, description, price FROM items WHERE id = $1"))
     defer span.Finish()
 
-    params := mux.Vars(r)
-    id, err := strconv.Atoi(params["id"])
+    id, err := parseItemID(r.PathValue("id"))
     if err != nil {
-        http.Error(w, "Invalid item ID", http.StatusBadRequest)
-        return
+        return &ValidationError{Code: "INVALID_ID", Message: "Invalid item ID"}
+    }
+
+    tenantID := tenantFromContext(ctx)
+    if item, ok := cachedItem(tenantID, id); ok {
+        writeItem(w, r, item)
+        return nil
+    }
+
+    item, err := app.items.GetByID(ctx, tenantID, id)
+    if err == sql.ErrNoRows {
+        return &NotFoundError{Resource: "Item"}
+    }
+    if err != nil {
+        return err
+    }
+    cacheItem(tenantID, item)
+    writeItem(w, r, item)
+    return nil
+}
+
+func (app *App) updateItem(w http.ResponseWriter, r *http.Request) error {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "updateItem", tracer.ResourceName("UPDATE items"))
+    defer span.Finish()
+
+    id, err := parseItemID(r.PathValue("id"))
+    if err != nil {
+        return &ValidationError{Code: "INVALID_ID", Message: "Invalid item ID"}
+    }
+
+    body, err := io.ReadAll(r.Body)
+    if err != nil {
+        return bodyError(err, "Could not read request body")
+    }
+    var fields map[string]interface{}
+    err = json.Unmarshal(body, &fields)
+    if err != nil {
+        return &ValidationError{Code: "INVALID_BODY", Message: "Request body is not valid JSON"}
+    }
+    if err := validatePatchFields(fields, immutableFields); err != nil {
+        return err
     }
 
     var item Item
-    sqlStatement := `SELECT id, name, description, price FROM items WHERE id = $1`
-    err = db.QueryRowContext(ctx, sqlStatement, id).Scan(&item.ID, &item.Name, &item.Description, &item.Price)
+    err = json.Unmarshal(body, &item)
     if err != nil {
-        if err == sql.ErrNoRows {
-            http.Error(w, "Item not found", http.StatusNotFound)
-            return
-        }
-        http.Error(w, err.Error(), http.StatusInternalServerError)
-        return
+        return &ValidationError{Code: "INVALID_BODY", Message: "Request body does not match the item schema"}
+    }
+
+    if err := validateItem(ctx, item); err != nil {
+        return err
+    }
+
+    // Updating a missing item stays a no-op.
+    tenantID := tenantFromContext(ctx)
+    old, item, err := app.items.Update(ctx, tenantID, id, item)
+    if err == sql.ErrNoRows {
+        w.WriteHeader(http.StatusNoContent)
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    evictItem(id)
+    if old.Price != item.Price {
+        priceChanges.Publish(priceChange{ItemID: id, Old: old.Price, New: item.Price})
+    }
+    if fresh, err := app.items.GetByID(ctx, tenantID, id); err == nil {
+        item = fresh
+        w.Header().Set("ETag", itemETag(fresh))
     }
+    notifyItemChange(ctx, eventItemUpdated, item)
 
+    w.Header().Set(itemVersionHeader, strconv.Itoa(item.Version))
     w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(item)
+    w.WriteHeader(http.StatusNoContent)
+    return nil
+}
+
+// itemPatch holds the fields of a PATCH /items/{id} body. Nil fields were not
+// supplied and are left untouched.
+type itemPatch struct {
+    Name        *string  `json:"name"`
+    Description *string  `json:"description"`
+    Price       *float64 `json:"price"`
+    // Metadata, when supplied, replaces the stored metadata as a whole.
+    Metadata *Metadata `json:"metadata"`
+    // Version, when supplied, must match the stored version.
+    Version *int `json:"version"`
 }
 
-func updateItem(w http.ResponseWriter, r *http.Request) {
+func (app *App) patchItem(w http.ResponseWriter, r *http.Request) error {
     ctx := r.Context()
-    span, _ := tracer.StartSpanFromContext(ctx, "updateItem", tracer.ResourceName("UPDATE items"))
+    span, _ := tracer.StartSpanFromContext(ctx, "patchItem", tracer.ResourceName("UPDATE items"))
     defer span.Finish()
 
-    params := mux.Vars(r)
-    id, err := strconv.Atoi(params["id"])
+    id, err := parseItemID(r.PathValue("id"))
     if err != nil {
-        http.Error(w, "Invalid item ID", http.StatusBadRequest)
-        return
+        return &ValidationError{Code: "INVALID_ID", Message: "Invalid item ID"}
+    }
+
+    body, err := io.ReadAll(r.Body)
+    if err != nil {
+        return bodyError(err, "Could not read request body")
+    }
+    var fields map[string]interface{}
+    err = json.Unmarshal(body, &fields)
+    if err != nil {
+        return &ValidationError{Code: "INVALID_BODY", Message: "Request body is not valid JSON"}
+    }
+    if err := validatePatchFields(fields, immutableFields); err != nil {
+        return err
+    }
+
+    var patch itemPatch
+    err = json.Unmarshal(body, &patch)
+    if err != nil {
+        return &ValidationError{Code: "INVALID_BODY", Message: "Request body does not match the item schema"}
     }
 
+    var set []string
+    var args []interface{}
+    if patch.Name != nil {
+        args = append(args, *patch.Name)
+        set = append(set, fmt.Sprintf("name = $%d", len(args)))
+    }
+    if patch.Description != nil {
+        args = append(args, *patch.Description)
+        set = append(set, fmt.Sprintf("description = $%d", len(args)))
+    }
+    if patch.Price != nil {
+        args = append(args, *patch.Price)
+        set = append(set, fmt.Sprintf("price = $%d", len(args)))
+    }
+    if patch.Metadata != nil {
+        args = append(args, *patch.Metadata)
+        set = append(set, fmt.Sprintf("metadata = $%d", len(args)))
+    }
+    if len(set) == 0 {
+        return &ValidationError{Code: "INVALID_BODY", Message: "At least one of name, description, price or metadata is required"}
+    }
+
+    tx, err := beginTxWithRetry(ctx, db, lockedUpdateTxOptions)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    // Lock the row, so a concurrent writer waits for this commit, and
+    // validate the merged item, so a partial update cannot produce a row that
+    // a full update would have rejected.
+    tenantID := tenantFromContext(ctx)
+    current, err := app.stmts.lockItem(ctx, tx, tenantID, id)
+    if err == sql.ErrNoRows {
+        return &NotFoundError{Resource: "Item"}
+    }
+    if err != nil {
+        return err
+    }
+    if err := checkReservation(ctx, tx, tenantID, id); err != nil {
+        return err
+    }
+    merged := current
+    if patch.Name != nil {
+        merged.Name = *patch.Name
+    }
+    if patch.Description != nil {
+        merged.Description = *patch.Description
+    }
+    if patch.Price != nil {
+        merged.Price = *patch.Price
+    }
+    if patch.Metadata != nil {
+        merged.Metadata = *patch.Metadata
+    }
+    if err := validateItem(ctx, merged); err != nil {
+        return err
+    }
+
+    set = append(set, "version = version + 1")
+    args = append(args, id, tenantID)
+    where := fmt.Sprintf("id = $%d AND tenant_id = $%d", len(args)-1, len(args))
+    if patch.Version != nil {
+        args = append(args, *patch.Version)
+        where += fmt.Sprintf(" AND version = $%d", len(args))
+    }
+    sqlStatement := fmt.Sprintf(`UPDATE items SET %s WHERE %s RETURNING id, name, description, price, version, COALESCE(image_url, ''), COALESCE(sku, ''), metadata`,
+        strings.Join(set, ", "), where)
     var item Item
-    err = json.NewDecoder(r.Body).Decode(&item)
+    timer := prometheus.NewTimer(dbQueryDuration.WithLabelValues("update"))
+    err = tx.QueryRowContext(ctx, sqlStatement, args...).Scan(&item.ID, &item.Name, &item.Description, &item.Price, &item.Version, &item.ImageURL, &item.SKU, &item.Metadata)
+    timer.ObserveDuration()
+    if err == sql.ErrNoRows {
+        return &versionConflictError{Current: current.Version}
+    }
+    if isDuplicateName(err) {
+        return errDuplicateName
+    }
     if err != nil {
-        http.Error(w, err.Error(), http.StatusBadRequest)
-        return
+        return err
+    }
+    if err := recordAudit(ctx, tx, id, auditUpdate, current, item); err != nil {
+        return err
+    }
+    if err := recordPriceChange(ctx, tx, id, current.Price, item.Price, ""); err != nil {
+        return err
+    }
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+    evictItem(id)
+    if item.Price != current.Price {
+        priceChanges.Publish(priceChange{ItemID: id, Old: current.Price, New: item.Price})
     }
+    // Respond with the item as GET /items/{id} would serve it, so the ETag
+    // matches what a later conditional GET compares against.
+    if fresh, err := app.stmts.loadItem(ctx, tenantID, id); err == nil {
+        item = fresh
+    }
+    notifyItemChange(ctx, eventItemUpdated, item)
+
+    w.Header().Set("ETag", itemETag(item))
+    writeJSON(w, http.StatusOK, item)
+    return nil
+}
 
-    sqlStatement := `UPDATE items SET name = $1, description = $2, price = $3 WHERE id = $4`
-    _, err = db.ExecContext(ctx, sqlStatement, item.Name, item.Description, item.Price, id)
+func (app *App) deleteItem(w http.ResponseWriter, r *http.Request) error {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "deleteItem", tracer.ResourceName("UPDATE items SET deleted_at = NOW() WHERE id = $1"))
+    defer span.Finish()
+
+    id, err := parseItemID(r.PathValue("id"))
     if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
-        return
+        return &ValidationError{Code: "INVALID_ID", Message: "Invalid item ID"}
     }
 
-    w.Header().Set("Content-Type", "application/json")
+    old, err := app.items.Delete(ctx, tenantFromContext(ctx), id)
+    if err == sql.ErrNoRows {
+        w.WriteHeader(http.StatusNoContent)
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    evictItem(id)
+    notifyItemChange(ctx, eventItemDeleted, old)
+
     w.WriteHeader(http.StatusNoContent)
+    return nil
+}
+
+// restoreItem undoes the soft delete of an item, as long as no live item has
+// taken its name in the meantime.
+func (app *App) restoreItem(w http.ResponseWriter, r *http.Request) error {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "restoreItem", tracer.ResourceName("UPDATE items SET deleted_at = NULL WHERE id = $1"))
+    defer span.Finish()
+
+    id, err := parseItemID(r.PathValue("id"))
+    if err != nil {
+        return &ValidationError{Code: "INVALID_ID", Message: "Invalid item ID"}
+    }
+
+    item, err := app.items.Restore(ctx, tenantFromContext(ctx), id)
+    if err == sql.ErrNoRows {
+        return &NotFoundError{Resource: "Item"}
+    }
+    if err != nil {
+        return err
+    }
+    evictItem(id)
+    notifyItemChange(ctx, eventItemRestored, item)
+
+    writeJSON(w, http.StatusOK, item)
+    return nil
+}
+
+const maxBulkDeleteIDs = 500
+
+type bulkDeleteRequest struct {
+    IDs []int `json:"ids"`
 }
 
-func deleteItem(w http.ResponseWriter, r *http.Request) {
+// deleteItemsBulk soft-deletes every listed item in a single statement.
+// IDs that do not exist, belong to another tenant, are already deleted or are
+// reserved by someone else are skipped, so the reported count can be lower
+// than the number of IDs sent.
+func deleteItemsBulk(w http.ResponseWriter, r *http.Request) {
     ctx := r.Context()
-    span, _ := tracer.StartSpanFromContext(ctx, "deleteItem", tracer.ResourceName("DELETE FROM items WHERE id = $1"))
+    span, _ := tracer.StartSpanFromContext(ctx, "deleteItemsBulk", tracer.ResourceName("UPDATE items SET deleted_at = NOW() WHERE id = ANY($1)"))
     defer span.Finish()
 
-    params := mux.Vars(r)
-    id, err := strconv.Atoi(params["id"])
+    var req bulkDeleteRequest
+    err := json.NewDecoder(r.Body).Decode(&req)
     if err != nil {
-        http.Error(w, "Invalid item ID", http.StatusBadRequest)
+        writeBodyError(w, err, `Request body must be a JSON object like {"ids": [1, 2]}`)
+        return
+    }
+    if len(req.IDs) == 0 {
+        writeError(w, http.StatusBadRequest, "INVALID_BODY", "At least one id is required")
+        return
+    }
+    if len(req.IDs) > maxBulkDeleteIDs {
+        writeError(w, http.StatusBadRequest, "TOO_MANY_IDS", fmt.Sprintf("At most %d items can be deleted at once", maxBulkDeleteIDs))
         return
     }
 
-    sqlStatement := `DELETE FROM items WHERE id = $1`
-    _, err = db.ExecContext(ctx, sqlStatement, id)
+    tx, err := db.BeginTx(ctx, nil)
     if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
+        writeInternalError(w, r, err)
         return
     }
+    defer tx.Rollback()
 
-    w.WriteHeader(http.StatusNoContent)
+    // None of the returned columns change on delete, so they serve as the
+    // audited before-state.
+    sqlStatement := `UPDATE items SET deleted_at = NOW() WHERE id = ANY($1) AND tenant_id = $3 AND deleted_at IS NULL
+            AND (reserved_until IS NULL OR reserved_until <= NOW() OR reserved_by = $2)
+        RETURNING id, name, description, price, version`
+    timer := prometheus.NewTimer(dbQueryDuration.WithLabelValues("delete"))
+    rows, err := tx.QueryContext(ctx, sqlStatement, pq.Array(req.IDs), userIDFromContext(ctx), tenantFromContext(ctx))
+    if err != nil {
+        timer.ObserveDuration()
+        writeInternalError(w, r, err)
+        return
+    }
+    var deleted []Item
+    for rows.Next() {
+        var item Item
+        if err := rows.Scan(&item.ID, &item.Name, &item.Description, &item.Price, &item.Version); err != nil {
+            rows.Close()
+            timer.ObserveDuration()
+            writeInternalError(w, r, err)
+            return
+        }
+        deleted = append(deleted, item)
+    }
+    rows.Close()
+    timer.ObserveDuration()
+    if err := rows.Err(); err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+
+    for _, item := range deleted {
+        if err := recordAudit(ctx, tx, item.ID, auditDelete, item, nil); err != nil {
+            writeInternalError(w, r, err)
+            return
+        }
+    }
+    if err := tx.Commit(); err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+    for _, item := range deleted {
+        evictItem(item.ID)
+        notifyItemChange(ctx, eventItemDeleted, item)
+    }
+
+    writeJSON(w, http.StatusOK, map[string]int{"deleted": len(deleted)})
+}
+
+const maxCompareItems = 5
+
+func compareItems(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "compareItems", tracer.ResourceName("SELECT id, name, description, price FROM items WHERE id = ANY($1)"))
+    defer span.Finish()
+
+    var ids []int64
+    seen := map[int64]bool{}
+    for _, raw := range strings.Split(r.URL.Query().Get("ids"), ",") {
+        raw = strings.TrimSpace(raw)
+        if raw == "" {
+            continue
+        }
+        id, err := parseItemID(raw)
+        if err != nil {
+            writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid item ID: "+raw)
+            return
+        }
+        if !seen[int64(id)] {
+            seen[int64(id)] = true
+            ids = append(ids, int64(id))
+        }
+    }
+    if len(ids) < 2 {
+        writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "At least 2 distinct item IDs are required")
+        return
+    }
+    if len(ids) > maxCompareItems {
+        writeError(w, http.StatusBadRequest, "INVALID_REQUEST", fmt.Sprintf("At most %d item IDs can be compared", maxCompareItems))
+        return
+    }
+
+    sqlStatement := `SELECT id, name, description, price FROM items WHERE id = ANY($1) AND tenant_id = $2 AND deleted_at IS NULL`
+    rows, err := queryRead(r, sqlStatement, pq.Array(ids), tenantFromContext(ctx))
+    if err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+    defer rows.Close()
+
+    found := map[int64]Item{}
+    for rows.Next() {
+        var item Item
+        err := rows.Scan(&item.ID, &item.Name, &item.Description, &item.Price)
+        if err != nil {
+            writeInternalError(w, r, err)
+            return
+        }
+        found[int64(item.ID)] = item
+    }
+    if err := rows.Err(); err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+
+    // Keep the items in the order they were requested.
+    items := make([]Item, 0, len(ids))
+    for _, id := range ids {
+        item, ok := found[id]
+        if !ok {
+            writeError(w, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("Item %d not found", id))
+            return
+        }
+        items = append(items, item)
+    }
+
+    // Split every comparable field into "common" when all items agree and
+    // "differences" (one value per item, in request order) otherwise.
+    fields := map[string]func(Item) interface{}{
+        "name":        func(i Item) interface{} { return i.Name },
+        "description": func(i Item) interface{} { return i.Description },
+        "price":       func(i Item) interface{} { return i.Price },
+    }
+    common := map[string]interface{}{}
+    differences := map[string][]interface{}{}
+    for field, value := range fields {
+        values := make([]interface{}, len(items))
+        same := true
+        for i, item := range items {
+            values[i] = value(item)
+            if values[i] != values[0] {
+                same = false
+            }
+        }
+        if same {
+            common[field] = values[0]
+        } else {
+            differences[field] = values
+        }
+    }
+
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "items":       items,
+        "differences": differences,
+        "common":      common,
+    })
 }
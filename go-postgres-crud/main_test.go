@@ -0,0 +1,649 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log/slog"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/DATA-DOG/go-sqlmock"
+    "github.com/golang-jwt/jwt/v5"
+    "github.com/lib/pq"
+)
+
+// testJWTSecret signs the bearer tokens of the tests.
+var testJWTSecret = []byte("test-secret")
+
+func TestMain(m *testing.M) {
+    jwtSecret = testJWTSecret
+    slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+    stop, err := startIntegrationDB()
+    if err != nil {
+        slog.New(slog.NewTextHandler(os.Stderr, nil)).Error("starting the integration database failed", "error", err)
+        os.Exit(1)
+    }
+    if db == nil {
+        // Handlers dispatch webhooks in the background, which look up the
+        // subscriptions in db. A mock without expectations fails those
+        // lookups instead of dereferencing a nil handle.
+        db, _, err = sqlmock.New()
+        if err != nil {
+            slog.New(slog.NewTextHandler(os.Stderr, nil)).Error("creating the mock database failed", "error", err)
+            os.Exit(1)
+        }
+    }
+    code := m.Run()
+    stop()
+    os.Exit(code)
+}
+
+// testToken signs a bearer token for user_id "test-user", valid for an hour.
+// claims are added to, or replace, the defaults.
+func testToken(t testing.TB, claims jwt.MapClaims) string {
+    t.Helper()
+    all := jwt.MapClaims{"user_id": "test-user", "exp": time.Now().Add(time.Hour).Unix()}
+    for key, value := range claims {
+        all[key] = value
+    }
+    signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, all).SignedString(testJWTSecret)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return "Bearer " + signed
+}
+
+// newTestRouter registers every route on a router that runs the
+// authentication middleware main installs in front of them.
+func newTestRouter(app *App) *router {
+    rt := newRouter()
+    rt.Use(apiKeyMiddleware)
+    rt.Use(jwtMiddleware)
+    rt.Use(tenantMiddleware)
+    registerRoutes(rt, app, nil)
+    return rt
+}
+
+// doRequest sends a request to h and records the response. A non-nil body is
+// encoded as JSON unless it is already a string; a non-empty token is sent as
+// the Authorization header.
+func doRequest(t testing.TB, h http.Handler, method, target string, body interface{}, token string) *httptest.ResponseRecorder {
+    t.Helper()
+    var reader io.Reader
+    switch body := body.(type) {
+    case nil:
+    case string:
+        reader = bytes.NewBufferString(body)
+    default:
+        encoded, err := json.Marshal(body)
+        if err != nil {
+            t.Fatal(err)
+        }
+        reader = bytes.NewReader(encoded)
+    }
+    req := httptest.NewRequest(method, target, reader)
+    if reader != nil {
+        req.Header.Set("Content-Type", "application/json")
+    }
+    if token != "" {
+        req.Header.Set("Authorization", token)
+    }
+    rec := httptest.NewRecorder()
+    h.ServeHTTP(rec, req)
+    return rec
+}
+
+// decodeBody decodes the JSON body of rec into v.
+func decodeBody(t testing.TB, rec *httptest.ResponseRecorder, v interface{}) {
+    t.Helper()
+    if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+        t.Fatalf("decoding %q: %v", rec.Body, err)
+    }
+}
+
+// errorCode returns the code of an ErrorResponse body.
+func errorCode(t testing.TB, rec *httptest.ResponseRecorder) string {
+    t.Helper()
+    var resp ErrorResponse
+    decodeBody(t, rec, &resp)
+    return resp.Code
+}
+
+// mockDB points db at a sqlmock database for the duration of the test and
+// checks at the end that every expected statement ran. Queries match as
+// regular expressions, in order; pings have to be expected too.
+func mockDB(t *testing.T) sqlmock.Sqlmock {
+    t.Helper()
+    conn, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+    if err != nil {
+        t.Fatal(err)
+    }
+    previous := db
+    db = conn
+    t.Cleanup(func() {
+        db = previous
+        if err := mock.ExpectationsWereMet(); err != nil {
+            t.Error(err)
+        }
+        conn.Close()
+    })
+    return mock
+}
+
+// expectWebhookLookup expects the background webhook lookup of a mutation on
+// the mock database of mockDB, finding no subscriptions.
+func expectWebhookLookup(mock sqlmock.Sqlmock) {
+    mock.ExpectQuery(`FROM webhooks`).WillReturnRows(sqlmock.NewRows([]string{"id", "url", "secret"}))
+}
+
+// awaitExpectations waits for background queries to meet the expectations of
+// mock, so they cannot outlive the test and log into the next one.
+func awaitExpectations(t *testing.T, mock sqlmock.Sqlmock) {
+    t.Helper()
+    deadline := time.Now().Add(time.Second)
+    for mock.ExpectationsWereMet() != nil && time.Now().Before(deadline) {
+        time.Sleep(time.Millisecond)
+    }
+}
+
+// mockStatements prepares the item statements on the mock database of
+// mockDB, for handlers that use App.stmts.
+func mockStatements(t *testing.T, mock sqlmock.Sqlmock) *Statements {
+    t.Helper()
+    for i := 0; i < 5; i++ {
+        mock.ExpectPrepare(".")
+    }
+    stmts, err := prepareStatements(db)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return stmts
+}
+
+// lockedItemRows is the row the Lock statement returns for item.
+func lockedItemRows(item Item) *sqlmock.Rows {
+    return sqlmock.NewRows([]string{"id", "name", "description", "price", "version", "image_url", "sku", "metadata"}).
+        AddRow(item.ID, item.Name, item.Description, item.Price, item.Version, item.ImageURL, item.SKU, nil)
+}
+
+// newMockApp returns an App over repo and a router serving it. The item cache
+// is emptied, so reads reach the repository.
+func newMockApp(t testing.TB, repo *MockItemRepository) *router {
+    t.Helper()
+    itemCache = newItemCache(1000, time.Minute)
+    return newTestRouter(NewApp(repo, nil, NewFeatureFlags(nil), nil))
+}
+
+func TestGetItem(t *testing.T) {
+    rt := newMockApp(t, storedItems(Item{ID: 7, Name: "Widget", Price: 9.99, Version: 3}))
+
+    rec := doRequest(t, rt, http.MethodGet, "/items/7", nil, "")
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+    }
+    var got Item
+    decodeBody(t, rec, &got)
+    if got.ID != 7 || got.Name != "Widget" || got.Version != 3 {
+        t.Errorf("body = %+v, want the stored item", got)
+    }
+    if rec.Header().Get("ETag") == "" {
+        t.Error("response has no ETag")
+    }
+
+    rec = doRequest(t, rt, http.MethodGet, "/items/8", nil, "")
+    if rec.Code != http.StatusNotFound || errorCode(t, rec) != "NOT_FOUND" {
+        t.Errorf("missing item: status %d, body %s; want 404 NOT_FOUND", rec.Code, rec.Body)
+    }
+
+    for _, id := range []string{"abc", "0", "-1"} {
+        rec = doRequest(t, rt, http.MethodGet, "/items/"+id, nil, "")
+        if rec.Code != http.StatusBadRequest || errorCode(t, rec) != "INVALID_ID" {
+            t.Errorf("GET /items/%s: status %d, body %s; want 400 INVALID_ID", id, rec.Code, rec.Body)
+        }
+    }
+}
+
+func TestGetItemRepositoryError(t *testing.T) {
+    repo := &MockItemRepository{GetByIDFunc: func(ctx context.Context, id int) (Item, error) {
+        return Item{}, errors.New("connection reset")
+    }}
+    rec := doRequest(t, newMockApp(t, repo), http.MethodGet, "/items/1", nil, "")
+    if rec.Code != http.StatusInternalServerError {
+        t.Errorf("status = %d, want 500", rec.Code)
+    }
+    if strings.Contains(rec.Body.String(), "connection reset") {
+        t.Errorf("body %s leaks the repository error", rec.Body)
+    }
+}
+
+func TestCreateItem(t *testing.T) {
+    repo := storedItems()
+    rt := newMockApp(t, repo)
+    token := testToken(t, nil)
+
+    rec := doRequest(t, rt, http.MethodPost, "/items", Item{Name: "Widget", Description: "Small", Price: 9.99}, token)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+    }
+    var created Item
+    decodeBody(t, rec, &created)
+    if created.ID != 1 || created.Name != "Widget" || created.Version != 1 {
+        t.Errorf("created = %+v, want ID 1, version 1", created)
+    }
+    if calls := repo.Calls(); len(calls) != 1 || calls[0].TenantID != defaultTenantID {
+        t.Errorf("repository calls = %+v, want one Create for the default tenant", calls)
+    }
+}
+
+func TestCreateItemValidation(t *testing.T) {
+    tests := []struct {
+        name   string
+        body   interface{}
+        status int
+        code   string
+    }{
+        {"blank name", Item{Name: "   ", Price: 1}, http.StatusBadRequest, "VALIDATION_FAILED"},
+        {"price above the maximum", Item{Name: "Pricey", Price: maxItemPrice + 1}, http.StatusUnprocessableEntity, "PRICE_OUT_OF_RANGE"},
+        {"missing price", map[string]interface{}{"name": "Free"}, http.StatusUnprocessableEntity, "SCHEMA_VIOLATION"},
+        {"malformed JSON", `{"name": `, http.StatusBadRequest, "INVALID_BODY"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            repo := storedItems()
+            rec := doRequest(t, newMockApp(t, repo), http.MethodPost, "/items", tt.body, testToken(t, nil))
+            if rec.Code != tt.status || errorCode(t, rec) != tt.code {
+                t.Errorf("status %d, body %s; want %d %s", rec.Code, rec.Body, tt.status, tt.code)
+            }
+            if n := repo.CallCount("Create"); n != 0 {
+                t.Errorf("Create called %d times for an invalid item", n)
+            }
+        })
+    }
+}
+
+func TestCreateItemDuplicateName(t *testing.T) {
+    repo := &MockItemRepository{CreateFunc: func(ctx context.Context, item Item, idempotencyKey string) (Item, error) {
+        return Item{}, errDuplicateName
+    }}
+    rec := doRequest(t, newMockApp(t, repo), http.MethodPost, "/items", Item{Name: "Widget", Price: 1}, testToken(t, nil))
+    if rec.Code != http.StatusConflict || errorCode(t, rec) != "DUPLICATE_NAME" {
+        t.Errorf("status %d, body %s; want 409 DUPLICATE_NAME", rec.Code, rec.Body)
+    }
+}
+
+// upsertRequest posts item with X-Upsert-Key set to key.
+func upsertRequest(t *testing.T, h http.Handler, key string, item Item) *httptest.ResponseRecorder {
+    t.Helper()
+    body, err := json.Marshal(item)
+    if err != nil {
+        t.Fatal(err)
+    }
+    r := httptest.NewRequest(http.MethodPost, "/items", bytes.NewReader(body))
+    r.Header.Set("Content-Type", "application/json")
+    r.Header.Set("Authorization", testToken(t, nil))
+    r.Header.Set(upsertKeyHeader, key)
+    rec := httptest.NewRecorder()
+    h.ServeHTTP(rec, r)
+    return rec
+}
+
+func TestCreateItemUpsert(t *testing.T) {
+    repo := storedItems(Item{ID: 3, Name: "Gadget", Price: 5, Version: 1})
+    rt := newMockApp(t, repo)
+
+    rec := upsertRequest(t, rt, "name", Item{Name: "Widget", Price: 9.99})
+    if rec.Code != http.StatusCreated {
+        t.Fatalf("insert: status = %d, want 201: %s", rec.Code, rec.Body)
+    }
+    var inserted Item
+    decodeBody(t, rec, &inserted)
+    if want := fmt.Sprintf("/items/%d", inserted.ID); inserted.ID == 3 || rec.Header().Get("Location") != want {
+        t.Errorf("insert: item %+v, Location %q; want a new item at %s", inserted, rec.Header().Get("Location"), want)
+    }
+
+    rec = upsertRequest(t, rt, "name", Item{Name: "gadget", Description: "Bigger", Price: 7})
+    if rec.Code != http.StatusOK {
+        t.Fatalf("update: status = %d, want 200: %s", rec.Code, rec.Body)
+    }
+    var updated Item
+    decodeBody(t, rec, &updated)
+    if updated.ID != 3 || updated.Version != 2 || updated.Price != 7 || updated.Description != "Bigger" {
+        t.Errorf("update: item = %+v, want item 3 replaced at version 2", updated)
+    }
+    if rec.Header().Get("Location") != "" {
+        t.Errorf("update: Location = %q, want none", rec.Header().Get("Location"))
+    }
+    if n := repo.CallCount("Create"); n != 0 {
+        t.Errorf("Create called %d times for upserts", n)
+    }
+}
+
+func TestCreateItemUpsertInvalidKey(t *testing.T) {
+    for _, key := range []string{"id", "created_at", "sku"} {
+        repo := storedItems()
+        rec := upsertRequest(t, newMockApp(t, repo), key, Item{Name: "Widget", Price: 1})
+        if rec.Code != http.StatusBadRequest || errorCode(t, rec) != "INVALID_UPSERT_KEY" {
+            t.Errorf("X-Upsert-Key %s: status %d, body %s; want 400 INVALID_UPSERT_KEY", key, rec.Code, rec.Body)
+        }
+        if calls := repo.Calls(); len(calls) != 0 {
+            t.Errorf("X-Upsert-Key %s: repository calls = %+v, want none", key, calls)
+        }
+    }
+}
+
+func TestUpdateItem(t *testing.T) {
+    repo := storedItems(Item{ID: 4, Name: "Gadget", Price: 5, Version: 1})
+    rt := newMockApp(t, repo)
+    token := testToken(t, nil)
+
+    rec := doRequest(t, rt, http.MethodPut, "/items/4", Item{Name: "Gadget Pro", Price: 7.5, Version: 1}, token)
+    if rec.Code != http.StatusNoContent {
+        t.Fatalf("status = %d, want 204: %s", rec.Code, rec.Body)
+    }
+    if got := rec.Header().Get(itemVersionHeader); got != "2" {
+        t.Errorf("%s = %q, want 2", itemVersionHeader, got)
+    }
+    if rec.Header().Get("ETag") == "" {
+        t.Error("response has no ETag")
+    }
+
+    rec = doRequest(t, rt, http.MethodGet, "/items/4", nil, "")
+    var got Item
+    decodeBody(t, rec, &got)
+    if got.Name != "Gadget Pro" || got.Price != 7.5 {
+        t.Errorf("after update GET returned %+v", got)
+    }
+
+    rec = doRequest(t, rt, http.MethodPut, "/items/4", Item{Name: "Stale", Price: 1, Version: 1}, token)
+    if rec.Code != http.StatusConflict || errorCode(t, rec) != "VERSION_CONFLICT" {
+        t.Errorf("stale version: status %d, body %s; want 409 VERSION_CONFLICT", rec.Code, rec.Body)
+    }
+}
+
+func TestUpdateItemNotFound(t *testing.T) {
+    repo := storedItems()
+    rec := doRequest(t, newMockApp(t, repo), http.MethodPut, "/items/9", Item{Name: "Ghost", Price: 1}, testToken(t, nil))
+    if rec.Code != http.StatusNoContent {
+        t.Errorf("status = %d, want 204 for a missing item: %s", rec.Code, rec.Body)
+    }
+    if rec.Header().Get(itemVersionHeader) != "" {
+        t.Errorf("a no-op update reports version %q", rec.Header().Get(itemVersionHeader))
+    }
+}
+
+func TestUpdateItemValidation(t *testing.T) {
+    tests := []struct {
+        name   string
+        target string
+        body   interface{}
+        status int
+        code   string
+    }{
+        {"invalid ID", "/items/abc", Item{Name: "Gadget", Price: 1}, http.StatusBadRequest, "INVALID_ID"},
+        {"blank name", "/items/4", Item{Name: " ", Price: 1}, http.StatusBadRequest, "VALIDATION_FAILED"},
+        {"negative price", "/items/4", map[string]interface{}{"name": "Gadget", "price": -1}, http.StatusUnprocessableEntity, "SCHEMA_VIOLATION"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            repo := storedItems(Item{ID: 4, Name: "Gadget", Price: 5, Version: 1})
+            rec := doRequest(t, newMockApp(t, repo), http.MethodPut, tt.target, tt.body, testToken(t, nil))
+            if rec.Code != tt.status || errorCode(t, rec) != tt.code {
+                t.Errorf("status %d, body %s; want %d %s", rec.Code, rec.Body, tt.status, tt.code)
+            }
+            if n := repo.CallCount("Update"); n != 0 {
+                t.Errorf("Update called %d times for an invalid request", n)
+            }
+        })
+    }
+}
+
+// TestUpdatesLockTheRowFirst checks that PUT and PATCH take the row lock in
+// a read-committed transaction before they write, so a second writer waits
+// for the first to commit. TestIntegrationConcurrentUpdates races two.
+func TestUpdatesLockTheRowFirst(t *testing.T) {
+    if lockedUpdateTxOptions.Isolation != sql.LevelReadCommitted {
+        t.Errorf("isolation = %v, want read committed", lockedUpdateTxOptions.Isolation)
+    }
+    current := Item{ID: 1, Name: "Widget", Price: 9.99, Version: 1}
+
+    t.Run("PUT", func(t *testing.T) {
+        mock := mockDB(t)
+        repo := NewPostgresItemRepository(db, mockStatements(t, mock))
+        mock.ExpectBegin()
+        mock.ExpectQuery(`SELECT .* FROM items WHERE id = \$1 AND tenant_id = \$2 AND deleted_at IS NULL FOR UPDATE`).
+            WithArgs(1, defaultTenantID).WillReturnRows(lockedItemRows(current))
+        mock.ExpectQuery(`SELECT reserved_by FROM items`).WillReturnRows(sqlmock.NewRows([]string{"reserved_by"}))
+        mock.ExpectExec(`UPDATE items SET name = \$1`).WillReturnResult(sqlmock.NewResult(0, 1))
+        mock.ExpectExec(`INSERT INTO audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+        mock.ExpectCommit()
+
+        if _, _, err := repo.Update(withTenant(context.Background(), defaultTenantID), defaultTenantID, 1, Item{Name: "Gadget", Price: 9.99}); err != nil {
+            t.Fatal(err)
+        }
+    })
+
+    t.Run("PATCH", func(t *testing.T) {
+        mock := mockDB(t)
+        rt := newStockRouter(t, mock)
+        // The lock finds no row, so nothing is written.
+        mock.ExpectBegin()
+        mock.ExpectQuery(`FOR UPDATE`).WithArgs(1, defaultTenantID).WillReturnError(sql.ErrNoRows)
+        mock.ExpectRollback()
+
+        rec := doRequest(t, rt, http.MethodPatch, "/items/1", map[string]string{"name": "Gadget"}, testToken(t, nil))
+        if rec.Code != http.StatusNotFound {
+            t.Errorf("status = %d, want 404: %s", rec.Code, rec.Body)
+        }
+    })
+}
+
+func TestDeleteItem(t *testing.T) {
+    repo := storedItems(Item{ID: 2, Name: "Doomed", Price: 1, Version: 1})
+    rt := newMockApp(t, repo)
+    token := testToken(t, nil)
+
+    if rec := doRequest(t, rt, http.MethodDelete, "/items/2", nil, token); rec.Code != http.StatusNoContent {
+        t.Fatalf("status = %d, want 204: %s", rec.Code, rec.Body)
+    }
+    if rec := doRequest(t, rt, http.MethodGet, "/items/2", nil, ""); rec.Code != http.StatusNotFound {
+        t.Errorf("GET after DELETE: status = %d, want 404", rec.Code)
+    }
+    if rec := doRequest(t, rt, http.MethodDelete, "/items/2", nil, token); rec.Code != http.StatusNoContent {
+        t.Errorf("deleting a missing item: status = %d, want 204", rec.Code)
+    }
+    if rec := doRequest(t, rt, http.MethodDelete, "/items/abc", nil, token); rec.Code != http.StatusBadRequest {
+        t.Errorf("invalid ID: status = %d, want 400", rec.Code)
+    }
+}
+
+func TestDeleteItemRepositoryError(t *testing.T) {
+    repo := &MockItemRepository{DeleteFunc: func(ctx context.Context, id int) (Item, error) {
+        return Item{}, errors.New("connection reset")
+    }}
+    rec := doRequest(t, newMockApp(t, repo), http.MethodDelete, "/items/1", nil, testToken(t, nil))
+    if rec.Code != http.StatusInternalServerError {
+        t.Errorf("status = %d, want 500", rec.Code)
+    }
+}
+
+// newBulkRouter serves an App whose repository runs against mock, so the
+// bulk tests see the statements of PostgresItemRepository.CreateMany.
+func newBulkRouter(t *testing.T, mock sqlmock.Sqlmock) *router {
+    t.Helper()
+    stmts := mockStatements(t, mock)
+    return newTestRouter(NewApp(NewPostgresItemRepository(db, stmts), stmts, NewFeatureFlags(nil), nil))
+}
+
+// expectNameFree expects the live name check of a create to find no item.
+func expectNameFree(mock sqlmock.Sqlmock, name string) {
+    mock.ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM items WHERE LOWER\(name\)`).WithArgs(name, defaultTenantID).
+        WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+}
+
+func TestCreateItemsBulk(t *testing.T) {
+    mock := mockDB(t)
+    rt := newBulkRouter(t, mock)
+
+    mock.ExpectBegin()
+    expectNameFree(mock, "Widget")
+    mock.ExpectQuery(`INSERT INTO items`).WithArgs("Widget", "Small", 9.99, sqlmock.AnyArg(), defaultTenantID).
+        WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow(7, 1))
+    mock.ExpectExec(`DELETE FROM item_categories WHERE item_id = \$1`).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 0))
+    mock.ExpectExec(`INSERT INTO item_categories`).WithArgs(7, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+    mock.ExpectQuery(`FROM item_categories`).
+        WillReturnRows(sqlmock.NewRows([]string{"item_id", "id", "name", "slug"}).AddRow(7, 3, "Tools", "tools"))
+    mock.ExpectExec(`INSERT INTO audit_logs`).WithArgs(7, "test-user", auditCreate, nil, sqlmock.AnyArg()).
+        WillReturnResult(sqlmock.NewResult(1, 1))
+    expectNameFree(mock, "Gadget")
+    mock.ExpectQuery(`INSERT INTO items`).WithArgs("Gadget", "", 5.0, sqlmock.AnyArg(), defaultTenantID).
+        WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow(8, 1))
+    mock.ExpectExec(`INSERT INTO audit_logs`).WithArgs(8, "test-user", auditCreate, nil, sqlmock.AnyArg()).
+        WillReturnResult(sqlmock.NewResult(2, 1))
+    mock.ExpectCommit()
+
+    body := []Item{{Name: "Widget", Description: "Small", Price: 9.99, CategoryIDs: []int{3}}, {Name: "Gadget", Price: 5}}
+    rec := doRequest(t, rt, http.MethodPost, "/items/bulk", body, testToken(t, nil))
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+    }
+    var created []Item
+    decodeBody(t, rec, &created)
+    if len(created) != 2 || created[0].ID != 7 || created[1].ID != 8 || created[1].Name != "Gadget" {
+        t.Fatalf("created = %+v, want Widget as 7 and Gadget as 8", created)
+    }
+    if len(created[0].Categories) != 1 || created[0].Categories[0].Slug != "tools" {
+        t.Errorf("Widget categories = %+v, want tools", created[0].Categories)
+    }
+}
+
+func TestCreateItemsBulkRejectedBeforeTheDatabase(t *testing.T) {
+    tooMany := make([]Item, maxBulkItems+1)
+    for i := range tooMany {
+        tooMany[i] = Item{Name: fmt.Sprintf("Item %d", i), Price: 1}
+    }
+    tests := []struct {
+        name string
+        body interface{}
+        code string
+    }{
+        {"over the limit", tooMany, "TOO_MANY_ITEMS"},
+        {"empty", []Item{}, "INVALID_BODY"},
+        {"one invalid item", []Item{{Name: "Widget", Price: 1}, {Name: "", Price: 1}}, "VALIDATION_FAILED"},
+        {"sku supplied", []Item{{Name: "Widget", Price: 1, SKU: "TOO-WID-X7K2"}}, "VALIDATION_FAILED"},
+        {"not an array", Item{Name: "Widget", Price: 1}, "INVALID_BODY"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            // No Begin is expected: nothing may reach the database.
+            rt := newBulkRouter(t, mockDB(t))
+            rec := doRequest(t, rt, http.MethodPost, "/items/bulk", tt.body, testToken(t, nil))
+            if rec.Code != http.StatusBadRequest || errorCode(t, rec) != tt.code {
+                t.Errorf("status %d, body %s; want 400 %s", rec.Code, rec.Body, tt.code)
+            }
+        })
+    }
+}
+
+func TestCreateItemsBulkDatabaseError(t *testing.T) {
+    mock := mockDB(t)
+    rt := newBulkRouter(t, mock)
+
+    mock.ExpectBegin()
+    expectNameFree(mock, "Widget")
+    mock.ExpectQuery(`INSERT INTO items`).WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow(7, 1))
+    mock.ExpectExec(`INSERT INTO audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+    expectNameFree(mock, "Gadget")
+    mock.ExpectQuery(`INSERT INTO items`).WillReturnError(errors.New("connection reset"))
+    mock.ExpectRollback()
+
+    body := []Item{{Name: "Widget", Price: 1}, {Name: "Gadget", Price: 2}, {Name: "Gizmo", Price: 3}}
+    rec := doRequest(t, rt, http.MethodPost, "/items/bulk", body, testToken(t, nil))
+    if rec.Code != http.StatusInternalServerError {
+        t.Errorf("status %d, body %s; want 500", rec.Code, rec.Body)
+    }
+}
+
+func TestCreateItemsBulkDuplicateName(t *testing.T) {
+    mock := mockDB(t)
+    rt := newBulkRouter(t, mock)
+
+    mock.ExpectBegin()
+    expectNameFree(mock, "Widget")
+    mock.ExpectQuery(`INSERT INTO items`).WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow(7, 1))
+    mock.ExpectExec(`INSERT INTO audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+    // The second Widget sees the first, inserted in the same transaction.
+    mock.ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM items WHERE LOWER\(name\)`).WithArgs("widget", defaultTenantID).
+        WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+    mock.ExpectRollback()
+
+    body := []Item{{Name: "Widget", Price: 1}, {Name: "widget", Price: 2}}
+    rec := doRequest(t, rt, http.MethodPost, "/items/bulk", body, testToken(t, nil))
+    if rec.Code != http.StatusConflict || errorCode(t, rec) != "DUPLICATE_NAME" {
+        t.Fatalf("status %d, body %s; want 409 DUPLICATE_NAME", rec.Code, rec.Body)
+    }
+    var resp struct {
+        Details []bulkItemError `json:"details"`
+    }
+    decodeBody(t, rec, &resp)
+    if len(resp.Details) != 1 || resp.Details[0].Index != 1 {
+        t.Errorf("details = %+v, want index 1", resp.Details)
+    }
+}
+
+func TestDeleteItemsBulkPartialMatch(t *testing.T) {
+    mock := mockDB(t)
+    rt := newStockRouter(t, mock)
+
+    mock.ExpectBegin()
+    mock.ExpectQuery(`UPDATE items SET deleted_at = NOW\(\) WHERE id = ANY\(\$1\)`).
+        WithArgs(pq.Array([]int{1, 2, 99}), "test-user", defaultTenantID).
+        WillReturnRows(sqlmock.NewRows([]string{"id", "name", "description", "price", "version"}).
+            AddRow(1, "Widget", "", 9.99, 1).
+            AddRow(2, "Gadget", "", 5, 3))
+    mock.ExpectExec(`INSERT INTO audit_logs`).WithArgs(1, "test-user", auditDelete, sqlmock.AnyArg(), nil).WillReturnResult(sqlmock.NewResult(1, 1))
+    mock.ExpectExec(`INSERT INTO audit_logs`).WithArgs(2, "test-user", auditDelete, sqlmock.AnyArg(), nil).WillReturnResult(sqlmock.NewResult(2, 1))
+    mock.ExpectCommit()
+
+    rec := doRequest(t, rt, http.MethodDelete, "/items", map[string][]int{"ids": {1, 2, 99}}, testToken(t, nil))
+    var got map[string]int
+    decodeBody(t, rec, &got)
+    if rec.Code != http.StatusOK || got["deleted"] != 2 {
+        t.Errorf("status %d, body %v; want 200 with 2 deleted", rec.Code, got)
+    }
+}
+
+func TestDeleteItemsBulkValidation(t *testing.T) {
+    tooMany := make([]int, maxBulkDeleteIDs+1)
+    for i := range tooMany {
+        tooMany[i] = i + 1
+    }
+    tests := []struct {
+        name string
+        body interface{}
+        code string
+    }{
+        {"empty ids", map[string][]int{"ids": {}}, "INVALID_BODY"},
+        {"no ids", map[string]string{}, "INVALID_BODY"},
+        {"too many ids", map[string][]int{"ids": tooMany}, "TOO_MANY_IDS"},
+        {"malformed JSON", `{"ids": [1,`, "INVALID_BODY"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            rt := newStockRouter(t, mockDB(t))
+            rec := doRequest(t, rt, http.MethodDelete, "/items", tt.body, testToken(t, nil))
+            if rec.Code != http.StatusBadRequest || errorCode(t, rec) != tt.code {
+                t.Errorf("status %d, body %s; want 400 %s", rec.Code, rec.Body, tt.code)
+            }
+        })
+    }
+}
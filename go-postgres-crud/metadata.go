@@ -0,0 +1,36 @@
+package main
+
+import (
+    "database/sql/driver"
+    "encoding/json"
+    "fmt"
+)
+
+const maxMetadataBytes = 10 << 10 // 10 KB serialized
+
+// Metadata holds arbitrary key-value attributes of an item, stored in the
+// items.metadata JSONB column. A nil Metadata is stored as NULL.
+type Metadata map[string]interface{}
+
+// Scan implements sql.Scanner for JSONB values.
+func (m *Metadata) Scan(src interface{}) error {
+    switch value := src.(type) {
+    case nil:
+        *m = nil
+        return nil
+    case []byte:
+        return json.Unmarshal(value, m)
+    case string:
+        return json.Unmarshal([]byte(value), m)
+    default:
+        return fmt.Errorf("cannot scan %T into item metadata", src)
+    }
+}
+
+// Value implements driver.Valuer.
+func (m Metadata) Value() (driver.Value, error) {
+    if m == nil {
+        return nil, nil
+    }
+    return json.Marshal(m)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// returnBodyMiddleware implements the RFC 7240 "Prefer: return=representation"
+// preference for handlers that answer 204 No Content. When the client asks for
+// the representation, the 204 is replaced by a 200 carrying the resource as
+// returned by fetch. Without the preference, or with return=minimal, the
+// handler's response is sent unchanged.
+func returnBodyMiddleware(fetch func(r *http.Request) (interface{}, error)) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            w.Header().Add("Vary", "Prefer")
+            if preferReturn(r) != "representation" {
+                next.ServeHTTP(w, r)
+                return
+            }
+
+            buf := &bufferedResponseWriter{ResponseWriter: w, status: http.StatusOK}
+            next.ServeHTTP(buf, r)
+
+            if buf.status == http.StatusNoContent {
+                resource, err := fetch(r)
+                if err == nil {
+                    w.Header().Set("Preference-Applied", "return=representation")
+                    writeJSON(w, http.StatusOK, resource)
+                    return
+                }
+            }
+            w.WriteHeader(buf.status)
+            w.Write(buf.body.Bytes())
+        })
+    }
+}
+
+// bodyLimitOverrides raises the request body limit for routes that take file
+// uploads. The slack covers the multipart framing around the file.
+var bodyLimitOverrides = map[string]int64{
+    "/items/{id}/image": maxImageBytes + 64<<10,
+    "/items/import":     maxCSVImportBytes + 64<<10,
+}
+
+// maxBytesMiddleware caps request bodies at limit bytes, or at the route's
+// entry in bodyLimitOverrides. Reads past the limit fail with
+// *http.MaxBytesError, which handlers turn into a 413 through writeBodyError,
+// so an oversized body is never buffered in full.
+func maxBytesMiddleware(limit int64) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if r.Body != nil && r.Body != http.NoBody {
+                routeLimit := limit
+                if override, ok := bodyLimitOverrides[routeLabel(r)]; ok {
+                    routeLimit = override
+                }
+                r.Body = http.MaxBytesReader(w, r.Body, routeLimit)
+            }
+            next.ServeHTTP(w, r)
+        })
+    }
+}
+
+// preferReturn extracts the "return" preference from the Prefer header(s).
+func preferReturn(r *http.Request) string {
+    for _, header := range r.Header.Values("Prefer") {
+        for _, pref := range strings.Split(header, ",") {
+            name, value, _ := strings.Cut(strings.TrimSpace(pref), "=")
+            if strings.EqualFold(strings.TrimSpace(name), "return") {
+                return strings.ToLower(strings.Trim(strings.TrimSpace(value), `"`))
+            }
+        }
+    }
+    return ""
+}
+
+func (app *App) fetchItemFromRequest(r *http.Request) (interface{}, error) {
+    id, err := parseItemID(r.PathValue("id"))
+    if err != nil {
+        return nil, err
+    }
+    return app.stmts.fetchItem(r.Context(), tenantFromContext(r.Context()), id)
+}
+
+// deprecationMiddleware marks every response as coming from a deprecated API
+// (RFC 9745 and RFC 8594): Deprecation carries the configured moment the
+// routes were deprecated, Sunset the date they go away, and Link points
+// clients at the successor.
+func deprecationMiddleware(deprecatedAt, sunsetDate time.Time, link string) func(http.Handler) http.Handler {
+    deprecation := "@" + strconv.FormatInt(deprecatedAt.Unix(), 10)
+    sunset := sunsetDate.UTC().Format(http.TimeFormat)
+    successor := "<" + link + `>; rel="successor-version"`
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            w.Header().Set("Deprecation", deprecation)
+            w.Header().Set("Sunset", sunset)
+            w.Header().Add("Link", successor)
+            next.ServeHTTP(w, r)
+        })
+    }
+}
+
+// pathPrefixMiddleware applies mw only to requests whose path starts with prefix.
+func pathPrefixMiddleware(prefix string, mw func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        wrapped := mw(next)
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if r.URL.Path == prefix || strings.HasPrefix(r.URL.Path, prefix+"/") {
+                wrapped.ServeHTTP(w, r)
+                return
+            }
+            next.ServeHTTP(w, r)
+        })
+    }
+}
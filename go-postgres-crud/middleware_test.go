@@ -0,0 +1,41 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestDeprecationMiddleware(t *testing.T) {
+    deprecatedAt := time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)
+    sunsetDate := time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)
+    ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+    h := pathPrefixMiddleware("/items", deprecationMiddleware(deprecatedAt, sunsetDate, "https://api.example.com/v2/items"))(ok)
+
+    rec := httptest.NewRecorder()
+    h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/items/1", nil))
+
+    deprecation := rec.Header().Get("Deprecation")
+    if deprecation != "@1738281600" {
+        t.Errorf("Deprecation = %q, want @1738281600", deprecation)
+    }
+    unix, err := strconv.ParseInt(strings.TrimPrefix(deprecation, "@"), 10, 64)
+    if err != nil || !time.Unix(unix, 0).Before(time.Now()) {
+        t.Errorf("Deprecation %q is not a timestamp in the past", deprecation)
+    }
+    if got := rec.Header().Get("Sunset"); got != "Mon, 30 Jun 2025 00:00:00 GMT" {
+        t.Errorf("Sunset = %q", got)
+    }
+    if got := rec.Header().Get("Link"); got != `<https://api.example.com/v2/items>; rel="successor-version"` {
+        t.Errorf("Link = %q", got)
+    }
+
+    rec = httptest.NewRecorder()
+    h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+    if rec.Header().Get("Deprecation") != "" || rec.Header().Get("Sunset") != "" {
+        t.Errorf("/healthz got deprecation headers %v", rec.Header())
+    }
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+    "crypto/sha256"
+    "database/sql"
+    "embed"
+    "encoding/hex"
+    "errors"
+    "flag"
+    "fmt"
+    "io/fs"
+    "log/slog"
+    "sort"
+    "strconv"
+    "strings"
+
+    "github.com/golang-migrate/migrate/v4"
+    "github.com/golang-migrate/migrate/v4/database/postgres"
+    "github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// createMigrationChecksums keeps the checksum of every applied migration
+// beside golang-migrate's schema_migrations, which only records the version.
+const createMigrationChecksums = `CREATE TABLE IF NOT EXISTS schema_migration_checksums (
+    version BIGINT PRIMARY KEY,
+    checksum TEXT NOT NULL,
+    recorded_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+)`
+
+// migrationFile is one NNN_name.up.sql file and its down file.
+type migrationFile struct {
+    Version uint
+    Name    string
+    // Checksum is the SHA-256 of the up and down SQL.
+    Checksum string
+    // Irreversible is set when the down file is missing or holds nothing
+    // but comments; such a migration is never rolled back.
+    Irreversible bool
+}
+
+// embeddedMigrations is the migrations directory of the binary.
+func embeddedMigrations() fs.FS {
+    dir, err := fs.Sub(migrationFiles, "migrations")
+    if err != nil {
+        panic(err)
+    }
+    return dir
+}
+
+// readMigrations reads every migration in fsys, keyed by version.
+func readMigrations(fsys fs.FS) (map[uint]migrationFile, error) {
+    ups, err := fs.Glob(fsys, "*.up.sql")
+    if err != nil {
+        return nil, err
+    }
+    files := map[uint]migrationFile{}
+    for _, up := range ups {
+        base := strings.TrimSuffix(up, ".up.sql")
+        prefix, name, _ := strings.Cut(base, "_")
+        version, err := strconv.ParseUint(prefix, 10, 64)
+        if err != nil {
+            return nil, fmt.Errorf("migration %s: the file name must start with a version number", up)
+        }
+        upSQL, err := fs.ReadFile(fsys, up)
+        if err != nil {
+            return nil, err
+        }
+        downSQL, err := fs.ReadFile(fsys, base+".down.sql")
+        if err != nil && !errors.Is(err, fs.ErrNotExist) {
+            return nil, err
+        }
+        sum := sha256.New()
+        sum.Write(upSQL)
+        sum.Write([]byte{0})
+        sum.Write(downSQL)
+        files[uint(version)] = migrationFile{
+            Version:      uint(version),
+            Name:         name,
+            Checksum:     hex.EncodeToString(sum.Sum(nil)),
+            Irreversible: !containsSQL(string(downSQL)),
+        }
+    }
+    return files, nil
+}
+
+// containsSQL reports whether script has any line that is not blank or a
+// -- comment.
+func containsSQL(script string) bool {
+    for _, line := range strings.Split(script, "\n") {
+        if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "--") {
+            return true
+        }
+    }
+    return false
+}
+
+// ValidateMigrations fails when a migration the database has applied was
+// changed or removed on disk since, naming each one. A database that has no
+// checksums recorded yet passes; runMigrations records them as it applies.
+func ValidateMigrations(db *sql.DB, migrationsFS fs.FS) error {
+    files, err := readMigrations(migrationsFS)
+    if err != nil {
+        return fmt.Errorf("reading migrations: %w", err)
+    }
+    var recorded bool
+    if err := db.QueryRow(`SELECT to_regclass('schema_migration_checksums') IS NOT NULL`).Scan(&recorded); err != nil {
+        return fmt.Errorf("reading migration checksums: %w", err)
+    }
+    if !recorded {
+        return nil
+    }
+    rows, err := db.Query(`SELECT version, checksum FROM schema_migration_checksums ORDER BY version`)
+    if err != nil {
+        return fmt.Errorf("reading migration checksums: %w", err)
+    }
+    defer rows.Close()
+    var problems []string
+    for rows.Next() {
+        var version uint
+        var checksum string
+        if err := rows.Scan(&version, &checksum); err != nil {
+            return fmt.Errorf("reading migration checksums: %w", err)
+        }
+        file, ok := files[version]
+        switch {
+        case !ok:
+            problems = append(problems, fmt.Sprintf("%d was applied but its file is gone", version))
+        case file.Checksum != checksum:
+            problems = append(problems, fmt.Sprintf("%d (%s) was changed after it was applied", version, file.Name))
+        }
+    }
+    if err := rows.Err(); err != nil {
+        return fmt.Errorf("reading migration checksums: %w", err)
+    }
+    if len(problems) > 0 {
+        return fmt.Errorf("migrations do not match the applied history: %s", strings.Join(problems, "; "))
+    }
+    return nil
+}
+
+// recordMigrationChecksums stores the checksum of every migration up to
+// version that has none yet. A database migrated before checksums existed
+// adopts its current files.
+func recordMigrationChecksums(db *sql.DB, files map[uint]migrationFile, version uint) error {
+    if _, err := db.Exec(createMigrationChecksums); err != nil {
+        return err
+    }
+    versions := make([]uint, 0, len(files))
+    for v := range files {
+        if v <= version {
+            versions = append(versions, v)
+        }
+    }
+    sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+    for _, v := range versions {
+        _, err := db.Exec(`INSERT INTO schema_migration_checksums (version, checksum) VALUES ($1, $2)
+            ON CONFLICT (version) DO NOTHING`, v, files[v].Checksum)
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// newMigrator reads the embedded migrations against db.
+func newMigrator(db *sql.DB) (*migrate.Migrate, error) {
+    source, err := iofs.New(migrationFiles, "migrations")
+    if err != nil {
+        return nil, fmt.Errorf("reading migrations: %w", err)
+    }
+    driver, err := postgres.WithInstance(db, &postgres.Config{})
+    if err != nil {
+        return nil, fmt.Errorf("preparing migrations: %w", err)
+    }
+    m, err := migrate.NewWithInstance("iofs", source, "postgres", driver)
+    if err != nil {
+        return nil, fmt.Errorf("preparing migrations: %w", err)
+    }
+    return m, nil
+}
+
+// runMigrations applies every embedded migration that the database has not
+// seen yet. The items table used to be created by hand, so 001 uses IF NOT
+// EXISTS and existing databases adopt the migration history without changes.
+// It refuses to run when ValidateMigrations finds an applied migration that
+// was edited.
+func runMigrations(db *sql.DB) error {
+    if err := ValidateMigrations(db, embeddedMigrations()); err != nil {
+        return err
+    }
+    m, err := newMigrator(db)
+    if err != nil {
+        return err
+    }
+
+    err = m.Up()
+    if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+        return fmt.Errorf("applying migrations: %w", err)
+    }
+    version, dirty, err := m.Version()
+    if err != nil {
+        return fmt.Errorf("reading migration version: %w", err)
+    }
+    files, err := readMigrations(embeddedMigrations())
+    if err != nil {
+        return fmt.Errorf("reading migrations: %w", err)
+    }
+    if err := recordMigrationChecksums(db, files, version); err != nil {
+        return fmt.Errorf("recording migration checksums: %w", err)
+    }
+    slog.Info("database schema is up to date", "version", version, "dirty", dirty)
+    return nil
+}
+
+// runRollback implements the rollback subcommand: it reverts the latest
+// applied migration using the same DB_* configuration as the server. An
+// irreversible migration is refused.
+func runRollback(args []string) error {
+    flags := flag.NewFlagSet("rollback", flag.ContinueOnError)
+    if err := flags.Parse(args); err == flag.ErrHelp {
+        return nil
+    } else if err != nil {
+        return err
+    }
+
+    settings, err := loadDBSettings()
+    if err != nil {
+        return err
+    }
+    rollbackDB, err := sql.Open("postgres", settings.dsn())
+    if err != nil {
+        return err
+    }
+    defer rollbackDB.Close()
+    return rollbackMigration(rollbackDB)
+}
+
+// rollbackMigration reverts the latest applied migration after checking the
+// applied history and that the migration has a down file with SQL in it.
+func rollbackMigration(db *sql.DB) error {
+    if err := ValidateMigrations(db, embeddedMigrations()); err != nil {
+        return err
+    }
+    m, err := newMigrator(db)
+    if err != nil {
+        return err
+    }
+    version, dirty, err := m.Version()
+    if err != nil {
+        return fmt.Errorf("reading migration version: %w", err)
+    }
+    if dirty {
+        return fmt.Errorf("migration %d failed halfway and needs fixing by hand", version)
+    }
+    files, err := readMigrations(embeddedMigrations())
+    if err != nil {
+        return fmt.Errorf("reading migrations: %w", err)
+    }
+    if file := files[version]; file.Irreversible {
+        return fmt.Errorf("migration %d (%s) is irreversible: its down file has no SQL", version, file.Name)
+    }
+    if err := m.Steps(-1); err != nil {
+        return fmt.Errorf("rolling back migration %d: %w", version, err)
+    }
+    if _, err := db.Exec(`DELETE FROM schema_migration_checksums WHERE version = $1`, version); err != nil {
+        return fmt.Errorf("forgetting the checksum of migration %d: %w", version, err)
+    }
+    slog.Info("rolled back migration", "version", version, "name", files[version].Name)
+    return nil
+}
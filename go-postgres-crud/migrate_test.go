@@ -0,0 +1,91 @@
+package main
+
+import (
+    "strings"
+    "testing"
+    "testing/fstest"
+
+    "github.com/DATA-DOG/go-sqlmock"
+)
+
+func migrationFS(down string) fstest.MapFS {
+    return fstest.MapFS{
+        "001_create_items.up.sql":   {Data: []byte("CREATE TABLE items (id SERIAL PRIMARY KEY);\n")},
+        "001_create_items.down.sql": {Data: []byte("DROP TABLE items;\n")},
+        "002_backfill.up.sql":       {Data: []byte("UPDATE items SET id = id;\n")},
+        "002_backfill.down.sql":     {Data: []byte(down)},
+    }
+}
+
+func TestReadMigrations(t *testing.T) {
+    files, err := readMigrations(migrationFS("-- Nothing to undo.\n\n"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(files) != 2 || files[1].Name != "create_items" || files[1].Irreversible || !files[2].Irreversible {
+        t.Errorf("readMigrations = %+v, want 001 reversible and 002 irreversible", files)
+    }
+    // Editing either half changes the checksum.
+    edited, err := readMigrations(migrationFS("UPDATE items SET id = id;\n"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if edited[2].Checksum == files[2].Checksum || edited[1].Checksum != files[1].Checksum || edited[2].Irreversible {
+        t.Errorf("checksums %s and %s after editing 002's down file", files[2].Checksum, edited[2].Checksum)
+    }
+
+    if _, err := readMigrations(fstest.MapFS{"init.up.sql": {Data: []byte("SELECT 1;")}}); err == nil {
+        t.Error("readMigrations accepted a file name without a version")
+    }
+}
+
+// Every shipped migration can be rolled back.
+func TestEmbeddedMigrationsAreReversible(t *testing.T) {
+    files, err := readMigrations(embeddedMigrations())
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, file := range files {
+        if file.Irreversible {
+            t.Errorf("migration %d (%s) has no down SQL", file.Version, file.Name)
+        }
+    }
+}
+
+func TestValidateMigrations(t *testing.T) {
+    fsys := migrationFS("UPDATE items SET id = id;\n")
+    files, err := readMigrations(fsys)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    t.Run("no checksums recorded", func(t *testing.T) {
+        mock := mockDB(t)
+        mock.ExpectQuery(`to_regclass`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+        if err := ValidateMigrations(db, fsys); err != nil {
+            t.Errorf("ValidateMigrations = %v, want nil", err)
+        }
+    })
+
+    t.Run("matching", func(t *testing.T) {
+        mock := mockDB(t)
+        mock.ExpectQuery(`to_regclass`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+        mock.ExpectQuery(`SELECT version, checksum FROM schema_migration_checksums`).
+            WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}).AddRow(1, files[1].Checksum).AddRow(2, files[2].Checksum))
+        if err := ValidateMigrations(db, fsys); err != nil {
+            t.Errorf("ValidateMigrations = %v, want nil", err)
+        }
+    })
+
+    t.Run("edited and removed", func(t *testing.T) {
+        mock := mockDB(t)
+        mock.ExpectQuery(`to_regclass`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+        mock.ExpectQuery(`SELECT version, checksum FROM schema_migration_checksums`).
+            WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}).
+                AddRow(1, files[1].Checksum).AddRow(2, "0000").AddRow(3, "ffff"))
+        err := ValidateMigrations(db, fsys)
+        if err == nil || !strings.Contains(err.Error(), "2 (backfill) was changed") || !strings.Contains(err.Error(), "3 was applied but its file is gone") {
+            t.Errorf("ValidateMigrations = %v, want 2 changed and 3 gone", err)
+        }
+    })
+}
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS items (
+    id          SERIAL PRIMARY KEY,
+    name        VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    price       NUMERIC(10, 2) NOT NULL
+);
@@ -0,0 +1,6 @@
+-- Soft delete: DELETE /items/{id} sets deleted_at instead of removing the row.
+-- Soft-deleted rows are kept indefinitely; purging them permanently will need
+-- a later migration or an admin endpoint.
+ALTER TABLE items ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS items_deleted_at_idx ON items (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS items_created_at_idx;
+
+ALTER TABLE items DROP COLUMN IF EXISTS created_at;
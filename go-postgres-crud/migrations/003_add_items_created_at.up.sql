@@ -0,0 +1,5 @@
+-- created_at backs ?sort=created_at_desc on GET /items. Existing rows get the
+-- time the migration ran.
+ALTER TABLE items ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS items_created_at_idx ON items (created_at);
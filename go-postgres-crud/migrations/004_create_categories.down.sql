@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS item_categories;
+
+DROP TABLE IF EXISTS categories;
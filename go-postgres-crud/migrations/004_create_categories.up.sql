@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS categories (
+    id   SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    slug VARCHAR(255) NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS item_categories (
+    item_id     INTEGER NOT NULL REFERENCES items (id) ON DELETE CASCADE,
+    category_id INTEGER NOT NULL REFERENCES categories (id) ON DELETE CASCADE,
+    PRIMARY KEY (item_id, category_id)
+);
+
+CREATE INDEX IF NOT EXISTS item_categories_category_id_idx ON item_categories (category_id);
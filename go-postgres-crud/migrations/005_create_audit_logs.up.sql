@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS audit_logs (
+    id         BIGSERIAL PRIMARY KEY,
+    item_id    INTEGER NOT NULL,
+    user_id    TEXT,
+    action     VARCHAR(16) NOT NULL,
+    old_value  JSONB,
+    new_value  JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS audit_logs_item_id_idx ON audit_logs (item_id, created_at);
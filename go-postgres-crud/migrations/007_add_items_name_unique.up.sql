@@ -0,0 +1 @@
+CREATE UNIQUE INDEX IF NOT EXISTS items_name_lower_key ON items (LOWER(name)) WHERE deleted_at IS NULL;
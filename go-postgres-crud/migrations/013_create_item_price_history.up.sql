@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS item_price_history (
+    id                 BIGSERIAL PRIMARY KEY,
+    item_id            INTEGER NOT NULL,
+    old_price          NUMERIC(10, 2) NOT NULL,
+    new_price          NUMERIC(10, 2) NOT NULL,
+    changed_at         TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    changed_by_user_id TEXT
+);
+
+CREATE INDEX IF NOT EXISTS item_price_history_item_id_idx ON item_price_history (item_id, changed_at);
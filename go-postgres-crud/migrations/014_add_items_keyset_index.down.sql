@@ -0,0 +1 @@
+DROP INDEX IF EXISTS items_created_at_id_idx;
@@ -0,0 +1,3 @@
+-- Backs keyset pagination on GET /items?after=, which orders live items by
+-- (created_at, id).
+CREATE INDEX IF NOT EXISTS items_created_at_id_idx ON items (created_at, id) WHERE deleted_at IS NULL;
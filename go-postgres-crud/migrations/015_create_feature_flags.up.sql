@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS feature_flags (
+    flag_name          TEXT PRIMARY KEY,
+    enabled            BOOLEAN NOT NULL DEFAULT FALSE,
+    rollout_percentage INTEGER NOT NULL DEFAULT 100 CHECK (rollout_percentage BETWEEN 0 AND 100)
+);
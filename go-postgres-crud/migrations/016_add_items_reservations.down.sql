@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS items_reserved_until_idx;
+
+ALTER TABLE items DROP COLUMN IF EXISTS reserved_until;
+ALTER TABLE items DROP COLUMN IF EXISTS reserved_by;
@@ -0,0 +1,6 @@
+-- A reservation holds an item for reserved_by until reserved_until; see
+-- POST /items/{id}/reserve.
+ALTER TABLE items ADD COLUMN IF NOT EXISTS reserved_by TEXT;
+ALTER TABLE items ADD COLUMN IF NOT EXISTS reserved_until TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS items_reserved_until_idx ON items (reserved_until) WHERE reserved_until IS NOT NULL;
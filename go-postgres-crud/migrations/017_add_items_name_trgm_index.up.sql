@@ -0,0 +1,9 @@
+-- Backs the name-similarity fallback of GET /items/{id}/related. pg_trgm is
+-- optional, so the index is only created where the extension is installed.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_trgm') THEN
+        CREATE INDEX IF NOT EXISTS items_name_trgm_idx ON items USING gin (name gin_trgm_ops) WHERE deleted_at IS NULL;
+    END IF;
+END
+$$;
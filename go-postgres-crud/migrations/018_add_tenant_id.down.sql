@@ -0,0 +1,8 @@
+-- Fails while two tenants have a live item of the same name.
+DROP INDEX IF EXISTS items_tenant_id_idx;
+DROP INDEX IF EXISTS items_name_lower_key;
+CREATE UNIQUE INDEX items_name_lower_key ON items (LOWER(name)) WHERE deleted_at IS NULL;
+
+ALTER TABLE webhooks DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE items DROP COLUMN IF EXISTS tenant_id;
@@ -0,0 +1,12 @@
+-- Items, API keys and webhooks belong to a tenant. Existing rows, and
+-- requests that name no tenant, fall in the default tenant, the nil UUID.
+ALTER TABLE items ADD COLUMN IF NOT EXISTS tenant_id UUID NOT NULL DEFAULT '00000000-0000-0000-0000-000000000000';
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS tenant_id UUID NOT NULL DEFAULT '00000000-0000-0000-0000-000000000000';
+ALTER TABLE webhooks ADD COLUMN IF NOT EXISTS tenant_id UUID NOT NULL DEFAULT '00000000-0000-0000-0000-000000000000';
+
+-- Names are unique within a tenant. The index keeps its name, which
+-- isDuplicateName matches.
+DROP INDEX IF EXISTS items_name_lower_key;
+CREATE UNIQUE INDEX items_name_lower_key ON items (tenant_id, LOWER(name)) WHERE deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS items_tenant_id_idx ON items (tenant_id, id);
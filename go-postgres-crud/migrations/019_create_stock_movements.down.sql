@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS stock_movements;
+DROP TYPE IF EXISTS stock_reference_type;
+
+ALTER TABLE items DROP COLUMN IF EXISTS stock;
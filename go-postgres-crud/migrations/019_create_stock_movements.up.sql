@@ -0,0 +1,25 @@
+-- stock is the quantity on hand. A reservation holds one unit of it until it
+-- is released or expires. Every change is recorded in stock_movements; see
+-- GET /items/{id}/stock-history.
+ALTER TABLE items ADD COLUMN IF NOT EXISTS stock INTEGER NOT NULL DEFAULT 0 CHECK (stock >= 0);
+
+DO $$ BEGIN
+    CREATE TYPE stock_reference_type AS ENUM ('adjustment', 'restock', 'reservation');
+EXCEPTION
+    WHEN duplicate_object THEN NULL;
+END $$;
+
+CREATE TABLE IF NOT EXISTS stock_movements (
+    id             BIGSERIAL PRIMARY KEY,
+    tenant_id      UUID NOT NULL,
+    item_id        INTEGER NOT NULL,
+    delta          INTEGER NOT NULL,
+    reason         TEXT NOT NULL,
+    reference_type stock_reference_type NOT NULL,
+    reference_id   TEXT,
+    actor          TEXT NOT NULL,
+    stock_after    INTEGER NOT NULL,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS stock_movements_item_id_idx ON stock_movements (tenant_id, item_id, created_at, id);
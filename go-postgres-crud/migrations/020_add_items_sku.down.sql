@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS items_sku_key;
+
+ALTER TABLE items DROP COLUMN IF EXISTS sku;
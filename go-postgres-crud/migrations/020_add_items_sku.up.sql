@@ -0,0 +1,5 @@
+-- A SKU is optional, set once by POST /items/{id}/generate-sku, and unique
+-- within a tenant.
+ALTER TABLE items ADD COLUMN IF NOT EXISTS sku TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS items_sku_key ON items (tenant_id, sku) WHERE sku IS NOT NULL;
@@ -0,0 +1,7 @@
+-- Idempotency keys belong to the tenant that sent them, so two tenants can
+-- use the same key without seeing each other's responses. Existing keys fall
+-- in the default tenant.
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS tenant_id UUID NOT NULL DEFAULT '00000000-0000-0000-0000-000000000000';
+
+ALTER TABLE idempotency_keys DROP CONSTRAINT IF EXISTS idempotency_keys_pkey;
+ALTER TABLE idempotency_keys ADD PRIMARY KEY (tenant_id, key);
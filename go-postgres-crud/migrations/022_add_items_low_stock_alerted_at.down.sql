@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS items_stock_idx;
+
+ALTER TABLE items DROP COLUMN IF EXISTS low_stock_alerted_at;
@@ -0,0 +1,5 @@
+-- low_stock_alerted_at is when the daily low-stock alert last included the
+-- item, so an item that stays low is announced at most once a day.
+ALTER TABLE items ADD COLUMN IF NOT EXISTS low_stock_alerted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS items_stock_idx ON items (tenant_id, stock) WHERE deleted_at IS NULL;
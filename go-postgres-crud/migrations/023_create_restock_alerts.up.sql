@@ -0,0 +1,11 @@
+-- A restock alert asks to be told when an out-of-stock item is restocked.
+-- notified_at is when it last fired; an alert fires at most once a day.
+CREATE TABLE IF NOT EXISTS restock_alerts (
+    id          BIGSERIAL PRIMARY KEY,
+    tenant_id   UUID NOT NULL,
+    item_id     INTEGER NOT NULL REFERENCES items (id) ON DELETE CASCADE,
+    email       TEXT NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    notified_at TIMESTAMPTZ,
+    UNIQUE (tenant_id, item_id, email)
+);
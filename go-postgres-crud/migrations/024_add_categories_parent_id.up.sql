@@ -0,0 +1,5 @@
+-- A category may sit under a parent, for breadcrumbs. Deleting a parent makes
+-- its children top-level categories.
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS parent_id INTEGER REFERENCES categories (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS categories_parent_id_idx ON categories (parent_id);
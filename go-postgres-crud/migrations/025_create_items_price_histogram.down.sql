@@ -0,0 +1 @@
+DROP MATERIALIZED VIEW IF EXISTS items_price_histogram;
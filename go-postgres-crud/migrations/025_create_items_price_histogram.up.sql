@@ -0,0 +1,12 @@
+-- Live items per tenant in 20 price buckets of 50 between 0 and 1000; bucket
+-- 21 holds prices of 1000 and above. Refreshed nightly, so analytics reads
+-- do not aggregate items on every load. The unique index lets the refresh
+-- run CONCURRENTLY, without blocking those reads.
+CREATE MATERIALIZED VIEW IF NOT EXISTS items_price_histogram AS
+    SELECT tenant_id, width_bucket(price, 0, 1000, 20) AS bucket, COUNT(*) AS count,
+        MIN(price) AS bucket_min, MAX(price) AS bucket_max
+    FROM items
+    WHERE deleted_at IS NULL
+    GROUP BY tenant_id, bucket;
+
+CREATE UNIQUE INDEX IF NOT EXISTS items_price_histogram_key ON items_price_histogram (tenant_id, bucket);
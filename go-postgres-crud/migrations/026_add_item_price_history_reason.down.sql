@@ -0,0 +1 @@
+ALTER TABLE item_price_history DROP COLUMN IF EXISTS reason;
@@ -0,0 +1,3 @@
+-- Why the price changed, when the change says so, e.g. a bulk adjustment's
+-- "Annual price review".
+ALTER TABLE item_price_history ADD COLUMN IF NOT EXISTS reason TEXT;
@@ -0,0 +1,18 @@
+-- A user's report that an item's price is wrong. An admin accepts it, which
+-- sets the item to correct_price, or rejects it. reporter_id is NULL for
+-- requests authenticated by API key.
+CREATE TABLE IF NOT EXISTS price_error_reports (
+    id             BIGSERIAL PRIMARY KEY,
+    tenant_id      UUID NOT NULL,
+    item_id        INTEGER NOT NULL REFERENCES items (id) ON DELETE CASCADE,
+    reporter_id    TEXT,
+    reported_price NUMERIC(10, 2) NOT NULL,
+    correct_price  NUMERIC(10, 2) NOT NULL,
+    notes          TEXT NOT NULL DEFAULT '',
+    status         TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'rejected')),
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    resolved_at    TIMESTAMPTZ,
+    resolved_by    TEXT
+);
+
+CREATE INDEX IF NOT EXISTS price_error_reports_status_idx ON price_error_reports (tenant_id, status, created_at);
@@ -0,0 +1,212 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "strings"
+    "sync"
+
+    "github.com/google/uuid"
+)
+
+// MockItemRepository is an ItemRepository whose results the test controls.
+// Each method calls the matching func field; one left nil reports the item
+// as missing. Every call is recorded, with the tenant it was made for.
+type MockItemRepository struct {
+    CreateFunc     func(ctx context.Context, item Item, idempotencyKey string) (Item, error)
+    CreateManyFunc func(ctx context.Context, items []Item) ([]Item, error)
+    UpsertFunc     func(ctx context.Context, item Item) (old, stored Item, inserted bool, err error)
+    GetAllFunc     func(ctx context.Context, filters ItemFilters) (itemPage, error)
+    GetAfterFunc   func(ctx context.Context, filters ItemFilters) (itemCursorPage, error)
+    GetByIDFunc    func(ctx context.Context, id int) (Item, error)
+    UpdateFunc     func(ctx context.Context, id int, item Item) (old, updated Item, err error)
+    DeleteFunc     func(ctx context.Context, id int) (Item, error)
+    RestoreFunc    func(ctx context.Context, id int) (Item, error)
+
+    mu    sync.Mutex
+    calls []mockCall
+}
+
+type mockCall struct {
+    Method   string
+    TenantID uuid.UUID
+}
+
+func (m *MockItemRepository) record(method string, tenantID uuid.UUID) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.calls = append(m.calls, mockCall{Method: method, TenantID: tenantID})
+}
+
+// Calls returns the methods called so far, in order.
+func (m *MockItemRepository) Calls() []mockCall {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    return append([]mockCall(nil), m.calls...)
+}
+
+// CallCount returns how often method was called.
+func (m *MockItemRepository) CallCount(method string) int {
+    n := 0
+    for _, call := range m.Calls() {
+        if call.Method == method {
+            n++
+        }
+    }
+    return n
+}
+
+func (m *MockItemRepository) Create(ctx context.Context, tenantID uuid.UUID, item Item, idempotencyKey string) (Item, error) {
+    m.record("Create", tenantID)
+    if m.CreateFunc == nil {
+        return Item{}, sql.ErrNoRows
+    }
+    return m.CreateFunc(ctx, item, idempotencyKey)
+}
+
+func (m *MockItemRepository) CreateMany(ctx context.Context, tenantID uuid.UUID, items []Item) ([]Item, error) {
+    m.record("CreateMany", tenantID)
+    if m.CreateManyFunc == nil {
+        return nil, sql.ErrNoRows
+    }
+    return m.CreateManyFunc(ctx, items)
+}
+
+func (m *MockItemRepository) Upsert(ctx context.Context, tenantID uuid.UUID, item Item) (Item, Item, bool, error) {
+    m.record("Upsert", tenantID)
+    if m.UpsertFunc == nil {
+        return Item{}, Item{}, false, sql.ErrNoRows
+    }
+    return m.UpsertFunc(ctx, item)
+}
+
+func (m *MockItemRepository) GetAll(ctx context.Context, tenantID uuid.UUID, filters ItemFilters) (itemPage, error) {
+    m.record("GetAll", tenantID)
+    if m.GetAllFunc == nil {
+        return itemPage{Items: []Item{}, Limit: filters.Limit, Offset: filters.Offset}, nil
+    }
+    return m.GetAllFunc(ctx, filters)
+}
+
+func (m *MockItemRepository) GetAfter(ctx context.Context, tenantID uuid.UUID, filters ItemFilters) (itemCursorPage, error) {
+    m.record("GetAfter", tenantID)
+    if m.GetAfterFunc == nil {
+        return itemCursorPage{Items: []Item{}, Limit: filters.Limit}, nil
+    }
+    return m.GetAfterFunc(ctx, filters)
+}
+
+func (m *MockItemRepository) GetByID(ctx context.Context, tenantID uuid.UUID, id int) (Item, error) {
+    m.record("GetByID", tenantID)
+    if m.GetByIDFunc == nil {
+        return Item{}, sql.ErrNoRows
+    }
+    return m.GetByIDFunc(ctx, id)
+}
+
+func (m *MockItemRepository) Update(ctx context.Context, tenantID uuid.UUID, id int, item Item) (Item, Item, error) {
+    m.record("Update", tenantID)
+    if m.UpdateFunc == nil {
+        return Item{}, Item{}, sql.ErrNoRows
+    }
+    return m.UpdateFunc(ctx, id, item)
+}
+
+func (m *MockItemRepository) Delete(ctx context.Context, tenantID uuid.UUID, id int) (Item, error) {
+    m.record("Delete", tenantID)
+    if m.DeleteFunc == nil {
+        return Item{}, sql.ErrNoRows
+    }
+    return m.DeleteFunc(ctx, id)
+}
+
+func (m *MockItemRepository) Restore(ctx context.Context, tenantID uuid.UUID, id int) (Item, error) {
+    m.record("Restore", tenantID)
+    if m.RestoreFunc == nil {
+        return Item{}, sql.ErrNoRows
+    }
+    return m.RestoreFunc(ctx, id)
+}
+
+// storedItems is a MockItemRepository backed by a map, for tests that need
+// writes to be visible to later reads.
+func storedItems(items ...Item) *MockItemRepository {
+    var mu sync.Mutex
+    byID := map[int]Item{}
+    nextID := 1
+    for _, item := range items {
+        byID[item.ID] = item
+        if item.ID >= nextID {
+            nextID = item.ID + 1
+        }
+    }
+    return &MockItemRepository{
+        CreateFunc: func(ctx context.Context, item Item, idempotencyKey string) (Item, error) {
+            mu.Lock()
+            defer mu.Unlock()
+            item.ID, item.Version = nextID, 1
+            nextID++
+            byID[item.ID] = item
+            return item, nil
+        },
+        CreateManyFunc: func(ctx context.Context, items []Item) ([]Item, error) {
+            mu.Lock()
+            defer mu.Unlock()
+            created := append([]Item(nil), items...)
+            for i := range created {
+                created[i].ID, created[i].Version = nextID, 1
+                nextID++
+                byID[created[i].ID] = created[i]
+            }
+            return created, nil
+        },
+        UpsertFunc: func(ctx context.Context, item Item) (Item, Item, bool, error) {
+            mu.Lock()
+            defer mu.Unlock()
+            for id, old := range byID {
+                if strings.EqualFold(old.Name, item.Name) {
+                    item.ID, item.Version = id, old.Version+1
+                    byID[id] = item
+                    return old, item, false, nil
+                }
+            }
+            item.ID, item.Version = nextID, 1
+            nextID++
+            byID[item.ID] = item
+            return Item{}, item, true, nil
+        },
+        GetByIDFunc: func(ctx context.Context, id int) (Item, error) {
+            mu.Lock()
+            defer mu.Unlock()
+            item, ok := byID[id]
+            if !ok {
+                return Item{}, sql.ErrNoRows
+            }
+            return item, nil
+        },
+        UpdateFunc: func(ctx context.Context, id int, item Item) (Item, Item, error) {
+            mu.Lock()
+            defer mu.Unlock()
+            old, ok := byID[id]
+            if !ok {
+                return Item{}, Item{}, sql.ErrNoRows
+            }
+            if item.Version != 0 && item.Version != old.Version {
+                return Item{}, Item{}, &versionConflictError{Current: old.Version}
+            }
+            item.ID, item.Version = id, old.Version+1
+            byID[id] = item
+            return old, item, nil
+        },
+        DeleteFunc: func(ctx context.Context, id int) (Item, error) {
+            mu.Lock()
+            defer mu.Unlock()
+            old, ok := byID[id]
+            if !ok {
+                return Item{}, sql.ErrNoRows
+            }
+            delete(byID, id)
+            return old, nil
+        },
+    }
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+    "reflect"
+    "sort"
+    "strings"
+    "testing"
+
+    "gopkg.in/yaml.v3"
+)
+
+// undocumentedRoutes are served but deliberately left out of openapi.yaml:
+// the documentation itself and the Allow answers to OPTIONS.
+var undocumentedRoutes = map[string]bool{
+    "GET /docs":                 true,
+    "GET /openapi.yaml":         true,
+    "OPTIONS /items":            true,
+    "OPTIONS /items/{id}":       true,
+    "OPTIONS /items/import":     true,
+    "OPTIONS /items/{id}/image": true,
+}
+
+type openAPIDocument struct {
+    Paths      map[string]map[string]yaml.Node `yaml:"paths"`
+    Components struct {
+        Schemas map[string]struct {
+            Properties map[string]yaml.Node `yaml:"properties"`
+        } `yaml:"schemas"`
+    } `yaml:"components"`
+}
+
+func loadOpenAPISpec(t *testing.T) openAPIDocument {
+    t.Helper()
+    var doc openAPIDocument
+    if err := yaml.Unmarshal(openAPISpec, &doc); err != nil {
+        t.Fatalf("openapi.yaml: %v", err)
+    }
+    return doc
+}
+
+// TestOpenAPISpecMatchesRoutes fails when a route is registered without a
+// matching operation in openapi.yaml, or the spec documents one that is not
+// served. go generate runs it.
+func TestOpenAPISpecMatchesRoutes(t *testing.T) {
+    doc := loadOpenAPISpec(t)
+    rt := newTestRouter(NewApp(nil, nil, nil, nil))
+
+    served := map[string]bool{}
+    for _, pattern := range *rt.patterns {
+        served[pattern] = true
+        if undocumentedRoutes[pattern] {
+            continue
+        }
+        method, path, _ := strings.Cut(pattern, " ")
+        if _, ok := doc.Paths[path][strings.ToLower(method)]; !ok {
+            t.Errorf("%s is served but not documented in openapi.yaml", pattern)
+        }
+    }
+
+    var documented []string
+    for path, operations := range doc.Paths {
+        for method := range operations {
+            if method == "parameters" {
+                continue
+            }
+            documented = append(documented, strings.ToUpper(method)+" "+path)
+        }
+    }
+    sort.Strings(documented)
+    for _, pattern := range documented {
+        if !served[pattern] {
+            t.Errorf("openapi.yaml documents %s, which is not served", pattern)
+        }
+    }
+}
+
+// TestOpenAPIItemSchemaMatchesItem fails when an Item field is added or
+// renamed without updating the Item schema, or ItemInput for fields only
+// read from request bodies.
+func TestOpenAPIItemSchemaMatchesItem(t *testing.T) {
+    doc := loadOpenAPISpec(t)
+    schema, ok := doc.Components.Schemas["Item"]
+    if !ok {
+        t.Fatal("openapi.yaml has no Item schema")
+    }
+    input := doc.Components.Schemas["ItemInput"]
+
+    fields := map[string]bool{}
+    itemType := reflect.TypeOf(Item{})
+    for i := 0; i < itemType.NumField(); i++ {
+        name, _, _ := strings.Cut(itemType.Field(i).Tag.Get("json"), ",")
+        if name == "" || name == "-" {
+            continue
+        }
+        fields[name] = true
+        _, inItem := schema.Properties[name]
+        _, inInput := input.Properties[name]
+        if !inItem && !inInput {
+            t.Errorf("Item field %s is missing from the Item and ItemInput schemas", name)
+        }
+    }
+    for name := range schema.Properties {
+        if !fields[name] {
+            t.Errorf("the Item schema has %s, which Item does not", name)
+        }
+    }
+}
+
+// TestOpenAPIPriceBounds fails when the default MIN_ITEM_PRICE or
+// MAX_ITEM_PRICE changes without the bounds of ItemInput.price.
+func TestOpenAPIPriceBounds(t *testing.T) {
+    doc := loadOpenAPISpec(t)
+    price, ok := doc.Components.Schemas["ItemInput"].Properties["price"]
+    if !ok {
+        t.Fatal("the ItemInput schema has no price")
+    }
+    var bounds struct {
+        Minimum float64 `yaml:"minimum"`
+        Maximum float64 `yaml:"maximum"`
+    }
+    if err := price.Decode(&bounds); err != nil {
+        t.Fatal(err)
+    }
+    if bounds.Minimum != minItemPrice || bounds.Maximum != maxItemPrice {
+        t.Errorf("ItemInput.price is within [%v, %v], want [%v, %v]", bounds.Minimum, bounds.Maximum, minItemPrice, maxItemPrice)
+    }
+}
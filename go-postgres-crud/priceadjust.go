@@ -0,0 +1,138 @@
+package main
+
+import (
+    "encoding/json"
+    "math"
+    "net/http"
+    "strings"
+
+    "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+const maxPriceAdjustReasonLength = 255
+
+// priceAdjustStatusActive is the only status filter items support: live
+// items. Deleted items are never adjusted.
+const priceAdjustStatusActive = "active"
+
+type priceAdjustRequest struct {
+    Filter struct {
+        CategoryID *int   `json:"category_id"`
+        Status     string `json:"status"`
+    } `json:"filter"`
+    AdjustPercent *float64 `json:"adjust_percent"`
+    Reason        string   `json:"reason"`
+}
+
+// adjustPrices raises or lowers by adjust_percent the price of every live
+// item of the tenant, or of one category, rounding to cents and keeping the
+// result within MIN_ITEM_PRICE and MAX_ITEM_PRICE. capped counts the items
+// held down by MAX_ITEM_PRICE. Items reserved by another user and items whose
+// price would not change are left alone. Every change is audited and written
+// to the price history with the reason, in one transaction. With
+// ?dry_run=true the same statement runs and is rolled back, so the counts are
+// what a real run would report.
+func (app *App) adjustPrices(w http.ResponseWriter, r *http.Request) error {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "adjustPrices", tracer.ResourceName("UPDATE items SET price = ROUND(price * $1, 2)"))
+    defer span.Finish()
+
+    var req priceAdjustRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        return bodyError(err, "Request body is not valid JSON")
+    }
+    if req.AdjustPercent == nil || math.IsNaN(*req.AdjustPercent) || *req.AdjustPercent <= -100 || *req.AdjustPercent > 1000 || *req.AdjustPercent == 0 {
+        return &ValidationError{Code: "INVALID_BODY", Message: "adjust_percent must be a non-zero number above -100 and at most 1000"}
+    }
+    if req.Filter.CategoryID != nil && *req.Filter.CategoryID <= 0 {
+        return &ValidationError{Code: "INVALID_BODY", Message: "filter.category_id must be a positive integer"}
+    }
+    if status := req.Filter.Status; status != "" && status != priceAdjustStatusActive {
+        return &ValidationError{Code: "UNSUPPORTED_FILTER", Message: `Items have no status; filter.status can only be "active", the live items`}
+    }
+    req.Reason = strings.TrimSpace(req.Reason)
+    if req.Reason == "" || len(req.Reason) > maxPriceAdjustReasonLength {
+        return &ValidationError{Code: "INVALID_BODY", Message: "reason is required and must be at most 255 characters"}
+    }
+    dryRun := r.URL.Query().Get("dry_run") == "true"
+
+    tx, err := db.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    // The candidates are locked first, so the old price each change records
+    // is the one it replaced.
+    rows, err := tx.QueryContext(ctx, `WITH candidates AS (
+            SELECT id, price AS old_price, ROUND(price * (1 + $1::numeric / 100), 2) AS raw_price
+            FROM items
+            WHERE tenant_id = $2 AND deleted_at IS NULL
+                AND ($3::int IS NULL OR EXISTS (SELECT 1 FROM item_categories ic WHERE ic.item_id = items.id AND ic.category_id = $3))
+                AND (reserved_until IS NULL OR reserved_until <= NOW() OR reserved_by = $4)
+            FOR UPDATE
+        )
+        UPDATE items SET price = LEAST(GREATEST(c.raw_price, $5), $6), version = items.version + 1
+        FROM candidates c
+        WHERE items.id = c.id AND LEAST(GREATEST(c.raw_price, $5), $6) <> c.old_price
+        RETURNING items.id, items.name, items.description, items.price, items.version, COALESCE(items.image_url, ''),
+            COALESCE(items.sku, ''), items.metadata, c.old_price, c.raw_price > $6`,
+        *req.AdjustPercent, tenantFromContext(ctx), req.Filter.CategoryID, userIDFromContext(ctx), minItemPrice, maxItemPrice)
+    if err != nil {
+        return err
+    }
+    type adjustment struct {
+        item     Item
+        oldPrice float64
+    }
+    var adjusted []adjustment
+    capped := 0
+    for rows.Next() {
+        var a adjustment
+        var wasCapped bool
+        err := rows.Scan(&a.item.ID, &a.item.Name, &a.item.Description, &a.item.Price, &a.item.Version, &a.item.ImageURL,
+            &a.item.SKU, &a.item.Metadata, &a.oldPrice, &wasCapped)
+        if err != nil {
+            rows.Close()
+            return err
+        }
+        if wasCapped {
+            capped++
+        }
+        adjusted = append(adjusted, a)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return err
+    }
+
+    for _, a := range adjusted {
+        // Only the price and version changed, so the before state is the
+        // item as returned with those put back.
+        old := a.item
+        old.Price, old.Version = a.oldPrice, a.item.Version-1
+        if err := recordAudit(ctx, tx, a.item.ID, auditUpdate, old, a.item); err != nil {
+            return err
+        }
+        if err := recordPriceChange(ctx, tx, a.item.ID, a.oldPrice, a.item.Price, req.Reason); err != nil {
+            return err
+        }
+    }
+    if !dryRun {
+        if err := tx.Commit(); err != nil {
+            return err
+        }
+        for _, a := range adjusted {
+            evictItem(a.item.ID)
+            priceChanges.Publish(priceChange{ItemID: a.item.ID, Old: a.oldPrice, New: a.item.Price})
+            notifyItemChange(ctx, eventItemUpdated, a.item)
+        }
+    }
+
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "adjusted": len(adjusted),
+        "capped":   capped,
+        "dry_run":  dryRun,
+    })
+    return nil
+}
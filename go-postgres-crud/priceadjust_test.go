@@ -0,0 +1,86 @@
+package main
+
+import (
+    "fmt"
+    "net/http"
+    "testing"
+
+    "github.com/DATA-DOG/go-sqlmock"
+    "github.com/golang-jwt/jwt/v5"
+)
+
+// adjustedRows are the RETURNING rows of the price adjustment: Widget went
+// from 10 to 10.50 and Gadget from 999999.00 to the cap.
+func adjustedRows() *sqlmock.Rows {
+    return sqlmock.NewRows([]string{"id", "name", "description", "price", "version", "image_url", "sku", "metadata", "old_price", "capped"}).
+        AddRow(1, "Widget", "", 10.5, 3, "", "", []byte(`{}`), 10.0, false).
+        AddRow(2, "Gadget", "", maxItemPrice, 8, "", "", []byte(`{}`), 999999.0, true)
+}
+
+func expectPriceAdjustment(mock sqlmock.Sqlmock) {
+    mock.ExpectBegin()
+    mock.ExpectQuery(`WITH candidates AS \(.*ROUND\(price \* \(1 \+ \$1::numeric / 100\), 2\).*FOR UPDATE`).
+        WithArgs(5.0, defaultTenantID, 4, "test-user", minItemPrice, maxItemPrice).
+        WillReturnRows(adjustedRows())
+    for _, change := range []struct {
+        id       int
+        old, new float64
+    }{{1, 10, 10.5}, {2, 999999, maxItemPrice}} {
+        mock.ExpectExec(`INSERT INTO audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+        mock.ExpectExec(`INSERT INTO item_price_history`).
+            WithArgs(change.id, change.old, change.new, "test-user", "Annual price review").
+            WillReturnResult(sqlmock.NewResult(1, 1))
+    }
+}
+
+func TestAdjustPrices(t *testing.T) {
+    admin := testToken(t, jwt.MapClaims{"role": "admin"})
+    body := `{"filter": {"category_id": 4, "status": "active"}, "adjust_percent": 5, "reason": " Annual price review "}`
+
+    for _, dryRun := range []bool{false, true} {
+        t.Run(fmt.Sprintf("dry_run=%v", dryRun), func(t *testing.T) {
+            mock := mockDB(t)
+            rt := newTestRouter(NewApp(storedItems(), nil, NewFeatureFlags(nil), nil))
+            expectPriceAdjustment(mock)
+            if dryRun {
+                mock.ExpectRollback()
+            } else {
+                mock.ExpectCommit()
+                expectWebhookLookup(mock)
+                expectWebhookLookup(mock)
+            }
+
+            rec := doRequest(t, rt, http.MethodPost, fmt.Sprintf("/admin/items/price-adjust?dry_run=%v", dryRun), body, admin)
+            var got struct {
+                Adjusted int  `json:"adjusted"`
+                Capped   int  `json:"capped"`
+                DryRun   bool `json:"dry_run"`
+            }
+            decodeBody(t, rec, &got)
+            if rec.Code != http.StatusOK || got.Adjusted != 2 || got.Capped != 1 || got.DryRun != dryRun {
+                t.Errorf("status %d, body %s; want 2 adjusted, 1 capped", rec.Code, rec.Body)
+            }
+            awaitExpectations(t, mock)
+        })
+    }
+}
+
+func TestAdjustPricesInvalid(t *testing.T) {
+    mockDB(t)
+    rt := newTestRouter(NewApp(storedItems(), nil, NewFeatureFlags(nil), nil))
+    admin := testToken(t, jwt.MapClaims{"role": "admin"})
+    for body, code := range map[string]string{
+        `{"reason": "Review"}`:                                                     "INVALID_BODY",
+        `{"adjust_percent": 0, "reason": "Review"}`:                                "INVALID_BODY",
+        `{"adjust_percent": -100, "reason": "Review"}`:                             "INVALID_BODY",
+        `{"adjust_percent": 5}`:                                                    "INVALID_BODY",
+        `{"adjust_percent": 5, "reason": "Review", "filter": {"category_id": 0}}`:  "INVALID_BODY",
+        `{"adjust_percent": 5, "reason": "Review", "filter": {"status": "draft"}}`: "UNSUPPORTED_FILTER",
+        `[]`: "INVALID_BODY",
+    } {
+        rec := doRequest(t, rt, http.MethodPost, "/admin/items/price-adjust", body, admin)
+        if rec.Code != http.StatusBadRequest || errorCode(t, rec) != code {
+            t.Errorf("%s: status %d, body %s; want 400 %s", body, rec.Code, rec.Body, code)
+        }
+    }
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+const maxPriceErrorNotesLength = 1000
+
+// The statuses of a price error report.
+const (
+    priceErrorPending  = "pending"
+    priceErrorAccepted = "accepted"
+    priceErrorRejected = "rejected"
+)
+
+type priceErrorReport struct {
+    ID            int64      `json:"id"`
+    ItemID        int        `json:"item_id"`
+    ReporterID    *string    `json:"reporter_id"`
+    ReportedPrice float64    `json:"reported_price"`
+    CorrectPrice  float64    `json:"correct_price"`
+    Notes         string     `json:"notes"`
+    Status        string     `json:"status"`
+    CreatedAt     time.Time  `json:"created_at"`
+    ResolvedAt    *time.Time `json:"resolved_at,omitempty"`
+    ResolvedBy    *string    `json:"resolved_by,omitempty"`
+}
+
+type priceErrorRequest struct {
+    ReportedPrice *float64 `json:"reported_price"`
+    CorrectPrice  *float64 `json:"correct_price"`
+    Notes         string   `json:"notes"`
+}
+
+type priceErrorResolution struct {
+    Action string `json:"action"`
+}
+
+const priceErrorColumns = `id, item_id, reporter_id, reported_price, correct_price, notes, status, created_at, resolved_at, resolved_by`
+
+func scanPriceErrorReport(row interface{ Scan(...interface{}) error }) (priceErrorReport, error) {
+    var report priceErrorReport
+    var reporterID, resolvedBy sql.NullString
+    var resolvedAt sql.NullTime
+    err := row.Scan(&report.ID, &report.ItemID, &reporterID, &report.ReportedPrice, &report.CorrectPrice, &report.Notes,
+        &report.Status, &report.CreatedAt, &resolvedAt, &resolvedBy)
+    if reporterID.Valid {
+        report.ReporterID = &reporterID.String
+    }
+    if resolvedAt.Valid {
+        report.ResolvedAt = &resolvedAt.Time
+    }
+    if resolvedBy.Valid {
+        report.ResolvedBy = &resolvedBy.String
+    }
+    return report, err
+}
+
+// flagPriceError reports that the price of one of the tenant's live items is
+// wrong. An admin resolves the report with PUT /admin/price-errors/{id}.
+func flagPriceError(w http.ResponseWriter, r *http.Request) error {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "flagPriceError", tracer.ResourceName("INSERT INTO price_error_reports"))
+    defer span.Finish()
+
+    id, err := parseItemID(r.PathValue("id"))
+    if err != nil {
+        return &ValidationError{Code: "INVALID_ID", Message: "Invalid item ID"}
+    }
+    var req priceErrorRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        return bodyError(err, "Request body is not valid JSON")
+    }
+    if req.ReportedPrice == nil || req.CorrectPrice == nil {
+        return &ValidationError{Code: "INVALID_BODY", Message: "reported_price and correct_price are required"}
+    }
+    if *req.CorrectPrice < minItemPrice || *req.CorrectPrice > maxItemPrice {
+        return &priceRangeError{Min: minItemPrice, Max: maxItemPrice}
+    }
+    if *req.ReportedPrice == *req.CorrectPrice {
+        return &ValidationError{Code: "INVALID_BODY", Message: "correct_price must differ from reported_price"}
+    }
+    req.Notes = strings.TrimSpace(req.Notes)
+    if len(req.Notes) > maxPriceErrorNotesLength {
+        return &ValidationError{Code: "INVALID_BODY", Message: fmt.Sprintf("notes must be at most %d characters", maxPriceErrorNotesLength)}
+    }
+
+    tenantID := tenantFromContext(ctx)
+    var exists bool
+    err = db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM items WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL)`, id, tenantID).Scan(&exists)
+    if err != nil {
+        return err
+    }
+    if !exists {
+        return &NotFoundError{Resource: "Item"}
+    }
+
+    reporterID := userIDFromContext(ctx)
+    report, err := scanPriceErrorReport(db.QueryRowContext(ctx, `INSERT INTO price_error_reports
+            (tenant_id, item_id, reporter_id, reported_price, correct_price, notes)
+        VALUES ($1, $2, $3, $4, $5, $6) RETURNING `+priceErrorColumns,
+        tenantID, id, sql.NullString{String: reporterID, Valid: reporterID != ""}, *req.ReportedPrice, *req.CorrectPrice, req.Notes))
+    if err != nil {
+        return err
+    }
+    writeJSON(w, http.StatusCreated, report)
+    return nil
+}
+
+// listPriceErrors lists the tenant's price error reports with ?status=
+// (default pending), oldest first.
+func listPriceErrors(w http.ResponseWriter, r *http.Request) error {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "listPriceErrors", tracer.ResourceName("SELECT FROM price_error_reports"))
+    defer span.Finish()
+
+    status := r.URL.Query().Get("status")
+    switch status {
+    case "":
+        status = priceErrorPending
+    case priceErrorPending, priceErrorAccepted, priceErrorRejected:
+    default:
+        return &ValidationError{Code: "INVALID_QUERY", Message: "status must be pending, accepted or rejected"}
+    }
+    limit, offset, err := parsePagination(r)
+    if err != nil {
+        return &ValidationError{Code: "INVALID_PAGINATION", Message: err.Error()}
+    }
+
+    rows, err := queryRead(r, `SELECT `+priceErrorColumns+` FROM price_error_reports
+        WHERE tenant_id = $1 AND status = $2 ORDER BY created_at, id LIMIT $3 OFFSET $4`, tenantFromContext(ctx), status, limit, offset)
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+    reports := []priceErrorReport{}
+    for rows.Next() {
+        report, err := scanPriceErrorReport(rows)
+        if err != nil {
+            return err
+        }
+        reports = append(reports, report)
+    }
+    if err := rows.Err(); err != nil {
+        return err
+    }
+
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "reports": reports,
+        "status":  status,
+        "limit":   limit,
+        "offset":  offset,
+    })
+    return nil
+}
+
+// resolvePriceError accepts or rejects a pending report. Accepting sets the
+// item's price to the report's correct_price, audited and recorded in the
+// price history, in the transaction that resolves the report.
+func (app *App) resolvePriceError(w http.ResponseWriter, r *http.Request) error {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "resolvePriceError", tracer.ResourceName("UPDATE price_error_reports"))
+    defer span.Finish()
+
+    id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+    if err != nil || id <= 0 {
+        return &ValidationError{Code: "INVALID_ID", Message: "Invalid report ID"}
+    }
+    var req priceErrorResolution
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        return bodyError(err, "Request body is not valid JSON")
+    }
+    var status string
+    switch req.Action {
+    case "accept":
+        status = priceErrorAccepted
+    case "reject":
+        status = priceErrorRejected
+    default:
+        return &ValidationError{Code: "INVALID_BODY", Message: `action must be "accept" or "reject"`}
+    }
+
+    tenantID := tenantFromContext(ctx)
+    tx, err := db.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    report, err := scanPriceErrorReport(tx.QueryRowContext(ctx, `SELECT `+priceErrorColumns+` FROM price_error_reports
+        WHERE id = $1 AND tenant_id = $2 FOR UPDATE`, id, tenantID))
+    if err == sql.ErrNoRows {
+        return &NotFoundError{Resource: "Price error report"}
+    }
+    if err != nil {
+        return err
+    }
+    if report.Status != priceErrorPending {
+        return &ConflictError{Code: "REPORT_RESOLVED", Message: "The report was already " + report.Status}
+    }
+
+    var old, item Item
+    if status == priceErrorAccepted {
+        if report.CorrectPrice < minItemPrice || report.CorrectPrice > maxItemPrice {
+            return &priceRangeError{Min: minItemPrice, Max: maxItemPrice}
+        }
+        old, err = app.stmts.lockItem(ctx, tx, tenantID, report.ItemID)
+        if err == sql.ErrNoRows {
+            return &NotFoundError{Resource: "Item"}
+        }
+        if err != nil {
+            return err
+        }
+        item = old
+        err = tx.QueryRowContext(ctx, `UPDATE items SET price = $1, version = version + 1 WHERE id = $2 AND tenant_id = $3
+            RETURNING price, version`, report.CorrectPrice, report.ItemID, tenantID).Scan(&item.Price, &item.Version)
+        if err != nil {
+            return err
+        }
+        if err := recordAudit(ctx, tx, item.ID, auditUpdate, old, item); err != nil {
+            return err
+        }
+        reason := fmt.Sprintf("Price error report %d", report.ID)
+        if err := recordPriceChange(ctx, tx, item.ID, old.Price, item.Price, reason); err != nil {
+            return err
+        }
+    }
+
+    resolvedBy := userIDFromContext(ctx)
+    report, err = scanPriceErrorReport(tx.QueryRowContext(ctx, `UPDATE price_error_reports
+        SET status = $1, resolved_at = NOW(), resolved_by = $2 WHERE id = $3 RETURNING `+priceErrorColumns,
+        status, sql.NullString{String: resolvedBy, Valid: resolvedBy != ""}, id))
+    if err != nil {
+        return err
+    }
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+    if status == priceErrorAccepted {
+        evictItem(item.ID)
+        if item.Price != old.Price {
+            priceChanges.Publish(priceChange{ItemID: item.ID, Old: old.Price, New: item.Price})
+        }
+        notifyItemChange(ctx, eventItemUpdated, item)
+    }
+
+    writeJSON(w, http.StatusOK, report)
+    return nil
+}
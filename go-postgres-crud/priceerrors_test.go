@@ -0,0 +1,154 @@
+package main
+
+import (
+    "net/http"
+    "testing"
+    "time"
+
+    "github.com/DATA-DOG/go-sqlmock"
+    "github.com/golang-jwt/jwt/v5"
+)
+
+var priceErrorRowColumns = []string{"id", "item_id", "reporter_id", "reported_price", "correct_price", "notes", "status", "created_at", "resolved_at", "resolved_by"}
+
+func TestFlagPriceError(t *testing.T) {
+    mock := mockDB(t)
+    rt := newTestRouter(NewApp(storedItems(), nil, NewFeatureFlags(nil), nil))
+    createdAt := time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+    mock.ExpectQuery(`SELECT EXISTS`).WithArgs(7, defaultTenantID).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+    mock.ExpectQuery(`INSERT INTO price_error_reports`).
+        WithArgs(defaultTenantID, 7, "test-user", 9.99, 14.99, "Mistyped decimal").
+        WillReturnRows(sqlmock.NewRows(priceErrorRowColumns).
+            AddRow(1, 7, "test-user", 9.99, 14.99, "Mistyped decimal", priceErrorPending, createdAt, nil, nil))
+
+    body := map[string]interface{}{"reported_price": 9.99, "correct_price": 14.99, "notes": " Mistyped decimal "}
+    rec := doRequest(t, rt, http.MethodPost, "/items/7/flag-price-error", body, testToken(t, nil))
+    var got priceErrorReport
+    decodeBody(t, rec, &got)
+    if rec.Code != http.StatusCreated || got.ID != 1 || got.Status != priceErrorPending || got.ReporterID == nil || *got.ReporterID != "test-user" {
+        t.Errorf("status %d, body %s; want the pending report by test-user", rec.Code, rec.Body)
+    }
+
+    t.Run("missing item", func(t *testing.T) {
+        mock := mockDB(t)
+        mock.ExpectQuery(`SELECT EXISTS`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+        rec := doRequest(t, rt, http.MethodPost, "/items/7/flag-price-error", body, testToken(t, nil))
+        if rec.Code != http.StatusNotFound {
+            t.Errorf("status %d, body %s; want 404", rec.Code, rec.Body)
+        }
+    })
+
+    t.Run("invalid", func(t *testing.T) {
+        mockDB(t)
+        for body, want := range map[string]int{
+            `{"correct_price": 14.99}`:                           http.StatusBadRequest,
+            `{"reported_price": 9.99, "correct_price": 9.99}`:    http.StatusBadRequest,
+            `{"reported_price": 9.99, "correct_price": 0}`:       http.StatusUnprocessableEntity,
+            `{"reported_price": 9.99, "correct_price": 1e9}`:     http.StatusUnprocessableEntity,
+            `{"reported_price": "9.99", "correct_price": 14.99}`: http.StatusBadRequest,
+        } {
+            if rec := doRequest(t, rt, http.MethodPost, "/items/7/flag-price-error", body, testToken(t, nil)); rec.Code != want {
+                t.Errorf("%s: status %d, body %s; want %d", body, rec.Code, rec.Body, want)
+            }
+        }
+    })
+}
+
+func TestListPriceErrors(t *testing.T) {
+    mock := mockDB(t)
+    rt := newTestRouter(NewApp(storedItems(), nil, NewFeatureFlags(nil), nil))
+    admin := testToken(t, jwt.MapClaims{"role": "admin"})
+    mock.ExpectQuery(`FROM price_error_reports\s+WHERE tenant_id = \$1 AND status = \$2 ORDER BY created_at, id`).
+        WithArgs(defaultTenantID, priceErrorPending, defaultPageLimit, 0).
+        WillReturnRows(sqlmock.NewRows(priceErrorRowColumns).
+            AddRow(1, 7, nil, 9.99, 14.99, "", priceErrorPending, time.Now(), nil, nil))
+
+    rec := doRequest(t, rt, http.MethodGet, "/admin/price-errors", nil, admin)
+    var got struct {
+        Reports []priceErrorReport `json:"reports"`
+        Status  string             `json:"status"`
+    }
+    decodeBody(t, rec, &got)
+    if rec.Code != http.StatusOK || len(got.Reports) != 1 || got.Status != priceErrorPending || got.Reports[0].ReporterID != nil {
+        t.Errorf("status %d, body %s; want one pending report without a reporter", rec.Code, rec.Body)
+    }
+
+    if rec := doRequest(t, rt, http.MethodGet, "/admin/price-errors?status=open", nil, admin); rec.Code != http.StatusBadRequest {
+        t.Errorf("?status=open: status %d, want 400", rec.Code)
+    }
+}
+
+func TestResolvePriceError(t *testing.T) {
+    admin := testToken(t, jwt.MapClaims{"role": "admin"})
+    createdAt := time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+    pending := func() *sqlmock.Rows {
+        return sqlmock.NewRows(priceErrorRowColumns).AddRow(3, 7, "reporter", 9.99, 14.99, "", priceErrorPending, createdAt, nil, nil)
+    }
+    resolved := func(status string) *sqlmock.Rows {
+        return sqlmock.NewRows(priceErrorRowColumns).AddRow(3, 7, "reporter", 9.99, 14.99, "", status, createdAt, time.Now(), "test-user")
+    }
+
+    t.Run("accept", func(t *testing.T) {
+        mock := mockDB(t)
+        rt := newStockRouter(t, mock)
+        mock.ExpectBegin()
+        mock.ExpectQuery(`FROM price_error_reports\s+WHERE id = \$1 AND tenant_id = \$2 FOR UPDATE`).WithArgs(3, defaultTenantID).WillReturnRows(pending())
+        mock.ExpectQuery(`FOR UPDATE`).WithArgs(7, defaultTenantID).WillReturnRows(lockedItemRows(Item{ID: 7, Name: "Widget", Price: 9.99, Version: 2}))
+        mock.ExpectQuery(`UPDATE items SET price = \$1, version = version \+ 1`).WithArgs(14.99, 7, defaultTenantID).
+            WillReturnRows(sqlmock.NewRows([]string{"price", "version"}).AddRow(14.99, 3))
+        mock.ExpectExec(`INSERT INTO audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+        mock.ExpectExec(`INSERT INTO item_price_history`).WithArgs(7, 9.99, 14.99, "test-user", "Price error report 3").
+            WillReturnResult(sqlmock.NewResult(1, 1))
+        mock.ExpectQuery(`UPDATE price_error_reports\s+SET status = \$1`).WithArgs(priceErrorAccepted, "test-user", 3).
+            WillReturnRows(resolved(priceErrorAccepted))
+        mock.ExpectCommit()
+        expectWebhookLookup(mock)
+
+        rec := doRequest(t, rt, http.MethodPut, "/admin/price-errors/3", `{"action": "accept"}`, admin)
+        var got priceErrorReport
+        decodeBody(t, rec, &got)
+        if rec.Code != http.StatusOK || got.Status != priceErrorAccepted || got.ResolvedBy == nil {
+            t.Errorf("status %d, body %s; want the accepted report", rec.Code, rec.Body)
+        }
+        awaitExpectations(t, mock)
+    })
+
+    t.Run("reject", func(t *testing.T) {
+        mock := mockDB(t)
+        rt := newStockRouter(t, mock)
+        mock.ExpectBegin()
+        mock.ExpectQuery(`FROM price_error_reports`).WithArgs(3, defaultTenantID).WillReturnRows(pending())
+        mock.ExpectQuery(`UPDATE price_error_reports`).WithArgs(priceErrorRejected, "test-user", 3).WillReturnRows(resolved(priceErrorRejected))
+        mock.ExpectCommit()
+
+        if rec := doRequest(t, rt, http.MethodPut, "/admin/price-errors/3", `{"action": "reject"}`, admin); rec.Code != http.StatusOK {
+            t.Errorf("status %d, body %s; want 200", rec.Code, rec.Body)
+        }
+    })
+
+    t.Run("already resolved", func(t *testing.T) {
+        mock := mockDB(t)
+        rt := newStockRouter(t, mock)
+        mock.ExpectBegin()
+        mock.ExpectQuery(`FROM price_error_reports`).WillReturnRows(resolved(priceErrorRejected))
+        mock.ExpectRollback()
+
+        rec := doRequest(t, rt, http.MethodPut, "/admin/price-errors/3", `{"action": "accept"}`, admin)
+        if rec.Code != http.StatusConflict || errorCode(t, rec) != "REPORT_RESOLVED" {
+            t.Errorf("status %d, body %s; want 409 REPORT_RESOLVED", rec.Code, rec.Body)
+        }
+    })
+
+    t.Run("invalid", func(t *testing.T) {
+        mock := mockDB(t)
+        rt := newStockRouter(t, mock)
+        for target, body := range map[string]string{
+            "/admin/price-errors/abc": `{"action": "accept"}`,
+            "/admin/price-errors/3":   `{"action": "approve"}`,
+        } {
+            if rec := doRequest(t, rt, http.MethodPut, target, body, admin); rec.Code != http.StatusBadRequest {
+                t.Errorf("PUT %s %s: status %d, want 400", target, body, rec.Code)
+            }
+        }
+    })
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "net/http"
+    "time"
+
+    "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+const priceHistoryDateLayout = "2006-01-02"
+
+type priceHistoryEntry struct {
+    ID              int64     `json:"id"`
+    ItemID          int       `json:"item_id"`
+    OldPrice        float64   `json:"old_price"`
+    NewPrice        float64   `json:"new_price"`
+    ChangedAt       time.Time `json:"changed_at"`
+    ChangedByUserID *string   `json:"changed_by_user_id"`
+    Reason          *string   `json:"reason,omitempty"`
+}
+
+// recordPriceChange stores a price change in the mutation's transaction. It
+// does nothing when the price is unchanged. An empty reason is stored as
+// NULL.
+func recordPriceChange(ctx context.Context, tx *sql.Tx, itemID int, oldPrice, newPrice float64, reason string) error {
+    if oldPrice == newPrice {
+        return nil
+    }
+    var userID sql.NullString
+    if id := userIDFromContext(ctx); id != "" {
+        userID = sql.NullString{String: id, Valid: true}
+    }
+    _, err := tx.ExecContext(ctx, `INSERT INTO item_price_history (item_id, old_price, new_price, changed_by_user_id, reason)
+        VALUES ($1, $2, $3, $4, $5)`, itemID, oldPrice, newPrice, userID, sql.NullString{String: reason, Valid: reason != ""})
+    return err
+}
+
+// getPriceHistory lists the price changes of one of the tenant's items,
+// newest first. The optional from and to dates (YYYY-MM-DD) bound the range,
+// both inclusive. Deleted items keep their history.
+func getPriceHistory(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "getPriceHistory", tracer.ResourceName("SELECT FROM item_price_history WHERE item_id = $1"))
+    defer span.Finish()
+
+    id, err := parseItemID(r.PathValue("id"))
+    if err != nil {
+        writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid item ID")
+        return
+    }
+    from, err := parseHistoryDate(r, "from")
+    if err != nil {
+        writeError(w, http.StatusBadRequest, "INVALID_QUERY", err.Error())
+        return
+    }
+    to, err := parseHistoryDate(r, "to")
+    if err != nil {
+        writeError(w, http.StatusBadRequest, "INVALID_QUERY", err.Error())
+        return
+    }
+    if to != nil {
+        // Include the whole of the to date.
+        end := to.AddDate(0, 0, 1)
+        to = &end
+    }
+    if from != nil && to != nil && !from.Before(*to) {
+        writeError(w, http.StatusBadRequest, "INVALID_QUERY", "from must not be after to")
+        return
+    }
+
+    rows, err := queryRead(r, `SELECT h.id, h.item_id, h.old_price, h.new_price, h.changed_at, h.changed_by_user_id, h.reason
+        FROM item_price_history h JOIN items i ON i.id = h.item_id
+        WHERE h.item_id = $1 AND i.tenant_id = $4
+            AND ($2::timestamptz IS NULL OR h.changed_at >= $2) AND ($3::timestamptz IS NULL OR h.changed_at < $3)
+        ORDER BY h.changed_at DESC, h.id DESC`, id, from, to, tenantFromContext(ctx))
+    if err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+    defer rows.Close()
+
+    entries := []priceHistoryEntry{}
+    for rows.Next() {
+        var entry priceHistoryEntry
+        var userID, reason sql.NullString
+        err := rows.Scan(&entry.ID, &entry.ItemID, &entry.OldPrice, &entry.NewPrice, &entry.ChangedAt, &userID, &reason)
+        if err != nil {
+            writeInternalError(w, r, err)
+            return
+        }
+        if userID.Valid {
+            entry.ChangedByUserID = &userID.String
+        }
+        if reason.Valid {
+            entry.Reason = &reason.String
+        }
+        entries = append(entries, entry)
+    }
+    if err := rows.Err(); err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+
+    writeJSON(w, http.StatusOK, map[string]interface{}{"item_id": id, "history": entries})
+}
+
+// parseHistoryDate reads an optional YYYY-MM-DD query parameter as midnight
+// UTC.
+func parseHistoryDate(r *http.Request, name string) (*time.Time, error) {
+    raw := r.URL.Query().Get(name)
+    if raw == "" {
+        return nil, nil
+    }
+    date, err := time.Parse(priceHistoryDateLayout, raw)
+    if err != nil {
+        return nil, fmt.Errorf("%s must be a date like 2024-01-31", name)
+    }
+    return &date, nil
+}
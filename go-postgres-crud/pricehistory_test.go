@@ -0,0 +1,109 @@
+package main
+
+import (
+    "context"
+    "net/http"
+    "testing"
+    "time"
+
+    "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestPriceHistoryRecordsEveryChange(t *testing.T) {
+    mock := mockDB(t)
+    repo := NewPostgresItemRepository(db, mockStatements(t, mock))
+    ctx := withTenant(context.WithValue(context.Background(), userIDKey{}, "test-user"), defaultTenantID)
+
+    // Three updates change the price 10 → 12 → 15 → 9; each records a row.
+    prices := []float64{10, 12, 15, 9}
+    for i := 1; i < len(prices); i++ {
+        mock.ExpectBegin()
+        mock.ExpectQuery(`FOR UPDATE`).WithArgs(1, defaultTenantID).
+            WillReturnRows(lockedItemRows(Item{ID: 1, Name: "Widget", Price: prices[i-1], Version: i}))
+        mock.ExpectQuery(`SELECT reserved_by FROM items`).WillReturnRows(sqlmock.NewRows([]string{"reserved_by"}))
+        mock.ExpectExec(`UPDATE items SET name = \$1`).WillReturnResult(sqlmock.NewResult(0, 1))
+        mock.ExpectExec(`INSERT INTO audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+        mock.ExpectExec(`INSERT INTO item_price_history`).WithArgs(1, prices[i-1], prices[i], "test-user", nil).
+            WillReturnResult(sqlmock.NewResult(int64(i), 1))
+        mock.ExpectCommit()
+
+        if _, _, err := repo.Update(ctx, defaultTenantID, 1, Item{Name: "Widget", Price: prices[i]}); err != nil {
+            t.Fatalf("update %d: %v", i, err)
+        }
+    }
+
+    // An update that keeps the price records nothing.
+    mock.ExpectBegin()
+    mock.ExpectQuery(`FOR UPDATE`).WillReturnRows(lockedItemRows(Item{ID: 1, Name: "Widget", Price: 9, Version: 4}))
+    mock.ExpectQuery(`SELECT reserved_by FROM items`).WillReturnRows(sqlmock.NewRows([]string{"reserved_by"}))
+    mock.ExpectExec(`UPDATE items SET name = \$1`).WillReturnResult(sqlmock.NewResult(0, 1))
+    mock.ExpectExec(`INSERT INTO audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+    mock.ExpectCommit()
+    if _, _, err := repo.Update(ctx, defaultTenantID, 1, Item{Name: "Gadget", Price: 9}); err != nil {
+        t.Fatal(err)
+    }
+
+    now := time.Now().UTC()
+    rows := sqlmock.NewRows([]string{"id", "item_id", "old_price", "new_price", "changed_at", "changed_by_user_id", "reason"})
+    for i := len(prices) - 1; i >= 1; i-- {
+        rows.AddRow(i, 1, prices[i-1], prices[i], now.Add(time.Duration(i)*time.Minute), "test-user", nil)
+    }
+    mock.ExpectQuery(`FROM item_price_history h JOIN items i`).WithArgs(1, nil, nil, defaultTenantID).WillReturnRows(rows)
+
+    rec := doRequest(t, newTestRouter(NewApp(storedItems(), nil, nil, nil)), http.MethodGet, "/items/1/price-history", nil, "")
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+    }
+    var body struct {
+        ItemID  int                 `json:"item_id"`
+        History []priceHistoryEntry `json:"history"`
+    }
+    decodeBody(t, rec, &body)
+    if body.ItemID != 1 || len(body.History) != 3 {
+        t.Fatalf("body = %+v, want the three changes of item 1", body)
+    }
+    for i, entry := range body.History {
+        want := len(prices) - 1 - i
+        if entry.OldPrice != prices[want-1] || entry.NewPrice != prices[want] {
+            t.Errorf("history[%d] = %v → %v, want %v → %v", i, entry.OldPrice, entry.NewPrice, prices[want-1], prices[want])
+        }
+        if entry.ChangedByUserID == nil || *entry.ChangedByUserID != "test-user" {
+            t.Errorf("history[%d] changed by %v, want test-user", i, entry.ChangedByUserID)
+        }
+        if i > 0 && entry.ChangedAt.After(body.History[i-1].ChangedAt) {
+            t.Errorf("history[%d] is newer than the entry before it", i)
+        }
+    }
+}
+
+func TestGetPriceHistoryDateRange(t *testing.T) {
+    mock := mockDB(t)
+    rt := newTestRouter(NewApp(storedItems(), nil, nil, nil))
+    from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+    // The to date is inclusive, so the query bound is the following midnight.
+    to := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+    mock.ExpectQuery(`FROM item_price_history`).WithArgs(1, from, to, defaultTenantID).
+        WillReturnRows(sqlmock.NewRows([]string{"id", "item_id", "old_price", "new_price", "changed_at", "changed_by_user_id", "reason"}))
+
+    rec := doRequest(t, rt, http.MethodGet, "/items/1/price-history?from=2024-01-01&to=2024-12-31", nil, "")
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+    }
+    var body struct {
+        History []priceHistoryEntry `json:"history"`
+    }
+    decodeBody(t, rec, &body)
+    if body.History == nil || len(body.History) != 0 {
+        t.Errorf("history = %v, want an empty list", body.History)
+    }
+}
+
+func TestGetPriceHistoryInvalidDates(t *testing.T) {
+    for _, query := range []string{"from=2024-13-01", "to=yesterday", "from=2024-06-01&to=2024-05-31"} {
+        mockDB(t)
+        rec := doRequest(t, newTestRouter(NewApp(storedItems(), nil, nil, nil)), http.MethodGet, "/items/1/price-history?"+query, nil, "")
+        if rec.Code != http.StatusBadRequest || errorCode(t, rec) != "INVALID_QUERY" {
+            t.Errorf("%s: status %d, body %s; want 400 INVALID_QUERY", query, rec.Code, rec.Body)
+        }
+    }
+}
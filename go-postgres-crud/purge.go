@@ -0,0 +1,81 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "log/slog"
+    "time"
+
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/promauto"
+    "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+var itemsPurgedTotal = promauto.NewCounter(prometheus.CounterOpts{
+    Name: "items_purged_total",
+    Help: "Number of soft-deleted items permanently removed by the purge worker.",
+})
+
+// startPurgeWorker permanently deletes items that were soft-deleted more than
+// retention ago, once every interval, along with expired idempotency keys.
+// The returned stop function cancels the worker, including a purge in
+// progress, and waits for it to exit.
+func startPurgeWorker(db *sql.DB, retention time.Duration, interval time.Duration) (stop func()) {
+    ctx, cancel := context.WithCancel(context.Background())
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+        for {
+            select {
+            case <-ctx.Done():
+                return
+            case <-ticker.C:
+                purgeDeletedItems(ctx, db, retention)
+                purgeIdempotencyKeys(ctx, db)
+            }
+        }
+    }()
+    return func() {
+        cancel()
+        <-done
+    }
+}
+
+func purgeDeletedItems(ctx context.Context, db *sql.DB, retention time.Duration) {
+    span, ctx := tracer.StartSpanFromContext(ctx, "purgeDeletedItems", tracer.ResourceName("DELETE FROM items WHERE deleted_at < NOW() - $1::interval"))
+    defer span.Finish()
+
+    sqlStatement := `DELETE FROM items WHERE deleted_at IS NOT NULL AND deleted_at < NOW() - $1::interval`
+    result, err := db.ExecContext(ctx, sqlStatement, fmt.Sprintf("%d seconds", int64(retention.Seconds())))
+    if err == nil {
+        var purged int64
+        purged, err = result.RowsAffected()
+        if err == nil {
+            itemsPurgedTotal.Add(float64(purged))
+            slog.Info("purged soft-deleted items", "purged", purged, "retention", retention.String())
+            return
+        }
+    }
+    if ctx.Err() != nil {
+        return
+    }
+    span.SetTag("error", err)
+    slog.Error("purging soft-deleted items failed", "error", err)
+}
+
+// purgeIdempotencyKeys drops stored responses that can no longer be replayed.
+func purgeIdempotencyKeys(ctx context.Context, db *sql.DB) {
+    result, err := db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE created_at <= NOW() - $1::interval`, idempotencyWindow)
+    if err != nil {
+        if ctx.Err() == nil {
+            slog.Error("purging idempotency keys failed", "error", err)
+        }
+        return
+    }
+    if purged, err := result.RowsAffected(); err == nil && purged > 0 {
+        slog.Info("purged expired idempotency keys", "purged", purged)
+    }
+}
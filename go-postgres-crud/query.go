@@ -0,0 +1,237 @@
+package main
+
+import (
+    "fmt"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+
+    "github.com/google/uuid"
+)
+
+// ItemFilters are the list options of GET /items. Nil price bounds and empty
+// strings do not constrain the result.
+type ItemFilters struct {
+    // TenantID confines the result to one tenant's items. The repository
+    // sets it; it is not a query parameter.
+    TenantID uuid.UUID
+    Q        string
+    Name     string
+    // Category is a category slug.
+    Category string
+    MinPrice *float64
+    MaxPrice *float64
+    // Metadata requires metadata->>key = value for every entry.
+    Metadata map[string]string
+    // FullText selects the full-text search clause for Q instead of ILIKE.
+    FullText bool
+    // Sort is a key of itemSortOrders; empty means ordering by ID.
+    Sort   string
+    Limit  int
+    Offset int
+    // Keyset selects cursor pagination ordered by (created_at, id). After is
+    // the position to continue from; nil starts at the first item.
+    Keyset bool
+    After  *itemCursor
+}
+
+// itemSortOrders maps the accepted ?sort= values to ORDER BY clauses. User
+// input is only ever used as a key, never spliced into SQL. The trailing id
+// keeps pagination stable between rows with equal sort values.
+var itemSortOrders = map[string]string{
+    "":                "id",
+    "price_asc":       "price ASC, id",
+    "price_desc":      "price DESC, id",
+    "name_asc":        "name ASC, id",
+    "name_desc":       "name DESC, id",
+    "created_at_desc": "created_at DESC, id",
+}
+
+// defaultItemSort is the key of itemSortOrders used when a request names no
+// ?sort=. It is set from DEFAULT_SORT_BY and DEFAULT_SORT_ORDER at startup.
+var defaultItemSort = ""
+
+// parseDefaultSort turns a sort field and order, as in DEFAULT_SORT_BY=price
+// and DEFAULT_SORT_ORDER=desc, into a key of itemSortOrders. The order
+// defaults to asc; an empty field, or id ascending, is the ordering by ID.
+func parseDefaultSort(by, order string) (string, error) {
+    by, order = strings.ToLower(strings.TrimSpace(by)), strings.ToLower(strings.TrimSpace(order))
+    if by == "" && order != "" {
+        return "", fmt.Errorf("DEFAULT_SORT_ORDER needs DEFAULT_SORT_BY")
+    }
+    if order == "" {
+        order = "asc"
+    }
+    if by == "" || (by == "id" && order == "asc") {
+        return "", nil
+    }
+    key := by + "_" + order
+    if _, ok := itemSortOrders[key]; !ok {
+        return "", fmt.Errorf("DEFAULT_SORT_BY and DEFAULT_SORT_ORDER must make one of %s, got %s", strings.Join(sortKeys(), ", "), key)
+    }
+    return key, nil
+}
+
+// parseItemFilters reads ?q=, ?name=, ?category=, ?min_price=, ?max_price=,
+// ?meta.<key>=, ?sort= and the pagination parameters. Any ?after=, even an
+// empty one, switches to keyset pagination; otherwise a missing ?sort= means
+// defaultItemSort.
+func parseItemFilters(r *http.Request) (ItemFilters, error) {
+    query := r.URL.Query()
+    limit, offset, err := parsePagination(r)
+    if err != nil {
+        return ItemFilters{}, err
+    }
+    filters := ItemFilters{
+        Q:        strings.TrimSpace(query.Get("q")),
+        Name:     strings.TrimSpace(query.Get("name")),
+        Category: strings.TrimSpace(query.Get("category")),
+        Sort:     query.Get("sort"),
+        Limit:    limit,
+        Offset:   offset,
+    }
+    if _, ok := itemSortOrders[filters.Sort]; !ok {
+        return ItemFilters{}, fmt.Errorf("sort must be one of %s", strings.Join(sortKeys(), ", "))
+    }
+    if query.Has("after") {
+        if query.Has("offset") || filters.Sort != "" {
+            return ItemFilters{}, fmt.Errorf("after cannot be combined with offset or sort")
+        }
+        filters.Keyset = true
+        if raw := query.Get("after"); raw != "" {
+            cursor, err := decodeItemCursor(raw)
+            if err != nil {
+                return ItemFilters{}, err
+            }
+            filters.After = &cursor
+        }
+    } else if filters.Sort == "" {
+        filters.Sort = defaultItemSort
+    }
+    for _, bound := range []struct {
+        key  string
+        dest **float64
+    }{{"min_price", &filters.MinPrice}, {"max_price", &filters.MaxPrice}} {
+        raw := query.Get(bound.key)
+        if raw == "" {
+            continue
+        }
+        value, err := strconv.ParseFloat(raw, 64)
+        if err != nil || value < 0 {
+            return ItemFilters{}, fmt.Errorf("%s must be a non-negative number", bound.key)
+        }
+        *bound.dest = &value
+    }
+    if filters.MinPrice != nil && filters.MaxPrice != nil && *filters.MinPrice > *filters.MaxPrice {
+        return ItemFilters{}, fmt.Errorf("min_price must not exceed max_price")
+    }
+    for param, values := range query {
+        key, ok := strings.CutPrefix(param, "meta.")
+        if !ok {
+            continue
+        }
+        if key == "" {
+            return ItemFilters{}, fmt.Errorf("meta. parameters must name a metadata key, e.g. meta.color")
+        }
+        if filters.Metadata == nil {
+            filters.Metadata = map[string]string{}
+        }
+        filters.Metadata[key] = values[0]
+    }
+    return filters, nil
+}
+
+// itemsWhereClause returns the WHERE clause that selects the tenant's live
+// items matching filters, and its bind arguments, starting at $1.
+func itemsWhereClause(filters ItemFilters) (string, []interface{}) {
+    conditions := []string{"tenant_id = $1", "deleted_at IS NULL"}
+    args := []interface{}{filters.TenantID}
+    if filters.Q != "" {
+        args = append(args, filters.Q)
+        conditions = append(conditions, searchClause(filters.FullText, len(args)))
+    }
+    if filters.Name != "" {
+        args = append(args, escapeLike(filters.Name))
+        conditions = append(conditions, fmt.Sprintf("name ILIKE '%%' || $%d || '%%'", len(args)))
+    }
+    if filters.Category != "" {
+        args = append(args, filters.Category)
+        conditions = append(conditions, fmt.Sprintf(`EXISTS (SELECT 1 FROM item_categories ic
+            JOIN categories c ON c.id = ic.category_id WHERE ic.item_id = items.id AND c.slug = $%d)`, len(args)))
+    }
+    if filters.MinPrice != nil {
+        args = append(args, *filters.MinPrice)
+        conditions = append(conditions, fmt.Sprintf("price >= $%d", len(args)))
+    }
+    if filters.MaxPrice != nil {
+        args = append(args, *filters.MaxPrice)
+        conditions = append(conditions, fmt.Sprintf("price <= $%d", len(args)))
+    }
+    // Sorted so the same filters always produce the same statement.
+    keys := make([]string, 0, len(filters.Metadata))
+    for key := range filters.Metadata {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    for _, key := range keys {
+        args = append(args, key, filters.Metadata[key])
+        conditions = append(conditions, fmt.Sprintf("metadata->>$%d = $%d", len(args)-1, len(args)))
+    }
+    return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// buildItemsCountQuery counts every item matching filters, ignoring
+// pagination.
+func buildItemsCountQuery(filters ItemFilters) (string, []interface{}) {
+    where, args := itemsWhereClause(filters)
+    return "SELECT COUNT(*) FROM items" + where, args
+}
+
+// buildItemsQuery builds the SELECT used by getItems for one page of results.
+func buildItemsQuery(filters ItemFilters) (string, []interface{}) {
+    sqlStatement, args := buildItemsExportQuery(filters)
+    args = append(args, filters.Limit, filters.Offset)
+    return fmt.Sprintf("%s LIMIT $%d OFFSET $%d", sqlStatement, len(args)-1, len(args)), args
+}
+
+// buildItemsKeysetQuery builds the SELECT for one keyset page. It reads one
+// row past the limit so the caller can tell whether another page follows,
+// and selects created_at last for the next cursor.
+func buildItemsKeysetQuery(filters ItemFilters) (string, []interface{}) {
+    where, args := itemsWhereClause(filters)
+    if filters.After != nil {
+        args = append(args, filters.After.CreatedAt, filters.After.ID)
+        where += fmt.Sprintf(" AND (created_at, id) > ($%d, $%d)", len(args)-1, len(args))
+    }
+    args = append(args, filters.Limit+1)
+    return fmt.Sprintf("SELECT id, name, description, price, version, COALESCE(image_url, ''), COALESCE(sku, ''), metadata, created_at FROM items%s ORDER BY created_at, id LIMIT $%d", where, len(args)), args
+}
+
+// buildItemsExportQuery selects every item matching filters, in sort order,
+// without pagination.
+func buildItemsExportQuery(filters ItemFilters) (string, []interface{}) {
+    where, args := itemsWhereClause(filters)
+    orderBy, ok := itemSortOrders[filters.Sort]
+    if !ok {
+        orderBy = itemSortOrders[""]
+    }
+    return fmt.Sprintf("SELECT id, name, description, price, version, COALESCE(image_url, ''), COALESCE(sku, ''), metadata FROM items%s ORDER BY %s", where, orderBy), args
+}
+
+// sortKeys lists the named ?sort= values in a stable order for error messages.
+func sortKeys() []string {
+    keys := make([]string, 0, len(itemSortOrders))
+    for key := range itemSortOrders {
+        if key != "" {
+            keys = append(keys, key)
+        }
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+// escapeLike escapes the ILIKE wildcards in s so it matches literally.
+func escapeLike(s string) string {
+    return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
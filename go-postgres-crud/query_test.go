@@ -0,0 +1,291 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "reflect"
+    "regexp"
+    "sort"
+    "strings"
+    "testing"
+
+    "github.com/google/uuid"
+    "github.com/lib/pq"
+)
+
+func TestBuildItemsQuery(t *testing.T) {
+    const selectItems = "SELECT id, name, description, price, version, COALESCE(image_url, ''), COALESCE(sku, ''), metadata FROM items"
+    tenant := uuid.MustParse("7d444840-9dc0-11d1-b245-5ffdce74fad2")
+    five, fifty := 5.0, 50.0
+
+    tests := []struct {
+        name     string
+        filters  ItemFilters
+        wantSQL  string
+        wantArgs []interface{}
+    }{
+        {
+            name:     "no filters",
+            filters:  ItemFilters{TenantID: tenant, Limit: 20},
+            wantSQL:  selectItems + " WHERE tenant_id = $1 AND deleted_at IS NULL ORDER BY id LIMIT $2 OFFSET $3",
+            wantArgs: []interface{}{tenant, 20, 0},
+        },
+        {
+            name:     "name is escaped for ILIKE",
+            filters:  ItemFilters{TenantID: tenant, Name: "50%_off", Limit: 20, Offset: 40},
+            wantSQL:  selectItems + ` WHERE tenant_id = $1 AND deleted_at IS NULL AND name ILIKE '%' || $2 || '%' ORDER BY id LIMIT $3 OFFSET $4`,
+            wantArgs: []interface{}{tenant, `50\%\_off`, 20, 40},
+        },
+        {
+            name:    "full-text search",
+            filters: ItemFilters{TenantID: tenant, Q: "blue", FullText: true, Limit: 10},
+            wantSQL: selectItems + ` WHERE tenant_id = $1 AND deleted_at IS NULL AND ` +
+                `to_tsvector('english', name || ' ' || description) @@ plainto_tsquery('english', $2) ORDER BY id LIMIT $3 OFFSET $4`,
+            wantArgs: []interface{}{tenant, "blue", 10, 0},
+        },
+        {
+            name:    "search without the full-text index",
+            filters: ItemFilters{TenantID: tenant, Q: "blue", Limit: 10},
+            wantSQL: selectItems + ` WHERE tenant_id = $1 AND deleted_at IS NULL AND ` +
+                `(name ILIKE '%' || $2 || '%' OR description ILIKE '%' || $2 || '%') ORDER BY id LIMIT $3 OFFSET $4`,
+            wantArgs: []interface{}{tenant, "blue", 10, 0},
+        },
+        {
+            name:     "price range",
+            filters:  ItemFilters{TenantID: tenant, MinPrice: &five, MaxPrice: &fifty, Sort: "price_desc", Limit: 20},
+            wantSQL:  selectItems + " WHERE tenant_id = $1 AND deleted_at IS NULL AND price >= $2 AND price <= $3 ORDER BY price DESC, id LIMIT $4 OFFSET $5",
+            wantArgs: []interface{}{tenant, 5.0, 50.0, 20, 0},
+        },
+        {
+            name:     "only a maximum price",
+            filters:  ItemFilters{TenantID: tenant, MaxPrice: &fifty, Limit: 20},
+            wantSQL:  selectItems + " WHERE tenant_id = $1 AND deleted_at IS NULL AND price <= $2 ORDER BY id LIMIT $3 OFFSET $4",
+            wantArgs: []interface{}{tenant, 50.0, 20, 0},
+        },
+        {
+            name: "every filter",
+            filters: ItemFilters{
+                TenantID: tenant, Q: "blue", FullText: true, Name: "widget", MinPrice: &five, MaxPrice: &fifty,
+                Metadata: map[string]string{"size": "L", "color": "red"}, Sort: "name_asc", Limit: 20, Offset: 20,
+            },
+            wantSQL: selectItems + ` WHERE tenant_id = $1 AND deleted_at IS NULL AND ` +
+                `to_tsvector('english', name || ' ' || description) @@ plainto_tsquery('english', $2) AND ` +
+                `name ILIKE '%' || $3 || '%' AND price >= $4 AND price <= $5 AND ` +
+                `metadata->>$6 = $7 AND metadata->>$8 = $9 ORDER BY name ASC, id LIMIT $10 OFFSET $11`,
+            wantArgs: []interface{}{tenant, "blue", "widget", 5.0, 50.0, "color", "red", "size", "L", 20, 20},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            gotSQL, gotArgs := buildItemsQuery(tt.filters)
+            if gotSQL != tt.wantSQL {
+                t.Errorf("SQL =\n%s\nwant\n%s", gotSQL, tt.wantSQL)
+            }
+            if !reflect.DeepEqual(gotArgs, tt.wantArgs) {
+                t.Errorf("args = %v, want %v", gotArgs, tt.wantArgs)
+            }
+        })
+    }
+}
+
+func TestBuildItemsCountQueryIgnoresPagination(t *testing.T) {
+    five := 5.0
+    gotSQL, gotArgs := buildItemsCountQuery(ItemFilters{TenantID: defaultTenantID, MinPrice: &five, Sort: "price_asc", Limit: 20, Offset: 40})
+    wantSQL := "SELECT COUNT(*) FROM items WHERE tenant_id = $1 AND deleted_at IS NULL AND price >= $2"
+    if gotSQL != wantSQL || !reflect.DeepEqual(gotArgs, []interface{}{defaultTenantID, 5.0}) {
+        t.Errorf("buildItemsCountQuery = %q, %v", gotSQL, gotArgs)
+    }
+}
+
+func TestGetItemsRejectsUnknownSort(t *testing.T) {
+    for _, sort := range []string{
+        "price_asc; DROP TABLE items",
+        "price_asc;DROP TABLE items--",
+        "price",
+        "PRICE_ASC",
+        "id ASC",
+        "(SELECT 1)",
+    } {
+        t.Run(sort, func(t *testing.T) {
+            repo := storedItems()
+            target := "/items?" + url.Values{"sort": {sort}}.Encode()
+            rec := doRequest(t, newMockApp(t, repo), http.MethodGet, target, nil, "")
+            if rec.Code != http.StatusBadRequest || errorCode(t, rec) != "INVALID_QUERY" {
+                t.Errorf("status %d, body %s; want 400 INVALID_QUERY", rec.Code, rec.Body)
+            }
+            if calls := repo.Calls(); len(calls) != 0 {
+                t.Errorf("repository calls = %+v, want none", calls)
+            }
+        })
+    }
+}
+
+func TestGetItemsSortOrders(t *testing.T) {
+    for sort := range itemSortOrders {
+        var got ItemFilters
+        repo := &MockItemRepository{GetAllFunc: func(ctx context.Context, filters ItemFilters) (itemPage, error) {
+            got = filters
+            return itemPage{Items: []Item{}}, nil
+        }}
+        rec := doRequest(t, newMockApp(t, repo), http.MethodGet, "/items?sort="+sort+"&limit=5&offset=10", nil, "")
+        if rec.Code != http.StatusOK || got.Sort != sort || got.Limit != 5 || got.Offset != 10 {
+            t.Errorf("sort=%s: status %d, filters %+v", sort, rec.Code, got)
+        }
+        if query, _ := buildItemsQuery(got); !strings.Contains(query, "ORDER BY "+itemSortOrders[sort]+" LIMIT") {
+            t.Errorf("sort=%s: query %q lacks ORDER BY %s", sort, query, itemSortOrders[sort])
+        }
+    }
+}
+
+func TestParseDefaultSort(t *testing.T) {
+    tests := []struct {
+        by, order string
+        want      string
+        wantErr   bool
+    }{
+        {"", "", "", false},
+        {"id", "", "", false},
+        {"price", "", "price_asc", false},
+        {"Price", "DESC", "price_desc", false},
+        {"created_at", "desc", "created_at_desc", false},
+        {"created_at", "asc", "", true},
+        {"id", "desc", "", true},
+        {"stock", "asc", "", true},
+        {"", "desc", "", true},
+    }
+    for _, tt := range tests {
+        got, err := parseDefaultSort(tt.by, tt.order)
+        if got != tt.want || (err != nil) != tt.wantErr {
+            t.Errorf("parseDefaultSort(%q, %q) = %q, %v; want %q, error %t", tt.by, tt.order, got, err, tt.want, tt.wantErr)
+        }
+    }
+}
+
+func TestGetItemsDefaultSort(t *testing.T) {
+    defaultItemSort = "name_asc"
+    t.Cleanup(func() { defaultItemSort = "" })
+
+    var got ItemFilters
+    repo := &MockItemRepository{
+        GetAllFunc: func(ctx context.Context, filters ItemFilters) (itemPage, error) {
+            got = filters
+            return itemPage{Items: []Item{}}, nil
+        },
+        GetAfterFunc: func(ctx context.Context, filters ItemFilters) (itemCursorPage, error) {
+            got = filters
+            return itemCursorPage{Items: []Item{}}, nil
+        },
+    }
+    rt := newMockApp(t, repo)
+    for target, want := range map[string]string{
+        "/items":                 "name_asc",
+        "/items?sort=price_desc": "price_desc",
+        // Keyset pages always run in (created_at, id) order.
+        "/items?after=": "",
+    } {
+        if rec := doRequest(t, rt, http.MethodGet, target, nil, ""); rec.Code != http.StatusOK || got.Sort != want {
+            t.Errorf("GET %s: status %d, sort %q; want %q", target, rec.Code, got.Sort, want)
+        }
+    }
+}
+
+var placeholderPattern = regexp.MustCompile(`\$(\d+)`)
+
+// neutralFilters replaces every user-supplied value in filters with a fixed
+// one of the same shape, so the statement built from it shows what the
+// statement would be if no input reached the SQL text.
+func neutralFilters(filters ItemFilters) ItemFilters {
+    zero := 0.0
+    for _, field := range []*string{&filters.Q, &filters.Name, &filters.Category} {
+        if *field != "" {
+            *field = "x"
+        }
+    }
+    if filters.MinPrice != nil {
+        filters.MinPrice = &zero
+    }
+    if filters.MaxPrice != nil {
+        filters.MaxPrice = &zero
+    }
+    if filters.Metadata != nil {
+        metadata := map[string]string{}
+        for range filters.Metadata {
+            metadata[fmt.Sprint(len(metadata))] = "x"
+        }
+        filters.Metadata = metadata
+    }
+    return filters
+}
+
+// FuzzGetItemsFilter feeds random ?q=, ?name=, ?min_price=, ?max_price= and
+// ?meta.<key>= values through parseItemFilters and the list queries. Each
+// statement must number its placeholders $1 to $n for its n arguments and
+// match the statement built from neutral values, so no input is spliced
+// into the SQL. With INTEGRATION_TESTS=true Postgres also runs every
+// statement and must not report a syntax error. Run it with
+// go test -fuzz=FuzzGetItemsFilter -fuzztime=30s.
+func FuzzGetItemsFilter(f *testing.F) {
+    for _, seed := range [][5]string{
+        {"", "", "", "", ""},
+        {"blue", "widget", "1", "10", "color"},
+        {"' OR 1=1 --", "50%_off", "0", "1e3", "a'b"},
+        {"'); DROP TABLE items; --", `\' $1`, "-1", "NaN", "$2"},
+        {"\x00", "Robert\"); --", "1e309", "0x10", "meta"},
+    } {
+        f.Add(seed[0], seed[1], seed[2], seed[3], seed[4])
+    }
+    tenant := uuid.New()
+    f.Fuzz(func(t *testing.T, q, name, minPrice, maxPrice, metaKey string) {
+        query := url.Values{}
+        query.Set("q", q)
+        query.Set("name", name)
+        query.Set("min_price", minPrice)
+        query.Set("max_price", maxPrice)
+        query.Set("meta."+metaKey, q)
+        filters, err := parseItemFilters(httptest.NewRequest(http.MethodGet, "/items?"+query.Encode(), nil))
+        if err != nil {
+            return
+        }
+        filters.TenantID = tenant
+        neutral := neutralFilters(filters)
+
+        for _, build := range []func(ItemFilters) (string, []interface{}){buildItemsQuery, buildItemsCountQuery, buildItemsKeysetQuery} {
+            sqlStatement, args := build(filters)
+            numbers := map[string]bool{}
+            for _, match := range placeholderPattern.FindAllStringSubmatch(sqlStatement, -1) {
+                numbers[match[1]] = true
+            }
+            var want []string
+            for i := range args {
+                want = append(want, fmt.Sprint(i+1))
+            }
+            got := make([]string, 0, len(numbers))
+            for number := range numbers {
+                got = append(got, number)
+            }
+            sort.Strings(got)
+            sort.Strings(want)
+            if !reflect.DeepEqual(got, want) {
+                t.Fatalf("%s\nuses placeholders %v for %d arguments", sqlStatement, got, len(args))
+            }
+            if neutralSQL, _ := build(neutral); sqlStatement != neutralSQL {
+                t.Fatalf("input reached the SQL text:\n%s\nwant\n%s", sqlStatement, neutralSQL)
+            }
+            if integration.db == nil {
+                continue
+            }
+            rows, err := integration.db.QueryContext(context.Background(), sqlStatement, args...)
+            if err == nil {
+                rows.Close()
+            }
+            var pqErr *pq.Error
+            if errors.As(err, &pqErr) && pqErr.Code.Name() == "syntax_error" {
+                t.Fatalf("%s\n%v: %v", sqlStatement, args, err)
+            }
+        }
+    })
+}
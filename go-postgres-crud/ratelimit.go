@@ -0,0 +1,78 @@
+package main
+
+import (
+    "math"
+    "net/http"
+    "strconv"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "golang.org/x/time/rate"
+)
+
+// rateLimitCleanupInterval is RATE_LIMIT_CLEANUP_INTERVAL: limiters of
+// clients idle for longer are dropped.
+var rateLimitCleanupInterval = 5 * time.Minute
+
+// rateLimitExemptPaths are probes and scrapes, which must not be throttled.
+var rateLimitExemptPaths = map[string]bool{
+    "/healthz": true,
+    "/metrics": true,
+}
+
+type clientLimiter struct {
+    limiter  *rate.Limiter
+    lastSeen atomic.Int64 // unix nanoseconds
+}
+
+// rateLimitMiddleware gives every client IP its own token bucket refilled at
+// rps with room for burst requests. Clients are identified by realIP, so
+// X-Forwarded-For is only honoured from TRUSTED_PROXY_CIDRS.
+func rateLimitMiddleware(rps float64, burst int) func(http.Handler) http.Handler {
+    var clients sync.Map // string -> *clientLimiter
+    go evictIdleLimiters(&clients, rateLimitCleanupInterval)
+
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if rateLimitExemptPaths[r.URL.Path] {
+                next.ServeHTTP(w, r)
+                return
+            }
+
+            key := "unknown"
+            if ip := realIP(r); ip != nil {
+                key = ip.String()
+            }
+            value, ok := clients.Load(key)
+            if !ok {
+                value, _ = clients.LoadOrStore(key, &clientLimiter{limiter: rate.NewLimiter(rate.Limit(rps), burst)})
+            }
+            client := value.(*clientLimiter)
+            client.lastSeen.Store(time.Now().UnixNano())
+
+            reservation := client.limiter.Reserve()
+            if delay := reservation.Delay(); !reservation.OK() || delay > 0 {
+                reservation.Cancel()
+                w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(math.Max(delay.Seconds(), 1)))))
+                writeError(w, http.StatusTooManyRequests, "RATE_LIMITED", "Too many requests, try again later")
+                return
+            }
+            next.ServeHTTP(w, r)
+        })
+    }
+}
+
+func evictIdleLimiters(clients *sync.Map, interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for range ticker.C {
+        cutoff := time.Now().Add(-interval).UnixNano()
+        clients.Range(func(key, value interface{}) bool {
+            if value.(*clientLimiter).lastSeen.Load() < cutoff {
+                clients.Delete(key)
+            }
+            return true
+        })
+    }
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "sync"
+    "testing"
+    "time"
+
+    "golang.org/x/time/rate"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+    trustProxies(t, "")
+    const burst = 10
+    h := rateLimitMiddleware(1, burst)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+    statuses := map[int]int{}
+    for i := 0; i < 200; i++ {
+        r := httptest.NewRequest(http.MethodGet, "/items", nil)
+        r.RemoteAddr = "203.0.113.1:4711"
+        rec := httptest.NewRecorder()
+        h.ServeHTTP(rec, r)
+        statuses[rec.Code]++
+        if rec.Code == http.StatusTooManyRequests {
+            if retry, err := strconv.Atoi(rec.Header().Get("Retry-After")); err != nil || retry < 1 {
+                t.Fatalf("Retry-After = %q, want a positive number of seconds", rec.Header().Get("Retry-After"))
+            }
+        }
+    }
+    // A token may be refilled while the loop runs, but not more than one.
+    if ok := statuses[http.StatusOK]; ok < burst || ok > burst+1 || statuses[http.StatusTooManyRequests] != 200-ok {
+        t.Errorf("statuses = %v, want %d (or %d) OK and the rest 429", statuses, burst, burst+1)
+    }
+
+    r := httptest.NewRequest(http.MethodGet, "/items", nil)
+    r.RemoteAddr = "198.51.100.7:4711"
+    rec := httptest.NewRecorder()
+    h.ServeHTTP(rec, r)
+    if rec.Code != http.StatusOK {
+        t.Errorf("another client: status = %d, want its own bucket", rec.Code)
+    }
+
+    r = httptest.NewRequest(http.MethodGet, "/healthz", nil)
+    r.RemoteAddr = "203.0.113.1:4711"
+    rec = httptest.NewRecorder()
+    h.ServeHTTP(rec, r)
+    if rec.Code != http.StatusOK {
+        t.Errorf("/healthz of a throttled client: status = %d, want it exempt", rec.Code)
+    }
+}
+
+func TestEvictIdleLimiters(t *testing.T) {
+    var clients sync.Map
+    idle := &clientLimiter{limiter: rate.NewLimiter(1, 1)}
+    idle.lastSeen.Store(time.Now().Add(-time.Hour).UnixNano())
+    clients.Store("203.0.113.1", idle)
+    go evictIdleLimiters(&clients, 10*time.Millisecond)
+
+    deadline := time.Now().Add(time.Second)
+    for time.Now().Before(deadline) {
+        if _, ok := clients.Load("203.0.113.1"); !ok {
+            return
+        }
+        time.Sleep(5 * time.Millisecond)
+    }
+    t.Error("the idle limiter was not evicted")
+}
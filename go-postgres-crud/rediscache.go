@@ -0,0 +1,148 @@
+package main
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "log/slog"
+    "time"
+
+    "github.com/google/uuid"
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/promauto"
+    "github.com/redis/go-redis/v9"
+)
+
+// itemListKeyPrefix starts the key of every cached GET /items page.
+const itemListKeyPrefix = "items:list:"
+
+// redisOpTimeout bounds each cache call, so a slow or unreachable Redis
+// delays a request by at most this long before it goes to the database.
+const redisOpTimeout = 100 * time.Millisecond
+
+// Cache is a byte store shared between server replicas. Lookups and writes
+// never fail the request: an unavailable backend behaves like an empty cache.
+type Cache interface {
+    Get(key string) ([]byte, bool)
+    Set(key string, value []byte, ttl time.Duration)
+    // Delete removes every key matching pattern, a Redis-style glob such as
+    // items:list:*.
+    Delete(pattern string)
+}
+
+// listCache holds GET /items pages for REDIS_CACHE_TTL_SECONDS when REDIS_URL
+// is set; it is nil otherwise. Unlike itemCache it is shared by every
+// replica, so a write on one is seen by the others.
+var (
+    listCache    Cache
+    listCacheTTL = 30 * time.Second
+)
+
+var itemListCacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+    Name: "item_list_cache_requests_total",
+    Help: "Redis cache lookups by GET /items, by result (hit or miss).",
+}, []string{"result"})
+
+// RedisItemCache is the Cache backed by Redis.
+type RedisItemCache struct {
+    client *redis.Client
+}
+
+func NewRedisItemCache(url string) (*RedisItemCache, error) {
+    options, err := redis.ParseURL(url)
+    if err != nil {
+        return nil, err
+    }
+    return &RedisItemCache{client: redis.NewClient(options)}, nil
+}
+
+func (c *RedisItemCache) Get(key string) ([]byte, bool) {
+    ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+    defer cancel()
+    value, err := c.client.Get(ctx, key).Bytes()
+    if err != nil {
+        if err != redis.Nil {
+            slog.Warn("redis cache read failed", "key", key, "error", err)
+        }
+        return nil, false
+    }
+    return value, true
+}
+
+func (c *RedisItemCache) Set(key string, value []byte, ttl time.Duration) {
+    ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+    defer cancel()
+    if err := c.client.Set(ctx, key, value, ttl).Err(); err != nil {
+        slog.Warn("redis cache write failed", "key", key, "error", err)
+    }
+}
+
+// Delete scans for the matching keys rather than using KEYS, so a large
+// keyspace does not block Redis. A failed delete leaves the entries to expire
+// with their TTL.
+func (c *RedisItemCache) Delete(pattern string) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*redisOpTimeout)
+    defer cancel()
+    iter := c.client.Scan(ctx, 0, pattern, 100).Iterator()
+    var keys []string
+    for iter.Next(ctx) {
+        keys = append(keys, iter.Val())
+    }
+    err := iter.Err()
+    if err == nil && len(keys) > 0 {
+        err = c.client.Del(ctx, keys...).Err()
+    }
+    if err != nil {
+        slog.Warn("redis cache delete failed", "pattern", pattern, "error", err)
+    }
+}
+
+func (c *RedisItemCache) Close() error {
+    return c.client.Close()
+}
+
+// itemListCacheKey derives the cache key of a tenant's GET /items page from
+// its parsed filters, so query strings that differ only in parameter order,
+// or in parameters that do not change the result, share an entry.
+func itemListCacheKey(tenantID uuid.UUID, filters ItemFilters) string {
+    filters.TenantID = tenantID
+    raw, _ := json.Marshal(filters)
+    sum := sha256.Sum256(raw)
+    return itemListKeyPrefix + hex.EncodeToString(sum[:])
+}
+
+// cachedItemPage returns the tenant's cached page for filters and records
+// the lookup.
+func cachedItemPage(tenantID uuid.UUID, filters ItemFilters) (itemPage, bool) {
+    if listCache == nil {
+        return itemPage{}, false
+    }
+    var page itemPage
+    raw, ok := listCache.Get(itemListCacheKey(tenantID, filters))
+    if ok && json.Unmarshal(raw, &page) == nil {
+        itemListCacheRequests.WithLabelValues("hit").Inc()
+        return page, true
+    }
+    itemListCacheRequests.WithLabelValues("miss").Inc()
+    return itemPage{}, false
+}
+
+func storeItemPage(tenantID uuid.UUID, filters ItemFilters, page itemPage) {
+    if listCache == nil {
+        return
+    }
+    raw, err := json.Marshal(page)
+    if err != nil {
+        return
+    }
+    listCache.Set(itemListCacheKey(tenantID, filters), raw, listCacheTTL)
+}
+
+// evictItemLists drops every cached GET /items page, since any item change
+// can move items between pages.
+func evictItemLists() {
+    if listCache != nil {
+        listCache.Delete(itemListKeyPrefix + "*")
+    }
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "net/http"
+    "strconv"
+
+    "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+const (
+    defaultRelatedLimit = 5
+    maxRelatedLimit     = 20
+)
+
+// relatedByCategory ranks the live items of tenant $3 by how many categories
+// they share with item $1.
+const relatedByCategory = `SELECT i.id, i.name, i.description, i.price, i.version, COALESCE(i.image_url, ''), COALESCE(i.sku, ''), i.metadata
+    FROM items i
+    JOIN item_categories ic ON ic.item_id = i.id
+    WHERE ic.category_id IN (SELECT category_id FROM item_categories WHERE item_id = $1)
+        AND i.id <> $1 AND i.tenant_id = $3 AND i.deleted_at IS NULL
+    GROUP BY i.id
+    ORDER BY COUNT(*) DESC, i.id
+    LIMIT $2`
+
+// relatedByName ranks the live items of tenant $4 by trigram similarity to
+// name $2. The % operator applies pg_trgm.similarity_threshold and can use
+// items_name_trgm_idx.
+const relatedByName = `SELECT id, name, description, price, version, COALESCE(image_url, ''), COALESCE(sku, ''), metadata
+    FROM items
+    WHERE name % $2 AND id <> $1 AND tenant_id = $4 AND deleted_at IS NULL
+    ORDER BY similarity(name, $2) DESC, id
+    LIMIT $3`
+
+// getRelatedItems lists up to limit (default 5, at most 20) items related to
+// item id: those sharing the most categories with it or, for an item without
+// categories, those with the most similar names. Without pg_trgm an item
+// without categories has no related items.
+func (app *App) getRelatedItems(w http.ResponseWriter, r *http.Request) error {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "getRelatedItems", tracer.ResourceName("SELECT id, name, description, price FROM items JOIN item_categories"))
+    defer span.Finish()
+
+    id, err := parseItemID(r.PathValue("id"))
+    if err != nil {
+        return &ValidationError{Code: "INVALID_ID", Message: "Invalid item ID"}
+    }
+    limit := defaultRelatedLimit
+    if raw := r.URL.Query().Get("limit"); raw != "" {
+        limit, err = strconv.Atoi(raw)
+        if err != nil || limit < 1 || limit > maxRelatedLimit {
+            return &ValidationError{Code: "INVALID_PAGINATION", Message: "limit must be an integer between 1 and 20"}
+        }
+    }
+
+    tenantID := tenantFromContext(ctx)
+    item, ok := cachedItem(tenantID, id)
+    if !ok {
+        item, err = app.items.GetByID(ctx, tenantID, id)
+        if err == sql.ErrNoRows {
+            return &NotFoundError{Resource: "Item"}
+        }
+        if err != nil {
+            return err
+        }
+        cacheItem(tenantID, item)
+    }
+
+    related := []Item{}
+    err = withReadFallback(ctx, readDB(), func(q *sql.DB) error {
+        var err error
+        switch {
+        case len(item.Categories) > 0:
+            related, err = queryRelatedItems(ctx, q, relatedByCategory, id, limit, tenantID)
+        case trigramAvailable:
+            related, err = queryRelatedItems(ctx, q, relatedByName, id, item.Name, limit, tenantID)
+        }
+        return err
+    })
+    if err != nil {
+        return err
+    }
+    if err := attachCategories(ctx, db, related); err != nil {
+        return err
+    }
+
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "item_id": id,
+        "related": related,
+    })
+    return nil
+}
+
+func queryRelatedItems(ctx context.Context, q *sql.DB, query string, args ...interface{}) ([]Item, error) {
+    rows, err := q.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    items := []Item{}
+    for rows.Next() {
+        var item Item
+        err := rows.Scan(&item.ID, &item.Name, &item.Description, &item.Price, &item.Version, &item.ImageURL, &item.SKU, &item.Metadata)
+        if err != nil {
+            return nil, err
+        }
+        items = append(items, item)
+    }
+    return items, rows.Err()
+}
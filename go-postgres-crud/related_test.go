@@ -0,0 +1,96 @@
+package main
+
+import (
+    "net/http"
+    "regexp"
+    "testing"
+
+    "github.com/DATA-DOG/go-sqlmock"
+)
+
+// relatedBody is the response of GET /items/{id}/related.
+type relatedBody struct {
+    ItemID  int    `json:"item_id"`
+    Related []Item `json:"related"`
+}
+
+func relatedIDs(items []Item) []int {
+    ids := []int{}
+    for _, item := range items {
+        ids = append(ids, item.ID)
+    }
+    return ids
+}
+
+func TestGetRelatedItemsByCategory(t *testing.T) {
+    mock := mockDB(t)
+    rt := newMockApp(t, storedItems(Item{ID: 1, Name: "Widget", Price: 1, Version: 1, Categories: []Category{{ID: 7, Name: "Tools", Slug: "tools"}}}))
+    mock.ExpectQuery(regexp.QuoteMeta(relatedByCategory)).WithArgs(1, 3, defaultTenantID).
+        WillReturnRows(exportRows(Item{ID: 4, Name: "Wrench", Price: 2}, Item{ID: 2, Name: "Hammer", Price: 3}))
+    mock.ExpectQuery(`FROM item_categories`).
+        WillReturnRows(sqlmock.NewRows([]string{"item_id", "id", "name", "slug"}).AddRow(4, 7, "Tools", "tools").AddRow(2, 7, "Tools", "tools"))
+
+    rec := doRequest(t, rt, http.MethodGet, "/items/1/related?limit=3", nil, "")
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+    }
+    var body relatedBody
+    decodeBody(t, rec, &body)
+    if ids := relatedIDs(body.Related); body.ItemID != 1 || len(ids) != 2 || ids[0] != 4 || ids[1] != 2 {
+        t.Fatalf("related = %v, want items 4 and 2 in the query's order", ids)
+    }
+    if len(body.Related[0].Categories) != 1 {
+        t.Errorf("related items carry categories %v, want theirs attached", body.Related[0].Categories)
+    }
+}
+
+func TestGetRelatedItemsByName(t *testing.T) {
+    previous := trigramAvailable
+    t.Cleanup(func() { trigramAvailable = previous })
+    rt := newMockApp(t, storedItems(Item{ID: 1, Name: "Blue Widget", Price: 1, Version: 1}))
+
+    t.Run("with pg_trgm", func(t *testing.T) {
+        trigramAvailable = true
+        mock := mockDB(t)
+        mock.ExpectQuery(regexp.QuoteMeta(relatedByName)).WithArgs(1, "Blue Widget", defaultRelatedLimit, defaultTenantID).
+            WillReturnRows(exportRows(Item{ID: 5, Name: "Blue Widgets", Price: 1}))
+        mock.ExpectQuery(`FROM item_categories`).WillReturnRows(sqlmock.NewRows([]string{"item_id", "id", "name", "slug"}))
+
+        var body relatedBody
+        decodeBody(t, doRequest(t, rt, http.MethodGet, "/items/1/related", nil, ""), &body)
+        if ids := relatedIDs(body.Related); len(ids) != 1 || ids[0] != 5 {
+            t.Errorf("related = %v, want item 5", ids)
+        }
+    })
+
+    t.Run("without pg_trgm", func(t *testing.T) {
+        trigramAvailable = false
+        mockDB(t)
+        rec := doRequest(t, rt, http.MethodGet, "/items/1/related", nil, "")
+        var body relatedBody
+        decodeBody(t, rec, &body)
+        if rec.Code != http.StatusOK || body.Related == nil || len(body.Related) != 0 {
+            t.Errorf("status %d, body %s; want 200 with no related items", rec.Code, rec.Body)
+        }
+    })
+}
+
+func TestGetRelatedItemsErrors(t *testing.T) {
+    rt := newMockApp(t, storedItems(Item{ID: 1, Name: "Widget", Price: 1, Version: 1}))
+    tests := []struct {
+        target string
+        status int
+        code   string
+    }{
+        {"/items/9/related", http.StatusNotFound, "NOT_FOUND"},
+        {"/items/abc/related", http.StatusBadRequest, "INVALID_ID"},
+        {"/items/1/related?limit=0", http.StatusBadRequest, "INVALID_PAGINATION"},
+        {"/items/1/related?limit=21", http.StatusBadRequest, "INVALID_PAGINATION"},
+    }
+    for _, tt := range tests {
+        rec := doRequest(t, rt, http.MethodGet, tt.target, nil, "")
+        if rec.Code != tt.status || errorCode(t, rec) != tt.code {
+            t.Errorf("GET %s: status %d, body %s; want %d %s", tt.target, rec.Code, rec.Body, tt.status, tt.code)
+        }
+    }
+}
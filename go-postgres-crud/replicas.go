@@ -0,0 +1,66 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "net/http"
+    "sync/atomic"
+
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// readReplicas are the pools opened from DB_READ_REPLICA_DSN, taken in turn
+// for read-only queries. With none configured every query goes to db.
+var readReplicas []*sql.DB
+
+var nextReplica atomic.Uint32
+
+var dbReplicaFallbackTotal = promauto.NewCounter(prometheus.CounterOpts{
+    Name: "db_replica_fallback_total",
+    Help: "Number of read queries retried on the primary after a replica connection error.",
+})
+
+// readDB returns the next replica pool, or db when there are no replicas.
+func readDB() *sql.DB {
+    if len(readReplicas) == 0 {
+        return db
+    }
+    return readReplicas[int(nextReplica.Add(1)-1)%len(readReplicas)]
+}
+
+// selectDB routes GET and HEAD requests to a replica and everything else to
+// the primary. Replicas lag behind the primary, so a handler that reads back
+// its own write must use db directly.
+func selectDB(r *http.Request) *sql.DB {
+    if r.Method == http.MethodGet || r.Method == http.MethodHead {
+        return readDB()
+    }
+    return db
+}
+
+// withReadFallback runs fn against q. When q is a replica and fn fails with a
+// connection error, fn runs once more against the primary.
+func withReadFallback(ctx context.Context, q *sql.DB, fn func(q *sql.DB) error) error {
+    err := fn(q)
+    if err != nil && q != db && isTransientDBError(err) {
+        dbReplicaFallbackTotal.Inc()
+        requestLogger(ctx).Warn("replica query failed, retrying on the primary", "error", err)
+        err = fn(db)
+    }
+    return err
+}
+
+// queryRead runs a query on selectDB(r), retrying on the primary as
+// withReadFallback does. Errors that surface while the rows are read are not
+// retried.
+func queryRead(r *http.Request, query string, args ...interface{}) (*sql.Rows, error) {
+    ctx := r.Context()
+    var rows *sql.Rows
+    err := withReadFallback(ctx, selectDB(r), func(q *sql.DB) error {
+        var err error
+        rows, err = q.QueryContext(ctx, query, args...)
+        return err
+    })
+    return rows, err
+}
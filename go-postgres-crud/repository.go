@@ -0,0 +1,519 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "net/http"
+    "time"
+
+    "github.com/google/uuid"
+    "github.com/prometheus/client_golang/prometheus"
+)
+
+var errDuplicateName = errors.New("an item with this name already exists")
+
+// errItemNotDeleted rejects the restore of an item that is still live.
+var errItemNotDeleted = errors.New("item is not deleted")
+
+// versionConflictError reports an update whose version no longer matches the
+// stored item.
+type versionConflictError struct {
+    Current int
+}
+
+func (e *versionConflictError) Error() string {
+    return fmt.Sprintf("item is at version %d", e.Current)
+}
+
+// ItemRepository is the storage behind the item CRUD handlers. Every method
+// sees only the items of tenantID: another tenant's item is as missing as one
+// that never existed. A missing item is reported as sql.ErrNoRows; an update
+// or delete of an item reserved by someone else as errItemReserved. Writes
+// record their audit entries in the same transaction; cache eviction and
+// change notifications are left to the caller.
+type ItemRepository interface {
+    // Create inserts item and its categories. A non-empty idempotencyKey is
+    // stored with the created item in the same transaction.
+    Create(ctx context.Context, tenantID uuid.UUID, item Item, idempotencyKey string) (Item, error)
+    // CreateMany creates all of items as Create does, in one transaction:
+    // either every item is created or none is. The failure of an item is
+    // reported as an *itemCreateError.
+    CreateMany(ctx context.Context, tenantID uuid.UUID, items []Item) ([]Item, error)
+    // Upsert creates item or, when a live item of the tenant already has its
+    // name regardless of case, replaces that item's fields. inserted reports
+    // which happened; old is the replaced item.
+    Upsert(ctx context.Context, tenantID uuid.UUID, item Item) (old, stored Item, inserted bool, err error)
+    GetAll(ctx context.Context, tenantID uuid.UUID, filters ItemFilters) (itemPage, error)
+    // GetAfter reads one keyset page, for filters with Keyset set.
+    GetAfter(ctx context.Context, tenantID uuid.UUID, filters ItemFilters) (itemCursorPage, error)
+    GetByID(ctx context.Context, tenantID uuid.UUID, id int) (Item, error)
+    // Update replaces the item's fields, conditional on item.Version when it
+    // is set, and returns the item as it was before and after. It is audited
+    // as an update unless withAuditAction says otherwise.
+    Update(ctx context.Context, tenantID uuid.UUID, id int, item Item) (old, updated Item, err error)
+    // Delete soft-deletes the item and returns it as it was.
+    Delete(ctx context.Context, tenantID uuid.UUID, id int) (Item, error)
+    // Restore undoes the soft delete of the item and returns it. A live
+    // item is reported as errItemNotDeleted, and a live item of the tenant
+    // with the same name regardless of case as errDuplicateName.
+    Restore(ctx context.Context, tenantID uuid.UUID, id int) (Item, error)
+}
+
+// PostgresItemRepository is the ItemRepository backed by the items table.
+// Every method fails with ErrMissingTenant when ctx carries no tenant, so a
+// caller that bypassed tenantMiddleware cannot query the default tenant.
+type PostgresItemRepository struct {
+    db    *sql.DB
+    stmts *Statements
+}
+
+func NewPostgresItemRepository(db *sql.DB, stmts *Statements) *PostgresItemRepository {
+    return &PostgresItemRepository{db: db, stmts: stmts}
+}
+
+func (p *PostgresItemRepository) Create(ctx context.Context, tenantID uuid.UUID, item Item, idempotencyKey string) (Item, error) {
+    if _, err := RequireTenant(ctx); err != nil {
+        return Item{}, err
+    }
+    // Serializable isolation keeps the name check and the insert atomic
+    // against a concurrent create of the same name.
+    tx, err := beginTxWithRetry(ctx, p.db, &sql.TxOptions{Isolation: sql.LevelSerializable})
+    if err != nil {
+        return Item{}, err
+    }
+    defer tx.Rollback()
+
+    item, err = p.insertItem(ctx, tx, tenantID, item)
+    if err != nil {
+        return Item{}, err
+    }
+    if idempotencyKey != "" {
+        if err := storeIdempotentResponse(ctx, tx, tenantID, idempotencyKey, http.StatusOK, item); err != nil {
+            return Item{}, err
+        }
+    }
+    return item, tx.Commit()
+}
+
+// itemCreateError reports which item of a CreateMany failed. It unwraps to
+// the error of that item.
+type itemCreateError struct {
+    Index int
+    Err   error
+}
+
+func (e *itemCreateError) Error() string {
+    return fmt.Sprintf("item %d: %v", e.Index, e.Err)
+}
+
+func (e *itemCreateError) Unwrap() error {
+    return e.Err
+}
+
+func (p *PostgresItemRepository) CreateMany(ctx context.Context, tenantID uuid.UUID, items []Item) ([]Item, error) {
+    if _, err := RequireTenant(ctx); err != nil {
+        return nil, err
+    }
+    // As in Create. The name check of each item also sees the items inserted
+    // before it, so a batch cannot repeat a name either.
+    tx, err := beginTxWithRetry(ctx, p.db, &sql.TxOptions{Isolation: sql.LevelSerializable})
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    created := make([]Item, len(items))
+    for i, item := range items {
+        created[i], err = p.insertItem(ctx, tx, tenantID, item)
+        if err != nil {
+            return nil, &itemCreateError{Index: i, Err: err}
+        }
+    }
+    return created, tx.Commit()
+}
+
+// insertItem inserts item, its categories and its audit entry in tx.
+func (p *PostgresItemRepository) insertItem(ctx context.Context, tx *sql.Tx, tenantID uuid.UUID, item Item) (Item, error) {
+    // Names are unique regardless of case among a tenant's live items. The
+    // check gives a clear error up front; the unique index on LOWER(name)
+    // catches a concurrent create that slips past it.
+    var exists bool
+    err := tx.QueryRowContext(ctx, liveNameExists, item.Name, tenantID).Scan(&exists)
+    if err != nil {
+        return Item{}, err
+    }
+    if exists {
+        return Item{}, errDuplicateName
+    }
+
+    timer := prometheus.NewTimer(dbQueryDuration.WithLabelValues("create"))
+    err = tx.StmtContext(ctx, p.stmts.Insert).QueryRowContext(ctx, item.Name, item.Description, item.Price, item.Metadata, tenantID).Scan(&item.ID, &item.Version)
+    timer.ObserveDuration()
+    if isDuplicateName(err) {
+        return Item{}, errDuplicateName
+    }
+    if err != nil {
+        return Item{}, err
+    }
+    if err := saveItemCategories(ctx, tx, &item); err != nil {
+        return Item{}, err
+    }
+    if err := recordAudit(ctx, tx, item.ID, auditCreate, nil, item); err != nil {
+        return Item{}, err
+    }
+    return item, nil
+}
+
+// liveNameExists reports whether tenant $2 has a live item named $1,
+// regardless of case.
+const liveNameExists = `SELECT EXISTS(SELECT 1 FROM items WHERE LOWER(name) = LOWER($1) AND tenant_id = $2 AND deleted_at IS NULL)`
+
+// upsertItemStatement inserts an item or updates the tenant's live item with
+// the same name. xmax is 0 only on a freshly inserted row version.
+const upsertItemStatement = `INSERT INTO items (name, description, price, metadata, tenant_id) VALUES ($1, $2, $3, $4, $5)
+    ON CONFLICT (tenant_id, LOWER(name)) WHERE deleted_at IS NULL DO UPDATE SET
+        name = EXCLUDED.name,
+        description = EXCLUDED.description,
+        price = EXCLUDED.price,
+        metadata = COALESCE(EXCLUDED.metadata, items.metadata),
+        version = items.version + 1
+    RETURNING id, version, metadata, (xmax = 0) AS inserted`
+
+func (p *PostgresItemRepository) Upsert(ctx context.Context, tenantID uuid.UUID, item Item) (Item, Item, bool, error) {
+    if _, err := RequireTenant(ctx); err != nil {
+        return Item{}, Item{}, false, err
+    }
+    // As in Create, serializable isolation turns a concurrent upsert of the
+    // same name into a serialization failure rather than an update of a row
+    // this transaction never locked.
+    tx, err := beginTxWithRetry(ctx, p.db, &sql.TxOptions{Isolation: sql.LevelSerializable})
+    if err != nil {
+        return Item{}, Item{}, false, err
+    }
+    defer tx.Rollback()
+
+    // Lock the item being replaced, if any, for the audit log and the
+    // reservation check.
+    var old Item
+    err = tx.QueryRowContext(ctx, `SELECT `+itemColumns+` FROM items WHERE LOWER(name) = LOWER($1) AND tenant_id = $2 AND deleted_at IS NULL FOR UPDATE`, item.Name, tenantID).
+        Scan(&old.ID, &old.Name, &old.Description, &old.Price, &old.Version, &old.ImageURL, &old.SKU, &old.Metadata)
+    if err != nil && err != sql.ErrNoRows {
+        return Item{}, Item{}, false, err
+    }
+    if old.ID != 0 {
+        if err := checkReservation(ctx, tx, tenantID, old.ID); err != nil {
+            return old, Item{}, false, err
+        }
+    }
+
+    var inserted bool
+    timer := prometheus.NewTimer(dbQueryDuration.WithLabelValues("upsert"))
+    err = tx.QueryRowContext(ctx, upsertItemStatement, item.Name, item.Description, item.Price, item.Metadata, tenantID).
+        Scan(&item.ID, &item.Version, &item.Metadata, &inserted)
+    timer.ObserveDuration()
+    if err != nil {
+        return old, Item{}, false, err
+    }
+    if err := saveItemCategories(ctx, tx, &item); err != nil {
+        return old, Item{}, false, err
+    }
+    if inserted {
+        err = recordAudit(ctx, tx, item.ID, auditCreate, nil, item)
+    } else {
+        err = recordAudit(ctx, tx, item.ID, auditUpdate, old, item)
+        if err == nil {
+            err = recordPriceChange(ctx, tx, item.ID, old.Price, item.Price, "")
+        }
+    }
+    if err != nil {
+        return old, Item{}, false, err
+    }
+    return old, item, inserted, tx.Commit()
+}
+
+// GetAll reads one page and the total match count in a single
+// repeatable-read snapshot, so the total always agrees with the page. Like
+// GetAfter it runs on a read replica when one is configured.
+func (p *PostgresItemRepository) GetAll(ctx context.Context, tenantID uuid.UUID, filters ItemFilters) (itemPage, error) {
+    if _, err := RequireTenant(ctx); err != nil {
+        return itemPage{}, err
+    }
+    defer prometheus.NewTimer(dbQueryDuration.WithLabelValues("read")).ObserveDuration()
+    filters.TenantID = tenantID
+    var page itemPage
+    err := withReadFallback(ctx, readDB(), func(q *sql.DB) error {
+        var err error
+        page, err = p.getAll(ctx, q, filters)
+        return err
+    })
+    return page, err
+}
+
+func (p *PostgresItemRepository) getAll(ctx context.Context, q *sql.DB, filters ItemFilters) (itemPage, error) {
+    page := itemPage{Items: []Item{}, Limit: filters.Limit, Offset: filters.Offset}
+
+    tx, err := q.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+    if err != nil {
+        return page, err
+    }
+    defer tx.Rollback()
+
+    sqlStatement, args := buildItemsCountQuery(filters)
+    err = tx.QueryRowContext(ctx, sqlStatement, args...).Scan(&page.Total)
+    if err != nil {
+        return page, err
+    }
+
+    sqlStatement, args = buildItemsQuery(filters)
+    rows, err := tx.QueryContext(ctx, sqlStatement, args...)
+    if err != nil {
+        return page, err
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var item Item
+        err := rows.Scan(&item.ID, &item.Name, &item.Description, &item.Price, &item.Version, &item.ImageURL, &item.SKU, &item.Metadata)
+        if err != nil {
+            return page, err
+        }
+        page.Items = append(page.Items, item)
+    }
+    if err := rows.Err(); err != nil {
+        return page, err
+    }
+    rows.Close()
+    if err := attachCategories(ctx, tx, page.Items); err != nil {
+        return page, err
+    }
+    return page, tx.Commit()
+}
+
+func (p *PostgresItemRepository) GetAfter(ctx context.Context, tenantID uuid.UUID, filters ItemFilters) (itemCursorPage, error) {
+    if _, err := RequireTenant(ctx); err != nil {
+        return itemCursorPage{}, err
+    }
+    defer prometheus.NewTimer(dbQueryDuration.WithLabelValues("read")).ObserveDuration()
+    filters.TenantID = tenantID
+    var page itemCursorPage
+    err := withReadFallback(ctx, readDB(), func(q *sql.DB) error {
+        var err error
+        page, err = p.getAfter(ctx, q, filters)
+        return err
+    })
+    return page, err
+}
+
+func (p *PostgresItemRepository) getAfter(ctx context.Context, q *sql.DB, filters ItemFilters) (itemCursorPage, error) {
+    page := itemCursorPage{Items: []Item{}, Limit: filters.Limit}
+
+    sqlStatement, args := buildItemsKeysetQuery(filters)
+    rows, err := q.QueryContext(ctx, sqlStatement, args...)
+    if err != nil {
+        return page, err
+    }
+    defer rows.Close()
+    var last itemCursor
+    for rows.Next() {
+        var item Item
+        var createdAt time.Time
+        err := rows.Scan(&item.ID, &item.Name, &item.Description, &item.Price, &item.Version, &item.ImageURL, &item.SKU, &item.Metadata, &createdAt)
+        if err != nil {
+            return page, err
+        }
+        if len(page.Items) == filters.Limit {
+            page.HasMore = true
+            break
+        }
+        page.Items = append(page.Items, item)
+        last = itemCursor{ID: item.ID, CreatedAt: createdAt}
+    }
+    if err := rows.Err(); err != nil {
+        return page, err
+    }
+    rows.Close()
+    if page.HasMore {
+        next := encodeItemCursor(last)
+        page.NextCursor = &next
+    }
+    if err := attachCategories(ctx, q, page.Items); err != nil {
+        return page, err
+    }
+    return page, nil
+}
+
+func (p *PostgresItemRepository) GetByID(ctx context.Context, tenantID uuid.UUID, id int) (Item, error) {
+    if _, err := RequireTenant(ctx); err != nil {
+        return Item{}, err
+    }
+    return p.stmts.loadItem(ctx, tenantID, id)
+}
+
+func (p *PostgresItemRepository) Update(ctx context.Context, tenantID uuid.UUID, id int, item Item) (Item, Item, error) {
+    if _, err := RequireTenant(ctx); err != nil {
+        return Item{}, Item{}, err
+    }
+    tx, err := beginTxWithRetry(ctx, p.db, lockedUpdateTxOptions)
+    if err != nil {
+        return Item{}, Item{}, err
+    }
+    defer tx.Rollback()
+
+    // The row lock makes a concurrent writer wait for this commit, so two
+    // updates never interleave. The locked before-state feeds the audit log
+    // and the caller's price-change stream.
+    old, err := p.stmts.lockItem(ctx, tx, tenantID, id)
+    if err != nil {
+        return Item{}, Item{}, err
+    }
+    if err := checkReservation(ctx, tx, tenantID, id); err != nil {
+        return old, Item{}, err
+    }
+
+    // A version makes the update conditional on it; without one the update
+    // applies to whatever is stored.
+    var version interface{}
+    if item.Version != 0 {
+        version = item.Version
+    }
+    timer := prometheus.NewTimer(dbQueryDuration.WithLabelValues("update"))
+    result, err := tx.StmtContext(ctx, p.stmts.Update).ExecContext(ctx, item.Name, item.Description, item.Price, id, item.Metadata, version, tenantID)
+    timer.ObserveDuration()
+    if isDuplicateName(err) {
+        return old, Item{}, errDuplicateName
+    }
+    if err != nil {
+        return old, Item{}, err
+    }
+    updated, err := result.RowsAffected()
+    if err != nil {
+        return old, Item{}, err
+    }
+    if updated == 0 {
+        return old, Item{}, &versionConflictError{Current: old.Version}
+    }
+    item.ID = id
+    if item.Metadata == nil {
+        item.Metadata = old.Metadata
+    }
+    // The row is locked, so the stored version is now exactly one ahead.
+    item.Version = old.Version + 1
+    if err := saveItemCategories(ctx, tx, &item); err != nil {
+        return old, Item{}, err
+    }
+    if err := recordAudit(ctx, tx, id, auditAction(ctx, auditUpdate), old, item); err != nil {
+        return old, Item{}, err
+    }
+    if err := recordPriceChange(ctx, tx, id, old.Price, item.Price, ""); err != nil {
+        return old, Item{}, err
+    }
+    return old, item, tx.Commit()
+}
+
+func (p *PostgresItemRepository) Delete(ctx context.Context, tenantID uuid.UUID, id int) (Item, error) {
+    if _, err := RequireTenant(ctx); err != nil {
+        return Item{}, err
+    }
+    tx, err := beginTxWithRetry(ctx, p.db, nil)
+    if err != nil {
+        return Item{}, err
+    }
+    defer tx.Rollback()
+
+    old, err := p.stmts.lockItem(ctx, tx, tenantID, id)
+    if err != nil {
+        return Item{}, err
+    }
+    if err := checkReservation(ctx, tx, tenantID, id); err != nil {
+        return Item{}, err
+    }
+
+    // Items are soft-deleted so a record is kept; see
+    // migrations/002_add_items_deleted_at.up.sql.
+    timer := prometheus.NewTimer(dbQueryDuration.WithLabelValues("delete"))
+    _, err = tx.StmtContext(ctx, p.stmts.Delete).ExecContext(ctx, id, tenantID)
+    timer.ObserveDuration()
+    if err != nil {
+        return Item{}, err
+    }
+    if err := recordAudit(ctx, tx, id, auditDelete, old, nil); err != nil {
+        return Item{}, err
+    }
+    return old, tx.Commit()
+}
+
+func (p *PostgresItemRepository) Restore(ctx context.Context, tenantID uuid.UUID, id int) (Item, error) {
+    if _, err := RequireTenant(ctx); err != nil {
+        return Item{}, err
+    }
+    // Serializable for the same reason as Create: the name check must not
+    // race a concurrent create or restore of the same name.
+    tx, err := beginTxWithRetry(ctx, p.db, &sql.TxOptions{Isolation: sql.LevelSerializable})
+    if err != nil {
+        return Item{}, err
+    }
+    defer tx.Rollback()
+
+    var item Item
+    var deleted bool
+    err = tx.QueryRowContext(ctx, `SELECT `+itemColumns+`, deleted_at IS NOT NULL FROM items WHERE id = $1 AND tenant_id = $2 FOR UPDATE`, id, tenantID).
+        Scan(&item.ID, &item.Name, &item.Description, &item.Price, &item.Version, &item.ImageURL, &item.SKU, &item.Metadata, &deleted)
+    if err != nil {
+        return Item{}, err
+    }
+    if !deleted {
+        return Item{}, errItemNotDeleted
+    }
+
+    var exists bool
+    err = tx.QueryRowContext(ctx, liveNameExists, item.Name, tenantID).Scan(&exists)
+    if err != nil {
+        return Item{}, err
+    }
+    if exists {
+        return Item{}, errDuplicateName
+    }
+
+    timer := prometheus.NewTimer(dbQueryDuration.WithLabelValues("restore"))
+    _, err = tx.ExecContext(ctx, `UPDATE items SET deleted_at = NULL WHERE id = $1 AND tenant_id = $2`, id, tenantID)
+    timer.ObserveDuration()
+    if isDuplicateName(err) {
+        return Item{}, errDuplicateName
+    }
+    if err != nil {
+        return Item{}, err
+    }
+    items := []Item{item}
+    if err := attachCategories(ctx, tx, items); err != nil {
+        return Item{}, err
+    }
+    item = items[0]
+    if err := recordAudit(ctx, tx, id, auditRestore, nil, item); err != nil {
+        return Item{}, err
+    }
+    return item, tx.Commit()
+}
+
+// lockedUpdateTxOptions is the isolation of the updates that lock their row
+// first. Read committed is enough: the lock already serializes writers, and
+// the statements after it read the committed row.
+var lockedUpdateTxOptions = &sql.TxOptions{Isolation: sql.LevelReadCommitted}
+
+// saveItemCategories stores item.CategoryIDs, when supplied, and loads the
+// resulting categories into item.
+func saveItemCategories(ctx context.Context, tx *sql.Tx, item *Item) error {
+    if item.CategoryIDs == nil {
+        return nil
+    }
+    if err := setItemCategories(ctx, tx, item.ID, item.CategoryIDs); err != nil {
+        return err
+    }
+    items := []Item{*item}
+    if err := attachCategories(ctx, tx, items); err != nil {
+        return err
+    }
+    *item = items[0]
+    item.CategoryIDs = nil
+    return nil
+}
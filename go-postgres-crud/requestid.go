@@ -0,0 +1,51 @@
+package main
+
+import (
+    "context"
+    "net/http"
+
+    "github.com/google/uuid"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds client-supplied IDs so they cannot bloat logs.
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// requestIDMiddleware gives every request an ID, reusing a well-formed
+// X-Request-ID from the client or generating a UUID otherwise. The ID is
+// stored in the request context and echoed in the response header.
+func requestIDMiddleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        id := r.Header.Get(requestIDHeader)
+        if !validRequestID(id) {
+            id = uuid.NewString()
+        }
+        w.Header().Set(requestIDHeader, id)
+        ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+        next.ServeHTTP(w, r.WithContext(ctx))
+    })
+}
+
+// validRequestID accepts non-empty IDs of printable ASCII without spaces, so
+// a client cannot inject line breaks or fake fields into log lines.
+func validRequestID(id string) bool {
+    if id == "" || len(id) > maxRequestIDLength {
+        return false
+    }
+    for i := 0; i < len(id); i++ {
+        if id[i] <= ' ' || id[i] > '~' {
+            return false
+        }
+    }
+    return true
+}
+
+// requestIDFromContext returns the request ID stored by requestIDMiddleware,
+// or "" outside a request.
+func requestIDFromContext(ctx context.Context) string {
+    id, _ := ctx.Value(requestIDKey{}).(string)
+    return id
+}
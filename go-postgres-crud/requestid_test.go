@@ -0,0 +1,76 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/google/uuid"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+    tests := []struct {
+        name     string
+        incoming string
+        reused   bool
+    }{
+        {"client ID", "client-req-42", true},
+        {"no header", "", false},
+        {"line break", "abc\ninjected=1", false},
+        {"too long", strings.Repeat("a", maxRequestIDLength+1), false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var seen string
+            h := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                seen = requestIDFromContext(r.Context())
+            }))
+            r := httptest.NewRequest(http.MethodGet, "/items", nil)
+            if tt.incoming != "" {
+                r.Header.Set(requestIDHeader, tt.incoming)
+            }
+            rec := httptest.NewRecorder()
+            h.ServeHTTP(rec, r)
+
+            got := rec.Header().Get(requestIDHeader)
+            if got != seen {
+                t.Errorf("response ID %q, context ID %q; want them equal", got, seen)
+            }
+            if tt.reused && got != tt.incoming {
+                t.Errorf("response ID = %q, want the client's %q", got, tt.incoming)
+            }
+            if !tt.reused {
+                if _, err := uuid.Parse(got); err != nil {
+                    t.Errorf("response ID = %q, want a generated UUID", got)
+                }
+            }
+        })
+    }
+}
+
+func TestAccessLogIncludesRequestID(t *testing.T) {
+    logs := captureLogs(t)
+
+    h := requestIDMiddleware(accessLogMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        requestLogger(r.Context()).Error("handler failed")
+    })))
+    r := httptest.NewRequest(http.MethodGet, "/items", nil)
+    r.Header.Set(requestIDHeader, "client-req-42")
+    h.ServeHTTP(httptest.NewRecorder(), r)
+
+    lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+    if len(lines) != 2 {
+        t.Fatalf("logged %d lines, want the handler's and the access log's: %s", len(lines), logs.String())
+    }
+    for _, line := range lines {
+        var entry map[string]interface{}
+        if err := json.Unmarshal([]byte(line), &entry); err != nil {
+            t.Fatal(err)
+        }
+        if entry["request_id"] != "client-req-42" {
+            t.Errorf("log entry %s lacks the request ID", line)
+        }
+    }
+}
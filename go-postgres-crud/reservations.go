@@ -0,0 +1,228 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "io"
+    "log/slog"
+    "net/http"
+    "time"
+
+    "github.com/google/uuid"
+    "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+const (
+    defaultReservationSeconds = 300
+    maxReservationSeconds     = 3600
+    reservationSweepInterval  = time.Minute
+)
+
+// errItemReserved rejects a change to an item that someone else holds.
+var errItemReserved = errors.New("item is reserved")
+
+// itemReservation is the response of POST /items/{id}/reserve.
+type itemReservation struct {
+    ItemID        int       `json:"item_id"`
+    ReservedBy    string    `json:"reserved_by"`
+    ReservedUntil time.Time `json:"reserved_until"`
+}
+
+type reserveRequest struct {
+    DurationSeconds *int `json:"duration_seconds"`
+}
+
+// checkReservation fails with errItemReserved when the tenant's item id has
+// an unexpired reservation held by anyone other than the caller. Callers lock
+// the row first, so the reservation cannot change before they commit.
+func checkReservation(ctx context.Context, tx *sql.Tx, tenantID uuid.UUID, id int) error {
+    var reservedBy string
+    err := tx.QueryRowContext(ctx, `SELECT reserved_by FROM items WHERE id = $1 AND tenant_id = $2 AND reserved_until > NOW()`, id, tenantID).Scan(&reservedBy)
+    if err == sql.ErrNoRows {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    if reservedBy != userIDFromContext(ctx) {
+        return errItemReserved
+    }
+    return nil
+}
+
+// reserveItem holds an item for the caller for duration_seconds (default 300,
+// at most 3600), taking one unit of its stock. The holder may reserve again to
+// extend the hold; anyone else gets 409 until it is released or expires, as
+// does everyone once the stock runs out.
+func (app *App) reserveItem(w http.ResponseWriter, r *http.Request) error {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "reserveItem", tracer.ResourceName("UPDATE items SET reserved_until"))
+    defer span.Finish()
+
+    id, err := parseItemID(r.PathValue("id"))
+    if err != nil {
+        return &ValidationError{Code: "INVALID_ID", Message: "Invalid item ID"}
+    }
+    var req reserveRequest
+    err = json.NewDecoder(r.Body).Decode(&req)
+    if err != nil && err != io.EOF {
+        return bodyError(err, "Request body is not valid JSON")
+    }
+    seconds := defaultReservationSeconds
+    if req.DurationSeconds != nil {
+        seconds = *req.DurationSeconds
+    }
+    if seconds <= 0 || seconds > maxReservationSeconds {
+        return &ValidationError{Code: "INVALID_BODY", Message: "duration_seconds must be between 1 and 3600"}
+    }
+
+    tx, err := beginTxWithRetry(ctx, db, lockedUpdateTxOptions)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    tenantID := tenantFromContext(ctx)
+    _, err = app.stmts.lockItem(ctx, tx, tenantID, id)
+    if err == sql.ErrNoRows {
+        return &NotFoundError{Resource: "Item"}
+    }
+    if err != nil {
+        return err
+    }
+    if err := releaseExpiredReservation(ctx, tx, tenantID, id); err != nil {
+        return err
+    }
+    if err := checkReservation(ctx, tx, tenantID, id); err != nil {
+        return err
+    }
+
+    // Any reservation left is the caller's own, which an extension keeps
+    // holding the same unit for. A new one takes a unit of stock.
+    reservation := itemReservation{ItemID: id, ReservedBy: userIDFromContext(ctx)}
+    var extending bool
+    err = tx.QueryRowContext(ctx, `SELECT reserved_until IS NOT NULL FROM items WHERE id = $1 AND tenant_id = $2`, id, tenantID).Scan(&extending)
+    if err != nil {
+        return err
+    }
+    if !extending {
+        _, err = recordStockMovement(ctx, tx, tenantID, stockMovement{
+            ItemID: id, Delta: -1, Reason: "reserved", ReferenceType: stockReferenceReservation, Actor: reservation.ReservedBy,
+        })
+        if err != nil {
+            return err
+        }
+    }
+    err = tx.QueryRowContext(ctx, `UPDATE items SET reserved_by = $1, reserved_until = NOW() + $2 * INTERVAL '1 second'
+        WHERE id = $3 AND tenant_id = $4 RETURNING reserved_until`, reservation.ReservedBy, seconds, id, tenantID).Scan(&reservation.ReservedUntil)
+    if err != nil {
+        return err
+    }
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+    requestLogger(ctx).Info("item reserved", "item_id", id, "reserved_until", reservation.ReservedUntil)
+
+    writeJSON(w, http.StatusOK, reservation)
+    return nil
+}
+
+// releaseItem ends the caller's reservation and returns its unit to stock.
+// Releasing an item that is not reserved is a no-op; one held by someone else
+// is refused.
+func (app *App) releaseItem(w http.ResponseWriter, r *http.Request) error {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "releaseItem", tracer.ResourceName("UPDATE items SET reserved_until = NULL"))
+    defer span.Finish()
+
+    id, err := parseItemID(r.PathValue("id"))
+    if err != nil {
+        return &ValidationError{Code: "INVALID_ID", Message: "Invalid item ID"}
+    }
+
+    tx, err := beginTxWithRetry(ctx, db, lockedUpdateTxOptions)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    tenantID := tenantFromContext(ctx)
+    _, err = app.stmts.lockItem(ctx, tx, tenantID, id)
+    if err == sql.ErrNoRows {
+        return &NotFoundError{Resource: "Item"}
+    }
+    if err != nil {
+        return err
+    }
+    if err := releaseExpiredReservation(ctx, tx, tenantID, id); err != nil {
+        return err
+    }
+    if err := checkReservation(ctx, tx, tenantID, id); err != nil {
+        return err
+    }
+    result, err := tx.ExecContext(ctx, `UPDATE items SET reserved_by = NULL, reserved_until = NULL
+        WHERE id = $1 AND tenant_id = $2 AND reserved_until IS NOT NULL`, id, tenantID)
+    if err != nil {
+        return err
+    }
+    released, err := result.RowsAffected()
+    if err != nil {
+        return err
+    }
+    if released > 0 {
+        _, err = recordStockMovement(ctx, tx, tenantID, stockMovement{
+            ItemID: id, Delta: 1, Reason: "released", ReferenceType: stockReferenceReservation, Actor: userIDFromContext(ctx),
+        })
+        if err != nil {
+            return err
+        }
+    }
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+
+    w.WriteHeader(http.StatusNoContent)
+    return nil
+}
+
+// startReservationSweeper releases expired reservations once every interval,
+// returning the units they held to stock. Expired holds are already ignored by
+// checkReservation, and reserving or releasing an item settles its own, but
+// stock only counts the unit again once the sweep gets to it. The returned
+// stop function cancels the sweeper and waits for it to exit.
+func startReservationSweeper(db *sql.DB, interval time.Duration) (stop func()) {
+    ctx, cancel := context.WithCancel(context.Background())
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+        for {
+            select {
+            case <-ctx.Done():
+                return
+            case <-ticker.C:
+                expireReservations(ctx, db)
+            }
+        }
+    }()
+    return func() {
+        cancel()
+        <-done
+    }
+}
+
+func expireReservations(ctx context.Context, db *sql.DB) {
+    result, err := db.ExecContext(ctx, releaseExpiredReservationsQuery(""))
+    if err != nil {
+        if ctx.Err() == nil {
+            slog.Error("expiring item reservations failed", "error", err)
+        }
+        return
+    }
+    if expired, err := result.RowsAffected(); err == nil && expired > 0 {
+        slog.Info("expired item reservations", "expired", expired)
+    }
+}
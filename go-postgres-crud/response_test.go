@@ -0,0 +1,114 @@
+package main
+
+import (
+    "context"
+    "encoding/xml"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+// specialName needs escaping in XML: markup characters, both quotes and
+// non-ASCII text.
+const specialName = `Fish & Chips <"Deluxe"> 'Café' ☕`
+
+// xmlRequest sends body as XML and asks for XML back.
+func xmlRequest(t *testing.T, h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+    t.Helper()
+    r := httptest.NewRequest(method, target, strings.NewReader(body))
+    if body != "" {
+        r.Header.Set("Content-Type", "application/xml; charset=utf-8")
+    }
+    r.Header.Set("Accept", "application/xml")
+    r.Header.Set("Authorization", testToken(t, nil))
+    rec := httptest.NewRecorder()
+    h.ServeHTTP(rec, r)
+    return rec
+}
+
+func TestNegotiateFormat(t *testing.T) {
+    tests := []struct {
+        accept []string
+        want   string
+    }{
+        {nil, "json"},
+        {[]string{"application/json"}, "json"},
+        {[]string{"application/xml"}, "xml"},
+        {[]string{"text/html, Application/XML;q=0.9"}, "xml"},
+        {[]string{"application/json", "application/xml"}, "xml"},
+        {[]string{"text/xml"}, "json"},
+        {[]string{envelopeMediaType}, "json"},
+    }
+    for _, tt := range tests {
+        r := httptest.NewRequest(http.MethodGet, "/items", nil)
+        for _, value := range tt.accept {
+            r.Header.Add("Accept", value)
+        }
+        if got := negotiateFormat(r); got != tt.want {
+            t.Errorf("negotiateFormat(Accept: %q) = %q, want %q", tt.accept, got, tt.want)
+        }
+    }
+}
+
+// TestItemXMLRoundTrip creates an item from an XML body, reads it back as
+// XML on its own and in a list, and checks the name survives each trip.
+func TestItemXMLRoundTrip(t *testing.T) {
+    repo := storedItems()
+    repo.GetAllFunc = func(ctx context.Context, filters ItemFilters) (itemPage, error) {
+        item, err := repo.GetByIDFunc(ctx, 1)
+        return itemPage{Items: []Item{item}, Total: 1, Limit: filters.Limit, Offset: filters.Offset}, err
+    }
+    rt := newMockApp(t, repo)
+
+    // Entities and a CDATA section both decode to the literal text.
+    rec := xmlRequest(t, rt, http.MethodPost, "/items", `<item>
+        <name>Fish &amp; Chips &lt;&quot;Deluxe&quot;&gt; &apos;Café&apos; ☕</name>
+        <description><![CDATA[Served <hot> & "fresh"]]></description>
+        <price>12.5</price>
+    </item>`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("POST: status = %d, want 200: %s", rec.Code, rec.Body)
+    }
+    // createItem reads XML but always answers in JSON.
+    var created Item
+    decodeBody(t, rec, &created)
+    if created.Name != specialName || created.Description != `Served <hot> & "fresh"` || created.Price != 12.5 {
+        t.Fatalf("created item = %+v, want the XML body's fields unescaped", created)
+    }
+
+    rec = xmlRequest(t, rt, http.MethodGet, "/items/1", "")
+    if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/xml" {
+        t.Fatalf("GET: status %d, Content-Type %q; want 200 application/xml", rec.Code, rec.Header().Get("Content-Type"))
+    }
+    if !strings.HasPrefix(rec.Body.String(), xml.Header) || strings.Contains(rec.Body.String(), "<hot>") {
+        t.Errorf("GET body %s, want an XML declaration and escaped text", rec.Body)
+    }
+    var got Item
+    if err := xml.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+        t.Fatal(err)
+    }
+    if got.XMLName.Local != "item" || got.ID != 1 || got.Name != specialName || got.Description != created.Description {
+        t.Errorf("GET decoded to %+v, want the created item in <item>", got)
+    }
+
+    rec = xmlRequest(t, rt, http.MethodGet, "/items?limit=5", "")
+    var page itemPage
+    if err := xml.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+        t.Fatalf("GET /items: %v: %s", err, rec.Body)
+    }
+    if page.XMLName.Local != "items" || page.Total != 1 || page.Limit != 5 || len(page.Items) != 1 || page.Items[0].Name != specialName {
+        t.Errorf("GET /items decoded to %+v, want one item in <items total=\"1\" limit=\"5\">", page)
+    }
+}
+
+func TestCreateItemInvalidXML(t *testing.T) {
+    repo := storedItems()
+    rec := xmlRequest(t, newMockApp(t, repo), http.MethodPost, "/items", `<item><name>Fish & Chips</name></item>`)
+    if rec.Code != http.StatusBadRequest {
+        t.Errorf("unescaped ampersand: status %d, body %s; want 400", rec.Code, rec.Body)
+    }
+    if n := repo.CallCount("Create"); n != 0 {
+        t.Errorf("Create called %d times for invalid XML", n)
+    }
+}
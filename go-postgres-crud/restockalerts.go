@@ -0,0 +1,149 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "io"
+    "net/http"
+    "net/mail"
+    "strings"
+    "time"
+
+    "github.com/google/uuid"
+    "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// restockAlertInterval is the least time between two alerts to the same
+// address for the same item.
+const restockAlertInterval = "24 hours"
+
+type restockAlert struct {
+    ItemID     int        `json:"item_id"`
+    Email      string     `json:"email"`
+    CreatedAt  time.Time  `json:"created_at"`
+    NotifiedAt *time.Time `json:"notified_at"`
+}
+
+type restockAlertRequest struct {
+    Email string `json:"email"`
+}
+
+// restockAlertEmail reads the address of a restock alert from the request
+// body, or when the body names none from the email claim of the bearer token.
+func restockAlertEmail(r *http.Request) (string, error) {
+    var req restockAlertRequest
+    err := json.NewDecoder(r.Body).Decode(&req)
+    if err != nil && err != io.EOF {
+        return "", bodyError(err, "Request body is not valid JSON")
+    }
+    email := strings.TrimSpace(req.Email)
+    if email == "" {
+        if claims, err := parseBearerToken(r); err == nil {
+            email, _ = claims["email"].(string)
+        }
+    }
+    if email == "" {
+        return "", &ValidationError{Code: "INVALID_BODY", Message: "email is required unless the token has an email claim"}
+    }
+    if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+        return "", &ValidationError{Code: "INVALID_BODY", Message: "email must be an email address"}
+    }
+    return strings.ToLower(email), nil
+}
+
+// createRestockAlert asks for email to be told when the tenant's item is
+// restocked after running out. Asking again for the same item returns the
+// existing alert with 200 instead of 201.
+func createRestockAlert(w http.ResponseWriter, r *http.Request) error {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "createRestockAlert", tracer.ResourceName("INSERT INTO restock_alerts"))
+    defer span.Finish()
+
+    id, err := parseItemID(r.PathValue("id"))
+    if err != nil {
+        return &ValidationError{Code: "INVALID_ID", Message: "Invalid item ID"}
+    }
+    email, err := restockAlertEmail(r)
+    if err != nil {
+        return err
+    }
+
+    tenantID := tenantFromContext(ctx)
+    var exists bool
+    err = db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM items WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL)`, id, tenantID).Scan(&exists)
+    if err != nil {
+        return err
+    }
+    if !exists {
+        return &NotFoundError{Resource: "Item"}
+    }
+
+    alert := restockAlert{ItemID: id, Email: email}
+    status := http.StatusCreated
+    err = db.QueryRowContext(ctx, `INSERT INTO restock_alerts (tenant_id, item_id, email) VALUES ($1, $2, $3)
+        ON CONFLICT (tenant_id, item_id, email) DO NOTHING RETURNING created_at`, tenantID, id, email).Scan(&alert.CreatedAt)
+    if err == sql.ErrNoRows {
+        status = http.StatusOK
+        err = db.QueryRowContext(ctx, `SELECT created_at, notified_at FROM restock_alerts WHERE tenant_id = $1 AND item_id = $2 AND email = $3`,
+            tenantID, id, email).Scan(&alert.CreatedAt, &alert.NotifiedAt)
+    }
+    if err != nil {
+        return err
+    }
+
+    writeJSON(w, status, alert)
+    return nil
+}
+
+// deleteRestockAlert cancels the restock alert of email for the tenant's
+// item.
+func deleteRestockAlert(w http.ResponseWriter, r *http.Request) error {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "deleteRestockAlert", tracer.ResourceName("DELETE FROM restock_alerts"))
+    defer span.Finish()
+
+    id, err := parseItemID(r.PathValue("id"))
+    if err != nil {
+        return &ValidationError{Code: "INVALID_ID", Message: "Invalid item ID"}
+    }
+    email, err := restockAlertEmail(r)
+    if err != nil {
+        return err
+    }
+
+    result, err := db.ExecContext(ctx, `DELETE FROM restock_alerts WHERE tenant_id = $1 AND item_id = $2 AND email = $3`, tenantFromContext(ctx), id, email)
+    if err != nil {
+        return err
+    }
+    if n, err := result.RowsAffected(); err != nil {
+        return err
+    } else if n == 0 {
+        return &NotFoundError{Resource: "Restock alert"}
+    }
+    w.WriteHeader(http.StatusNoContent)
+    return nil
+}
+
+// claimRestockAlerts marks the alerts of the tenant's item that have not
+// fired within restockAlertInterval as notified, and returns their addresses.
+// It runs in the restock's transaction, so a restock that rolls back leaves
+// them to fire next time.
+func claimRestockAlerts(ctx context.Context, tx *sql.Tx, tenantID uuid.UUID, id int) ([]string, error) {
+    rows, err := tx.QueryContext(ctx, `UPDATE restock_alerts SET notified_at = NOW()
+        WHERE tenant_id = $1 AND item_id = $2 AND (notified_at IS NULL OR notified_at <= NOW() - $3::interval)
+        RETURNING email`, tenantID, id, restockAlertInterval)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    var emails []string
+    for rows.Next() {
+        var email string
+        if err := rows.Scan(&email); err != nil {
+            return nil, err
+        }
+        emails = append(emails, email)
+    }
+    return emails, rows.Err()
+}
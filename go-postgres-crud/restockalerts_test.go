@@ -0,0 +1,99 @@
+package main
+
+import (
+    "net/http"
+    "testing"
+    "time"
+
+    "github.com/DATA-DOG/go-sqlmock"
+    "github.com/golang-jwt/jwt/v5"
+)
+
+func expectLiveItem(mock sqlmock.Sqlmock, exists bool) {
+    mock.ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM items WHERE id = \$1 AND tenant_id = \$2 AND deleted_at IS NULL\)`).
+        WithArgs(3, defaultTenantID).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(exists))
+}
+
+func TestCreateRestockAlert(t *testing.T) {
+    mock := mockDB(t)
+    rt := newStockRouter(t, mock)
+    createdAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+    expectLiveItem(mock, true)
+    mock.ExpectQuery(`INSERT INTO restock_alerts`).WithArgs(defaultTenantID, 3, "user@example.com").
+        WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(createdAt))
+    rec := doRequest(t, rt, http.MethodPost, "/items/3/notify-me", map[string]string{"email": "User@Example.com"}, testToken(t, nil))
+    var alert restockAlert
+    decodeBody(t, rec, &alert)
+    if rec.Code != http.StatusCreated || alert.Email != "user@example.com" || !alert.CreatedAt.Equal(createdAt) {
+        t.Errorf("status %d, body %s; want 201 with the lowercased address", rec.Code, rec.Body)
+    }
+
+    // Asking again returns the existing alert, and the token's email claim
+    // stands in for a missing body.
+    expectLiveItem(mock, true)
+    mock.ExpectQuery(`INSERT INTO restock_alerts`).WithArgs(defaultTenantID, 3, "claim@example.com").WillReturnRows(sqlmock.NewRows([]string{"created_at"}))
+    mock.ExpectQuery(`SELECT created_at, notified_at FROM restock_alerts`).WithArgs(defaultTenantID, 3, "claim@example.com").
+        WillReturnRows(sqlmock.NewRows([]string{"created_at", "notified_at"}).AddRow(createdAt, createdAt))
+    rec = doRequest(t, rt, http.MethodPost, "/items/3/notify-me", nil, testToken(t, jwt.MapClaims{"email": "claim@example.com"}))
+    decodeBody(t, rec, &alert)
+    if rec.Code != http.StatusOK || alert.NotifiedAt == nil {
+        t.Errorf("repeat: status %d, body %s; want 200 with the existing alert", rec.Code, rec.Body)
+    }
+}
+
+func TestCreateRestockAlertErrors(t *testing.T) {
+    mock := mockDB(t)
+    rt := newStockRouter(t, mock)
+
+    for _, body := range []interface{}{nil, map[string]string{"email": "not an address"}, map[string]string{"email": "Bob <bob@example.com>"}, `{"email": `} {
+        if rec := doRequest(t, rt, http.MethodPost, "/items/3/notify-me", body, testToken(t, nil)); rec.Code != http.StatusBadRequest {
+            t.Errorf("body %v: status %d, body %s; want 400", body, rec.Code, rec.Body)
+        }
+    }
+    expectLiveItem(mock, false)
+    rec := doRequest(t, rt, http.MethodPost, "/items/3/notify-me", map[string]string{"email": "user@example.com"}, testToken(t, nil))
+    if rec.Code != http.StatusNotFound {
+        t.Errorf("missing item: status %d, body %s; want 404", rec.Code, rec.Body)
+    }
+}
+
+func TestDeleteRestockAlert(t *testing.T) {
+    mock := mockDB(t)
+    rt := newStockRouter(t, mock)
+
+    mock.ExpectExec(`DELETE FROM restock_alerts WHERE tenant_id = \$1 AND item_id = \$2 AND email = \$3`).
+        WithArgs(defaultTenantID, 3, "user@example.com").WillReturnResult(sqlmock.NewResult(0, 1))
+    rec := doRequest(t, rt, http.MethodDelete, "/items/3/notify-me", map[string]string{"email": "user@example.com"}, testToken(t, nil))
+    if rec.Code != http.StatusNoContent {
+        t.Errorf("status %d, body %s; want 204", rec.Code, rec.Body)
+    }
+
+    mock.ExpectExec(`DELETE FROM restock_alerts`).WillReturnResult(sqlmock.NewResult(0, 0))
+    rec = doRequest(t, rt, http.MethodDelete, "/items/3/notify-me", map[string]string{"email": "user@example.com"}, testToken(t, nil))
+    if rec.Code != http.StatusNotFound {
+        t.Errorf("no alert: status %d, body %s; want 404", rec.Code, rec.Body)
+    }
+}
+
+// TestRestockFromZeroFiresAlerts restocks an item that had run out, which
+// claims its alerts in the restock's transaction and announces them.
+func TestRestockFromZeroFiresAlerts(t *testing.T) {
+    mock := mockDB(t)
+    rt := newStockRouter(t, mock)
+
+    mock.ExpectBegin()
+    mock.ExpectQuery(`FOR UPDATE`).WillReturnRows(lockedItemRows(Item{ID: 3, Name: "Widget", Price: 1}))
+    mock.ExpectQuery(`UPDATE items SET stock`).WithArgs(5, 3, defaultTenantID).WillReturnRows(sqlmock.NewRows([]string{"stock"}).AddRow(5))
+    mock.ExpectQuery(`INSERT INTO stock_movements`).WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(41, time.Now()))
+    mock.ExpectQuery(`UPDATE restock_alerts SET notified_at = NOW\(\)`).WithArgs(defaultTenantID, 3, restockAlertInterval).
+        WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("user@example.com"))
+    mock.ExpectCommit()
+    mock.ExpectQuery(`FROM webhooks`).WithArgs(eventItemRestocked, defaultTenantID).WillReturnRows(sqlmock.NewRows([]string{"id", "url", "secret"}))
+
+    body := map[string]interface{}{"delta": 5, "reference_type": "restock"}
+    if rec := doRequest(t, rt, http.MethodPost, "/items/3/stock", body, testToken(t, nil)); rec.Code != http.StatusCreated {
+        t.Fatalf("status %d, body %s; want 201", rec.Code, rec.Body)
+    }
+    awaitExpectations(t, mock)
+}
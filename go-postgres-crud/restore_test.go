@@ -0,0 +1,92 @@
+package main
+
+import (
+    "database/sql"
+    "net/http"
+    "testing"
+
+    "github.com/DATA-DOG/go-sqlmock"
+)
+
+// newRestoreRouter serves the Postgres repository over the mock database.
+func newRestoreRouter(t *testing.T) (*router, sqlmock.Sqlmock) {
+    t.Helper()
+    mock := mockDB(t)
+    return newTestRouter(NewApp(NewPostgresItemRepository(db, nil), nil, NewFeatureFlags(nil), nil)), mock
+}
+
+// restoreRows is the row the restore's lock returns for item.
+func restoreRows(item Item, deleted bool) *sqlmock.Rows {
+    return sqlmock.NewRows([]string{"id", "name", "description", "price", "version", "image_url", "sku", "metadata", "deleted"}).
+        AddRow(item.ID, item.Name, item.Description, item.Price, item.Version, item.ImageURL, item.SKU, nil, deleted)
+}
+
+func TestRestoreItem(t *testing.T) {
+    rt, mock := newRestoreRouter(t)
+    deleted := Item{ID: 4, Name: "Widget", Price: 9.99, Version: 2}
+    mock.ExpectBegin()
+    mock.ExpectQuery(`FROM items WHERE id = \$1 AND tenant_id = \$2 FOR UPDATE`).WithArgs(4, defaultTenantID).
+        WillReturnRows(restoreRows(deleted, true))
+    mock.ExpectQuery(`SELECT EXISTS`).WithArgs("Widget", defaultTenantID).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+    mock.ExpectExec(`UPDATE items SET deleted_at = NULL`).WithArgs(4, defaultTenantID).WillReturnResult(sqlmock.NewResult(0, 1))
+    mock.ExpectQuery(`FROM item_categories`).
+        WillReturnRows(sqlmock.NewRows([]string{"item_id", "id", "name", "slug"}).AddRow(4, 7, "Tools", "tools"))
+    mock.ExpectExec(`INSERT INTO audit_logs`).WithArgs(4, "test-user", auditRestore, nil, sqlmock.AnyArg()).
+        WillReturnResult(sqlmock.NewResult(1, 1))
+    mock.ExpectCommit()
+    expectWebhookLookup(mock)
+
+    rec := doRequest(t, rt, http.MethodPost, "/items/4/restore", nil, testToken(t, nil))
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+    }
+    awaitExpectations(t, mock)
+    var got Item
+    decodeBody(t, rec, &got)
+    if got.ID != 4 || got.Name != "Widget" || got.Version != 2 || len(got.Categories) != 1 {
+        t.Errorf("restored item = %+v, want item 4 with its category", got)
+    }
+}
+
+func TestRestoreItemErrors(t *testing.T) {
+    item := Item{ID: 4, Name: "Widget", Price: 9.99, Version: 2}
+    tests := []struct {
+        name   string
+        expect func(mock sqlmock.Sqlmock)
+        status int
+        code   string
+    }{
+        {"missing", func(mock sqlmock.Sqlmock) {
+            mock.ExpectQuery(`FOR UPDATE`).WillReturnError(sql.ErrNoRows)
+        }, http.StatusNotFound, "NOT_FOUND"},
+        {"not deleted", func(mock sqlmock.Sqlmock) {
+            mock.ExpectQuery(`FOR UPDATE`).WillReturnRows(restoreRows(item, false))
+        }, http.StatusBadRequest, "NOT_DELETED"},
+        {"name taken by a live item", func(mock sqlmock.Sqlmock) {
+            mock.ExpectQuery(`FOR UPDATE`).WillReturnRows(restoreRows(item, true))
+            mock.ExpectQuery(`SELECT EXISTS`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+        }, http.StatusConflict, "DUPLICATE_NAME"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            rt, mock := newRestoreRouter(t)
+            // Nothing is written, so every case rolls back.
+            mock.ExpectBegin()
+            tt.expect(mock)
+            mock.ExpectRollback()
+
+            rec := doRequest(t, rt, http.MethodPost, "/items/4/restore", nil, testToken(t, nil))
+            if rec.Code != tt.status || errorCode(t, rec) != tt.code {
+                t.Errorf("status %d, body %s; want %d %s", rec.Code, rec.Body, tt.status, tt.code)
+            }
+        })
+    }
+
+    t.Run("invalid ID", func(t *testing.T) {
+        rt, _ := newRestoreRouter(t)
+        rec := doRequest(t, rt, http.MethodPost, "/items/abc/restore", nil, testToken(t, nil))
+        if rec.Code != http.StatusBadRequest || errorCode(t, rec) != "INVALID_ID" {
+            t.Errorf("status %d, body %s; want 400 INVALID_ID", rec.Code, rec.Body)
+        }
+    })
+}
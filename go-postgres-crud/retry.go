@@ -0,0 +1,69 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "database/sql/driver"
+    "errors"
+    "net"
+    "time"
+
+    "github.com/lib/pq"
+)
+
+const (
+    dbRetryAttempts = 3
+    dbRetryBaseWait = 100 * time.Millisecond
+)
+
+// withRetry runs fn up to attempts times, waiting 100ms, 200ms, 400ms, ...
+// between tries, as long as it fails with a transient connection error. Any
+// other error, or a done ctx, ends the retries at once.
+func withRetry(ctx context.Context, attempts int, fn func() error) error {
+    var err error
+    for attempt := 0; attempt < attempts; attempt++ {
+        if err = fn(); err == nil || !isTransientDBError(err) {
+            return err
+        }
+        if attempt == attempts-1 {
+            break
+        }
+        requestLogger(ctx).Warn("transient database error, retrying", "attempt", attempt+1, "error", err)
+        select {
+        case <-ctx.Done():
+            return err
+        case <-time.After(dbRetryBaseWait << attempt):
+        }
+    }
+    return err
+}
+
+// isTransientDBError reports errors that a retry on a fresh connection may
+// fix: connection exceptions (SQLSTATE class 08), server shutdown and startup
+// (57P01-57P03), dropped pool connections and failed dials.
+func isTransientDBError(err error) bool {
+    var pqErr *pq.Error
+    if errors.As(err, &pqErr) {
+        switch pqErr.Code {
+        case "57P01", "57P02", "57P03":
+            return true
+        }
+        return pqErr.Code.Class() == "08"
+    }
+    var opErr *net.OpError
+    return errors.Is(err, driver.ErrBadConn) || errors.As(err, &opErr)
+}
+
+// beginTxWithRetry starts a transaction, retrying transient connection
+// errors. Statements inside the transaction are not retried: a lost
+// connection aborts the whole transaction, so replaying a single statement
+// would be wrong.
+func beginTxWithRetry(ctx context.Context, db *sql.DB, opts *sql.TxOptions) (*sql.Tx, error) {
+    var tx *sql.Tx
+    err := withRetry(ctx, dbRetryAttempts, func() error {
+        var err error
+        tx, err = db.BeginTx(ctx, opts)
+        return err
+    })
+    return tx, err
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+    "context"
+    "database/sql/driver"
+    "errors"
+    "fmt"
+    "net"
+    "testing"
+    "time"
+
+    "github.com/lib/pq"
+)
+
+func TestWithRetry(t *testing.T) {
+    connectionFailure := &pq.Error{Code: "08006"}
+    tests := []struct {
+        name      string
+        errs      []error
+        wantCalls int
+        wantErr   error
+    }{
+        {"success", []error{nil}, 1, nil},
+        {"recovers from transient errors", []error{&pq.Error{Code: "57P01"}, &pq.Error{Code: "08001"}, nil}, 3, nil},
+        {"unique violation is not retried", []error{&pq.Error{Code: "23505"}, nil}, 1, &pq.Error{Code: "23505"}},
+        {"gives up after the attempts", []error{connectionFailure, connectionFailure, connectionFailure, nil}, 3, connectionFailure},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            calls := 0
+            err := withRetry(context.Background(), 3, func() error {
+                calls++
+                return tt.errs[calls-1]
+            })
+            if calls != tt.wantCalls {
+                t.Errorf("fn called %d times, want %d", calls, tt.wantCalls)
+            }
+            if fmt.Sprint(err) != fmt.Sprint(tt.wantErr) {
+                t.Errorf("err = %v, want %v", err, tt.wantErr)
+            }
+        })
+    }
+}
+
+func TestWithRetryBacksOff(t *testing.T) {
+    var at []time.Time
+    withRetry(context.Background(), 3, func() error {
+        at = append(at, time.Now())
+        return driver.ErrBadConn
+    })
+    if len(at) != 3 {
+        t.Fatalf("fn called %d times, want 3", len(at))
+    }
+    if first, second := at[1].Sub(at[0]), at[2].Sub(at[1]); first < dbRetryBaseWait || second < 2*dbRetryBaseWait {
+        t.Errorf("waited %v then %v, want at least %v then %v", first, second, dbRetryBaseWait, 2*dbRetryBaseWait)
+    }
+}
+
+func TestWithRetryStopsWhenContextDone(t *testing.T) {
+    ctx, cancel := context.WithCancel(context.Background())
+    calls := 0
+    err := withRetry(ctx, 3, func() error {
+        calls++
+        cancel()
+        return driver.ErrBadConn
+    })
+    if calls != 1 || !errors.Is(err, driver.ErrBadConn) {
+        t.Errorf("calls = %d, err = %v; want one call returning its error", calls, err)
+    }
+}
+
+func TestIsTransientDBError(t *testing.T) {
+    tests := []struct {
+        err  error
+        want bool
+    }{
+        {&pq.Error{Code: "08006"}, true},
+        {&pq.Error{Code: "08001"}, true},
+        {&pq.Error{Code: "57P01"}, true},
+        {&pq.Error{Code: "57P03"}, true},
+        {fmt.Errorf("query: %w", driver.ErrBadConn), true},
+        {&net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+        {&pq.Error{Code: "23505"}, false},
+        {&pq.Error{Code: "57014"}, false},
+        {errors.New("syntax error"), false},
+    }
+    for _, tt := range tests {
+        if got := isTransientDBError(tt.err); got != tt.want {
+            t.Errorf("isTransientDBError(%v) = %v, want %v", tt.err, got, tt.want)
+        }
+    }
+}
+
+func TestBeginTxWithRetry(t *testing.T) {
+    mock := mockDB(t)
+    mock.ExpectBegin().WillReturnError(&pq.Error{Code: "08006"})
+    mock.ExpectBegin()
+    mock.ExpectRollback()
+
+    tx, err := beginTxWithRetry(context.Background(), db, nil)
+    if err != nil {
+        t.Fatalf("beginTxWithRetry: %v", err)
+    }
+    tx.Rollback()
+}
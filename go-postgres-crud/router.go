@@ -0,0 +1,74 @@
+package main
+
+import (
+    "context"
+    "net/http"
+    "strings"
+)
+
+type routeKey struct{}
+
+// router registers method-scoped patterns such as "GET /items/{id}" on an
+// http.ServeMux and wraps each handler in the middleware added with Use.
+// Middleware runs after the route is matched, so it can read the route
+// template through routeLabel, and requests that match no route skip it.
+type router struct {
+    mux         *http.ServeMux
+    middlewares []func(http.Handler) http.Handler
+    // patterns lists every pattern registered on mux, in order, through
+    // this router or one made by With.
+    patterns *[]string
+}
+
+func newRouter() *router {
+    return &router{mux: http.NewServeMux(), patterns: new([]string)}
+}
+
+// Use adds middleware to the routes registered after it. Middleware added
+// first runs first.
+func (rt *router) Use(mw func(http.Handler) http.Handler) {
+    rt.middlewares = append(rt.middlewares, mw)
+}
+
+// With returns a router on the same mux whose routes also run mw, inside the
+// middleware added so far.
+func (rt *router) With(mw func(http.Handler) http.Handler) *router {
+    middlewares := append([]func(http.Handler) http.Handler{}, rt.middlewares...)
+    return &router{mux: rt.mux, middlewares: append(middlewares, mw), patterns: rt.patterns}
+}
+
+func (rt *router) Handle(pattern string, h http.Handler) {
+    for i := len(rt.middlewares) - 1; i >= 0; i-- {
+        h = rt.middlewares[i](h)
+    }
+    _, template, _ := strings.Cut(pattern, " ")
+    *rt.patterns = append(*rt.patterns, pattern)
+    rt.mux.Handle(pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), routeKey{}, template)))
+    }))
+}
+
+func (rt *router) HandleFunc(pattern string, fn http.HandlerFunc) {
+    rt.Handle(pattern, fn)
+}
+
+// ServeHTTP answers an unmatched path with a trailing slash, e.g. /items/,
+// with a redirect to the path without it: 301 for GET and HEAD, and 308 for
+// other methods, so clients repeat the method and body instead of turning
+// the request into a GET.
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    if path := r.URL.Path; len(path) > 1 && strings.HasSuffix(path, "/") {
+        if _, pattern := rt.mux.Handler(r); pattern == "" {
+            target := *r.URL
+            target.Path = strings.TrimRight(path, "/")
+            target.RawPath = ""
+            status := http.StatusPermanentRedirect
+            if r.Method == http.MethodGet || r.Method == http.MethodHead {
+                status = http.StatusMovedPermanently
+            }
+            http.Redirect(w, r, target.RequestURI(), status)
+            return
+        }
+    }
+    rt.mux.ServeHTTP(w, r)
+}
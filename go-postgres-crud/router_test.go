@@ -0,0 +1,204 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "regexp"
+    "strings"
+    "testing"
+
+    httptrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/net/http"
+    "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+    "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+)
+
+func TestRouterRedirectsTrailingSlash(t *testing.T) {
+    rt := newTestRouter(NewApp(nil, nil, nil, nil))
+
+    rec := doRequest(t, rt, http.MethodGet, "/items/42/?fields=name", nil, "")
+    if rec.Code != http.StatusMovedPermanently {
+        t.Fatalf("status = %d, want 301", rec.Code)
+    }
+    if got, want := rec.Header().Get("Location"), "/items/42?fields=name"; got != want {
+        t.Errorf("Location = %q, want %q", got, want)
+    }
+}
+
+// TestRouterTrailingSlashVariants requests every registered route with and
+// without a trailing slash. The slash variant redirects to the route: 301
+// for GET and HEAD, 308 for methods a 301 could turn into a GET.
+func TestRouterTrailingSlashVariants(t *testing.T) {
+    rt := newTestRouter(NewApp(nil, nil, nil, nil))
+    wildcard := regexp.MustCompile(`\{[^}]+\}`)
+
+    for _, pattern := range *rt.patterns {
+        method, template, _ := strings.Cut(pattern, " ")
+        path := wildcard.ReplaceAllString(template, "1")
+        t.Run(pattern, func(t *testing.T) {
+            // The handlers are not run: the App has no repository.
+            if _, matched := rt.mux.Handler(httptest.NewRequest(method, path, nil)); matched != pattern {
+                t.Errorf("%s %s matched %q, want %q", method, path, matched, pattern)
+            }
+
+            rec := httptest.NewRecorder()
+            rt.ServeHTTP(rec, httptest.NewRequest(method, path+"/", nil))
+            want := http.StatusPermanentRedirect
+            if method == http.MethodGet || method == http.MethodHead {
+                want = http.StatusMovedPermanently
+            }
+            if rec.Code != want {
+                t.Errorf("%s %s/: status = %d, want %d", method, path, rec.Code, want)
+            }
+            if got := rec.Header().Get("Location"); got != path {
+                t.Errorf("%s %s/: Location = %q, want %q", method, path, got, path)
+            }
+        })
+    }
+
+    rec := doRequest(t, rt, http.MethodGet, "/items/", nil, "")
+    if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != "/items" {
+        t.Errorf("GET /items/: status %d, Location %q; want 301 to /items", rec.Code, rec.Header().Get("Location"))
+    }
+}
+
+func TestRouterUnknownRoutes(t *testing.T) {
+    rt := newTestRouter(NewApp(nil, nil, nil, nil))
+
+    if rec := doRequest(t, rt, http.MethodGet, "/nope", nil, ""); rec.Code != http.StatusNotFound {
+        t.Errorf("GET /nope: status = %d, want 404", rec.Code)
+    }
+    rec := doRequest(t, rt, http.MethodPost, "/items/42", nil, testToken(t, nil))
+    if rec.Code != http.StatusMethodNotAllowed {
+        t.Errorf("POST /items/42: status = %d, want 405", rec.Code)
+    }
+    if rec.Header().Get("Allow") == "" {
+        t.Error("405 response has no Allow header")
+    }
+}
+
+func TestRouterOptions(t *testing.T) {
+    rt := newTestRouter(NewApp(nil, nil, nil, nil))
+
+    rec := doRequest(t, rt, http.MethodOptions, "/items/42", nil, "")
+    if rec.Code != http.StatusNoContent {
+        t.Fatalf("status = %d, want 204", rec.Code)
+    }
+    if got, want := rec.Header().Get("Allow"), "GET, PUT, PATCH, DELETE, OPTIONS"; got != want {
+        t.Errorf("Allow = %q, want %q", got, want)
+    }
+}
+
+// Writes need a bearer token before any handler runs; reads do not.
+func TestRouterRequiresTokenForWrites(t *testing.T) {
+    rt := newTestRouter(NewApp(nil, nil, nil, nil))
+
+    for _, route := range []struct{ method, path string }{
+        {http.MethodPost, "/items"},
+        {http.MethodPut, "/items/1"},
+        {http.MethodPatch, "/items/1"},
+        {http.MethodDelete, "/items/1"},
+        {http.MethodDelete, "/items"},
+        {http.MethodPost, "/items/bulk"},
+        {http.MethodPost, "/items/1/restore"},
+    } {
+        rec := doRequest(t, rt, route.method, route.path, `{}`, "")
+        if rec.Code != http.StatusUnauthorized {
+            t.Errorf("%s %s without a token: status = %d, want 401", route.method, route.path, rec.Code)
+        }
+    }
+
+    rec := doRequest(t, rt, http.MethodGet, "/openapi.yaml", nil, "")
+    if rec.Code != http.StatusOK {
+        t.Errorf("GET /openapi.yaml: status = %d, want 200", rec.Code)
+    }
+}
+
+func TestRouterStoresRouteTemplate(t *testing.T) {
+    rt := newRouter()
+    var got string
+    rt.HandleFunc("GET /items/{id}", func(w http.ResponseWriter, r *http.Request) {
+        got = routeLabel(r)
+    })
+
+    rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items/7", nil))
+    if got != "/items/{id}" {
+        t.Errorf("routeLabel = %q, want /items/{id}", got)
+    }
+}
+
+func TestRouterMiddlewareOrder(t *testing.T) {
+    rt := newRouter()
+    var order []string
+    mark := func(name string) func(http.Handler) http.Handler {
+        return func(next http.Handler) http.Handler {
+            return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                order = append(order, name)
+                next.ServeHTTP(w, r)
+            })
+        }
+    }
+    rt.Use(mark("first"))
+    rt.Use(mark("second"))
+    rt.With(mark("inner")).HandleFunc("GET /x", func(w http.ResponseWriter, r *http.Request) {
+        order = append(order, "handler")
+    })
+
+    rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/x", nil))
+    want := []string{"first", "second", "inner", "handler"}
+    if len(order) != len(want) {
+        t.Fatalf("order = %v, want %v", order, want)
+    }
+    for i := range want {
+        if order[i] != want[i] {
+            t.Fatalf("order = %v, want %v", order, want)
+        }
+    }
+}
+
+func TestRouterPathValues(t *testing.T) {
+    rt := newRouter()
+    var id, name string
+    rt.HandleFunc("PUT /items/{id}/tags/{name}", func(w http.ResponseWriter, r *http.Request) {
+        id, name = r.PathValue("id"), r.PathValue("name")
+    })
+
+    rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/items/42/tags/on%20sale", nil))
+    if id != "42" || name != "on sale" {
+        t.Errorf("PathValue = %q, %q; want 42 and the decoded name", id, name)
+    }
+}
+
+// TestRouterTracing serves a request the way main does, through the Datadog
+// ServeMux, and checks the root span is named after the matched pattern.
+func TestRouterTracing(t *testing.T) {
+    mt := mocktracer.Start()
+    defer mt.Stop()
+
+    rt := newMockApp(t, storedItems(Item{ID: 42, Name: "Widget", Price: 1, Version: 1}))
+    traced := httptrace.NewServeMux(
+        httptrace.WithResourceNamer(routeResourceNamer(rt.mux)),
+        httptrace.WithIgnoreRequest(ignoreUntracedPaths),
+    )
+    traced.Handle("/", rt)
+
+    if rec := doRequest(t, traced, http.MethodGet, "/items/42", nil, ""); rec.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+    }
+    doRequest(t, traced, http.MethodGet, "/metrics", nil, "")
+
+    var roots []mocktracer.Span
+    for _, span := range mt.FinishedSpans() {
+        if span.ParentID() == 0 {
+            roots = append(roots, span)
+        }
+    }
+    if len(roots) != 1 {
+        t.Fatalf("%d root spans, want one for /items/42 and none for /metrics", len(roots))
+    }
+    if got := roots[0].Tag(ext.ResourceName); got != "GET /items/{id}" {
+        t.Errorf("resource = %v, want GET /items/{id}", got)
+    }
+    if got := roots[0].Tag(ext.HTTPCode); got != "200" {
+        t.Errorf("%s = %v, want 200", ext.HTTPCode, got)
+    }
+}
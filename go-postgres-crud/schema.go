@@ -0,0 +1,193 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "log/slog"
+    "sort"
+    "strings"
+
+    "github.com/lib/pq"
+)
+
+// expectedSchema lists the columns the handlers depend on, with the data types
+// (as reported by information_schema) each column may have.
+var expectedSchema = map[string]map[string][]string{
+    "items": {
+        "id":                   {"integer", "bigint"},
+        "name":                 {"text", "character varying"},
+        "description":          {"text", "character varying"},
+        "price":                {"numeric", "double precision", "real"},
+        "deleted_at":           {"timestamp with time zone"},
+        "created_at":           {"timestamp with time zone"},
+        "version":              {"integer"},
+        "image_url":            {"text"},
+        "metadata":             {"jsonb"},
+        "reserved_by":          {"text"},
+        "reserved_until":       {"timestamp with time zone"},
+        "tenant_id":            {"uuid"},
+        "stock":                {"integer"},
+        "sku":                  {"text"},
+        "low_stock_alerted_at": {"timestamp with time zone"},
+    },
+    "categories": {
+        "id":        {"integer"},
+        "name":      {"text", "character varying"},
+        "slug":      {"text", "character varying"},
+        "parent_id": {"integer"},
+    },
+    "item_categories": {
+        "item_id":     {"integer"},
+        "category_id": {"integer"},
+    },
+    "idempotency_keys": {
+        "key":           {"text"},
+        "status_code":   {"integer"},
+        "response_body": {"jsonb"},
+        "created_at":    {"timestamp with time zone"},
+        "tenant_id":     {"uuid"},
+    },
+    "webhooks": {
+        "id":         {"integer"},
+        "url":        {"text"},
+        "secret":     {"text"},
+        "events":     {"ARRAY"},
+        "created_at": {"timestamp with time zone"},
+        "tenant_id":  {"uuid"},
+    },
+    "api_keys": {
+        "id":           {"integer"},
+        "key_hash":     {"text"},
+        "description":  {"text"},
+        "created_at":   {"timestamp with time zone"},
+        "last_used_at": {"timestamp with time zone"},
+        "expires_at":   {"timestamp with time zone"},
+        "tenant_id":    {"uuid"},
+    },
+    "item_price_history": {
+        "id":                 {"bigint"},
+        "item_id":            {"integer"},
+        "old_price":          {"numeric"},
+        "new_price":          {"numeric"},
+        "changed_at":         {"timestamp with time zone"},
+        "changed_by_user_id": {"text"},
+        "reason":             {"text"},
+    },
+    "feature_flags": {
+        "flag_name":          {"text"},
+        "enabled":            {"boolean"},
+        "rollout_percentage": {"integer"},
+    },
+    "stock_movements": {
+        "id":             {"bigint"},
+        "tenant_id":      {"uuid"},
+        "item_id":        {"integer"},
+        "delta":          {"integer"},
+        "reason":         {"text"},
+        "reference_type": {"USER-DEFINED"},
+        "reference_id":   {"text"},
+        "actor":          {"text"},
+        "stock_after":    {"integer"},
+        "created_at":     {"timestamp with time zone"},
+    },
+    "restock_alerts": {
+        "tenant_id":   {"uuid"},
+        "item_id":     {"integer"},
+        "email":       {"text"},
+        "created_at":  {"timestamp with time zone"},
+        "notified_at": {"timestamp with time zone"},
+    },
+    "price_error_reports": {
+        "id":             {"bigint"},
+        "tenant_id":      {"uuid"},
+        "item_id":        {"integer"},
+        "reporter_id":    {"text"},
+        "reported_price": {"numeric"},
+        "correct_price":  {"numeric"},
+        "notes":          {"text"},
+        "status":         {"text"},
+        "created_at":     {"timestamp with time zone"},
+        "resolved_at":    {"timestamp with time zone"},
+        "resolved_by":    {"text"},
+    },
+    "audit_logs": {
+        "id":         {"bigint"},
+        "item_id":    {"integer"},
+        "user_id":    {"text"},
+        "action":     {"character varying"},
+        "old_value":  {"jsonb"},
+        "new_value":  {"jsonb"},
+        "created_at": {"timestamp with time zone"},
+    },
+}
+
+// verifySchema compares the live schema with expectedSchema. Missing columns
+// and type mismatches are returned as an error; extra columns are only logged
+// so the database can run ahead of the code during a rollout.
+func verifySchema(ctx context.Context, db *sql.DB) error {
+    rows, err := db.QueryContext(ctx, `SELECT table_name, column_name, data_type
+        FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = ANY($1)`, pq.Array(expectedTables()))
+    if err != nil {
+        return fmt.Errorf("reading schema: %w", err)
+    }
+    defer rows.Close()
+
+    actual := map[string]map[string]string{}
+    for rows.Next() {
+        var table, column, dataType string
+        if err := rows.Scan(&table, &column, &dataType); err != nil {
+            return fmt.Errorf("reading schema: %w", err)
+        }
+        if actual[table] == nil {
+            actual[table] = map[string]string{}
+        }
+        actual[table][column] = dataType
+    }
+    if err := rows.Err(); err != nil {
+        return fmt.Errorf("reading schema: %w", err)
+    }
+
+    var problems []string
+    for _, table := range expectedTables() {
+        for column, types := range expectedSchema[table] {
+            dataType, ok := actual[table][column]
+            if !ok {
+                problems = append(problems, fmt.Sprintf("missing column %s.%s", table, column))
+                continue
+            }
+            if !containsString(types, dataType) {
+                problems = append(problems, fmt.Sprintf("column %s.%s has type %s, expected %s", table, column, dataType, strings.Join(types, " or ")))
+            }
+        }
+        for column := range actual[table] {
+            if _, ok := expectedSchema[table][column]; !ok {
+                slog.Warn("unexpected column in database schema", "table", table, "column", column)
+            }
+        }
+    }
+    if len(problems) > 0 {
+        sort.Strings(problems)
+        return fmt.Errorf("schema verification failed: %s", strings.Join(problems, "; "))
+    }
+    return nil
+}
+
+func expectedTables() []string {
+    tables := make([]string, 0, len(expectedSchema))
+    for table := range expectedSchema {
+        tables = append(tables, table)
+    }
+    sort.Strings(tables)
+    return tables
+}
+
+func containsString(values []string, s string) bool {
+    for _, v := range values {
+        if v == s {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "log/slog"
+
+    "github.com/lib/pq"
+)
+
+// fullTextSearchAvailable is set at startup when items has a GIN index backing
+// full-text search. Without it, ?q= falls back to a plain ILIKE scan.
+var fullTextSearchAvailable bool
+
+const (
+    fullTextSearchClause = `to_tsvector('english', name || ' ' || description) @@ plainto_tsquery('english', $%[1]d)`
+    ilikeSearchClause    = `(name ILIKE '%%' || $%[1]d || '%%' OR description ILIKE '%%' || $%[1]d || '%%')`
+)
+
+func probeFullTextIndex(ctx context.Context, db *sql.DB) bool {
+    var exists bool
+    err := db.QueryRowContext(ctx, `SELECT EXISTS (
+        SELECT 1 FROM pg_indexes WHERE tablename = 'items' AND indexdef ILIKE '%USING gin%'
+    )`).Scan(&exists)
+    if err != nil {
+        slog.Warn("could not check for the items full-text index", "error", err)
+        return false
+    }
+    if !exists {
+        slog.Warn("no GIN full-text index on items; ?q= searches will use ILIKE")
+    }
+    return exists
+}
+
+// searchClause returns the WHERE condition for ?q=, with the search term
+// bound as placeholder $n.
+func searchClause(fullText bool, n int) string {
+    if fullText {
+        return fmt.Sprintf(fullTextSearchClause, n)
+    }
+    return fmt.Sprintf(ilikeSearchClause, n)
+}
+
+// isFullTextUnavailable reports whether err means the full-text search objects
+// are missing (undefined table or text search configuration).
+func isFullTextUnavailable(err error) bool {
+    var pqErr *pq.Error
+    if !errors.As(err, &pqErr) {
+        return false
+    }
+    return pqErr.Code == "42P01" || pqErr.Code == "42704"
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "flag"
+    "fmt"
+    "log/slog"
+    "math"
+    "math/rand"
+    "strings"
+    "time"
+)
+
+var (
+    seedAdjectives = []string{"Compact", "Deluxe", "Durable", "Ergonomic", "Heavy-Duty", "Lightweight", "Portable", "Premium", "Rugged", "Smart", "Vintage", "Wireless"}
+    seedMaterials  = []string{"Aluminium", "Bamboo", "Carbon", "Ceramic", "Copper", "Cotton", "Glass", "Leather", "Oak", "Steel", "Titanium", "Wool"}
+    seedNouns      = []string{"Backpack", "Bottle", "Chair", "Clock", "Desk", "Headphones", "Kettle", "Keyboard", "Lamp", "Mug", "Speaker", "Toolbox"}
+    seedWords      = []string{"built", "for", "everyday", "use", "with", "a", "sleek", "finish", "and", "reliable", "performance", "in", "any", "home", "or", "office", "designed", "to", "last"}
+)
+
+// runSeed implements the seed subcommand: it inserts --count generated items
+// using the same DB_* configuration as the server. The same --seed always
+// produces the same items.
+func runSeed(args []string) error {
+    flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+    count := flags.Int("count", 100, "number of items to insert")
+    seed := flags.Int64("seed", 0, "random seed for reproducible data; 0 picks one from the clock")
+    truncate := flags.Bool("truncate", false, "delete every existing item first")
+    if err := flags.Parse(args); err == flag.ErrHelp {
+        return nil
+    } else if err != nil {
+        return err
+    }
+    if *count <= 0 {
+        return fmt.Errorf("--count must be a positive integer")
+    }
+    if *seed == 0 {
+        *seed = time.Now().UnixNano()
+    }
+
+    settings, err := loadDBSettings()
+    if err != nil {
+        return err
+    }
+    seedDB, err := sql.Open("postgres", settings.dsn())
+    if err != nil {
+        return err
+    }
+    defer seedDB.Close()
+    if err := runMigrations(seedDB); err != nil {
+        return fmt.Errorf("migrating the database: %w", err)
+    }
+
+    ctx := context.Background()
+    tx, err := seedDB.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    if *truncate {
+        // CASCADE also clears the category links and audit history that
+        // reference the deleted items.
+        if _, err := tx.ExecContext(ctx, `TRUNCATE items RESTART IDENTITY CASCADE`); err != nil {
+            return err
+        }
+    }
+
+    // Generated names can collide with each other or with rows from an
+    // earlier run; those are skipped and another name is drawn.
+    stmt, err := tx.PrepareContext(ctx, `INSERT INTO items (name, description, price) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`)
+    if err != nil {
+        return err
+    }
+    defer stmt.Close()
+
+    random := rand.New(rand.NewSource(*seed))
+    inserted := 0
+    for attempts := 0; inserted < *count && attempts < *count*10; attempts++ {
+        name, description, price := seedItem(random)
+        result, err := stmt.ExecContext(ctx, name, description, price)
+        if err != nil {
+            return err
+        }
+        if n, _ := result.RowsAffected(); n > 0 {
+            inserted++
+        }
+    }
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+    if inserted < *count {
+        return fmt.Errorf("only %d of %d items could be given unique names", inserted, *count)
+    }
+    slog.Info("seeded items", "count", inserted, "seed", *seed, "truncated", *truncate)
+    return nil
+}
+
+// seedItem draws one item. Prices run from 1 to 1000 in whole cents.
+func seedItem(random *rand.Rand) (name, description string, price float64) {
+    name = fmt.Sprintf("%s %s %s",
+        seedAdjectives[random.Intn(len(seedAdjectives))],
+        seedMaterials[random.Intn(len(seedMaterials))],
+        seedNouns[random.Intn(len(seedNouns))])
+    if random.Intn(2) == 0 {
+        name += fmt.Sprintf(" %d", 100+random.Intn(900))
+    }
+
+    words := make([]string, 6+random.Intn(10))
+    for i := range words {
+        words[i] = seedWords[random.Intn(len(seedWords))]
+    }
+    description = strings.ToUpper(words[0][:1]) + strings.Join(words, " ")[1:] + "."
+
+    price = math.Round((1+random.Float64()*999)*100) / 100
+    return name, description, price
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+    "crypto/rand"
+    "database/sql"
+    "errors"
+    "math/big"
+    "net/http"
+    "strings"
+
+    "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+const (
+    skuSuffixLength = 4
+    skuAttempts     = 10
+    skuAlphabet     = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+var errSKUExhausted = errors.New("no unused SKU found")
+
+// skuSegment returns the first three ASCII letters of s in upper case,
+// padded with X when s has fewer.
+func skuSegment(s string) string {
+    var segment strings.Builder
+    for _, r := range strings.ToUpper(s) {
+        if r >= 'A' && r <= 'Z' {
+            segment.WriteRune(r)
+            if segment.Len() == 3 {
+                break
+            }
+        }
+    }
+    for segment.Len() < 3 {
+        segment.WriteByte('X')
+    }
+    return segment.String()
+}
+
+// randomSKUSuffix returns skuSuffixLength random characters of skuAlphabet.
+func randomSKUSuffix() (string, error) {
+    suffix := make([]byte, skuSuffixLength)
+    for i := range suffix {
+        n, err := rand.Int(rand.Reader, big.NewInt(int64(len(skuAlphabet))))
+        if err != nil {
+            return "", err
+        }
+        suffix[i] = skuAlphabet[n.Int64()]
+    }
+    return string(suffix), nil
+}
+
+// generateSKU gives an item without a SKU one of the form CAT-NAM-X7K2: the
+// first letters of its first category, by ID, and of its name, then a random
+// suffix. Items without a category get XXX. A suffix the tenant already uses
+// is drawn again, up to skuAttempts times. An item that has a SKU is refused
+// with 409.
+func (app *App) generateSKU(w http.ResponseWriter, r *http.Request) error {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "generateSKU", tracer.ResourceName("UPDATE items SET sku = $1 WHERE id = $2"))
+    defer span.Finish()
+
+    id, err := parseItemID(r.PathValue("id"))
+    if err != nil {
+        return &ValidationError{Code: "INVALID_ID", Message: "Invalid item ID"}
+    }
+
+    tx, err := beginTxWithRetry(ctx, db, lockedUpdateTxOptions)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    tenantID := tenantFromContext(ctx)
+    old, err := app.stmts.lockItem(ctx, tx, tenantID, id)
+    if err == sql.ErrNoRows {
+        return &NotFoundError{Resource: "Item"}
+    }
+    if err != nil {
+        return err
+    }
+    if old.SKU != "" {
+        return &ConflictError{Code: "SKU_EXISTS", Message: "The item already has a SKU", Details: map[string]string{"sku": old.SKU}}
+    }
+    if err := checkReservation(ctx, tx, tenantID, id); err != nil {
+        return err
+    }
+
+    var category string
+    err = tx.QueryRowContext(ctx, `SELECT c.name FROM item_categories ic JOIN categories c ON c.id = ic.category_id
+        WHERE ic.item_id = $1 ORDER BY c.id LIMIT 1`, id).Scan(&category)
+    if err != nil && err != sql.ErrNoRows {
+        return err
+    }
+    prefix := skuSegment(category) + "-" + skuSegment(old.Name) + "-"
+
+    item := old
+    for attempt := 0; item.SKU == ""; attempt++ {
+        if attempt == skuAttempts {
+            return errSKUExhausted
+        }
+        suffix, err := randomSKUSuffix()
+        if err != nil {
+            return err
+        }
+        var taken bool
+        err = tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM items WHERE sku = $1 AND tenant_id = $2)`, prefix+suffix, tenantID).Scan(&taken)
+        if err != nil {
+            return err
+        }
+        if !taken {
+            item.SKU = prefix + suffix
+        }
+    }
+    err = tx.QueryRowContext(ctx, `UPDATE items SET sku = $1, version = version + 1 WHERE id = $2 AND tenant_id = $3 RETURNING version`, item.SKU, id, tenantID).
+        Scan(&item.Version)
+    if err != nil {
+        return err
+    }
+    if err := recordAudit(ctx, tx, id, auditUpdate, old, item); err != nil {
+        return err
+    }
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+    evictItem(id)
+    requestLogger(ctx).Info("item SKU generated", "item_id", id, "sku", item.SKU)
+
+    if fresh, err := app.stmts.loadItem(ctx, tenantID, id); err == nil {
+        item = fresh
+    }
+    notifyItemChange(ctx, eventItemUpdated, item)
+    writeItem(w, r, item)
+    return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+    "database/sql"
+    "database/sql/driver"
+    "net/http"
+    "regexp"
+    "testing"
+
+    "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestSKUSegment(t *testing.T) {
+    tests := map[string]string{
+        "Electronics":  "ELE",
+        "laptop stand": "LAP",
+        "4k TV":        "KTV",
+        "Ü-boot":       "BOO",
+        "ab":           "ABX",
+        "":             "XXX",
+    }
+    for in, want := range tests {
+        if got := skuSegment(in); got != want {
+            t.Errorf("skuSegment(%q) = %q, want %q", in, got, want)
+        }
+    }
+}
+
+// expectSKULock expects the transaction of generateSKU up to the category
+// lookup, which returns category, or no row when it is empty.
+func expectSKULock(mock sqlmock.Sqlmock, item Item, category string) {
+    mock.ExpectBegin()
+    mock.ExpectQuery(`FOR UPDATE`).WithArgs(item.ID, defaultTenantID).WillReturnRows(lockedItemRows(item))
+    mock.ExpectQuery(`SELECT reserved_by FROM items`).WillReturnRows(sqlmock.NewRows([]string{"reserved_by"}))
+    rows := sqlmock.NewRows([]string{"name"})
+    if category != "" {
+        rows.AddRow(category)
+    }
+    mock.ExpectQuery(`SELECT c.name FROM item_categories`).WithArgs(item.ID).WillReturnRows(rows)
+}
+
+func TestGenerateSKU(t *testing.T) {
+    mock := mockDB(t)
+    rt := newStockRouter(t, mock)
+    item := Item{ID: 3, Name: "Laptop", Price: 999, Version: 2}
+
+    expectSKULock(mock, item, "Electronics")
+    mock.ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM items WHERE sku = \$1`).WithArgs(skuArg{}, defaultTenantID).
+        WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+    mock.ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM items WHERE sku = \$1`).WithArgs(skuArg{}, defaultTenantID).
+        WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+    mock.ExpectQuery(`UPDATE items SET sku = \$1`).WithArgs(skuArg{}, 3, defaultTenantID).
+        WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+    mock.ExpectExec(`INSERT INTO audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+    mock.ExpectCommit()
+    mock.ExpectQuery(`SELECT .* FROM items WHERE id = \$1`).WillReturnError(sql.ErrConnDone)
+
+    rec := doRequest(t, rt, http.MethodPost, "/items/3/generate-sku", nil, testToken(t, nil))
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+    }
+    var got Item
+    decodeBody(t, rec, &got)
+    if !skuFormat.MatchString(got.SKU) || got.SKU[:8] != "ELE-LAP-" || got.Version != 3 {
+        t.Errorf("item = %+v, want an ELE-LAP- SKU at version 3", got)
+    }
+}
+
+func TestGenerateSKUWithoutCategory(t *testing.T) {
+    mock := mockDB(t)
+    rt := newStockRouter(t, mock)
+    item := Item{ID: 3, Name: "Go", Price: 1, Version: 1}
+
+    expectSKULock(mock, item, "")
+    mock.ExpectQuery(`SELECT EXISTS`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+    mock.ExpectQuery(`UPDATE items SET sku`).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+    mock.ExpectExec(`INSERT INTO audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+    mock.ExpectCommit()
+    mock.ExpectQuery(`SELECT .* FROM items WHERE id = \$1`).WillReturnError(sql.ErrConnDone)
+
+    rec := doRequest(t, rt, http.MethodPost, "/items/3/generate-sku", nil, testToken(t, nil))
+    var got Item
+    decodeBody(t, rec, &got)
+    if rec.Code != http.StatusOK || got.SKU[:8] != "XXX-GOX-" {
+        t.Errorf("status %d, SKU %q; want 200 with an XXX-GOX- SKU", rec.Code, got.SKU)
+    }
+}
+
+func TestGenerateSKUExhausted(t *testing.T) {
+    mock := mockDB(t)
+    rt := newStockRouter(t, mock)
+    item := Item{ID: 3, Name: "Laptop", Price: 1, Version: 1}
+
+    expectSKULock(mock, item, "Electronics")
+    for i := 0; i < skuAttempts; i++ {
+        mock.ExpectQuery(`SELECT EXISTS`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+    }
+    mock.ExpectRollback()
+
+    rec := doRequest(t, rt, http.MethodPost, "/items/3/generate-sku", nil, testToken(t, nil))
+    if rec.Code != http.StatusInternalServerError {
+        t.Errorf("status %d, body %s; want 500", rec.Code, rec.Body)
+    }
+}
+
+func TestGenerateSKUExisting(t *testing.T) {
+    mock := mockDB(t)
+    rt := newStockRouter(t, mock)
+
+    mock.ExpectBegin()
+    mock.ExpectQuery(`FOR UPDATE`).WillReturnRows(lockedItemRows(Item{ID: 3, Name: "Laptop", Price: 1, SKU: "ELE-LAP-AB12"}))
+    mock.ExpectRollback()
+
+    rec := doRequest(t, rt, http.MethodPost, "/items/3/generate-sku", nil, testToken(t, nil))
+    if rec.Code != http.StatusConflict || errorCode(t, rec) != "SKU_EXISTS" {
+        t.Errorf("status %d, body %s; want 409 SKU_EXISTS", rec.Code, rec.Body)
+    }
+}
+
+func TestGenerateSKUNotFound(t *testing.T) {
+    mock := mockDB(t)
+    rt := newStockRouter(t, mock)
+
+    mock.ExpectBegin()
+    mock.ExpectQuery(`FOR UPDATE`).WithArgs(3, defaultTenantID).WillReturnError(sql.ErrNoRows)
+    mock.ExpectRollback()
+
+    rec := doRequest(t, rt, http.MethodPost, "/items/3/generate-sku", nil, testToken(t, nil))
+    if rec.Code != http.StatusNotFound {
+        t.Errorf("status %d, body %s; want 404", rec.Code, rec.Body)
+    }
+}
+
+var skuFormat = regexp.MustCompile(`^[A-Z]{3}-[A-Z]{3}-[A-Z0-9]{4}$`)
+
+// skuArg matches any argument of the SKU format.
+type skuArg struct{}
+
+func (skuArg) Match(v driver.Value) bool {
+    s, ok := v.(string)
+    return ok && skuFormat.MatchString(s)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+
+    "github.com/google/uuid"
+    "github.com/prometheus/client_golang/prometheus"
+)
+
+// itemColumns is the column list every item statement selects, in the order
+// the Scan calls expect.
+const itemColumns = `id, name, description, price, version, COALESCE(image_url, ''), COALESCE(sku, ''), metadata`
+
+// Statements holds the prepared statements of the single-item operations.
+// Each one is confined to the tenant passed with it.
+// database/sql prepares each one lazily on every pooled connection and reuses
+// it there, so the query plan is built once per connection. Handlers reach
+// it through App rather than a global.
+type Statements struct {
+    Insert *sql.Stmt
+    Get    *sql.Stmt
+    Lock   *sql.Stmt
+    Update *sql.Stmt
+    Delete *sql.Stmt
+}
+
+func prepareStatements(db *sql.DB) (*Statements, error) {
+    stmts := &Statements{}
+    queries := []struct {
+        dest  **sql.Stmt
+        query string
+    }{
+        {&stmts.Insert, `INSERT INTO items (name, description, price, metadata, tenant_id) VALUES ($1, $2, $3, $4, $5) RETURNING id, version`},
+        {&stmts.Get, `SELECT ` + itemColumns + ` FROM items WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL`},
+        {&stmts.Lock, `SELECT ` + itemColumns + ` FROM items WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL FOR UPDATE`},
+        // A NULL metadata keeps the stored value; a NULL version makes the
+        // update unconditional.
+        {&stmts.Update, `UPDATE items SET name = $1, description = $2, price = $3, metadata = COALESCE($5, metadata),
+            version = version + 1 WHERE id = $4 AND tenant_id = $7 AND ($6::integer IS NULL OR version = $6)`},
+        {&stmts.Delete, `UPDATE items SET deleted_at = NOW() WHERE id = $1 AND tenant_id = $2`},
+    }
+    for _, q := range queries {
+        stmt, err := db.Prepare(q.query)
+        if err != nil {
+            stmts.Close()
+            return nil, fmt.Errorf("preparing %q: %w", q.query, err)
+        }
+        *q.dest = stmt
+    }
+    return stmts, nil
+}
+
+func (s *Statements) Close() {
+    for _, stmt := range []*sql.Stmt{s.Insert, s.Get, s.Lock, s.Update, s.Delete} {
+        if stmt != nil {
+            stmt.Close()
+        }
+    }
+}
+
+func (s *Statements) fetchItem(ctx context.Context, tenantID uuid.UUID, id int) (Item, error) {
+    var item Item
+    defer prometheus.NewTimer(dbQueryDuration.WithLabelValues("read")).ObserveDuration()
+    err := s.Get.QueryRowContext(ctx, id, tenantID).Scan(&item.ID, &item.Name, &item.Description, &item.Price, &item.Version, &item.ImageURL, &item.SKU, &item.Metadata)
+    return item, err
+}
+
+// lockItem reads a live item and locks its row until tx ends.
+func (s *Statements) lockItem(ctx context.Context, tx *sql.Tx, tenantID uuid.UUID, id int) (Item, error) {
+    var item Item
+    err := tx.StmtContext(ctx, s.Lock).QueryRowContext(ctx, id, tenantID).
+        Scan(&item.ID, &item.Name, &item.Description, &item.Price, &item.Version, &item.ImageURL, &item.SKU, &item.Metadata)
+    return item, err
+}
+
+// loadItem fetches an item with its categories, as GET /items/{id} serves it.
+func (s *Statements) loadItem(ctx context.Context, tenantID uuid.UUID, id int) (Item, error) {
+    item, err := s.fetchItem(ctx, tenantID, id)
+    if err != nil {
+        return Item{}, err
+    }
+    items := []Item{item}
+    if err := attachCategories(ctx, db, items); err != nil {
+        return Item{}, err
+    }
+    return items[0], nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "testing"
+)
+
+func TestPrepareStatements(t *testing.T) {
+    mock := mockDB(t)
+    mock.ExpectPrepare(`INSERT INTO items`)
+    get := mock.ExpectPrepare(`SELECT .* FROM items WHERE id = \$1 AND tenant_id = \$2 AND deleted_at IS NULL$`)
+    mock.ExpectPrepare(`FOR UPDATE$`)
+    mock.ExpectPrepare(`UPDATE items SET name = \$1`)
+    mock.ExpectPrepare(`UPDATE items SET deleted_at = NOW\(\)`)
+
+    stmts, err := prepareStatements(db)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // Two reads run the statement prepared above; nothing is prepared again.
+    for i := 0; i < 2; i++ {
+        get.ExpectQuery().WithArgs(3, defaultTenantID).WillReturnRows(lockedItemRows(Item{ID: 3, Name: "Widget", Price: 1, Version: 2}))
+    }
+    for i := 0; i < 2; i++ {
+        item, err := stmts.fetchItem(context.Background(), defaultTenantID, 3)
+        if err != nil || item.Name != "Widget" || item.Version != 2 {
+            t.Errorf("fetchItem = %+v, %v", item, err)
+        }
+    }
+}
+
+func TestPrepareStatementsFailure(t *testing.T) {
+    mock := mockDB(t)
+    mock.ExpectPrepare(`INSERT INTO items`).WillBeClosed()
+    mock.ExpectPrepare(`SELECT`).WillBeClosed()
+    mock.ExpectPrepare(`FOR UPDATE`).WillReturnError(errors.New(`relation "items" does not exist`))
+
+    stmts, err := prepareStatements(db)
+    if err == nil || stmts != nil {
+        t.Fatalf("prepareStatements = %v, %v; want an error", stmts, err)
+    }
+}
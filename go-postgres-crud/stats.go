@@ -0,0 +1,207 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "net/http"
+    "strconv"
+    "sync"
+    "time"
+
+    "github.com/google/uuid"
+    "github.com/prometheus/client_golang/prometheus"
+    "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+const defaultStatsBucketSize = 10.0
+
+// statsCacheTTL is STATS_CACHE_TTL_SECONDS: how long a computed result is
+// served before the aggregate query runs again.
+var statsCacheTTL = 30 * time.Second
+
+type itemStats struct {
+    TotalItems         int             `json:"total_items"`
+    AveragePrice       float64         `json:"average_price"`
+    MinPrice           float64         `json:"min_price"`
+    MaxPrice           float64         `json:"max_price"`
+    TotalValue         float64         `json:"total_value"`
+    BucketSize         float64         `json:"bucket_size"`
+    ItemsByPriceBucket json.RawMessage `json:"items_by_price_bucket"`
+}
+
+type cachedStats struct {
+    stats   itemStats
+    expires time.Time
+}
+
+type statsCacheKey struct {
+    tenantID   uuid.UUID
+    bucketSize float64
+}
+
+// statsCache keeps one result per tenant and bucket size. It is separate from
+// itemCache, which only holds single items.
+var (
+    statsCacheMu sync.Mutex
+    statsCache   = map[statsCacheKey]cachedStats{}
+)
+
+// getItemStats returns aggregate figures over the tenant's live catalog plus
+// a price histogram. ?bucket_size sets the histogram bucket width (default
+// 10).
+func getItemStats(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    span, ctx := tracer.StartSpanFromContext(ctx, "getItemStats", tracer.ResourceName("SELECT COUNT(*), AVG(price), MIN(price), MAX(price), SUM(price) FROM items"))
+    defer span.Finish()
+
+    bucketSize := defaultStatsBucketSize
+    if raw := r.URL.Query().Get("bucket_size"); raw != "" {
+        value, err := strconv.ParseFloat(raw, 64)
+        if err != nil || value < 0.01 {
+            writeError(w, http.StatusBadRequest, "INVALID_QUERY", "bucket_size must be a number of at least 0.01")
+            return
+        }
+        bucketSize = value
+    }
+
+    key := statsCacheKey{tenantID: tenantFromContext(ctx), bucketSize: bucketSize}
+    statsCacheMu.Lock()
+    cached, ok := statsCache[key]
+    statsCacheMu.Unlock()
+    if ok && time.Now().Before(cached.expires) {
+        writeJSON(w, http.StatusOK, cached.stats)
+        return
+    }
+
+    stats, err := queryItemStats(ctx, key.tenantID, bucketSize)
+    if err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+    statsCacheMu.Lock()
+    for k, entry := range statsCache {
+        if time.Now().After(entry.expires) {
+            delete(statsCache, k)
+        }
+    }
+    statsCache[key] = cachedStats{stats: stats, expires: time.Now().Add(statsCacheTTL)}
+    statsCacheMu.Unlock()
+
+    writeJSON(w, http.StatusOK, stats)
+}
+
+// queryItemStats computes the totals and the histogram in one statement.
+// Buckets are half-open ranges [min, max) and only non-empty ones are listed.
+func queryItemStats(ctx context.Context, tenantID uuid.UUID, bucketSize float64) (itemStats, error) {
+    sqlStatement := `WITH live AS (
+            SELECT price FROM items WHERE tenant_id = $2 AND deleted_at IS NULL
+        ), buckets AS (
+            SELECT FLOOR(price / $1::numeric) * $1::numeric AS lower, COUNT(*) AS count
+            FROM live GROUP BY 1
+        )
+        SELECT COUNT(*), COALESCE(AVG(price), 0), COALESCE(MIN(price), 0), COALESCE(MAX(price), 0), COALESCE(SUM(price), 0),
+            COALESCE((SELECT json_agg(json_build_object('min', lower, 'max', lower + $1::numeric, 'count', count) ORDER BY lower) FROM buckets), '[]')
+        FROM live`
+    stats := itemStats{BucketSize: bucketSize}
+    var buckets []byte
+    defer prometheus.NewTimer(dbQueryDuration.WithLabelValues("read")).ObserveDuration()
+    err := withReadFallback(ctx, readDB(), func(q *sql.DB) error {
+        return q.QueryRowContext(ctx, sqlStatement, bucketSize, tenantID).Scan(&stats.TotalItems, &stats.AveragePrice, &stats.MinPrice,
+            &stats.MaxPrice, &stats.TotalValue, &buckets)
+    })
+    stats.ItemsByPriceBucket = buckets
+    return stats, err
+}
+
+const itemCountsCacheTTL = 10 * time.Second
+
+// itemCounts is the response of GET /items/count. ByCategory maps category
+// slugs to their live items; it is left out, rather than sent empty, while no
+// item has a category.
+type itemCounts struct {
+    Total      int            `json:"total"`
+    ByCategory map[string]int `json:"by_category,omitempty"`
+}
+
+type cachedCounts struct {
+    counts  itemCounts
+    expires time.Time
+}
+
+// itemCountsCache keeps one result per tenant.
+var (
+    itemCountsMu    sync.Mutex
+    itemCountsCache = map[uuid.UUID]cachedCounts{}
+)
+
+// getItemCounts returns the number of the tenant's live items, in total and
+// per category, cached for 10 seconds.
+func getItemCounts(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    span, ctx := tracer.StartSpanFromContext(ctx, "getItemCounts", tracer.ResourceName("SELECT COUNT(*)"))
+    defer span.Finish()
+
+    tenantID := tenantFromContext(ctx)
+    itemCountsMu.Lock()
+    cached, ok := itemCountsCache[tenantID]
+    itemCountsMu.Unlock()
+    if ok && time.Now().Before(cached.expires) {
+        writeJSON(w, http.StatusOK, cached.counts)
+        return
+    }
+
+    counts, err := queryItemCounts(ctx, tenantID)
+    if err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+    itemCountsMu.Lock()
+    for id, entry := range itemCountsCache {
+        if time.Now().After(entry.expires) {
+            delete(itemCountsCache, id)
+        }
+    }
+    itemCountsCache[tenantID] = cachedCounts{counts: counts, expires: time.Now().Add(itemCountsCacheTTL)}
+    itemCountsMu.Unlock()
+
+    writeJSON(w, http.StatusOK, counts)
+}
+
+// queryItemCounts gets both figures from one ROLLUP: the grand total row has
+// GROUPING(c.slug) = 1, and a per-slug row with a NULL slug counts the items
+// without a category. An item in several categories counts once in the total.
+func queryItemCounts(ctx context.Context, tenantID uuid.UUID) (itemCounts, error) {
+    sqlStatement := `SELECT GROUPING(c.slug) = 1, c.slug, COUNT(DISTINCT i.id)
+        FROM items i
+        LEFT JOIN item_categories ic ON ic.item_id = i.id
+        LEFT JOIN categories c ON c.id = ic.category_id
+        WHERE i.tenant_id = $1 AND i.deleted_at IS NULL
+        GROUP BY ROLLUP (c.slug)`
+    defer prometheus.NewTimer(dbQueryDuration.WithLabelValues("read")).ObserveDuration()
+    var counts itemCounts
+    err := withReadFallback(ctx, readDB(), func(q *sql.DB) error {
+        rows, err := q.QueryContext(ctx, sqlStatement, tenantID)
+        if err != nil {
+            return err
+        }
+        defer rows.Close()
+
+        counts = itemCounts{ByCategory: map[string]int{}}
+        for rows.Next() {
+            var isTotal bool
+            var slug sql.NullString
+            var count int
+            if err := rows.Scan(&isTotal, &slug, &count); err != nil {
+                return err
+            }
+            if isTotal {
+                counts.Total = count
+            } else if slug.Valid {
+                counts.ByCategory[slug.String] = count
+            }
+        }
+        return rows.Err()
+    })
+    return counts, err
+}
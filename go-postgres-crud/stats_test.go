@@ -0,0 +1,64 @@
+package main
+
+import (
+    "net/http"
+    "reflect"
+    "strings"
+    "testing"
+
+    "github.com/DATA-DOG/go-sqlmock"
+    "github.com/golang-jwt/jwt/v5"
+    "github.com/google/uuid"
+)
+
+// resetItemCounts empties the GET /items/count cache.
+func resetItemCounts(t *testing.T) {
+    t.Helper()
+    itemCountsMu.Lock()
+    itemCountsCache = map[uuid.UUID]cachedCounts{}
+    itemCountsMu.Unlock()
+}
+
+func countRows() *sqlmock.Rows {
+    return sqlmock.NewRows([]string{"is_total", "slug", "count"})
+}
+
+func TestGetItemCounts(t *testing.T) {
+    resetItemCounts(t)
+    mock := mockDB(t)
+    rt := newMockApp(t, storedItems())
+    // Four items: two in electronics, one of them also in books, and one
+    // without a category. The total counts each item once.
+    mock.ExpectQuery(`GROUP BY ROLLUP \(c.slug\)`).WithArgs(defaultTenantID).
+        WillReturnRows(countRows().AddRow(false, "books", 1).AddRow(false, "electronics", 2).AddRow(false, nil, 1).AddRow(true, nil, 3))
+
+    want := itemCounts{Total: 3, ByCategory: map[string]int{"books": 1, "electronics": 2}}
+    for i := 0; i < 2; i++ {
+        // The second request is answered from the cache.
+        rec := doRequest(t, rt, http.MethodGet, "/items/count", nil, "")
+        var got itemCounts
+        decodeBody(t, rec, &got)
+        if rec.Code != http.StatusOK || !reflect.DeepEqual(got, want) {
+            t.Errorf("request %d: status %d, counts %+v; want %+v", i+1, rec.Code, got, want)
+        }
+    }
+
+    // Another tenant's counts are its own.
+    other := uuid.New()
+    mock.ExpectQuery(`GROUP BY ROLLUP`).WithArgs(other).WillReturnRows(countRows().AddRow(true, nil, 0))
+    rec := doRequest(t, rt, http.MethodGet, "/items/count", nil, testToken(t, jwt.MapClaims{"tenant_id": other.String()}))
+    if strings.TrimSpace(rec.Body.String()) != `{"total":0}` {
+        t.Errorf("other tenant: body %s, want a total of 0", rec.Body)
+    }
+}
+
+func TestGetItemCountsWithoutCategories(t *testing.T) {
+    resetItemCounts(t)
+    mock := mockDB(t)
+    mock.ExpectQuery(`GROUP BY ROLLUP`).WillReturnRows(countRows().AddRow(false, nil, 2).AddRow(true, nil, 2))
+
+    rec := doRequest(t, newMockApp(t, storedItems()), http.MethodGet, "/items/count", nil, "")
+    if got := strings.TrimSpace(rec.Body.String()); rec.Code != http.StatusOK || got != `{"total":2}` {
+        t.Errorf("status %d, body %s; want {\"total\":2} without by_category", rec.Code, got)
+    }
+}
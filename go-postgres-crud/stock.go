@@ -0,0 +1,331 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/google/uuid"
+    "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// Reference types of a stock movement, the values of the
+// stock_reference_type enum.
+const (
+    stockReferenceAdjustment  = "adjustment"
+    stockReferenceRestock     = "restock"
+    stockReferenceReservation = "reservation"
+)
+
+const stockHistoryPageSize = 50
+
+// errOutOfStock rejects a change that would take the stock below zero.
+var errOutOfStock = errors.New("item is out of stock")
+
+// stockMovement is one change of an item's stock, as GET
+// /items/{id}/stock-history lists it.
+type stockMovement struct {
+    ID            int64     `json:"id"`
+    ItemID        int       `json:"item_id"`
+    Delta         int       `json:"delta"`
+    Reason        string    `json:"reason"`
+    ReferenceType string    `json:"reference_type"`
+    ReferenceID   *string   `json:"reference_id"`
+    Actor         string    `json:"actor"`
+    StockAfter    int       `json:"stock_after"`
+    CreatedAt     time.Time `json:"created_at"`
+}
+
+// recordStockMovement applies m.Delta to the stock of the tenant's item and
+// records the movement, filling in its ID, StockAfter and CreatedAt. Callers
+// lock the row first. A change that would take the stock below zero fails
+// with errOutOfStock.
+func recordStockMovement(ctx context.Context, tx *sql.Tx, tenantID uuid.UUID, m stockMovement) (stockMovement, error) {
+    err := tx.QueryRowContext(ctx, `UPDATE items SET stock = stock + $1
+        WHERE id = $2 AND tenant_id = $3 AND stock + $1 >= 0 RETURNING stock`, m.Delta, m.ItemID, tenantID).Scan(&m.StockAfter)
+    if err == sql.ErrNoRows {
+        return m, errOutOfStock
+    }
+    if err != nil {
+        return m, err
+    }
+    err = tx.QueryRowContext(ctx, `INSERT INTO stock_movements (tenant_id, item_id, delta, reason, reference_type, reference_id, actor, stock_after)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at`,
+        tenantID, m.ItemID, m.Delta, m.Reason, m.ReferenceType, m.ReferenceID, m.Actor, m.StockAfter).Scan(&m.ID, &m.CreatedAt)
+    return m, err
+}
+
+// releaseExpiredReservationsQuery returns the reserved unit of every expired
+// reservation matching where to stock, recording each as a movement by the
+// system.
+func releaseExpiredReservationsQuery(where string) string {
+    return `WITH expired AS (
+            UPDATE items SET reserved_by = NULL, reserved_until = NULL, stock = stock + 1
+            WHERE reserved_until <= NOW()` + where + `
+            RETURNING id, tenant_id, stock
+        )
+        INSERT INTO stock_movements (tenant_id, item_id, delta, reason, reference_type, actor, stock_after)
+        SELECT tenant_id, id, 1, 'reservation expired', 'reservation', 'system', stock FROM expired`
+}
+
+// releaseExpiredReservation releases the tenant's item id if its reservation
+// has expired but not been swept yet, so the unit it held counts again.
+func releaseExpiredReservation(ctx context.Context, tx *sql.Tx, tenantID uuid.UUID, id int) error {
+    _, err := tx.ExecContext(ctx, releaseExpiredReservationsQuery(` AND id = $1 AND tenant_id = $2`), id, tenantID)
+    return err
+}
+
+type stockAdjustmentRequest struct {
+    Delta         int     `json:"delta"`
+    ReferenceType string  `json:"reference_type"`
+    ReferenceID   *string `json:"reference_id"`
+    Reason        string  `json:"reason"`
+}
+
+// adjustStock changes the stock of an item by delta. reference_type is
+// "adjustment" (the default) or "restock", which must add stock; reason
+// defaults to the reference type. The movement is returned with 201. A
+// restock from zero sends the item's restock alerts to its item.restocked
+// webhooks.
+func (app *App) adjustStock(w http.ResponseWriter, r *http.Request) error {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "adjustStock", tracer.ResourceName("UPDATE items SET stock"))
+    defer span.Finish()
+
+    id, err := parseItemID(r.PathValue("id"))
+    if err != nil {
+        return &ValidationError{Code: "INVALID_ID", Message: "Invalid item ID"}
+    }
+    var req stockAdjustmentRequest
+    err = json.NewDecoder(r.Body).Decode(&req)
+    if err != nil {
+        return bodyError(err, "Request body is not valid JSON")
+    }
+    if req.ReferenceType == "" {
+        req.ReferenceType = stockReferenceAdjustment
+    }
+    switch {
+    case req.ReferenceType != stockReferenceAdjustment && req.ReferenceType != stockReferenceRestock:
+        return &ValidationError{Code: "INVALID_BODY", Message: "reference_type must be adjustment or restock"}
+    case req.Delta == 0:
+        return &ValidationError{Code: "INVALID_BODY", Message: "delta must not be 0"}
+    case req.ReferenceType == stockReferenceRestock && req.Delta < 0:
+        return &ValidationError{Code: "INVALID_BODY", Message: "a restock must add stock"}
+    }
+    reason := strings.TrimSpace(req.Reason)
+    if reason == "" {
+        reason = req.ReferenceType
+    }
+
+    tx, err := beginTxWithRetry(ctx, db, lockedUpdateTxOptions)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    tenantID := tenantFromContext(ctx)
+    _, err = app.stmts.lockItem(ctx, tx, tenantID, id)
+    if err == sql.ErrNoRows {
+        return &NotFoundError{Resource: "Item"}
+    }
+    if err != nil {
+        return err
+    }
+    movement, err := recordStockMovement(ctx, tx, tenantID, stockMovement{
+        ItemID:        id,
+        Delta:         req.Delta,
+        Reason:        reason,
+        ReferenceType: req.ReferenceType,
+        ReferenceID:   req.ReferenceID,
+        Actor:         userIDFromContext(ctx),
+    })
+    if err != nil {
+        return err
+    }
+    // A restock of an item that had run out fires its restock alerts.
+    var emails []string
+    if req.ReferenceType == stockReferenceRestock && movement.StockAfter == movement.Delta {
+        emails, err = claimRestockAlerts(ctx, tx, tenantID, id)
+        if err != nil {
+            return err
+        }
+    }
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+    if len(emails) > 0 {
+        dispatchWebhook(ctx, eventItemRestocked, map[string]interface{}{
+            "item_id": id,
+            "stock":   movement.StockAfter,
+            "emails":  emails,
+        })
+    }
+
+    writeJSON(w, http.StatusCreated, movement)
+    return nil
+}
+
+type reserveReleaseRequest struct {
+    Reserve   int     `json:"reserve"`
+    Release   int     `json:"release"`
+    SessionID *string `json:"session_id"`
+}
+
+// reserveReleaseStock takes reserve units of an item's stock and returns
+// release units in a single movement, so a checkout that reserved too much
+// can hand back the excess in the same call. The stock changes by release -
+// reserve in one conditional UPDATE, and the request fails with 409 without
+// changing anything when that would take it below zero. session_id becomes
+// the movement's reference.
+func (app *App) reserveReleaseStock(w http.ResponseWriter, r *http.Request) error {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "reserveReleaseStock", tracer.ResourceName("UPDATE items SET stock"))
+    defer span.Finish()
+
+    id, err := parseItemID(r.PathValue("id"))
+    if err != nil {
+        return &ValidationError{Code: "INVALID_ID", Message: "Invalid item ID"}
+    }
+    var req reserveReleaseRequest
+    err = json.NewDecoder(r.Body).Decode(&req)
+    if err != nil {
+        return bodyError(err, "Request body is not valid JSON")
+    }
+    switch {
+    case req.Reserve < 0 || req.Release < 0:
+        return &ValidationError{Code: "INVALID_BODY", Message: "reserve and release must not be negative"}
+    case req.Reserve == 0 && req.Release == 0:
+        return &ValidationError{Code: "INVALID_BODY", Message: "reserve or release must be positive"}
+    }
+
+    tx, err := beginTxWithRetry(ctx, db, lockedUpdateTxOptions)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    tenantID := tenantFromContext(ctx)
+    _, err = app.stmts.lockItem(ctx, tx, tenantID, id)
+    if err == sql.ErrNoRows {
+        return &NotFoundError{Resource: "Item"}
+    }
+    if err != nil {
+        return err
+    }
+    movement, err := recordStockMovement(ctx, tx, tenantID, stockMovement{
+        ItemID:        id,
+        Delta:         req.Release - req.Reserve,
+        Reason:        fmt.Sprintf("reserved %d, released %d", req.Reserve, req.Release),
+        ReferenceType: stockReferenceReservation,
+        ReferenceID:   req.SessionID,
+        Actor:         userIDFromContext(ctx),
+    })
+    if err != nil {
+        return err
+    }
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "item_id":  id,
+        "reserved": req.Reserve,
+        "released": req.Release,
+        "stock":    movement.StockAfter,
+        "movement": movement,
+    })
+    return nil
+}
+
+// getStockHistory lists the stock movements of one of the tenant's items
+// oldest first, stockHistoryPageSize to a page, with the current stock. The
+// optional from and to dates (YYYY-MM-DD) bound the range, both inclusive.
+// Deleted items keep their history.
+func getStockHistory(w http.ResponseWriter, r *http.Request) error {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "getStockHistory", tracer.ResourceName("SELECT FROM stock_movements WHERE item_id = $1"))
+    defer span.Finish()
+
+    id, err := parseItemID(r.PathValue("id"))
+    if err != nil {
+        return &ValidationError{Code: "INVALID_ID", Message: "Invalid item ID"}
+    }
+    from, err := parseHistoryDate(r, "from")
+    if err != nil {
+        return &ValidationError{Code: "INVALID_QUERY", Message: err.Error()}
+    }
+    to, err := parseHistoryDate(r, "to")
+    if err != nil {
+        return &ValidationError{Code: "INVALID_QUERY", Message: err.Error()}
+    }
+    if to != nil {
+        // Include the whole of the to date.
+        end := to.AddDate(0, 0, 1)
+        to = &end
+    }
+    if from != nil && to != nil && !from.Before(*to) {
+        return &ValidationError{Code: "INVALID_QUERY", Message: "from must not be after to"}
+    }
+    page := 1
+    if raw := r.URL.Query().Get("page"); raw != "" {
+        page, err = strconv.Atoi(raw)
+        if err != nil || page < 1 || page > math.MaxInt32/stockHistoryPageSize {
+            return &ValidationError{Code: "INVALID_QUERY", Message: "page must be a positive integer"}
+        }
+    }
+
+    tenantID := tenantFromContext(ctx)
+    var currentStock int
+    err = withReadFallback(ctx, selectDB(r), func(q *sql.DB) error {
+        return q.QueryRowContext(ctx, `SELECT stock FROM items WHERE id = $1 AND tenant_id = $2`, id, tenantID).Scan(&currentStock)
+    })
+    if err == sql.ErrNoRows {
+        return &NotFoundError{Resource: "Item"}
+    }
+    if err != nil {
+        return err
+    }
+
+    rows, err := queryRead(r, `SELECT id, item_id, delta, reason, reference_type, reference_id, actor, stock_after, created_at
+        FROM stock_movements
+        WHERE tenant_id = $1 AND item_id = $2
+            AND ($3::timestamptz IS NULL OR created_at >= $3) AND ($4::timestamptz IS NULL OR created_at < $4)
+        ORDER BY created_at, id
+        LIMIT $5 OFFSET $6`, tenantID, id, from, to, stockHistoryPageSize, (page-1)*stockHistoryPageSize)
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+
+    movements := []stockMovement{}
+    for rows.Next() {
+        var m stockMovement
+        var referenceID sql.NullString
+        err := rows.Scan(&m.ID, &m.ItemID, &m.Delta, &m.Reason, &m.ReferenceType, &referenceID, &m.Actor, &m.StockAfter, &m.CreatedAt)
+        if err != nil {
+            return err
+        }
+        if referenceID.Valid {
+            m.ReferenceID = &referenceID.String
+        }
+        movements = append(movements, m)
+    }
+    if err := rows.Err(); err != nil {
+        return err
+    }
+
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "item_id":       id,
+        "movements":     movements,
+        "current_stock": currentStock,
+        "page":          page,
+    })
+    return nil
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "net/http"
+    "testing"
+    "time"
+
+    "github.com/DATA-DOG/go-sqlmock"
+)
+
+// newStockRouter serves the routes over the mock database of mockDB.
+func newStockRouter(t *testing.T, mock sqlmock.Sqlmock) *router {
+    t.Helper()
+    return newTestRouter(NewApp(storedItems(), mockStatements(t, mock), NewFeatureFlags(nil), nil))
+}
+
+func TestAdjustStock(t *testing.T) {
+    mock := mockDB(t)
+    rt := newStockRouter(t, mock)
+    createdAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+    mock.ExpectBegin()
+    mock.ExpectQuery(`FOR UPDATE`).WithArgs(3, defaultTenantID).WillReturnRows(lockedItemRows(Item{ID: 3, Name: "Widget", Price: 1}))
+    mock.ExpectQuery(`UPDATE items SET stock = stock \+ \$1`).WithArgs(5, 3, defaultTenantID).
+        WillReturnRows(sqlmock.NewRows([]string{"stock"}).AddRow(12))
+    mock.ExpectQuery(`INSERT INTO stock_movements`).
+        WithArgs(defaultTenantID, 3, 5, "restock", "restock", "PO-17", "test-user", 12).
+        WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(41, createdAt))
+    mock.ExpectCommit()
+
+    body := map[string]interface{}{"delta": 5, "reference_type": "restock", "reference_id": "PO-17"}
+    rec := doRequest(t, rt, http.MethodPost, "/items/3/stock", body, testToken(t, nil))
+    if rec.Code != http.StatusCreated {
+        t.Fatalf("status = %d, want 201: %s", rec.Code, rec.Body)
+    }
+    var movement stockMovement
+    decodeBody(t, rec, &movement)
+    if movement.ID != 41 || movement.Delta != 5 || movement.StockAfter != 12 || movement.Actor != "test-user" ||
+        movement.ReferenceID == nil || *movement.ReferenceID != "PO-17" {
+        t.Errorf("movement = %+v", movement)
+    }
+}
+
+func TestAdjustStockOutOfStock(t *testing.T) {
+    mock := mockDB(t)
+    rt := newStockRouter(t, mock)
+
+    mock.ExpectBegin()
+    mock.ExpectQuery(`FOR UPDATE`).WillReturnRows(lockedItemRows(Item{ID: 3, Name: "Widget", Price: 1}))
+    mock.ExpectQuery(`UPDATE items SET stock`).WithArgs(-4, 3, defaultTenantID).WillReturnRows(sqlmock.NewRows([]string{"stock"}))
+    mock.ExpectRollback()
+
+    rec := doRequest(t, rt, http.MethodPost, "/items/3/stock", map[string]interface{}{"delta": -4}, testToken(t, nil))
+    if rec.Code != http.StatusConflict || errorCode(t, rec) != "OUT_OF_STOCK" {
+        t.Errorf("status %d, body %s; want 409 OUT_OF_STOCK", rec.Code, rec.Body)
+    }
+}
+
+func TestAdjustStockValidation(t *testing.T) {
+    tests := []struct {
+        name string
+        body interface{}
+    }{
+        {"zero delta", map[string]interface{}{"delta": 0}},
+        {"negative restock", map[string]interface{}{"delta": -1, "reference_type": "restock"}},
+        {"reservation", map[string]interface{}{"delta": -1, "reference_type": "reservation"}},
+        {"malformed JSON", `{"delta": `},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            rt := newStockRouter(t, mockDB(t))
+            rec := doRequest(t, rt, http.MethodPost, "/items/3/stock", tt.body, testToken(t, nil))
+            if rec.Code != http.StatusBadRequest {
+                t.Errorf("status %d, body %s; want 400", rec.Code, rec.Body)
+            }
+        })
+    }
+}
+
+func TestReserveReleaseStock(t *testing.T) {
+    mock := mockDB(t)
+    rt := newStockRouter(t, mock)
+
+    mock.ExpectBegin()
+    mock.ExpectQuery(`FOR UPDATE`).WithArgs(3, defaultTenantID).WillReturnRows(lockedItemRows(Item{ID: 3, Name: "Widget", Price: 1}))
+    // One update applies both halves.
+    mock.ExpectQuery(`UPDATE items SET stock = stock \+ \$1\s+WHERE id = \$2 AND tenant_id = \$3 AND stock \+ \$1 >= 0`).
+        WithArgs(-2, 3, defaultTenantID).WillReturnRows(sqlmock.NewRows([]string{"stock"}).AddRow(8))
+    mock.ExpectQuery(`INSERT INTO stock_movements`).
+        WithArgs(defaultTenantID, 3, -2, "reserved 5, released 3", "reservation", "abc", "test-user", 8).
+        WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(42, time.Now()))
+    mock.ExpectCommit()
+
+    body := map[string]interface{}{"reserve": 5, "release": 3, "session_id": "abc"}
+    rec := doRequest(t, rt, http.MethodPatch, "/items/3/stock/reserve-release", body, testToken(t, nil))
+    var got struct {
+        Stock    int           `json:"stock"`
+        Movement stockMovement `json:"movement"`
+    }
+    decodeBody(t, rec, &got)
+    if rec.Code != http.StatusOK || got.Stock != 8 || got.Movement.ID != 42 || got.Movement.Delta != -2 {
+        t.Errorf("status %d, body %s; want 200 with 8 left", rec.Code, rec.Body)
+    }
+}
+
+func TestReserveReleaseStockOutOfStock(t *testing.T) {
+    mock := mockDB(t)
+    rt := newStockRouter(t, mock)
+
+    mock.ExpectBegin()
+    mock.ExpectQuery(`FOR UPDATE`).WillReturnRows(lockedItemRows(Item{ID: 3, Name: "Widget", Price: 1}))
+    mock.ExpectQuery(`UPDATE items SET stock`).WithArgs(-4, 3, defaultTenantID).WillReturnRows(sqlmock.NewRows([]string{"stock"}))
+    mock.ExpectRollback()
+
+    body := map[string]interface{}{"reserve": 5, "release": 1}
+    rec := doRequest(t, rt, http.MethodPatch, "/items/3/stock/reserve-release", body, testToken(t, nil))
+    if rec.Code != http.StatusConflict || errorCode(t, rec) != "OUT_OF_STOCK" {
+        t.Errorf("status %d, body %s; want 409 OUT_OF_STOCK", rec.Code, rec.Body)
+    }
+}
+
+func TestReserveReleaseStockValidation(t *testing.T) {
+    tests := []struct {
+        name string
+        body interface{}
+    }{
+        {"nothing to do", map[string]interface{}{"session_id": "abc"}},
+        {"negative reserve", map[string]interface{}{"reserve": -1, "release": 2}},
+        {"negative release", map[string]interface{}{"reserve": 1, "release": -2}},
+        {"malformed JSON", `{"reserve": `},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            rt := newStockRouter(t, mockDB(t))
+            rec := doRequest(t, rt, http.MethodPatch, "/items/3/stock/reserve-release", tt.body, testToken(t, nil))
+            if rec.Code != http.StatusBadRequest {
+                t.Errorf("status %d, body %s; want 400", rec.Code, rec.Body)
+            }
+        })
+    }
+}
+
+func TestGetStockHistory(t *testing.T) {
+    mock := mockDB(t)
+    rt := newStockRouter(t, mock)
+    at := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+    from := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+    to := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+
+    mock.ExpectQuery(`SELECT stock FROM items`).WithArgs(3, defaultTenantID).WillReturnRows(sqlmock.NewRows([]string{"stock"}).AddRow(47))
+    mock.ExpectQuery(`FROM stock_movements`).WithArgs(defaultTenantID, 3, from, to, stockHistoryPageSize, stockHistoryPageSize).
+        WillReturnRows(sqlmock.NewRows([]string{"id", "item_id", "delta", "reason", "reference_type", "reference_id", "actor", "stock_after", "created_at"}).
+            AddRow(7, 3, -1, "reserved", "reservation", nil, "alice", 46, at).
+            AddRow(8, 3, 1, "reservation expired", "reservation", nil, "system", 47, at.Add(5*time.Minute)))
+
+    rec := doRequest(t, rt, http.MethodGet, "/items/3/stock-history?from=2025-03-01&to=2025-03-02&page=2", nil, "")
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+    }
+    var got struct {
+        Movements    []stockMovement `json:"movements"`
+        CurrentStock int             `json:"current_stock"`
+        Page         int             `json:"page"`
+    }
+    decodeBody(t, rec, &got)
+    if got.CurrentStock != 47 || got.Page != 2 || len(got.Movements) != 2 {
+        t.Fatalf("body = %+v", got)
+    }
+    if m := got.Movements[1]; m.Actor != "system" || m.Reason != "reservation expired" || m.StockAfter != 47 {
+        t.Errorf("expired reservation movement = %+v", m)
+    }
+}
+
+func TestGetStockHistoryErrors(t *testing.T) {
+    mock := mockDB(t)
+    rt := newStockRouter(t, mock)
+    mock.ExpectQuery(`SELECT stock FROM items`).WillReturnError(sql.ErrNoRows)
+
+    if rec := doRequest(t, rt, http.MethodGet, "/items/3/stock-history", nil, ""); rec.Code != http.StatusNotFound {
+        t.Errorf("missing item: status = %d, want 404", rec.Code)
+    }
+    for _, query := range []string{"page=0", "page=x", "from=yesterday", "from=2025-03-02&to=2025-03-01"} {
+        if rec := doRequest(t, rt, http.MethodGet, "/items/3/stock-history?"+query, nil, ""); rec.Code != http.StatusBadRequest {
+            t.Errorf("?%s: status = %d, want 400", query, rec.Code)
+        }
+    }
+}
+
+func TestReserveItemTakesStock(t *testing.T) {
+    mock := mockDB(t)
+    rt := newStockRouter(t, mock)
+    until := time.Now().Add(5 * time.Minute)
+
+    mock.ExpectBegin()
+    mock.ExpectQuery(`FOR UPDATE`).WillReturnRows(lockedItemRows(Item{ID: 3, Name: "Widget", Price: 1}))
+    mock.ExpectExec(`WITH expired AS .* AND id = \$1 AND tenant_id = \$2`).WithArgs(3, defaultTenantID).WillReturnResult(sqlmock.NewResult(0, 0))
+    mock.ExpectQuery(`SELECT reserved_by FROM items`).WillReturnRows(sqlmock.NewRows([]string{"reserved_by"}))
+    mock.ExpectQuery(`SELECT reserved_until IS NOT NULL`).WillReturnRows(sqlmock.NewRows([]string{"extending"}).AddRow(false))
+    mock.ExpectQuery(`UPDATE items SET stock`).WithArgs(-1, 3, defaultTenantID).WillReturnRows(sqlmock.NewRows([]string{"stock"}).AddRow(0))
+    mock.ExpectQuery(`INSERT INTO stock_movements`).
+        WithArgs(defaultTenantID, 3, -1, "reserved", "reservation", nil, "test-user", 0).
+        WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(9, time.Now()))
+    mock.ExpectQuery(`UPDATE items SET reserved_by`).WillReturnRows(sqlmock.NewRows([]string{"reserved_until"}).AddRow(until))
+    mock.ExpectCommit()
+
+    rec := doRequest(t, rt, http.MethodPost, "/items/3/reserve", nil, testToken(t, nil))
+    if rec.Code != http.StatusOK {
+        t.Errorf("status %d, body %s; want 200", rec.Code, rec.Body)
+    }
+}
+
+func TestReserveItemExtensionKeepsStock(t *testing.T) {
+    mock := mockDB(t)
+    rt := newStockRouter(t, mock)
+
+    mock.ExpectBegin()
+    mock.ExpectQuery(`FOR UPDATE`).WillReturnRows(lockedItemRows(Item{ID: 3, Name: "Widget", Price: 1}))
+    mock.ExpectExec(`WITH expired AS`).WillReturnResult(sqlmock.NewResult(0, 0))
+    mock.ExpectQuery(`SELECT reserved_by FROM items`).WillReturnRows(sqlmock.NewRows([]string{"reserved_by"}).AddRow("test-user"))
+    mock.ExpectQuery(`SELECT reserved_until IS NOT NULL`).WillReturnRows(sqlmock.NewRows([]string{"extending"}).AddRow(true))
+    mock.ExpectQuery(`UPDATE items SET reserved_by`).WillReturnRows(sqlmock.NewRows([]string{"reserved_until"}).AddRow(time.Now()))
+    mock.ExpectCommit()
+
+    if rec := doRequest(t, rt, http.MethodPost, "/items/3/reserve", nil, testToken(t, nil)); rec.Code != http.StatusOK {
+        t.Errorf("status %d, body %s; want 200", rec.Code, rec.Body)
+    }
+}
+
+func TestReserveItemOutOfStock(t *testing.T) {
+    mock := mockDB(t)
+    rt := newStockRouter(t, mock)
+
+    mock.ExpectBegin()
+    mock.ExpectQuery(`FOR UPDATE`).WillReturnRows(lockedItemRows(Item{ID: 3, Name: "Widget", Price: 1}))
+    mock.ExpectExec(`WITH expired AS`).WillReturnResult(sqlmock.NewResult(0, 0))
+    mock.ExpectQuery(`SELECT reserved_by FROM items`).WillReturnRows(sqlmock.NewRows([]string{"reserved_by"}))
+    mock.ExpectQuery(`SELECT reserved_until IS NOT NULL`).WillReturnRows(sqlmock.NewRows([]string{"extending"}).AddRow(false))
+    mock.ExpectQuery(`UPDATE items SET stock`).WillReturnRows(sqlmock.NewRows([]string{"stock"}))
+    mock.ExpectRollback()
+
+    rec := doRequest(t, rt, http.MethodPost, "/items/3/reserve", nil, testToken(t, nil))
+    if rec.Code != http.StatusConflict || errorCode(t, rec) != "OUT_OF_STOCK" {
+        t.Errorf("status %d, body %s; want 409 OUT_OF_STOCK", rec.Code, rec.Body)
+    }
+}
+
+func TestReleaseItemReturnsStock(t *testing.T) {
+    mock := mockDB(t)
+    rt := newStockRouter(t, mock)
+
+    mock.ExpectBegin()
+    mock.ExpectQuery(`FOR UPDATE`).WillReturnRows(lockedItemRows(Item{ID: 3, Name: "Widget", Price: 1}))
+    mock.ExpectExec(`WITH expired AS`).WillReturnResult(sqlmock.NewResult(0, 0))
+    mock.ExpectQuery(`SELECT reserved_by FROM items`).WillReturnRows(sqlmock.NewRows([]string{"reserved_by"}).AddRow("test-user"))
+    mock.ExpectExec(`UPDATE items SET reserved_by = NULL`).WillReturnResult(sqlmock.NewResult(0, 1))
+    mock.ExpectQuery(`UPDATE items SET stock`).WithArgs(1, 3, defaultTenantID).WillReturnRows(sqlmock.NewRows([]string{"stock"}).AddRow(1))
+    mock.ExpectQuery(`INSERT INTO stock_movements`).
+        WithArgs(defaultTenantID, 3, 1, "released", "reservation", nil, "test-user", 1).
+        WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(10, time.Now()))
+    mock.ExpectCommit()
+
+    if rec := doRequest(t, rt, http.MethodDelete, "/items/3/reserve", nil, testToken(t, nil)); rec.Code != http.StatusNoContent {
+        t.Errorf("status %d, body %s; want 204", rec.Code, rec.Body)
+    }
+}
+
+func TestExpireReservationsRecordsMovements(t *testing.T) {
+    mock := mockDB(t)
+    mock.ExpectExec(`WITH expired AS \(\s*UPDATE items SET reserved_by = NULL, reserved_until = NULL, stock = stock \+ 1\s*WHERE reserved_until <= NOW\(\)\s*RETURNING` +
+        `.*INSERT INTO stock_movements .*'reservation expired', 'reservation', 'system'`).
+        WithoutArgs().WillReturnResult(sqlmock.NewResult(0, 2))
+    expireReservations(context.Background(), db)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "strings"
+
+    "github.com/aws/aws-sdk-go-v2/aws"
+    awsconfig "github.com/aws/aws-sdk-go-v2/config"
+    "github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// s3Client and s3Bucket are set at startup when S3_BUCKET is configured.
+// Credentials follow the standard AWS chain (AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY, ...). S3_ENDPOINT points the client at an
+// S3-compatible service such as MinIO and switches to path-style addressing.
+var (
+    s3Client *s3.Client
+    s3Bucket string
+)
+
+func newS3Client(ctx context.Context) (*s3.Client, error) {
+    cfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(os.Getenv("S3_REGION")))
+    if err != nil {
+        return nil, err
+    }
+    return s3.NewFromConfig(cfg, func(o *s3.Options) {
+        if endpoint := os.Getenv("S3_ENDPOINT"); endpoint != "" {
+            o.BaseEndpoint = aws.String(endpoint)
+            o.UsePathStyle = true
+        }
+    }), nil
+}
+
+// s3PublicURL is the address clients use to fetch an object. S3_PUBLIC_URL
+// overrides it, e.g. for a CDN in front of the bucket; otherwise it is derived
+// from S3_ENDPOINT or the bucket's virtual-hosted AWS address.
+func s3PublicURL(key string) string {
+    if base := os.Getenv("S3_PUBLIC_URL"); base != "" {
+        return strings.TrimSuffix(base, "/") + "/" + key
+    }
+    if endpoint := os.Getenv("S3_ENDPOINT"); endpoint != "" {
+        return strings.TrimSuffix(endpoint, "/") + "/" + s3Bucket + "/" + key
+    }
+    return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s3Bucket, os.Getenv("S3_REGION"), key)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+
+    "github.com/golang-jwt/jwt/v5"
+    "github.com/google/uuid"
+)
+
+// defaultTenantID is the tenant of the rows that predate tenancy and of
+// requests that name no tenant. It matches the column default of
+// migrations/018_add_tenant_id.up.sql.
+var defaultTenantID = uuid.Nil
+
+type tenantKey struct{}
+
+// ErrMissingTenant rejects a repository call whose context carries no tenant,
+// which means the request never passed through tenantMiddleware.
+var ErrMissingTenant = errors.New("request context has no tenant; is tenantMiddleware installed?")
+
+// tenantFromContext returns the tenant of the request, or defaultTenantID
+// outside tenantMiddleware.
+func tenantFromContext(ctx context.Context) uuid.UUID {
+    if id, ok := ctx.Value(tenantKey{}).(uuid.UUID); ok {
+        return id
+    }
+    return defaultTenantID
+}
+
+// RequireTenant returns the tenant stored in ctx by tenantMiddleware or
+// withTenant. Unlike tenantFromContext it does not fall back to
+// defaultTenantID, so code that skipped the middleware fails with
+// ErrMissingTenant instead of reading the default tenant's items.
+func RequireTenant(ctx context.Context) (uuid.UUID, error) {
+    id, ok := ctx.Value(tenantKey{}).(uuid.UUID)
+    if !ok {
+        return uuid.Nil, ErrMissingTenant
+    }
+    return id, nil
+}
+
+func withTenant(ctx context.Context, tenantID uuid.UUID) context.Context {
+    return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// tenantClaim reads the tenant_id claim of a bearer token. A token without
+// one belongs to the default tenant. The error message is safe to show to
+// the client.
+func tenantClaim(claims jwt.MapClaims) (uuid.UUID, error) {
+    raw, ok := claims["tenant_id"]
+    if !ok {
+        return defaultTenantID, nil
+    }
+    s, _ := raw.(string)
+    id, err := uuid.Parse(s)
+    if err != nil {
+        return uuid.Nil, fmt.Errorf("token has an invalid tenant_id claim")
+    }
+    return id, nil
+}
+
+// tenantMiddleware stores the caller's tenant in the request context: the
+// tenant_id claim of the bearer token, or the tenant of the API key. Writes
+// are already authenticated by then, and apiKeyMiddleware has stored the
+// tenant of its key. Reads stay public and anonymous ones see the default
+// tenant, but credentials sent with a read must be valid, so an expired
+// token is refused rather than quietly shown another tenant's items.
+func tenantMiddleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        ctx := r.Context()
+        if _, ok := ctx.Value(tenantKey{}).(uuid.UUID); ok {
+            next.ServeHTTP(w, r)
+            return
+        }
+
+        tenantID := defaultTenantID
+        switch {
+        case r.Header.Get("Authorization") != "":
+            claims, err := parseBearerToken(r)
+            if err == nil {
+                tenantID, err = tenantClaim(claims)
+            }
+            if err != nil {
+                w.Header().Set("WWW-Authenticate", `Bearer realm="items"`)
+                writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", err.Error())
+                return
+            }
+        case r.Header.Get(apiKeyHeader) != "":
+            var err error
+            _, tenantID, err = verifyAPIKey(ctx, r.Header.Get(apiKeyHeader))
+            if errors.Is(err, errInvalidAPIKey) {
+                writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", err.Error())
+                return
+            }
+            if err != nil {
+                writeInternalError(w, r, err)
+                return
+            }
+        }
+        next.ServeHTTP(w, r.WithContext(withTenant(ctx, tenantID)))
+    })
+}
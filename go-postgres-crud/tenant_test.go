@@ -0,0 +1,50 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/google/uuid"
+)
+
+func TestRequireTenant(t *testing.T) {
+    if _, err := RequireTenant(context.Background()); !errors.Is(err, ErrMissingTenant) {
+        t.Errorf("RequireTenant without a tenant = %v, want ErrMissingTenant", err)
+    }
+    // The default tenant counts as a tenant once the middleware stored it.
+    for _, want := range []uuid.UUID{defaultTenantID, uuid.New()} {
+        if got, err := RequireTenant(withTenant(context.Background(), want)); err != nil || got != want {
+            t.Errorf("RequireTenant = %v, %v; want %v", got, err, want)
+        }
+    }
+}
+
+// A router that forgot tenantMiddleware answers 500 and says why in the log,
+// rather than serving the default tenant's items.
+func TestRepositoryRequiresTenantMiddleware(t *testing.T) {
+    logs := captureLogs(t)
+    mockDB(t)
+    itemCache = newItemCache(1000, time.Minute)
+    rt := newRouter()
+    rt.Use(jwtMiddleware)
+    registerRoutes(rt, NewApp(NewPostgresItemRepository(db, nil), nil, NewFeatureFlags(nil), nil), nil)
+
+    for _, route := range []struct{ method, path string }{
+        {http.MethodGet, "/items/1"},
+        {http.MethodGet, "/items"},
+        {http.MethodDelete, "/items/1"},
+        {http.MethodPost, "/items/1/restore"},
+    } {
+        rec := doRequest(t, rt, route.method, route.path, nil, testToken(t, nil))
+        if rec.Code != http.StatusInternalServerError {
+            t.Errorf("%s %s: status %d, want 500: %s", route.method, route.path, rec.Code, rec.Body)
+        }
+    }
+    if !strings.Contains(logs.String(), ErrMissingTenant.Error()) {
+        t.Errorf("logs %q do not name the missing tenant", logs)
+    }
+}
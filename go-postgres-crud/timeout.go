@@ -0,0 +1,127 @@
+package main
+
+import (
+    "context"
+    "net/http"
+    "sync"
+    "time"
+)
+
+// untimedRoutes stream for as long as the client stays connected, or until a
+// full export is written, so the request timeout does not apply to them.
+var untimedRoutes = map[string]bool{
+    "/items/export":            true,
+    "/items/stream":            true,
+    "/items/{id}/price-stream": true,
+}
+
+// timeoutMiddleware cancels the request context after d and answers 504 if the
+// handler has not started its response by then. A handler that already sent
+// its headers is left to finish; its queries fail once the context is done.
+//
+// The handler runs on its own goroutine and writes through a timeoutWriter,
+// which keeps it from touching the real ResponseWriter after the 504 went out.
+func timeoutMiddleware(d time.Duration) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if untimedRoutes[routeLabel(r)] {
+                next.ServeHTTP(w, r)
+                return
+            }
+
+            ctx, cancel := context.WithTimeout(r.Context(), d)
+            defer cancel()
+            r = r.WithContext(ctx)
+
+            tw := &timeoutWriter{w: w, header: make(http.Header)}
+            done := make(chan struct{})
+            panicked := make(chan interface{}, 1)
+            go func() {
+                defer func() {
+                    if p := recover(); p != nil {
+                        panicked <- p
+                    }
+                }()
+                next.ServeHTTP(tw, r)
+                close(done)
+            }()
+
+            select {
+            case p := <-panicked:
+                panic(p)
+            case <-done:
+                return
+            case <-ctx.Done():
+            }
+
+            tw.mu.Lock()
+            if tw.wroteHeader {
+                tw.mu.Unlock()
+                select {
+                case p := <-panicked:
+                    panic(p)
+                case <-done:
+                }
+                return
+            }
+            tw.timedOut = true
+            tw.mu.Unlock()
+
+            requestLogger(r.Context()).Warn("request timed out", "timeout", d.String())
+            writeError(w, http.StatusGatewayTimeout, "TIMEOUT", "The request took too long to complete")
+        })
+    }
+}
+
+// timeoutWriter buffers header changes in its own map and forwards the
+// response to w only while the request has not timed out, so WriteHeader is
+// never called twice on w.
+type timeoutWriter struct {
+    w           http.ResponseWriter
+    header      http.Header
+    mu          sync.Mutex
+    wroteHeader bool
+    timedOut    bool
+}
+
+func (t *timeoutWriter) Header() http.Header {
+    return t.header
+}
+
+func (t *timeoutWriter) WriteHeader(status int) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    t.writeHeaderLocked(status)
+}
+
+func (t *timeoutWriter) writeHeaderLocked(status int) {
+    if t.timedOut || t.wroteHeader {
+        return
+    }
+    t.wroteHeader = true
+    for key, values := range t.header {
+        t.w.Header()[key] = values
+    }
+    t.w.WriteHeader(status)
+}
+
+func (t *timeoutWriter) Write(p []byte) (int, error) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    if t.timedOut {
+        return 0, http.ErrHandlerTimeout
+    }
+    t.writeHeaderLocked(http.StatusOK)
+    return t.w.Write(p)
+}
+
+func (t *timeoutWriter) Flush() {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    if t.timedOut {
+        return
+    }
+    if flusher, ok := t.w.(http.Flusher); ok {
+        flusher.Flush()
+    }
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+    "context"
+    "net/http"
+    "strconv"
+    "sync"
+    "time"
+
+    "github.com/google/uuid"
+)
+
+type timingKey struct{}
+
+// TimingRecorder adds up how long a request spends in the database and in
+// encoding its response, for the Server-Timing header. A nil recorder
+// discards what it is given.
+type TimingRecorder struct {
+    mu     sync.Mutex
+    db     time.Duration
+    encode time.Duration
+}
+
+func (t *TimingRecorder) AddDB(d time.Duration) {
+    if t == nil {
+        return
+    }
+    t.mu.Lock()
+    t.db += d
+    t.mu.Unlock()
+}
+
+func (t *TimingRecorder) AddEncode(d time.Duration) {
+    if t == nil {
+        return
+    }
+    t.mu.Lock()
+    t.encode += d
+    t.mu.Unlock()
+}
+
+// header formats the totals as a Server-Timing value in milliseconds, e.g.
+// "db;dur=3.21, encode;dur=0.08".
+func (t *TimingRecorder) header() string {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    return "db;dur=" + formatTimingMillis(t.db) + ", encode;dur=" + formatTimingMillis(t.encode)
+}
+
+func formatTimingMillis(d time.Duration) string {
+    return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 2, 64)
+}
+
+// timingFromContext returns the request's recorder, or nil outside
+// serverTimingMiddleware.
+func timingFromContext(ctx context.Context) *TimingRecorder {
+    t, _ := ctx.Value(timingKey{}).(*TimingRecorder)
+    return t
+}
+
+// serverTimingMiddleware gives every request a TimingRecorder and sends its
+// totals as Server-Timing with the response headers. It is the innermost
+// router middleware, so the handler writes straight to serverTimingWriter and
+// writeJSON can record its encoding time.
+func serverTimingMiddleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        timing := &TimingRecorder{}
+        tw := &serverTimingWriter{ResponseWriter: w, timing: timing}
+        next.ServeHTTP(tw, r.WithContext(context.WithValue(r.Context(), timingKey{}, timing)))
+    })
+}
+
+// serverTimingWriter adds the Server-Timing header just before the status
+// line goes out, when the totals so far are known.
+type serverTimingWriter struct {
+    http.ResponseWriter
+    timing      *TimingRecorder
+    wroteHeader bool
+}
+
+func (s *serverTimingWriter) WriteHeader(status int) {
+    if !s.wroteHeader {
+        s.wroteHeader = true
+        s.Header().Set("Server-Timing", s.timing.header())
+    }
+    s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *serverTimingWriter) Write(p []byte) (int, error) {
+    if !s.wroteHeader {
+        s.WriteHeader(http.StatusOK)
+    }
+    return s.ResponseWriter.Write(p)
+}
+
+func (s *serverTimingWriter) Flush() {
+    if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+        flusher.Flush()
+    }
+}
+
+// recordEncodeTiming adds d to the encoding time of the response written to
+// w, when w is the writer from serverTimingMiddleware.
+func recordEncodeTiming(w http.ResponseWriter, d time.Duration) {
+    if tw, ok := w.(*serverTimingWriter); ok {
+        tw.timing.AddEncode(d)
+    }
+}
+
+// timedItemRepository adds the time spent in each repository call to the
+// request's database timing.
+type timedItemRepository struct {
+    ItemRepository
+}
+
+func (t timedItemRepository) Create(ctx context.Context, tenantID uuid.UUID, item Item, idempotencyKey string) (Item, error) {
+    defer recordDBTiming(ctx, time.Now())
+    return t.ItemRepository.Create(ctx, tenantID, item, idempotencyKey)
+}
+
+func (t timedItemRepository) CreateMany(ctx context.Context, tenantID uuid.UUID, items []Item) ([]Item, error) {
+    defer recordDBTiming(ctx, time.Now())
+    return t.ItemRepository.CreateMany(ctx, tenantID, items)
+}
+
+func (t timedItemRepository) Upsert(ctx context.Context, tenantID uuid.UUID, item Item) (Item, Item, bool, error) {
+    defer recordDBTiming(ctx, time.Now())
+    return t.ItemRepository.Upsert(ctx, tenantID, item)
+}
+
+func (t timedItemRepository) GetAll(ctx context.Context, tenantID uuid.UUID, filters ItemFilters) (itemPage, error) {
+    defer recordDBTiming(ctx, time.Now())
+    return t.ItemRepository.GetAll(ctx, tenantID, filters)
+}
+
+func (t timedItemRepository) GetAfter(ctx context.Context, tenantID uuid.UUID, filters ItemFilters) (itemCursorPage, error) {
+    defer recordDBTiming(ctx, time.Now())
+    return t.ItemRepository.GetAfter(ctx, tenantID, filters)
+}
+
+func (t timedItemRepository) GetByID(ctx context.Context, tenantID uuid.UUID, id int) (Item, error) {
+    defer recordDBTiming(ctx, time.Now())
+    return t.ItemRepository.GetByID(ctx, tenantID, id)
+}
+
+func (t timedItemRepository) Update(ctx context.Context, tenantID uuid.UUID, id int, item Item) (Item, Item, error) {
+    defer recordDBTiming(ctx, time.Now())
+    return t.ItemRepository.Update(ctx, tenantID, id, item)
+}
+
+func (t timedItemRepository) Delete(ctx context.Context, tenantID uuid.UUID, id int) (Item, error) {
+    defer recordDBTiming(ctx, time.Now())
+    return t.ItemRepository.Delete(ctx, tenantID, id)
+}
+
+func (t timedItemRepository) Restore(ctx context.Context, tenantID uuid.UUID, id int) (Item, error) {
+    defer recordDBTiming(ctx, time.Now())
+    return t.ItemRepository.Restore(ctx, tenantID, id)
+}
+
+func recordDBTiming(ctx context.Context, start time.Time) {
+    timingFromContext(ctx).AddDB(time.Since(start))
+}
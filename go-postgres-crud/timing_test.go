@@ -0,0 +1,79 @@
+package main
+
+import (
+    "context"
+    "net/http"
+    "regexp"
+    "strconv"
+    "testing"
+    "time"
+)
+
+var serverTimingPattern = regexp.MustCompile(`^db;dur=(\d+\.\d{2}), encode;dur=(\d+\.\d{2})$`)
+
+// newTimingRouter serves app with serverTimingMiddleware innermost, as main
+// does, and the repository timed.
+func newTimingRouter(repo ItemRepository) *router {
+    itemCache = newItemCache(1000, time.Minute)
+    rt := newRouter()
+    rt.Use(jwtMiddleware)
+    rt.Use(tenantMiddleware)
+    rt.Use(serverTimingMiddleware)
+    registerRoutes(rt, NewApp(timedItemRepository{repo}, nil, NewFeatureFlags(nil), nil), nil)
+    return rt
+}
+
+// serverTiming parses the Server-Timing header of a response into its db and
+// encode durations in milliseconds.
+func serverTiming(t *testing.T, header http.Header) (db, encode float64) {
+    t.Helper()
+    m := serverTimingPattern.FindStringSubmatch(header.Get("Server-Timing"))
+    if m == nil {
+        t.Fatalf("Server-Timing = %q, want db and encode durations", header.Get("Server-Timing"))
+    }
+    db, _ = strconv.ParseFloat(m[1], 64)
+    encode, _ = strconv.ParseFloat(m[2], 64)
+    return db, encode
+}
+
+func TestServerTimingGetItem(t *testing.T) {
+    const queryTime = 5 * time.Millisecond
+    stored := storedItems(Item{ID: 7, Name: "Widget", Price: 9.99, Version: 3})
+    repo := &MockItemRepository{GetByIDFunc: func(ctx context.Context, id int) (Item, error) {
+        time.Sleep(queryTime)
+        return stored.GetByID(ctx, defaultTenantID, id)
+    }}
+
+    rec := doRequest(t, newTimingRouter(repo), http.MethodGet, "/items/7", nil, "")
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+    }
+    db, encode := serverTiming(t, rec.Header())
+    if db < float64(queryTime.Milliseconds()) {
+        t.Errorf("db;dur=%v, want at least the %v the query took", db, queryTime)
+    }
+    if encode > db {
+        t.Errorf("encode;dur=%v exceeds db;dur=%v for a single small item", encode, db)
+    }
+}
+
+func TestServerTimingWithoutBody(t *testing.T) {
+    rt := newTimingRouter(storedItems(Item{ID: 7, Name: "Widget", Price: 9.99, Version: 3}))
+    rec := doRequest(t, rt, http.MethodDelete, "/items/7", nil, testToken(t, nil))
+    if rec.Code != http.StatusNoContent {
+        t.Fatalf("status = %d, want 204: %s", rec.Code, rec.Body)
+    }
+    // Nothing is encoded, but the header still goes out with the status line.
+    if _, encode := serverTiming(t, rec.Header()); encode != 0 {
+        t.Errorf("encode;dur=%v for an empty response, want 0", encode)
+    }
+}
+
+func TestTimingRecorderNil(t *testing.T) {
+    var timing *TimingRecorder
+    timing.AddDB(time.Second)
+    timing.AddEncode(time.Second)
+    if got := timingFromContext(context.Background()); got != nil {
+        t.Errorf("timingFromContext outside the middleware = %v, want nil", got)
+    }
+}
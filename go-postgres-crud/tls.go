@@ -0,0 +1,92 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+
+    "golang.org/x/crypto/acme/autocert"
+)
+
+const (
+    tlsModeDisabled = "disabled"
+    tlsModeManual   = "manual"
+    tlsModeAutocert = "autocert"
+)
+
+// tlsSettings is the TLS configuration read from TLS_MODE and its companion
+// variables.
+type tlsSettings struct {
+    Mode     string
+    CertFile string
+    KeyFile  string
+    Domain   string
+    CacheDir string
+}
+
+func loadTLSSettings() (tlsSettings, error) {
+    settings := tlsSettings{
+        Mode:     getEnv("TLS_MODE", tlsModeDisabled),
+        CertFile: getEnv("TLS_CERT_FILE", ""),
+        KeyFile:  getEnv("TLS_KEY_FILE", ""),
+        Domain:   getEnv("TLS_DOMAIN", ""),
+        CacheDir: getEnv("TLS_CACHE_DIR", "autocert-cache"),
+    }
+    switch settings.Mode {
+    case tlsModeDisabled:
+    case tlsModeManual:
+        if settings.CertFile == "" || settings.KeyFile == "" {
+            return settings, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set when TLS_MODE=manual")
+        }
+    case tlsModeAutocert:
+        if settings.Domain == "" {
+            return settings, errors.New("TLS_DOMAIN must be set when TLS_MODE=autocert")
+        }
+    default:
+        return settings, fmt.Errorf("TLS_MODE must be disabled, manual or autocert, got %q", settings.Mode)
+    }
+    return settings, nil
+}
+
+// defaultListenAddr is the address used when LISTEN_ADDR is not set. The
+// autocert challenge handler redirects plain requests to https://<domain>/,
+// so that mode serves on the standard HTTPS port.
+func (s tlsSettings) defaultListenAddr() string {
+    if s.Mode == tlsModeAutocert {
+        return ":443"
+    }
+    return ":8000"
+}
+
+// configureTLS prepares server for the configured mode. In autocert mode it
+// returns the :80 server that answers ACME HTTP-01 challenges and redirects
+// everything else to HTTPS; otherwise it returns nil.
+func configureTLS(server *http.Server, settings tlsSettings) *http.Server {
+    if settings.Mode != tlsModeAutocert {
+        return nil
+    }
+    manager := &autocert.Manager{
+        Prompt:     autocert.AcceptTOS,
+        HostPolicy: autocert.HostWhitelist(settings.Domain),
+        Cache:      autocert.DirCache(settings.CacheDir),
+    }
+    server.TLSConfig = manager.TLSConfig()
+    return &http.Server{
+        Addr:    ":80",
+        Handler: manager.HTTPHandler(nil),
+    }
+}
+
+// serve runs server until it is shut down, over TLS unless the mode is
+// disabled. The handler stack is the same in every mode.
+func serve(server *http.Server, settings tlsSettings) error {
+    switch settings.Mode {
+    case tlsModeManual:
+        return server.ListenAndServeTLS(settings.CertFile, settings.KeyFile)
+    case tlsModeAutocert:
+        // The certificates come from server.TLSConfig.
+        return server.ListenAndServeTLS("", "")
+    default:
+        return server.ListenAndServe()
+    }
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+    "fmt"
+    "net/http"
+
+    "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// criticalRoutes are sampled at DD_TRACE_CRITICAL_SAMPLE_RATE, when set,
+// regardless of the global rate.
+var criticalRoutes = []string{"POST /items", "DELETE /items/{id}"}
+
+// untracedPaths are never traced, whatever the sample rates: probes and
+// scrapes would only add noise to APM, and the SSE stream would hold a span
+// open for as long as the client stays connected.
+var untracedPaths = map[string]bool{
+    "/healthz":      true,
+    "/readyz":       true,
+    "/metrics":      true,
+    "/items/stream": true,
+}
+
+// samplingRules turns DD_TRACE_SAMPLE_RATE (default 1.0) and
+// DD_TRACE_CRITICAL_SAMPLE_RATE into trace sampling rules. Rules are used
+// instead of tracer.WithSampler because the legacy sampler drops traces before
+// any per-route override can keep them. The tracer is configured once at
+// process start, so a changed rate only takes effect after a restart.
+func samplingRules() ([]tracer.SamplingRule, error) {
+    var rules []tracer.SamplingRule
+
+    criticalRate, err := getEnvFloat("DD_TRACE_CRITICAL_SAMPLE_RATE", -1)
+    if err != nil {
+        return nil, err
+    }
+    if criticalRate != -1 {
+        if criticalRate < 0 || criticalRate > 1 {
+            return nil, fmt.Errorf("DD_TRACE_CRITICAL_SAMPLE_RATE must be between 0.0 and 1.0")
+        }
+        for _, route := range criticalRoutes {
+            rules = append(rules, tracer.TagsResourceRule(nil, route, "", "", criticalRate))
+        }
+    }
+
+    rate, err := getEnvFloat("DD_TRACE_SAMPLE_RATE", 1)
+    if err != nil {
+        return nil, err
+    }
+    if rate < 0 || rate > 1 {
+        return nil, fmt.Errorf("DD_TRACE_SAMPLE_RATE must be between 0.0 and 1.0")
+    }
+    return append(rules, tracer.RateRule(rate)), nil
+}
+
+// routeResourceNamer names root spans after the matched route pattern, e.g.
+// "DELETE /items/{id}", so sampling rules and APM resources are per route.
+func routeResourceNamer(mux *http.ServeMux) func(*http.Request) string {
+    return func(r *http.Request) string {
+        _, pattern := mux.Handler(r)
+        return pattern
+    }
+}
+
+func ignoreUntracedPaths(r *http.Request) bool {
+    return untracedPaths[r.URL.Path]
+}
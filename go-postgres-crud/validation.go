@@ -0,0 +1,186 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math"
+    "net/http"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+)
+
+// maxItemID is the largest value of the items.id integer column.
+const maxItemID = math.MaxInt32
+
+var errInvalidItemID = errors.New("invalid item ID")
+
+// parseItemID parses an item ID from a URL path or query string. Only plain
+// decimal digits are accepted (no sign, whitespace or NUL bytes) and the value
+// must fit the items.id column, so anything that passes can be bound to a
+// query safely.
+func parseItemID(s string) (int, error) {
+    if s == "" || len(s) > len(strconv.Itoa(maxItemID)) {
+        return 0, errInvalidItemID
+    }
+    for i := 0; i < len(s); i++ {
+        if s[i] < '0' || s[i] > '9' {
+            return 0, errInvalidItemID
+        }
+    }
+    id, err := strconv.ParseInt(s, 10, 64)
+    if err != nil || id <= 0 || id > maxItemID {
+        return 0, errInvalidItemID
+    }
+    return int(id), nil
+}
+
+// Price bounds guard against data entry mistakes such as 1000000 for 10.00.
+// They are configured at startup from MIN_ITEM_PRICE and MAX_ITEM_PRICE.
+var (
+    minItemPrice = 0.01
+    maxItemPrice = 999999.99
+)
+
+type priceRangeError struct {
+    Min float64
+    Max float64
+}
+
+func (e *priceRangeError) Error() string {
+    return fmt.Sprintf("price must be between %.2f and %.2f", e.Min, e.Max)
+}
+
+type contentPolicyError struct {
+    Field string
+}
+
+func (e *contentPolicyError) Error() string {
+    return fmt.Sprintf("%s contains blocked content", e.Field)
+}
+
+const (
+    maxNameLength        = 255
+    maxDescriptionLength = 1000
+)
+
+// fieldViolation describes one problem with one field of a request body.
+type fieldViolation struct {
+    Field   string `json:"field"`
+    Message string `json:"message"`
+}
+
+// validationErrors collects every structural problem with an item so the
+// client can fix them all in one round trip.
+type validationErrors []fieldViolation
+
+func (e validationErrors) Error() string {
+    messages := make([]string, len(e))
+    for i, v := range e {
+        messages[i] = v.Field + " " + v.Message
+    }
+    return strings.Join(messages, "; ")
+}
+
+// validateItem first checks the shape of the item and reports all violations
+// together. Only a structurally valid item is checked against the configured
+// price range and, unless the caller in ctx is an admin, the content policy.
+func validateItem(ctx context.Context, item Item) error {
+    var violations validationErrors
+    if strings.TrimSpace(item.Name) == "" {
+        violations = append(violations, fieldViolation{Field: "name", Message: "must not be empty"})
+    } else if utf8.RuneCountInString(item.Name) > maxNameLength {
+        violations = append(violations, fieldViolation{Field: "name", Message: fmt.Sprintf("must be at most %d characters", maxNameLength)})
+    }
+    if utf8.RuneCountInString(item.Description) > maxDescriptionLength {
+        violations = append(violations, fieldViolation{Field: "description", Message: fmt.Sprintf("must be at most %d characters", maxDescriptionLength)})
+    }
+    if item.Price <= 0 {
+        violations = append(violations, fieldViolation{Field: "price", Message: "must be greater than 0"})
+    }
+    for _, id := range item.CategoryIDs {
+        if id <= 0 || id > maxItemID {
+            violations = append(violations, fieldViolation{Field: "category_ids", Message: "must contain only positive integers"})
+            break
+        }
+    }
+    if item.Metadata != nil {
+        if encoded, err := json.Marshal(item.Metadata); err != nil || len(encoded) > maxMetadataBytes {
+            violations = append(violations, fieldViolation{Field: "metadata", Message: fmt.Sprintf("must be at most %d bytes when serialized", maxMetadataBytes)})
+        }
+    }
+    if len(violations) > 0 {
+        return violations
+    }
+
+    if item.Price < minItemPrice || item.Price > maxItemPrice {
+        return &priceRangeError{Min: minItemPrice, Max: maxItemPrice}
+    }
+    if roleFromContext(ctx) == "admin" {
+        return nil
+    }
+    if containsBlockedWord(item.Name) {
+        return &contentPolicyError{Field: "name"}
+    }
+    if containsBlockedWord(item.Description) {
+        return &contentPolicyError{Field: "description"}
+    }
+    return nil
+}
+
+// immutableFields lists item fields that may only be set at creation time,
+// configured from IMMUTABLE_FIELDS.
+var immutableFields []string
+
+type immutableFieldError struct {
+    Field string
+}
+
+func (e *immutableFieldError) Error() string {
+    return fmt.Sprintf("%s cannot be changed after creation", e.Field)
+}
+
+// validatePatchFields rejects an update payload that touches any immutable
+// field. fields is the decoded JSON object of the request body.
+func validatePatchFields(fields map[string]interface{}, immutable []string) error {
+    for _, field := range immutable {
+        if _, ok := fields[field]; ok {
+            return &immutableFieldError{Field: field}
+        }
+    }
+    return nil
+}
+
+// writeValidationError reports a validateItem failure to the client.
+func writeValidationError(w http.ResponseWriter, err error) {
+    var violations validationErrors
+    if errors.As(err, &violations) {
+        writeErrorDetails(w, http.StatusBadRequest, "VALIDATION_FAILED", "The item has invalid fields", violations)
+        return
+    }
+    var rangeErr *priceRangeError
+    if errors.As(err, &rangeErr) {
+        writeErrorDetails(w, http.StatusUnprocessableEntity, "PRICE_OUT_OF_RANGE", err.Error(), map[string]interface{}{
+            "min": rangeErr.Min,
+            "max": rangeErr.Max,
+        })
+        return
+    }
+    var policyErr *contentPolicyError
+    if errors.As(err, &policyErr) {
+        writeErrorDetails(w, http.StatusUnprocessableEntity, "CONTENT_POLICY_VIOLATION", err.Error(), map[string]interface{}{
+            "field": policyErr.Field,
+        })
+        return
+    }
+    var immutableErr *immutableFieldError
+    if errors.As(err, &immutableErr) {
+        writeErrorDetails(w, http.StatusUnprocessableEntity, "IMMUTABLE_FIELD", err.Error(), map[string]interface{}{
+            "field": immutableErr.Field,
+        })
+        return
+    }
+    writeError(w, http.StatusUnprocessableEntity, "INVALID_ITEM", err.Error())
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "regexp"
+    "strconv"
+    "strings"
+    "testing"
+
+    "github.com/golang-jwt/jwt/v5"
+)
+
+func TestValidateItem(t *testing.T) {
+    tests := []struct {
+        name   string
+        item   Item
+        fields []string
+        err    interface{}
+    }{
+        {name: "valid", item: Item{Name: "Widget", Description: "Small", Price: 9.99}},
+        {name: "blank name", item: Item{Name: "  ", Price: 1}, fields: []string{"name"}},
+        {name: "name too long", item: Item{Name: strings.Repeat("é", maxNameLength+1), Price: 1}, fields: []string{"name"}},
+        {name: "description too long", item: Item{Name: "Widget", Description: strings.Repeat("x", maxDescriptionLength+1), Price: 1}, fields: []string{"description"}},
+        {name: "zero price", item: Item{Name: "Widget"}, fields: []string{"price"}},
+        {name: "bad category", item: Item{Name: "Widget", Price: 1, CategoryIDs: []int{3, -1}}, fields: []string{"category_ids"}},
+        {name: "metadata too large", item: Item{Name: "Widget", Price: 1, Metadata: Metadata{"blob": strings.Repeat("x", maxMetadataBytes)}}, fields: []string{"metadata"}},
+        {name: "every violation at once", item: Item{Description: strings.Repeat("x", maxDescriptionLength+1), Price: -1}, fields: []string{"name", "description", "price"}},
+        {name: "price above the maximum", item: Item{Name: "Widget", Price: maxItemPrice + 1}, err: new(*priceRangeError)},
+        {name: "price below the minimum", item: Item{Name: "Widget", Price: minItemPrice / 2}, err: new(*priceRangeError)},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            err := validateItem(context.Background(), tt.item)
+            switch {
+            case tt.fields != nil:
+                var violations validationErrors
+                if !errors.As(err, &violations) {
+                    t.Fatalf("validateItem = %v, want field violations", err)
+                }
+                if len(violations) != len(tt.fields) {
+                    t.Fatalf("violations = %v, want one each for %v", violations, tt.fields)
+                }
+                for i, field := range tt.fields {
+                    if violations[i].Field != field {
+                        t.Errorf("violation %d is for %q, want %q", i, violations[i].Field, field)
+                    }
+                }
+            case tt.err != nil:
+                if !errors.As(err, tt.err) {
+                    t.Fatalf("validateItem = %v (%T), want %T", err, err, tt.err)
+                }
+            default:
+                if err != nil {
+                    t.Fatalf("validateItem = %v, want nil", err)
+                }
+            }
+        })
+    }
+}
+
+// blockWords installs a content policy for the duration of the test.
+func blockWords(t *testing.T, pattern string) {
+    t.Helper()
+    previous := blockedWords.Swap(regexp.MustCompile(pattern))
+    t.Cleanup(func() { blockedWords.Store(previous) })
+}
+
+func TestValidateItemContentPolicy(t *testing.T) {
+    blockWords(t, `(?i)\b(?:spam)\b`)
+    item := Item{Name: "Widget", Description: "Buy SPAM now", Price: 1}
+
+    var policyErr *contentPolicyError
+    err := validateItem(context.Background(), item)
+    if !errors.As(err, &policyErr) || policyErr.Field != "description" {
+        t.Errorf("validateItem = %v, want a content policy violation for description", err)
+    }
+    userCtx := context.WithValue(context.Background(), roleKey{}, "editor")
+    if err := validateItem(userCtx, item); !errors.As(err, &policyErr) {
+        t.Errorf("validateItem for an editor = %v, want a content policy violation", err)
+    }
+
+    adminCtx := context.WithValue(context.Background(), roleKey{}, "admin")
+    if err := validateItem(adminCtx, item); err != nil {
+        t.Errorf("validateItem for an admin = %v, want nil", err)
+    }
+    if err := validateItem(adminCtx, Item{Name: "spam", Price: -1}); err == nil {
+        t.Error("validateItem for an admin skipped the shape checks")
+    }
+}
+
+func TestCreateItemContentPolicyBypass(t *testing.T) {
+    blockWords(t, `(?i)\b(?:spam)\b`)
+    rt := newMockApp(t, storedItems())
+    item := Item{Name: "Spam fritters", Price: 1}
+
+    rec := doRequest(t, rt, http.MethodPost, "/items", item, testToken(t, nil))
+    if rec.Code != http.StatusUnprocessableEntity || errorCode(t, rec) != "CONTENT_POLICY_VIOLATION" {
+        t.Errorf("without a role: status %d, body %s; want 422 CONTENT_POLICY_VIOLATION", rec.Code, rec.Body)
+    }
+    rec = doRequest(t, rt, http.MethodPost, "/items", item, testToken(t, jwt.MapClaims{"role": "admin"}))
+    if rec.Code != http.StatusOK {
+        t.Errorf("as an admin: status %d, body %s; want 200", rec.Code, rec.Body)
+    }
+}
+
+func TestValidatePatchFields(t *testing.T) {
+    immutable := []string{"name"}
+    if err := validatePatchFields(map[string]interface{}{"price": 2.0}, immutable); err != nil {
+        t.Errorf("changing price: %v, want nil", err)
+    }
+    var immutableErr *immutableFieldError
+    err := validatePatchFields(map[string]interface{}{"name": "Renamed"}, immutable)
+    if !errors.As(err, &immutableErr) || immutableErr.Field != "name" {
+        t.Errorf("changing name: %v, want an immutableFieldError for name", err)
+    }
+}
+
+func FuzzParseItemID(f *testing.F) {
+    for _, seed := range []string{"", "-1", "9223372036854775808", "1\x00", "0", "1", "2147483647", "2147483648", "+5", " 5", "007"} {
+        f.Add(seed)
+    }
+    f.Fuzz(func(t *testing.T, s string) {
+        id, err := parseItemID(s)
+        if err != nil {
+            if !errors.Is(err, errInvalidItemID) {
+                t.Fatalf("parseItemID(%q) = %v, want errInvalidItemID", s, err)
+            }
+            return
+        }
+        if id < 1 || id > maxItemID {
+            t.Fatalf("parseItemID(%q) = %d, outside 1..%d", s, id, maxItemID)
+        }
+        if strings.TrimLeft(s, "0") != strconv.Itoa(id) {
+            t.Fatalf("parseItemID(%q) = %d, which does not round-trip", s, id)
+        }
+    })
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/google/uuid"
+    "github.com/lib/pq"
+    "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// Webhook events, one per kind of item mutation, and the stock alerts.
+const (
+    eventItemCreated   = "item.created"
+    eventItemUpdated   = "item.updated"
+    eventItemDeleted   = "item.deleted"
+    eventItemRestored  = "item.restored"
+    eventItemLowStock  = "item.low_stock"
+    eventItemRestocked = "item.restocked"
+)
+
+var webhookEvents = []string{eventItemCreated, eventItemUpdated, eventItemDeleted, eventItemRestored, eventItemLowStock, eventItemRestocked}
+
+const (
+    webhookAttempts       = 3
+    webhookInitialBackoff = time.Second
+)
+
+var webhookClient = newPublicHTTPClient(10 * time.Second)
+
+type Webhook struct {
+    ID     int      `json:"id"`
+    URL    string   `json:"url"`
+    Events []string `json:"events"`
+    // Secret is only returned when the webhook is created.
+    Secret    string    `json:"secret,omitempty"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// createWebhook registers a URL for some or all webhookEvents. Without a
+// secret in the body one is generated; either way it is only shown in this
+// response.
+func createWebhook(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "createWebhook", tracer.ResourceName("INSERT INTO webhooks"))
+    defer span.Finish()
+
+    var webhook Webhook
+    err := json.NewDecoder(r.Body).Decode(&webhook)
+    if err != nil {
+        writeBodyError(w, err, "Request body is not valid JSON")
+        return
+    }
+    if _, err := validateImportURL(ctx, webhook.URL); err != nil {
+        writeError(w, http.StatusBadRequest, "INVALID_URL", err.Error())
+        return
+    }
+    if len(webhook.Events) == 0 {
+        webhook.Events = webhookEvents
+    }
+    for _, event := range webhook.Events {
+        if !isWebhookEvent(event) {
+            writeError(w, http.StatusBadRequest, "INVALID_EVENT", "events must be among: "+strings.Join(webhookEvents, ", "))
+            return
+        }
+    }
+    if webhook.Secret == "" {
+        secret := make([]byte, 32)
+        if _, err := rand.Read(secret); err != nil {
+            writeInternalError(w, r, err)
+            return
+        }
+        webhook.Secret = hex.EncodeToString(secret)
+    }
+
+    sqlStatement := `INSERT INTO webhooks (url, secret, events, tenant_id) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+    err = db.QueryRowContext(ctx, sqlStatement, webhook.URL, webhook.Secret, pq.Array(webhook.Events), tenantFromContext(ctx)).Scan(&webhook.ID, &webhook.CreatedAt)
+    if err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+
+    writeJSON(w, http.StatusCreated, webhook)
+}
+
+func deleteWebhook(w http.ResponseWriter, r *http.Request) {
+    ctx := r.Context()
+    span, _ := tracer.StartSpanFromContext(ctx, "deleteWebhook", tracer.ResourceName("DELETE FROM webhooks WHERE id = $1 AND tenant_id = $2"))
+    defer span.Finish()
+
+    id, err := parseItemID(r.PathValue("id"))
+    if err != nil {
+        writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid webhook ID")
+        return
+    }
+    result, err := db.ExecContext(ctx, `DELETE FROM webhooks WHERE id = $1 AND tenant_id = $2`, id, tenantFromContext(ctx))
+    if err != nil {
+        writeInternalError(w, r, err)
+        return
+    }
+    if deleted, err := result.RowsAffected(); err == nil && deleted == 0 {
+        writeError(w, http.StatusNotFound, "NOT_FOUND", "Webhook not found")
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func isWebhookEvent(event string) bool {
+    for _, known := range webhookEvents {
+        if event == known {
+            return true
+        }
+    }
+    return false
+}
+
+type webhookDelivery struct {
+    Event     string      `json:"event"`
+    Payload   interface{} `json:"payload"`
+    Timestamp time.Time   `json:"timestamp"`
+}
+
+// dispatchWebhook delivers event to every webhook of the tenant of ctx that
+// is subscribed to it. It returns at once; deliveries run on their own
+// goroutine, detached from the request's cancellation, and failures are only
+// logged.
+func dispatchWebhook(ctx context.Context, event string, payload interface{}) {
+    ctx = context.WithoutCancel(ctx)
+    body, err := json.Marshal(webhookDelivery{Event: event, Payload: payload, Timestamp: time.Now().UTC()})
+    if err != nil {
+        requestLogger(ctx).Error("encoding webhook payload failed", "event", event, "error", err)
+        return
+    }
+    go func() {
+        hooks, err := subscribedWebhooks(ctx, tenantFromContext(ctx), event)
+        if err != nil {
+            requestLogger(ctx).Error("loading webhooks failed", "event", event, "error", err)
+            return
+        }
+        for _, hook := range hooks {
+            go deliverWebhook(ctx, hook, event, body)
+        }
+    }()
+}
+
+func subscribedWebhooks(ctx context.Context, tenantID uuid.UUID, event string) ([]Webhook, error) {
+    rows, err := db.QueryContext(ctx, `SELECT id, url, secret FROM webhooks WHERE $1 = ANY(events) AND tenant_id = $2`, event, tenantID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    var hooks []Webhook
+    for rows.Next() {
+        var hook Webhook
+        if err := rows.Scan(&hook.ID, &hook.URL, &hook.Secret); err != nil {
+            return nil, err
+        }
+        hooks = append(hooks, hook)
+    }
+    return hooks, rows.Err()
+}
+
+// deliverWebhook POSTs body to hook, retrying with exponential backoff on
+// transport errors and non-2xx responses.
+func deliverWebhook(ctx context.Context, hook Webhook, event string, body []byte) {
+    span, ctx := tracer.StartSpanFromContext(ctx, "deliverWebhook", tracer.ResourceName(event))
+    defer span.Finish()
+
+    mac := hmac.New(sha256.New, []byte(hook.Secret))
+    mac.Write(body)
+    signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+    backoff := webhookInitialBackoff
+    var err error
+    for attempt := 1; attempt <= webhookAttempts; attempt++ {
+        if err = postWebhook(ctx, hook.URL, signature, event, body); err == nil {
+            return
+        }
+        if attempt < webhookAttempts {
+            time.Sleep(backoff)
+            backoff *= 2
+        }
+    }
+    span.SetTag("error", err)
+    requestLogger(ctx).Error("webhook delivery failed", "webhook_id", hook.ID, "event", event, "attempts", webhookAttempts, "error", err)
+}
+
+func postWebhook(ctx context.Context, url, signature, event string, body []byte) error {
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("X-Signature", signature)
+    req.Header.Set("X-Webhook-Event", event)
+    resp, err := webhookClient.Do(req)
+    if err != nil {
+        return err
+    }
+    resp.Body.Close()
+    if resp.StatusCode < 200 || resp.StatusCode > 299 {
+        return fmt.Errorf("unexpected status %s", resp.Status)
+    }
+    return nil
+}
@@ -2,6 +2,11 @@ import React, { useState, useEffect } from 'react';
 import axios from 'axios';
 import './App.css';
 
+// Write endpoints require a bearer token; set REACT_APP_API_TOKEN at build time.
+if (process.env.REACT_APP_API_TOKEN) {
+    axios.defaults.headers.common['Authorization'] = `Bearer ${process.env.REACT_APP_API_TOKEN}`;
+}
+
 function App() {
     const [items, setItems] = useState([]);
     const [name, setName] = useState('');
@@ -16,7 +21,7 @@ function App() {
     const fetchItems = async () => {
         try {
             const response = await axios.get('http://localhost:8000/items');
-            setItems(response.data);
+            setItems(response.data.items);
         } catch (error) {
             console.error("There was an error fetching the items!", error);
         }
@@ -38,7 +43,11 @@ function App() {
     const updateItem = async () => {
         try {
             const updatedItem = { ...editItem, name, description, price: parseFloat(price) };
-            await axios.put(`http://localhost:8000/items/${editItem.id}`, updatedItem);
+            const response = await axios.put(`http://localhost:8000/items/${editItem.id}`, updatedItem);
+            const version = parseInt(response.headers['x-item-version'], 10);
+            if (!isNaN(version)) {
+                updatedItem.version = version;
+            }
             setItems(items.map(item => (item.id === editItem.id ? updatedItem : item)));
             setEditItem(null);
             setName('');